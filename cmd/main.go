@@ -9,8 +9,11 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/imyashkale/buildserver/internal/config"
 	"github.com/imyashkale/buildserver/internal/database"
+	"github.com/imyashkale/buildserver/internal/database/sqldb"
+	"github.com/imyashkale/buildserver/internal/dockergen"
 	"github.com/imyashkale/buildserver/internal/handlers"
 	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/logstore"
 	"github.com/imyashkale/buildserver/internal/queue"
 	"github.com/imyashkale/buildserver/internal/repository"
 	"github.com/imyashkale/buildserver/internal/router"
@@ -21,6 +24,11 @@ func main() {
 
 	ctx := context.Background()
 
+	// `buildserver migrate` creates and updates the database schema, then exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(ctx, os.Args[2:]))
+	}
+
 	// Load application configuration
 	cfg := config.New()
 
@@ -29,35 +37,51 @@ func main() {
 
 	logger.Infof("Configuration loaded successfully - LogLevel: %s", cfg.LogLevel)
 
-	// Initialize database configuration
-	dbConfig := database.NewConfig(cfg)
+	// DynamoDB is needed for the DynamoDB storage backend and job store only
+	var dbClient *database.Client
+	if cfg.DatabaseBackend == "dynamodb" || cfg.JobStore == "dynamodb" {
+		dbConfig := database.NewConfig(cfg)
+		logger.Infof("Initializing DynamoDB client for table: %s in region: %s", dbConfig.TableName, dbConfig.Region)
 
-	logger.Infof("Initializing DynamoDB client for table: %s in region: %s", dbConfig.TableName, dbConfig.Region)
-
-	// Create DynamoDB client
-	dbClient, err := database.NewClient(ctx, dbConfig)
-	if err != nil {
-		logger.Fatalf("Failed to initialize DynamoDB client: %v", err)
+		client, err := database.NewClient(ctx, dbConfig)
+		if err != nil {
+			logger.Fatalf("Failed to initialize DynamoDB client: %v", err)
+		}
+		dbClient = client
+		logger.Info("DynamoDB client initialized successfully")
 	}
 
-	logger.Info("DynamoDB client initialized successfully")
-
-	// Initialize database operations
-	mdb := database.NewMCPServer(dbClient, dbClient.TableName)
-
-	// Initialize GitHub database operations
-	githubDB := database.NewGitHubDB(dbClient, cfg.GitHubConnectionsTableName, cfg.GitHubOAuthStatesTableName)
-	logger.Info("GitHub database initialized")
+	// Initialize repositories on the configured storage backend
+	var (
+		mrepo          repository.MCPRepository
+		githubRepo     repository.GitHubRepository
+		deploymentRepo repository.DeploymentRepository
+		sqlDB          *sqldb.DB
+	)
+	switch cfg.DatabaseBackend {
+	case sqldb.BackendSQLite, sqldb.BackendPostgres:
+		db, err := sqldb.Open(ctx, cfg.DatabaseBackend, cfg.DatabaseDSN)
+		if err != nil {
+			logger.Fatalf("Failed to open %s database: %v", cfg.DatabaseBackend, err)
+		}
+		if _, err := db.Migrate(ctx); err != nil {
+			logger.Fatalf("Failed to migrate %s database: %v", cfg.DatabaseBackend, err)
+		}
+		sqlDB = db
 
-	// Initialize deployment database operations
-	deploymentDB := database.NewDeploymentOperations(dbClient, cfg.DeploymentsTableName)
-	logger.Info("Deployment database initialized")
+		mrepo = repository.NewSQLMCPRepository(sqldb.NewMCPServers(db))
+		githubRepo = repository.NewSQLGitHubRepository(sqldb.NewGitHub(db))
+		deploymentRepo = repository.NewSQLDeploymentRepository(sqldb.NewDeployments(db))
+	default:
+		mdb := database.NewMCPServer(dbClient, dbClient.TableName)
+		githubDB := database.NewGitHubDB(dbClient, cfg.GitHubConnectionsTableName, cfg.GitHubOAuthStatesTableName)
+		deploymentDB := database.NewDeploymentOperations(dbClient, cfg.DeploymentsTableName)
 
-	// Initialize repositories
-	mrepo := repository.NewMCPRepository(mdb)
-	githubRepo := repository.NewGitHubRepository(githubDB)
-	deploymentRepo := repository.NewDeploymentRepository(deploymentDB)
-	logger.Info("Repositories initialized with DynamoDB backend")
+		mrepo = repository.NewMCPRepository(mdb)
+		githubRepo = repository.NewGitHubRepository(githubDB)
+		deploymentRepo = repository.NewDeploymentRepository(deploymentDB)
+	}
+	logger.Infof("Repositories initialized with %s backend", cfg.DatabaseBackend)
 
 	// Initialize GitHub service with config values
 	githubService := services.NewGitHubService(
@@ -70,22 +94,121 @@ func main() {
 
 	logger.Info("GitHub service initialized")
 
+	// Initialize the job store that backs the queue
+	var jobStore queue.JobStore
+	switch cfg.JobStore {
+	case "dynamodb":
+		jobStore = queue.NewDynamoJobStore(dbClient, cfg.BuildJobsTableName)
+	case "memory":
+		jobStore = queue.NewMemoryJobStore()
+	default:
+		fileStore, err := queue.NewFileJobStore(cfg.JobStorePath)
+		if err != nil {
+			logger.Fatalf("Failed to initialize file job store: %v", err)
+		}
+		jobStore = fileStore
+	}
+	logger.Infof("Job store initialized with %s backend", cfg.JobStore)
+
 	// Initialize job queue (with buffer size of 100)
-	jobQueue := queue.NewJobQueue(100)
+	jobQueue := queue.NewJobQueue(100, jobStore)
 	logger.Info("Job queue initialized")
 
-	// Load AWS configuration for ECR
+	// Load AWS configuration for ECR and S3
 	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
 	if err != nil {
 		logger.Fatalf("Failed to load AWS configuration: %v", err)
 	}
 
-	// Initialize ECR service
-	ecrService := services.NewECRService(awsCfg, cfg.AWSAccountID)
-	logger.Info("ECR service initialized")
+	// git and docker run as child processes of the server
+	runner := services.NewExecRunner()
+
+	// Initialize the image registries. Local tagging is always available; ECR
+	// and OCI are available once configured, and servers may pick any of them.
+	imageRegistries := []services.Registry{services.NewLocalRegistry(runner)}
+	if cfg.AWSAccountID != "" {
+		imageRegistries = append(imageRegistries, services.NewECRService(awsCfg, cfg.AWSAccountID, runner))
+	}
+	if cfg.RegistryURL != "" {
+		ociRegistry, err := services.NewOCIRegistry(services.OCIConfig{
+			URL:       cfg.RegistryURL,
+			Namespace: cfg.RegistryNamespace,
+			Username:  cfg.RegistryUsername,
+			Password:  cfg.RegistryPassword,
+			Insecure:  cfg.RegistryInsecure,
+		}, runner)
+		if err != nil {
+			logger.Fatalf("Failed to initialize OCI registry: %v", err)
+		}
+		imageRegistries = append(imageRegistries, ociRegistry)
+	}
+	registries, err := services.NewRegistries(cfg.Registry, imageRegistries...)
+	if err != nil {
+		logger.Fatalf("Failed to initialize image registries: %v", err)
+	}
+	logger.Infof("Image registries initialized: %v (default %s)", registries.Names(), cfg.Registry)
+
+	// Initialize the image builders. Each only needs its tools at build time,
+	// so all of them are offered and servers may pick any of them.
+	builderOptions := services.BuilderOptions{
+		Platform:        cfg.BuildPlatform,
+		CacheRepository: cfg.BuildCacheRepository,
+		BuildkitAddr:    cfg.BuildkitAddr,
+	}
+	builders, err := services.NewBuilders(cfg.Builder,
+		services.NewDockerBuilder(runner, builderOptions),
+		services.NewBuildxBuilder(runner, builderOptions),
+		services.NewBuildctlBuilder(runner, builderOptions),
+	)
+	if err != nil {
+		logger.Fatalf("Failed to initialize image builders: %v", err)
+	}
+	logger.Infof("Image builders initialized: %v (default %s)", builders.Names(), cfg.Builder)
+
+	// Built images are started and checked with an MCP handshake before they
+	// are pushed. Hosts without a Docker daemon turn this off.
+	var verifier *services.MCPVerifier
+	if cfg.MCPVerify {
+		verifier = services.NewMCPVerifier(runner, services.MCPVerifyOptions{
+			Timeout:    cfg.MCPVerifyTimeout,
+			ProxyImage: cfg.MCPVerifyProxyImage,
+			Platform:   cfg.BuildPlatform,
+		})
+		logger.Infof("MCP verification enabled (timeout %s)", cfg.MCPVerifyTimeout)
+	} else {
+		logger.Warn("MCP verification is disabled; images are pushed without a handshake")
+	}
+
+	// Repositories without a Dockerfile get one rendered from the runtime's
+	// template, which organisations can override in DOCKERFILE_TEMPLATES_DIR
+	dockerfiles := dockergen.New(cfg.DockerfileTemplatesDir)
+	if cfg.DockerfileTemplatesDir != "" {
+		logger.Infof("Dockerfile templates can be overridden in %s", cfg.DockerfileTemplatesDir)
+	}
+
+	// Initialize the store that keeps full build logs
+	var logStore logstore.LogStore
+	switch cfg.LogStore {
+	case "s3":
+		logStore = logstore.NewS3LogStore(awsCfg, logstore.S3Config{
+			Bucket:   cfg.LogS3Bucket,
+			Prefix:   cfg.LogS3Prefix,
+			Endpoint: cfg.LogS3Endpoint,
+		})
+	default:
+		fileStore, err := logstore.NewFileLogStore(cfg.LogStorePath)
+		if err != nil {
+			logger.Fatalf("Failed to initialize filesystem log store: %v", err)
+		}
+		logStore = fileStore
+	}
+	logger.Infof("Log store initialized with %s backend", cfg.LogStore)
+
+	// Live build logs are shared between the pipeline and the log stream endpoint
+	logHub := services.NewLogHub()
 
 	// Initialize pipeline service
-	pipelineService := services.NewPipelineService(deploymentRepo, githubService, ecrService, mrepo, githubRepo)
+	pipelineService := services.NewPipelineService(deploymentRepo, githubService, registries, builders, verifier, dockerfiles, mrepo, githubRepo, logHub, logStore, runner)
 	logger.Info("Pipeline service initialized")
 
 	// Initialize worker pool (5 concurrent workers)
@@ -93,11 +216,21 @@ func main() {
 	logger.Info("Worker pool created with 5 concurrent workers")
 
 	// Start workers
-	workerPool.Start(func(job *queue.BuildJob) error {
+	workerPool.Start(func(ctx context.Context, job *queue.BuildJob) error {
 		return pipelineService.ExecuteBuild(ctx, job)
 	})
 	logger.Info("Build workers started")
 
+	// Re-dispatch jobs that were queued or interrupted before the last shutdown
+	restored, err := jobQueue.Restore(ctx)
+	if err != nil {
+		logger.Fatalf("Failed to restore build jobs: %v", err)
+	}
+	logger.Infof("Restored %d pending build jobs", restored)
+
+	// Pick up jobs whose worker stopped renewing the lease, here or on another node
+	go jobQueue.Reap(queue.DefaultLeaseDuration)
+
 	// Initialize handlers
 	healthHandler := handlers.NewHealthHandler()
 	buildHandler := handlers.NewBuildHandler(
@@ -106,10 +239,13 @@ func main() {
 		githubRepo,
 		jobQueue,
 	)
+	deploymentHandler := handlers.NewDeploymentHandler(mrepo, deploymentRepo, logHub, logStore)
+	schemaHandler := handlers.NewSchemaHandler()
+	webhookHandler := handlers.NewWebhookHandler(services.NewWebhookService(mrepo, deploymentRepo, githubService, jobQueue))
 	logger.Info("Handlers initialized")
 
 	// Setup router
-	r := router.Setup(healthHandler, buildHandler)
+	r := router.Setup(healthHandler, buildHandler, deploymentHandler, schemaHandler, webhookHandler)
 	logger.Info("Router setup completed")
 
 	// Setup graceful shutdown
@@ -127,6 +263,10 @@ func main() {
 		workerPool.Wait()
 		logger.Info("All workers stopped gracefully")
 
+		if sqlDB != nil {
+			sqlDB.Close()
+		}
+
 		logger.Info("Server shutdown complete")
 		os.Exit(0)
 	}()
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/config"
+	"github.com/imyashkale/buildserver/internal/database"
+	"github.com/imyashkale/buildserver/internal/database/sqldb"
+	"github.com/imyashkale/buildserver/internal/logger"
+)
+
+// runMigrate implements the migrate subcommand and returns the exit code.
+//
+//	buildserver migrate          apply pending schema migrations
+//	buildserver migrate status   list applied and pending migrations
+func runMigrate(ctx context.Context, args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: buildserver migrate [status]")
+		fmt.Fprintln(flags.Output(), "")
+		fmt.Fprintln(flags.Output(), "Creates or updates the DynamoDB tables to schema version", database.SchemaVersion)
+		fmt.Fprintln(flags.Output(), "Set DYNAMODB_ENDPOINT to migrate DynamoDB Local, e.g. http://localhost:8000")
+		fmt.Fprintln(flags.Output(), "With DATABASE_BACKEND=sqlite or postgres, applies the SQL migrations instead")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	statusOnly := false
+	switch flags.Arg(0) {
+	case "":
+	case "status":
+		statusOnly = true
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	cfg := config.NewForMigrate()
+	logger.Init(cfg.LogLevel)
+
+	if cfg.DatabaseBackend == sqldb.BackendSQLite || cfg.DatabaseBackend == sqldb.BackendPostgres {
+		return runSQLMigrate(ctx, cfg, statusOnly)
+	}
+
+	dbClient, err := database.NewClient(ctx, database.NewConfig(cfg))
+	if err != nil {
+		logger.Errorf("Failed to initialize DynamoDB client: %v", err)
+		return 1
+	}
+
+	migrator := database.NewMigrator(dbClient, database.TableNamesFromConfig(cfg), cfg.SchemaMigrationsTableName)
+
+	if statusOnly {
+		return printMigrationStatus(ctx, migrator)
+	}
+
+	applied, err := migrator.Migrate(ctx)
+	for _, migration := range applied {
+		logger.Infof("Applied migration %d: %s", migration.Version, migration.Description)
+	}
+	if err != nil {
+		logger.Errorf("Migration failed: %v", err)
+		return 1
+	}
+
+	logger.Infof("Schema is at version %d (%d migrations applied)", database.SchemaVersion, len(applied))
+	return 0
+}
+
+// printMigrationStatus writes the applied and pending migrations to stdout
+func printMigrationStatus(ctx context.Context, migrator *database.Migrator) int {
+	applied, err := migrator.Applied(ctx)
+	if err != nil {
+		logger.Errorf("Failed to read applied migrations: %v", err)
+		return 1
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		logger.Errorf("Failed to read pending migrations: %v", err)
+		return 1
+	}
+
+	for _, record := range applied {
+		fmt.Fprintf(os.Stdout, "applied  %3d  %s  %s\n", record.Version, time.Unix(record.AppliedAt, 0).UTC().Format(time.RFC3339), record.Description)
+	}
+	for _, migration := range pending {
+		fmt.Fprintf(os.Stdout, "pending  %3d  %-20s  %s\n", migration.Version, "", migration.Description)
+	}
+	return 0
+}
+
+// runSQLMigrate applies or lists the SQL migrations of the sqlite and postgres backends
+func runSQLMigrate(ctx context.Context, cfg *config.Config, statusOnly bool) int {
+	db, err := sqldb.Open(ctx, cfg.DatabaseBackend, cfg.DatabaseDSN)
+	if err != nil {
+		logger.Errorf("Failed to open %s database: %v", cfg.DatabaseBackend, err)
+		return 1
+	}
+	defer db.Close()
+
+	if statusOnly {
+		applied, pending, err := db.MigrationStatus(ctx)
+		if err != nil {
+			logger.Errorf("Failed to read migrations: %v", err)
+			return 1
+		}
+		for _, name := range applied {
+			fmt.Fprintf(os.Stdout, "applied  %s\n", name)
+		}
+		for _, name := range pending {
+			fmt.Fprintf(os.Stdout, "pending  %s\n", name)
+		}
+		return 0
+	}
+
+	applied, err := db.Migrate(ctx)
+	if err != nil {
+		logger.Errorf("Migration failed: %v", err)
+		return 1
+	}
+	logger.Infof("%s schema is up to date (%d migrations applied)", cfg.DatabaseBackend, len(applied))
+	return 0
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -20,11 +22,51 @@ type Config struct {
 	AWSRegion    string
 	AWSAccountID string
 
+	// Storage backend configuration
+	DatabaseBackend string
+	DatabaseDSN     string
+
 	// DynamoDB configuration
 	DynamoDBTableName          string
 	GitHubConnectionsTableName string
 	GitHubOAuthStatesTableName string
 	DeploymentsTableName       string
+	BuildJobsTableName         string
+	SchemaMigrationsTableName  string
+	DynamoDBEndpoint           string
+
+	// Job store configuration
+	JobStore     string
+	JobStorePath string
+
+	// Build log store configuration
+	LogStore      string
+	LogStorePath  string
+	LogS3Bucket   string
+	LogS3Prefix   string
+	LogS3Endpoint string
+
+	// Image registry configuration
+	Registry          string
+	RegistryURL       string
+	RegistryNamespace string
+	RegistryUsername  string
+	RegistryPassword  string
+	RegistryInsecure  bool
+
+	// Image builder configuration
+	Builder              string
+	BuildPlatform        string
+	BuildCacheRepository string
+	BuildkitAddr         string
+
+	// MCP verification configuration
+	MCPVerify           bool
+	MCPVerifyTimeout    time.Duration
+	MCPVerifyProxyImage string
+
+	// Dockerfile generation configuration
+	DockerfileTemplatesDir string
 
 	// GitHub OAuth configuration
 	GitHubClientID           string
@@ -42,6 +84,22 @@ type Config struct {
 // OS environment variables take precedence over .env file values.
 // Panics if required configuration values are missing or invalid.
 func New() *Config {
+	cfg := load()
+
+	// Validate required configuration
+	cfg.validate()
+
+	return cfg
+}
+
+// NewForMigrate loads the configuration like New but skips validation, so the
+// migrate command runs with only the AWS and table settings present
+func NewForMigrate() *Config {
+	return load()
+}
+
+// load reads the configuration from the .env file and the OS environment
+func load() *Config {
 	// Load .env file from project root (silently ignore if not found)
 	// We use the directory where the binary is run from as the base
 	envPath := filepath.Join(".", ".env")
@@ -58,11 +116,51 @@ func New() *Config {
 		AWSRegion:    getEnvOrDefault("AWS_REGION", "us-east-1"),
 		AWSAccountID: os.Getenv("AWS_ACCOUNT_ID"),
 
+		// Storage backend configuration
+		DatabaseBackend: getEnvOrDefault("DATABASE_BACKEND", "dynamodb"),
+		DatabaseDSN:     os.Getenv("DATABASE_DSN"),
+
 		// DynamoDB configuration
 		DynamoDBTableName:          getEnvOrDefault("DYNAMODB_TABLE_NAME", "McpServers"),
 		GitHubConnectionsTableName: getEnvOrDefault("GITHUB_CONNECTIONS_TABLE_NAME", "GitHubConnections"),
 		GitHubOAuthStatesTableName: getEnvOrDefault("GITHUB_OAUTH_STATES_TABLE_NAME", "GitHubOAuthStates"),
 		DeploymentsTableName:       getEnvOrDefault("DYNAMODB_DEPLOYMENTS_TABLE", "Deployments"),
+		BuildJobsTableName:         getEnvOrDefault("BUILD_JOBS_TABLE_NAME", "BuildJobs"),
+		SchemaMigrationsTableName:  getEnvOrDefault("SCHEMA_MIGRATIONS_TABLE_NAME", "SchemaMigrations"),
+		DynamoDBEndpoint:           os.Getenv("DYNAMODB_ENDPOINT"),
+
+		// Job store configuration
+		JobStore:     getEnvOrDefault("JOB_STORE", "file"),
+		JobStorePath: getEnvOrDefault("JOB_STORE_PATH", filepath.Join("data", "jobs")),
+
+		// Build log store configuration
+		LogStore:      getEnvOrDefault("LOG_STORE", "fs"),
+		LogStorePath:  getEnvOrDefault("LOG_STORE_PATH", filepath.Join("data", "logs")),
+		LogS3Bucket:   os.Getenv("LOG_S3_BUCKET"),
+		LogS3Prefix:   getEnvOrDefault("LOG_S3_PREFIX", "build-logs"),
+		LogS3Endpoint: os.Getenv("LOG_S3_ENDPOINT"),
+
+		// Image registry configuration
+		Registry:          getEnvOrDefault("REGISTRY", "ecr"),
+		RegistryURL:       os.Getenv("REGISTRY_URL"),
+		RegistryNamespace: os.Getenv("REGISTRY_NAMESPACE"),
+		RegistryUsername:  os.Getenv("REGISTRY_USERNAME"),
+		RegistryPassword:  os.Getenv("REGISTRY_PASSWORD"),
+		RegistryInsecure:  os.Getenv("REGISTRY_INSECURE") == "true",
+
+		// Image builder configuration
+		Builder:              getEnvOrDefault("BUILDER", "docker"),
+		BuildPlatform:        os.Getenv("BUILD_PLATFORM"),
+		BuildCacheRepository: os.Getenv("BUILD_CACHE_REPOSITORY"),
+		BuildkitAddr:         os.Getenv("BUILDKIT_ADDR"),
+
+		// MCP verification configuration
+		MCPVerify:           getEnvOrDefault("MCP_VERIFY", "true") == "true",
+		MCPVerifyTimeout:    getDurationOrDefault("MCP_VERIFY_TIMEOUT", time.Minute),
+		MCPVerifyProxyImage: getEnvOrDefault("MCP_VERIFY_PROXY_IMAGE", "alpine/socat"),
+
+		// Dockerfile generation configuration
+		DockerfileTemplatesDir: os.Getenv("DOCKERFILE_TEMPLATES_DIR"),
 
 		// GitHub OAuth configuration
 		GitHubClientID:           os.Getenv("GITHUB_CLIENT_ID"),
@@ -75,8 +173,17 @@ func New() *Config {
 		Auth0Audience: os.Getenv("AUTH0_AUDIENCE"),
 	}
 
-	// Validate required configuration
-	cfg.validate()
+	// SQLite needs no server, so it works without any database settings
+	if cfg.DatabaseBackend == "sqlite" && cfg.DatabaseDSN == "" {
+		cfg.DatabaseDSN = filepath.Join("data", "buildserver.db")
+	}
+
+	// Verification runs the image with the docker CLI. buildctl builds on a
+	// BuildKit daemon, usually where no Docker daemon is available, so
+	// verification is off with it unless MCP_VERIFY asks for it.
+	if os.Getenv("MCP_VERIFY") == "" && cfg.Builder == "buildctl" {
+		cfg.MCPVerify = false
+	}
 
 	return cfg
 }
@@ -85,9 +192,30 @@ func New() *Config {
 func (c *Config) validate() {
 	var missing []string
 
-	// Check required AWS configuration
-	if c.AWSAccountID == "" {
-		missing = append(missing, "AWS_ACCOUNT_ID")
+	// Images go to ECR unless another registry is chosen
+	switch c.Registry {
+	case "ecr":
+		if c.AWSAccountID == "" {
+			missing = append(missing, "AWS_ACCOUNT_ID")
+		}
+	case "oci":
+		if c.RegistryURL == "" {
+			missing = append(missing, "REGISTRY_URL")
+		}
+	case "local":
+	default:
+		panic(fmt.Sprintf("REGISTRY must be one of ecr, oci or local (got '%s')", c.Registry))
+	}
+
+	switch c.Builder {
+	case "docker", "buildx", "buildctl":
+	default:
+		panic(fmt.Sprintf("BUILDER must be one of docker, buildx or buildctl (got '%s')", c.Builder))
+	}
+
+	// The push uploads a single image manifest, not a multi-platform index
+	if strings.Contains(c.BuildPlatform, ",") {
+		panic(fmt.Sprintf("BUILD_PLATFORM must name a single platform (got '%s')", c.BuildPlatform))
 	}
 
 	// Check required GitHub OAuth configuration
@@ -101,6 +229,32 @@ func (c *Config) validate() {
 		missing = append(missing, "GITHUB_TOKEN_ENCRYPTION_KEY")
 	}
 
+	switch c.DatabaseBackend {
+	case "dynamodb", "sqlite":
+	case "postgres":
+		if c.DatabaseDSN == "" {
+			missing = append(missing, "DATABASE_DSN")
+		}
+	default:
+		panic(fmt.Sprintf("DATABASE_BACKEND must be one of dynamodb, sqlite or postgres (got '%s')", c.DatabaseBackend))
+	}
+
+	switch c.JobStore {
+	case "file", "dynamodb", "memory":
+	default:
+		panic(fmt.Sprintf("JOB_STORE must be one of file, dynamodb or memory (got '%s')", c.JobStore))
+	}
+
+	switch c.LogStore {
+	case "fs":
+	case "s3":
+		if c.LogS3Bucket == "" {
+			missing = append(missing, "LOG_S3_BUCKET")
+		}
+	default:
+		panic(fmt.Sprintf("LOG_STORE must be one of fs or s3 (got '%s')", c.LogStore))
+	}
+
 	if len(missing) > 0 {
 		panic(fmt.Sprintf("Missing required configuration values: %v", missing))
 	}
@@ -110,8 +264,9 @@ func (c *Config) validate() {
 		panic(fmt.Sprintf("GITHUB_TOKEN_ENCRYPTION_KEY must be exactly 32 characters (got %d)", len(c.GitHubTokenEncryptionKey)))
 	}
 
-	// Validate AWS Account ID format (should be 12 digits)
-	if len(c.AWSAccountID) != 12 || !isNumeric(c.AWSAccountID) {
+	// Validate AWS Account ID format (should be 12 digits). It is optional
+	// unless ECR is the default registry.
+	if c.AWSAccountID != "" && (len(c.AWSAccountID) != 12 || !isNumeric(c.AWSAccountID)) {
 		panic(fmt.Sprintf("AWS_ACCOUNT_ID must be exactly 12 digits (got '%s')", c.AWSAccountID))
 	}
 }
@@ -134,6 +289,20 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getDurationOrDefault returns an environment variable parsed as a duration,
+// e.g. "90s", or a default value. Panics if the value is not a positive duration.
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		panic(fmt.Sprintf("%s must be a positive duration such as 90s (got '%s')", key, value))
+	}
+	return duration
+}
+
 // Helper methods for accessing configuration values
 
 // GetPort returns the server port
@@ -205,3 +374,134 @@ func (c *Config) GetAuth0Audience() string {
 func (c *Config) GetDeploymentsTableName() string {
 	return c.DeploymentsTableName
 }
+
+// GetBuildJobsTableName returns the build jobs table name
+func (c *Config) GetBuildJobsTableName() string {
+	return c.BuildJobsTableName
+}
+
+// GetDatabaseBackend returns the storage backend for MCP servers, deployments
+// and GitHub connections (dynamodb, sqlite or postgres)
+func (c *Config) GetDatabaseBackend() string {
+	return c.DatabaseBackend
+}
+
+// GetDatabaseDSN returns the SQL database file path or connection URL
+func (c *Config) GetDatabaseDSN() string {
+	return c.DatabaseDSN
+}
+
+// GetSchemaMigrationsTableName returns the table that records applied schema migrations
+func (c *Config) GetSchemaMigrationsTableName() string {
+	return c.SchemaMigrationsTableName
+}
+
+// GetDynamoDBEndpoint returns the DynamoDB endpoint override, e.g. for DynamoDB Local
+func (c *Config) GetDynamoDBEndpoint() string {
+	return c.DynamoDBEndpoint
+}
+
+// GetJobStore returns the job store backend (file, dynamodb or memory)
+func (c *Config) GetJobStore() string {
+	return c.JobStore
+}
+
+// GetJobStorePath returns the directory used by the file job store
+func (c *Config) GetJobStorePath() string {
+	return c.JobStorePath
+}
+
+// GetLogStore returns the build log store backend (fs or s3)
+func (c *Config) GetLogStore() string {
+	return c.LogStore
+}
+
+// GetLogStorePath returns the directory used by the filesystem log store
+func (c *Config) GetLogStorePath() string {
+	return c.LogStorePath
+}
+
+// GetLogS3Bucket returns the bucket used by the S3 log store
+func (c *Config) GetLogS3Bucket() string {
+	return c.LogS3Bucket
+}
+
+// GetLogS3Prefix returns the key prefix used by the S3 log store
+func (c *Config) GetLogS3Prefix() string {
+	return c.LogS3Prefix
+}
+
+// GetLogS3Endpoint returns the S3-compatible endpoint override (may be empty)
+func (c *Config) GetLogS3Endpoint() string {
+	return c.LogS3Endpoint
+}
+
+// GetRegistry returns the default image registry backend (ecr, oci or local)
+func (c *Config) GetRegistry() string {
+	return c.Registry
+}
+
+// GetRegistryURL returns the base URL of the OCI registry (may be empty)
+func (c *Config) GetRegistryURL() string {
+	return c.RegistryURL
+}
+
+// GetRegistryNamespace returns the path under which OCI repositories are created, e.g. an organisation
+func (c *Config) GetRegistryNamespace() string {
+	return c.RegistryNamespace
+}
+
+// GetRegistryUsername returns the OCI registry username (may be empty)
+func (c *Config) GetRegistryUsername() string {
+	return c.RegistryUsername
+}
+
+// GetRegistryPassword returns the OCI registry password or token (may be empty)
+func (c *Config) GetRegistryPassword() string {
+	return c.RegistryPassword
+}
+
+// GetRegistryInsecure reports whether the OCI registry is reached over plain HTTP
+func (c *Config) GetRegistryInsecure() bool {
+	return c.RegistryInsecure
+}
+
+// GetBuilder returns the default image builder backend (docker, buildx or buildctl)
+func (c *Config) GetBuilder() string {
+	return c.Builder
+}
+
+// GetBuildPlatform returns the platform images are built for, e.g. "linux/amd64" (may be empty)
+func (c *Config) GetBuildPlatform() string {
+	return c.BuildPlatform
+}
+
+// GetBuildCacheRepository returns the registry repository buildx and buildctl keep their cache in (may be empty)
+func (c *Config) GetBuildCacheRepository() string {
+	return c.BuildCacheRepository
+}
+
+// GetBuildkitAddr returns the address of a running buildkitd for buildctl (may be empty)
+func (c *Config) GetBuildkitAddr() string {
+	return c.BuildkitAddr
+}
+
+// GetMCPVerify reports whether built images are started and checked with an MCP handshake
+func (c *Config) GetMCPVerify() bool {
+	return c.MCPVerify
+}
+
+// GetMCPVerifyTimeout returns how long a server may take to start and finish the MCP handshake
+func (c *Config) GetMCPVerifyTimeout() time.Duration {
+	return c.MCPVerifyTimeout
+}
+
+// GetMCPVerifyProxyImage returns the socat image used to reach HTTP servers without giving them a network
+func (c *Config) GetMCPVerifyProxyImage() string {
+	return c.MCPVerifyProxyImage
+}
+
+// GetDockerfileTemplatesDir returns the directory overriding the built-in Dockerfile templates
+func (c *Config) GetDockerfileTemplatesDir() string {
+	return c.DockerfileTemplatesDir
+}
@@ -15,6 +15,7 @@ import (
 type Config struct {
 	TableName string
 	Region    string
+	Endpoint  string // overrides the AWS endpoint, e.g. http://localhost:8000 for DynamoDB Local
 }
 
 // Client wraps the DynamoDB client
@@ -23,11 +24,23 @@ type Client struct {
 	TableName string
 }
 
+// TableNamesFromConfig returns the table names configured in the application config
+func TableNamesFromConfig(appCfg *appConfig.Config) TableNames {
+	return TableNames{
+		MCPServers:        appCfg.DynamoDBTableName,
+		Deployments:       appCfg.DeploymentsTableName,
+		GitHubConnections: appCfg.GitHubConnectionsTableName,
+		GitHubOAuthStates: appCfg.GitHubOAuthStatesTableName,
+		BuildJobs:         appCfg.BuildJobsTableName,
+	}
+}
+
 // NewConfig creates a new database configuration from the application config
 func NewConfig(appCfg *appConfig.Config) *Config {
 	return &Config{
 		TableName: appCfg.DynamoDBTableName,
 		Region:    appCfg.AWSRegion,
+		Endpoint:  appCfg.DynamoDBEndpoint,
 	}
 }
 
@@ -42,11 +55,15 @@ func NewClient(ctx context.Context, cfg *Config) (*Client, error) {
 	}
 
 	// Create DynamoDB client
-	dynamoClient := dynamodb.NewFromConfig(awsCfg)
+	dynamoClient := dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+		}
+	})
 
-	// Verify table exists or create it
+	// Verify table exists; tables are created by the migrate command
 	if err := ensureTableExists(ctx, dynamoClient, cfg.TableName); err != nil {
-		log.Printf("Warning: Could not verify table existence: %v", err)
+		log.Printf("Warning: Could not verify table existence (run `buildserver migrate` to create the tables): %v", err)
 	}
 
 	return &Client{
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ConflictError reports a write rejected because the stored record has a
+// newer version than the one the caller read. It matches ErrConflict.
+type ConflictError struct {
+	Key             string // key of the record, e.g. "server-1" or "server-1/deployment-1"
+	ExpectedVersion int64  // version the caller read
+	ActualVersion   int64  // version stored when the write was attempted
+}
+
+// Error implements the error interface
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: %s is at version %d, expected %d", ErrConflict, e.Key, e.ActualVersion, e.ExpectedVersion)
+}
+
+// Is makes errors.Is(err, ErrConflict) match
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// versionCondition returns a condition expression that holds while the stored
+// Version attribute is still expected. It uses the #version name and the
+// :expectedVersion value. Records written before versioning have no Version
+// attribute and count as version 0.
+func versionCondition(expected int64) string {
+	if expected == 0 {
+		return "(attribute_not_exists(#version) OR #version = :expectedVersion)"
+	}
+	return "#version = :expectedVersion"
+}
+
+// versionValues returns the expression values used by versionCondition and
+// by "SET #version = :nextVersion"
+func versionValues(expected int64) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		":expectedVersion": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", expected)},
+		":nextVersion":     &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", expected+1)},
+	}
+}
+
+// storedVersion reads the Version attribute from an item returned with a
+// failed condition check
+func storedVersion(item map[string]types.AttributeValue) int64 {
+	var stored struct {
+		Version int64 `dynamodbav:"Version"`
+	}
+	_ = attributevalue.UnmarshalMap(item, &stored)
+	return stored.Version
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -14,6 +16,10 @@ import (
 	"github.com/imyashkale/buildserver/internal/models"
 )
 
+// ErrStatusConflict is returned when a deployment is no longer in the status a
+// write expected. It wraps ErrConflict.
+var ErrStatusConflict = fmt.Errorf("%w: deployment status changed", ErrConflict)
+
 // DeploymentOperations handles all DynamoDB operations for deployments
 type DeploymentOperations struct {
 	client    *Client
@@ -28,6 +34,58 @@ func NewDeploymentOperations(client *Client, tableName string) *DeploymentOperat
 	}
 }
 
+// CreateDeployment inserts a new deployment at version 0. Returns
+// ErrAlreadyExists if the deployment ID is taken for its server.
+func (do *DeploymentOperations) CreateDeployment(ctx context.Context, deployment *models.Deployment) error {
+	item, err := attributevalue.MarshalMap(deploymentItem{
+		ServerId:       deployment.ServerId,
+		DeploymentId:   deployment.DeploymentId,
+		UserId:         deployment.UserId,
+		Branch:         deployment.Branch,
+		CommitHash:     deployment.CommitHash,
+		Status:         deployment.Status,
+		Stages:         deployment.Stages,
+		BuildLogs:      deployment.BuildLogs,
+		LogRef:         deployment.LogRef,
+		ImageURI:       deployment.ImageURI,
+		ImageDigestURI: deployment.ImageDigestURI,
+		Image:          deployment.Image,
+		Manifest:       deployment.Manifest,
+		ServerJSON:     deployment.ServerJSON,
+		CreatedAt:      deployment.CreatedAt.Unix(),
+		UpdatedAt:      deployment.UpdatedAt.Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment: %w", err)
+	}
+
+	_, err = do.client.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(do.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(DeploymentId)"),
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrAlreadyExists
+		}
+		logger.WithFields(map[string]interface{}{
+			"server_id":     deployment.ServerId,
+			"deployment_id": deployment.DeploymentId,
+			"error":         err.Error(),
+		}).Error("Failed to create deployment in DynamoDB")
+		return fmt.Errorf("failed to create deployment: %w", err)
+	}
+	deployment.Version = 0
+
+	logger.WithFields(map[string]interface{}{
+		"server_id":     deployment.ServerId,
+		"deployment_id": deployment.DeploymentId,
+	}).Info("Deployment created successfully in DynamoDB")
+
+	return nil
+}
+
 // GetDeployment retrieves a deployment by server ID and deployment ID from DynamoDB
 func (do *DeploymentOperations) GetDeployment(ctx context.Context, serverId, deploymentId string) (*models.Deployment, error) {
 	logger.WithFields(map[string]interface{}{
@@ -82,83 +140,167 @@ func (do *DeploymentOperations) GetDeployment(ctx context.Context, serverId, dep
 	return deployment, nil
 }
 
-// GetDeploymentsByUserId retrieves all deployments for a specific user from DynamoDB
-func (do *DeploymentOperations) GetDeploymentsByUserId(ctx context.Context, userId string) ([]*models.Deployment, error) {
-	// Use Scan with FilterExpression to filter by UserId
-	result, err := do.client.DynamoDB.Scan(ctx, &dynamodb.ScanInput{
-		TableName:        aws.String(do.tableName),
-		FilterExpression: aws.String("UserId = :userId"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":userId": &types.AttributeValueMemberS{Value: userId},
-		},
-	})
+// GetDeploymentsByUserId returns one page of a user's deployments matching
+// filter, newest first, from the UserId index
+func (do *DeploymentOperations) GetDeploymentsByUserId(ctx context.Context, userId string, filter models.DeploymentFilter, page models.PageRequest) ([]*models.Deployment, string, error) {
+	deployments, cursor, err := do.queryDeployments(ctx, DeploymentUserIdIndex, "UserId", userId, "", filter, page)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query deployments by user_id: %w", err)
+	}
+	return deployments, cursor, nil
+}
 
+// GetDeploymentsByUserIdAndServerId returns one page of a user's deployments
+// of one MCP server matching filter, newest first, from the ServerId index
+func (do *DeploymentOperations) GetDeploymentsByUserIdAndServerId(ctx context.Context, userId, serverId string, filter models.DeploymentFilter, page models.PageRequest) ([]*models.Deployment, string, error) {
+	deployments, cursor, err := do.queryDeployments(ctx, DeploymentServerIdIndex, "ServerId", serverId, userId, filter, page)
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan deployments by user_id: %w", err)
+		return nil, "", fmt.Errorf("failed to query deployments by user_id and server_id: %w", err)
 	}
+	return deployments, cursor, nil
+}
 
-	deployments := make([]*models.Deployment, 0, len(result.Items))
-	for _, item := range result.Items {
-		deployment, err := do.unmarshalDeployment(item)
-		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal deployment: %w", err)
+// queryDeployments queries an index partitioned by partitionKey and sorted by
+// CreatedAt. The date range of filter becomes part of the key condition, its
+// other fields a filter expression, as does userId unless it is empty.
+func (do *DeploymentOperations) queryDeployments(ctx context.Context, index, partitionKey, partitionValue, userId string, filter models.DeploymentFilter, page models.PageRequest) ([]*models.Deployment, string, error) {
+	keyCondition := "#pk = :pk"
+	names := map[string]string{"#pk": partitionKey}
+	values := map[string]types.AttributeValue{
+		":pk": &types.AttributeValueMemberS{Value: partitionValue},
+	}
+
+	// CreatedAt is stored in whole seconds
+	if from, to, ok := CreatedAtRange(filter); ok {
+		if from > to {
+			return []*models.Deployment{}, "", nil
 		}
-		deployments = append(deployments, deployment)
+		keyCondition += " AND #createdAt BETWEEN :from AND :to"
+		names["#createdAt"] = "CreatedAt"
+		values[":from"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", from)}
+		values[":to"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", to)}
 	}
 
-	return deployments, nil
-}
+	var conditions []string
+	if filter.Status != "" {
+		conditions = append(conditions, "#status = :status")
+		names["#status"] = "Status"
+		values[":status"] = &types.AttributeValueMemberS{Value: string(filter.Status)}
+	}
+	if filter.Branch != "" {
+		conditions = append(conditions, "#branch = :branch")
+		names["#branch"] = "Branch"
+		values[":branch"] = &types.AttributeValueMemberS{Value: filter.Branch}
+	}
+	if userId != "" {
+		conditions = append(conditions, "#userId = :userId")
+		names["#userId"] = "UserId"
+		values[":userId"] = &types.AttributeValueMemberS{Value: userId}
+	}
 
-// GetDeploymentsByUserIdAndServerId retrieves all deployments for a specific user and server from DynamoDB
-func (do *DeploymentOperations) GetDeploymentsByUserIdAndServerId(ctx context.Context, userId, serverId string) ([]*models.Deployment, error) {
-	// Use Scan with FilterExpression to filter by both UserId and ServerId
-	result, err := do.client.DynamoDB.Scan(ctx, &dynamodb.ScanInput{
-		TableName:        aws.String(do.tableName),
-		FilterExpression: aws.String("UserId = :userId AND ServerId = :serverId"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":userId":   &types.AttributeValueMemberS{Value: userId},
-			":serverId": &types.AttributeValueMemberS{Value: serverId},
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(do.tableName),
+		IndexName:                 aws.String(index),
+		KeyConditionExpression:    aws.String(keyCondition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		// Newest first
+		ScanIndexForward: aws.Bool(false),
+	}
+	if len(conditions) > 0 {
+		input.FilterExpression = aws.String(strings.Join(conditions, " AND "))
+	}
+
+	keys := []string{"ServerId", "DeploymentId", "CreatedAt"}
+	if partitionKey != "ServerId" {
+		keys = append(keys, partitionKey)
+	}
+	l := listing{
+		keys:      keys,
+		partition: map[string]string{partitionKey: partitionValue},
+		fetch: func(ctx context.Context, startKey map[string]types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+			input.ExclusiveStartKey = startKey
+			input.Limit = aws.Int32(limit)
+			result, err := do.client.DynamoDB.Query(ctx, input)
+			if err != nil {
+				return nil, nil, err
+			}
+			return result.Items, result.LastEvaluatedKey, nil
 		},
-	})
+	}
 
+	items, cursor, err := l.collect(ctx, page)
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan deployments by user_id and serverId: %w", err)
+		return nil, "", err
 	}
 
-	deployments := make([]*models.Deployment, 0, len(result.Items))
-	for _, item := range result.Items {
+	deployments := make([]*models.Deployment, 0, len(items))
+	for _, item := range items {
 		deployment, err := do.unmarshalDeployment(item)
 		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal deployment: %w", err)
+			return nil, "", fmt.Errorf("failed to unmarshal deployment: %w", err)
 		}
 		deployments = append(deployments, deployment)
 	}
 
-	return deployments, nil
+	return deployments, cursor, nil
 }
 
-// UpdateDeploymentStatus updates the status of a deployment
-func (do *DeploymentOperations) UpdateDeploymentStatus(ctx context.Context, serverId, deploymentId, status string) error {
+// CreatedAtRange converts the date range of filter to inclusive bounds in
+// Unix seconds. ok is false if the filter has no date range.
+func CreatedAtRange(filter models.DeploymentFilter) (from, to int64, ok bool) {
+	if filter.CreatedAfter.IsZero() && filter.CreatedBefore.IsZero() {
+		return 0, 0, false
+	}
+
+	from, to = 0, math.MaxInt64
+	if !filter.CreatedAfter.IsZero() {
+		// Round up: a deployment created at second s is at or after CreatedAfter
+		from = filter.CreatedAfter.Unix()
+		if filter.CreatedAfter.Nanosecond() > 0 {
+			from++
+		}
+	}
+	if !filter.CreatedBefore.IsZero() {
+		// CreatedBefore is exclusive
+		to = filter.CreatedBefore.Unix()
+		if filter.CreatedBefore.Nanosecond() == 0 {
+			to--
+		}
+	}
+	return from, to, true
+}
+
+// UpdateDeploymentStatus moves a deployment from one status to another.
+// Returns ErrStatusConflict if the deployment is no longer in status from.
+func (do *DeploymentOperations) UpdateDeploymentStatus(ctx context.Context, serverId, deploymentId string, from, to models.DeploymentStatus) error {
 	_, err := do.client.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(do.tableName),
 		Key: map[string]types.AttributeValue{
 			"ServerId":     &types.AttributeValueMemberS{Value: serverId},
 			"DeploymentId": &types.AttributeValueMemberS{Value: deploymentId},
 		},
-		UpdateExpression: aws.String("SET #status = :status, UpdatedAt = :updated_at"),
+		// The status condition guards this write, so the version is bumped without being checked
+		UpdateExpression:    aws.String("SET #status = :status, #version = if_not_exists(#version, :zero) + :one, UpdatedAt = :updated_at"),
+		ConditionExpression: aws.String("#status = :expected"),
 		ExpressionAttributeNames: map[string]string{
-			"#status": "Status",
+			"#status":  "Status",
+			"#version": "Version",
 		},
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":status":     &types.AttributeValueMemberS{Value: status},
+			":status":     &types.AttributeValueMemberS{Value: string(to)},
+			":expected":   &types.AttributeValueMemberS{Value: string(from)},
+			":zero":       &types.AttributeValueMemberN{Value: "0"},
+			":one":        &types.AttributeValueMemberN{Value: "1"},
 			":updated_at": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().Unix())},
 		},
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 	})
 
 	if err != nil {
 		var ccf *types.ConditionalCheckFailedException
 		if errors.As(err, &ccf) {
-			return ErrNotFound
+			return statusConflictError(ccf)
 		}
 		return fmt.Errorf("failed to update deployment status: %w", err)
 	}
@@ -166,33 +308,87 @@ func (do *DeploymentOperations) UpdateDeploymentStatus(ctx context.Context, serv
 	return nil
 }
 
-// UpdateDeployment updates a deployment with all fields including stages and logs
-func (do *DeploymentOperations) UpdateDeployment(ctx context.Context, deployment *models.Deployment) error {
+// statusConflictError tells a missing deployment apart from one whose status changed
+func statusConflictError(ccf *types.ConditionalCheckFailedException) error {
+	if len(ccf.Item) == 0 {
+		return ErrNotFound
+	}
+	return ErrStatusConflict
+}
+
+// deploymentConflictError tells a missing deployment, a changed status and a
+// newer version apart
+func deploymentConflictError(ccf *types.ConditionalCheckFailedException, deployment *models.Deployment, expected models.DeploymentStatus) error {
+	if len(ccf.Item) == 0 {
+		return ErrNotFound
+	}
+	var stored struct {
+		Status  models.DeploymentStatus `dynamodbav:"Status"`
+		Version int64                   `dynamodbav:"Version"`
+	}
+	_ = attributevalue.UnmarshalMap(ccf.Item, &stored)
+	if stored.Status != expected {
+		return ErrStatusConflict
+	}
+	return &ConflictError{
+		Key:             deployment.ServerId + "/" + deployment.DeploymentId,
+		ExpectedVersion: deployment.Version,
+		ActualVersion:   stored.Version,
+	}
+}
+
+// UpdateDeployment updates a deployment with all fields including stages and logs.
+// The write only succeeds while the stored status is still expected and the
+// stored Version still equals deployment.Version. A changed status returns
+// ErrStatusConflict, any other concurrent write a *ConflictError. On success
+// deployment.Version is incremented.
+func (do *DeploymentOperations) UpdateDeployment(ctx context.Context, deployment *models.Deployment, expected models.DeploymentStatus) error {
 	logger.WithFields(map[string]interface{}{
-		"server_id":     deployment.ServerId,
-		"deployment_id": deployment.DeploymentId,
-		"status":        deployment.Status,
+		"server_id":       deployment.ServerId,
+		"deployment_id":   deployment.DeploymentId,
+		"status":          deployment.Status,
+		"expected_status": expected,
+		"version":         deployment.Version,
 	}).Debug("Updating deployment in DynamoDB")
 
 	// Prepare the attributes to update
-	updateExpr := "SET #status = :status, #stages = :stages, #logs = :logs, #imageUri = :imageUri, UpdatedAt = :updated_at"
+	updateExpr := "SET #status = :status, #stages = :stages, #logs = :logs, #logRef = :logRef, #imageUri = :imageUri, #imageDigestUri = :imageDigestUri, #image = :image, #manifest = :manifest, #serverJson = :serverJson, #version = :nextVersion, UpdatedAt = :updated_at"
 	exprAttrNames := map[string]string{
-		"#status":   "Status",
-		"#stages":   "Stages",
-		"#logs":     "Logs",
-		"#imageUri": "ImageURI",
+		"#status":         "Status",
+		"#stages":         "Stages",
+		"#logs":           "Logs",
+		"#logRef":         "LogRef",
+		"#imageUri":       "ImageURI",
+		"#imageDigestUri": "ImageDigestURI",
+		"#image":          "Image",
+		"#manifest":       "Manifest",
+		"#serverJson":     "ServerJSON",
+		"#version":        "Version",
 	}
 
 	// Convert stages to DynamoDB attribute values
 	stagesAv, _ := attributevalue.Marshal(deployment.Stages)
 	logsAv, _ := attributevalue.Marshal(deployment.BuildLogs)
+	logRefAv, _ := attributevalue.Marshal(deployment.LogRef)
+	imageAv, _ := attributevalue.Marshal(deployment.Image)
+	manifestAv, _ := attributevalue.Marshal(deployment.Manifest)
+	serverJSONAv, _ := attributevalue.Marshal(deployment.ServerJSON)
 
 	exprAttrVals := map[string]types.AttributeValue{
-		":status":     &types.AttributeValueMemberS{Value: deployment.Status},
-		":stages":     stagesAv,
-		":logs":       logsAv,
-		":imageUri":   &types.AttributeValueMemberS{Value: deployment.ImageURI},
-		":updated_at": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", deployment.UpdatedAt.Unix())},
+		":status":         &types.AttributeValueMemberS{Value: string(deployment.Status)},
+		":expected":       &types.AttributeValueMemberS{Value: string(expected)},
+		":stages":         stagesAv,
+		":logs":           logsAv,
+		":logRef":         logRefAv,
+		":imageUri":       &types.AttributeValueMemberS{Value: deployment.ImageURI},
+		":imageDigestUri": &types.AttributeValueMemberS{Value: deployment.ImageDigestURI},
+		":image":          imageAv,
+		":manifest":       manifestAv,
+		":serverJson":     serverJSONAv,
+		":updated_at":     &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", deployment.UpdatedAt.Unix())},
+	}
+	for name, value := range versionValues(deployment.Version) {
+		exprAttrVals[name] = value
 	}
 
 	_, err := do.client.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
@@ -201,19 +397,24 @@ func (do *DeploymentOperations) UpdateDeployment(ctx context.Context, deployment
 			"ServerId":     &types.AttributeValueMemberS{Value: deployment.ServerId},
 			"DeploymentId": &types.AttributeValueMemberS{Value: deployment.DeploymentId},
 		},
-		UpdateExpression:          aws.String(updateExpr),
-		ExpressionAttributeNames:  exprAttrNames,
-		ExpressionAttributeValues: exprAttrVals,
+		UpdateExpression:                    aws.String(updateExpr),
+		ConditionExpression:                 aws.String("#status = :expected AND " + versionCondition(deployment.Version)),
+		ExpressionAttributeNames:            exprAttrNames,
+		ExpressionAttributeValues:           exprAttrVals,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 	})
 
 	if err != nil {
 		var ccf *types.ConditionalCheckFailedException
 		if errors.As(err, &ccf) {
 			logger.WithFields(map[string]interface{}{
-				"server_id":     deployment.ServerId,
-				"deployment_id": deployment.DeploymentId,
-			}).Warn("Deployment not found during update")
-			return ErrNotFound
+				"server_id":        deployment.ServerId,
+				"deployment_id":    deployment.DeploymentId,
+				"status":           deployment.Status,
+				"expected_status":  expected,
+				"expected_version": deployment.Version,
+			}).Warn("Deployment update rejected: deployment missing or modified concurrently")
+			return deploymentConflictError(ccf, deployment, expected)
 		}
 		logger.WithFields(map[string]interface{}{
 			"server_id":     deployment.ServerId,
@@ -222,32 +423,44 @@ func (do *DeploymentOperations) UpdateDeployment(ctx context.Context, deployment
 		}).Error("Failed to update deployment in DynamoDB")
 		return fmt.Errorf("failed to update deployment: %w", err)
 	}
+	deployment.Version++
 
 	logger.WithFields(map[string]interface{}{
 		"server_id":     deployment.ServerId,
 		"deployment_id": deployment.DeploymentId,
 		"status":        deployment.Status,
+		"version":       deployment.Version,
 	}).Info("Deployment updated successfully in DynamoDB")
 
 	return nil
 }
 
+// deploymentItem is a deployment as stored in DynamoDB, with times in Unix
+// seconds so CreatedAt can be an index sort key
+type deploymentItem struct {
+	ServerId       string                              `dynamodbav:"ServerId"`
+	DeploymentId   string                              `dynamodbav:"DeploymentId"`
+	UserId         string                              `dynamodbav:"UserId"`
+	Branch         string                              `dynamodbav:"Branch"`
+	CommitHash     string                              `dynamodbav:"CommitHash"`
+	Status         models.DeploymentStatus             `dynamodbav:"Status"`
+	Stages         map[string]*models.BuildStageStatus `dynamodbav:"Stages"`
+	BuildLogs      []models.BuildLogEntry              `dynamodbav:"Logs"`
+	LogRef         *models.LogReference                `dynamodbav:"LogRef"`
+	ImageURI       string                              `dynamodbav:"ImageURI"`
+	ImageDigestURI string                              `dynamodbav:"ImageDigestURI"`
+	Image          *models.ImageMetadata               `dynamodbav:"Image"`
+	Manifest       *models.MCPManifest                 `dynamodbav:"Manifest"`
+	ServerJSON     *models.RegistryServer              `dynamodbav:"ServerJSON"`
+	Version        int64                               `dynamodbav:"Version"`
+	CreatedAt      int64                               `dynamodbav:"CreatedAt"`
+	UpdatedAt      int64                               `dynamodbav:"UpdatedAt"`
+}
+
 // unmarshalDeployment is a helper function to unmarshal DynamoDB item to Deployment domain model
 func (do *DeploymentOperations) unmarshalDeployment(item map[string]types.AttributeValue) (*models.Deployment, error) {
 	// Unmarshal into a temporary struct to handle custom conversions
-	var temp struct {
-		ServerId     string                              `dynamodbav:"ServerId"`
-		DeploymentId string                              `dynamodbav:"DeploymentId"`
-		UserId       string                              `dynamodbav:"UserId"`
-		Branch       string                              `dynamodbav:"Branch"`
-		CommitHash   string                              `dynamodbav:"CommitHash"`
-		Status       string                              `dynamodbav:"Status"`
-		Stages       map[string]*models.BuildStageStatus `dynamodbav:"Stages"`
-		BuildLogs    []models.BuildLogEntry              `dynamodbav:"Logs"`
-		ImageURI     string                              `dynamodbav:"ImageURI"`
-		CreatedAt    int64                               `dynamodbav:"CreatedAt"`
-		UpdatedAt    int64                               `dynamodbav:"UpdatedAt"`
-	}
+	var temp deploymentItem
 
 	err := attributevalue.UnmarshalMap(item, &temp)
 	if err != nil {
@@ -256,17 +469,23 @@ func (do *DeploymentOperations) unmarshalDeployment(item map[string]types.Attrib
 
 	// Convert to domain model with proper time.Time conversion
 	deployment := &models.Deployment{
-		ServerId:     temp.ServerId,
-		DeploymentId: temp.DeploymentId,
-		UserId:       temp.UserId,
-		Branch:       temp.Branch,
-		CommitHash:   temp.CommitHash,
-		Status:       temp.Status,
-		Stages:       temp.Stages,
-		BuildLogs:    temp.BuildLogs,
-		ImageURI:     temp.ImageURI,
-		CreatedAt:    time.Unix(temp.CreatedAt, 0),
-		UpdatedAt:    time.Unix(temp.UpdatedAt, 0),
+		ServerId:       temp.ServerId,
+		DeploymentId:   temp.DeploymentId,
+		UserId:         temp.UserId,
+		Branch:         temp.Branch,
+		CommitHash:     temp.CommitHash,
+		Status:         temp.Status,
+		Stages:         temp.Stages,
+		BuildLogs:      temp.BuildLogs,
+		LogRef:         temp.LogRef,
+		ImageURI:       temp.ImageURI,
+		ImageDigestURI: temp.ImageDigestURI,
+		Image:          temp.Image,
+		Manifest:       temp.Manifest,
+		ServerJSON:     temp.ServerJSON,
+		Version:        temp.Version,
+		CreatedAt:      time.Unix(temp.CreatedAt, 0),
+		UpdatedAt:      time.Unix(temp.UpdatedAt, 0),
 	}
 
 	return deployment, nil
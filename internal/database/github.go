@@ -40,13 +40,15 @@ func NewGitHubDB(client *Client, connectionsTableName, oauthStatesTableName stri
 func (db *GitHubDB) GetGitHubConnectionByUserId(ctx context.Context, userId string) (*models.GitHubConnection, error) {
 	logger.WithField("user_id", userId).Debug("Retrieving GitHub connection from DynamoDB")
 
-	// For simplicity, we'll use Scan with filter
-	result, err := db.client.DynamoDB.Scan(ctx, &dynamodb.ScanInput{
-		TableName:        aws.String(db.connectionsTableName),
-		FilterExpression: aws.String("UserId = :userId"),
+	// A user has at most one connection
+	result, err := db.client.DynamoDB.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(db.connectionsTableName),
+		IndexName:              aws.String(GitHubConnectionUserIdIndex),
+		KeyConditionExpression: aws.String("UserId = :userId"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":userId": &types.AttributeValueMemberS{Value: userId},
 		},
+		Limit: aws.Int32(1),
 	})
 
 	// Handle errors
@@ -112,13 +114,15 @@ func (db *GitHubDB) GetGitHubConnectionById(ctx context.Context, id string) (*mo
 
 // GitHubConnectionExists checks if a GitHub connection exists for a user
 func (db *GitHubDB) GitHubConnectionExists(ctx context.Context, userId string) (bool, error) {
-	result, err := db.client.DynamoDB.Scan(ctx, &dynamodb.ScanInput{
-		TableName:        aws.String(db.connectionsTableName),
-		FilterExpression: aws.String("UserId = :userId"),
+	result, err := db.client.DynamoDB.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(db.connectionsTableName),
+		IndexName:              aws.String(GitHubConnectionUserIdIndex),
+		KeyConditionExpression: aws.String("UserId = :userId"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
 			":userId": &types.AttributeValueMemberS{Value: userId},
 		},
 		Select: types.SelectCount,
+		Limit:  aws.Int32(1),
 	})
 	if err != nil {
 		return false, fmt.Errorf("failed to check github connection existence: %w", err)
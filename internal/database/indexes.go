@@ -0,0 +1,116 @@
+package database
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	// MCPUserIdIndex is the GSI on the MCP servers table keyed by UserId and CreatedAt
+	MCPUserIdIndex = "UserIdIndex"
+
+	// MCPRepositoryKeyIndex is the sparse GSI on the MCP servers table keyed by
+	// RepositoryKey, which only servers with a webhook secret have
+	MCPRepositoryKeyIndex = "RepositoryKeyIndex"
+
+	// DeploymentUserIdIndex is the GSI on the deployments table keyed by UserId and CreatedAt
+	DeploymentUserIdIndex = "UserIdIndex"
+
+	// DeploymentServerIdIndex is the GSI on the deployments table keyed by ServerId
+	// and CreatedAt, which lists a server's deployments in creation order
+	DeploymentServerIdIndex = "ServerIdCreatedAtIndex"
+
+	// GitHubConnectionUserIdIndex is the GSI on the GitHub connections table keyed by UserId
+	GitHubConnectionUserIdIndex = "UserIdIndex"
+)
+
+// KeyAttribute is an attribute used as an index key
+type KeyAttribute struct {
+	Name string
+	Type types.ScalarAttributeType
+}
+
+// IndexDefinition describes a global secondary index the queries in this
+// package rely on. Every index projects all attributes.
+type IndexDefinition struct {
+	Name         string
+	PartitionKey KeyAttribute
+	SortKey      *KeyAttribute // nil for an index without a sort key
+}
+
+var (
+	// MCPServerIndexes are the GSIs of the MCP servers table
+	MCPServerIndexes = []IndexDefinition{
+		{
+			Name:         MCPUserIdIndex,
+			PartitionKey: KeyAttribute{Name: "UserId", Type: types.ScalarAttributeTypeS},
+			SortKey:      &KeyAttribute{Name: "CreatedAt", Type: types.ScalarAttributeTypeN},
+		},
+		{
+			Name:         MCPRepositoryKeyIndex,
+			PartitionKey: KeyAttribute{Name: "RepositoryKey", Type: types.ScalarAttributeTypeS},
+		},
+	}
+
+	// DeploymentIndexes are the GSIs of the deployments table
+	DeploymentIndexes = []IndexDefinition{
+		{
+			Name:         DeploymentUserIdIndex,
+			PartitionKey: KeyAttribute{Name: "UserId", Type: types.ScalarAttributeTypeS},
+			SortKey:      &KeyAttribute{Name: "CreatedAt", Type: types.ScalarAttributeTypeN},
+		},
+		{
+			Name:         DeploymentServerIdIndex,
+			PartitionKey: KeyAttribute{Name: "ServerId", Type: types.ScalarAttributeTypeS},
+			SortKey:      &KeyAttribute{Name: "CreatedAt", Type: types.ScalarAttributeTypeN},
+		},
+	}
+
+	// GitHubConnectionIndexes are the GSIs of the GitHub connections table
+	GitHubConnectionIndexes = []IndexDefinition{
+		{
+			Name:         GitHubConnectionUserIdIndex,
+			PartitionKey: KeyAttribute{Name: "UserId", Type: types.ScalarAttributeTypeS},
+		},
+	}
+)
+
+// KeyAttributes returns the index's key attributes, partition key first
+func (d IndexDefinition) KeyAttributes() []KeyAttribute {
+	if d.SortKey == nil {
+		return []KeyAttribute{d.PartitionKey}
+	}
+	return []KeyAttribute{d.PartitionKey, *d.SortKey}
+}
+
+// GlobalSecondaryIndex returns the index in the form CreateTable and UpdateTable expect
+func (d IndexDefinition) GlobalSecondaryIndex() types.GlobalSecondaryIndex {
+	keySchema := []types.KeySchemaElement{
+		{AttributeName: aws.String(d.PartitionKey.Name), KeyType: types.KeyTypeHash},
+	}
+	if d.SortKey != nil {
+		keySchema = append(keySchema, types.KeySchemaElement{
+			AttributeName: aws.String(d.SortKey.Name),
+			KeyType:       types.KeyTypeRange,
+		})
+	}
+
+	return types.GlobalSecondaryIndex{
+		IndexName:  aws.String(d.Name),
+		KeySchema:  keySchema,
+		Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+	}
+}
+
+// AttributeDefinitions returns the definitions of the index's key attributes
+func (d IndexDefinition) AttributeDefinitions() []types.AttributeDefinition {
+	keys := d.KeyAttributes()
+	definitions := make([]types.AttributeDefinition, 0, len(keys))
+	for _, key := range keys {
+		definitions = append(definitions, types.AttributeDefinition{
+			AttributeName: aws.String(key.Name),
+			AttributeType: key.Type,
+		})
+	}
+	return definitions
+}
@@ -19,6 +19,8 @@ var (
 	ErrNotFound = errors.New("record not found")
 	// ErrAlreadyExists is returned when a record already exists
 	ErrAlreadyExists = errors.New("record already exists")
+	// ErrConflict is returned when a record was modified since it was read
+	ErrConflict = errors.New("record was modified concurrently")
 )
 
 // MCPOperations handles all DynamoDB operations for MCP servers
@@ -80,58 +82,116 @@ func (ms *MCPServer) GetMCP(ctx context.Context, serverId string) (*models.MCPSe
 	return server, nil
 }
 
-// GetAllMCPs retrieves all MCP servers from DynamoDB
-func (ms *MCPServer) GetAllMCPs(ctx context.Context) ([]*models.MCPServer, error) {
-
-	// Scan the DynamoDB table to get all MCP servers
-	result, err := ms.client.DynamoDB.Scan(ctx, &dynamodb.ScanInput{
-		TableName: aws.String(ms.client.TableName),
-	})
+// GetAllMCPs returns one page of all MCP servers, in no particular order.
+// It scans the whole table and is meant for administrative use.
+func (ms *MCPServer) GetAllMCPs(ctx context.Context, page models.PageRequest) ([]*models.MCPServer, string, error) {
+	l := listing{
+		keys: []string{"ServerId"},
+		fetch: func(ctx context.Context, startKey map[string]types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+			result, err := ms.client.DynamoDB.Scan(ctx, &dynamodb.ScanInput{
+				TableName:         aws.String(ms.tableName),
+				ExclusiveStartKey: startKey,
+				Limit:             aws.Int32(limit),
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			return result.Items, result.LastEvaluatedKey, nil
+		},
+	}
 
+	servers, cursor, err := ms.collectServers(ctx, l, page)
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan MCP servers: %w", err)
+		return nil, "", fmt.Errorf("failed to scan MCP servers: %w", err)
 	}
+	return servers, cursor, nil
+}
 
-	servers := make([]*models.MCPServer, 0, len(result.Items))
-	for _, item := range result.Items {
-		server, err := ms.unmarshalMCPServer(item)
-		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal MCP server: %w", err)
-		}
-		servers = append(servers, server)
+// GetMCPsByUserId returns one page of a user's MCP servers, newest first, from the UserId index
+func (ms *MCPServer) GetMCPsByUserId(ctx context.Context, userId string, page models.PageRequest) ([]*models.MCPServer, string, error) {
+	l := listing{
+		keys:      []string{"ServerId", "UserId", "CreatedAt"},
+		partition: map[string]string{"UserId": userId},
+		fetch: func(ctx context.Context, startKey map[string]types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+			result, err := ms.client.DynamoDB.Query(ctx, &dynamodb.QueryInput{
+				TableName:              aws.String(ms.tableName),
+				IndexName:              aws.String(MCPUserIdIndex),
+				KeyConditionExpression: aws.String("UserId = :userId"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":userId": &types.AttributeValueMemberS{Value: userId},
+				},
+				ScanIndexForward:  aws.Bool(false),
+				ExclusiveStartKey: startKey,
+				Limit:             aws.Int32(limit),
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			return result.Items, result.LastEvaluatedKey, nil
+		},
 	}
 
-	return servers, nil
+	servers, cursor, err := ms.collectServers(ctx, l, page)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query MCP servers by user_id: %w", err)
+	}
+	return servers, cursor, nil
 }
 
-// GetMCPsByUserId retrieves all MCP servers for a specific user from DynamoDB
-func (ms *MCPServer) GetMCPsByUserId(ctx context.Context, userId string) ([]*models.MCPServer, error) {
-	// Use Scan with FilterExpression to filter by UserId
-	result, err := ms.client.DynamoDB.Scan(ctx, &dynamodb.ScanInput{
-		TableName:        aws.String(ms.tableName),
-		FilterExpression: aws.String("UserId = :userId"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":userId": &types.AttributeValueMemberS{Value: userId},
+// GetMCPsByRepositoryKey returns one page of the servers with a webhook secret
+// that are built from a repository, in no particular order, from the
+// RepositoryKey index
+func (ms *MCPServer) GetMCPsByRepositoryKey(ctx context.Context, repositoryKey string, page models.PageRequest) ([]*models.MCPServer, string, error) {
+	l := listing{
+		keys:      []string{"ServerId", "RepositoryKey"},
+		partition: map[string]string{"RepositoryKey": repositoryKey},
+		fetch: func(ctx context.Context, startKey map[string]types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+			result, err := ms.client.DynamoDB.Query(ctx, &dynamodb.QueryInput{
+				TableName:              aws.String(ms.tableName),
+				IndexName:              aws.String(MCPRepositoryKeyIndex),
+				KeyConditionExpression: aws.String("RepositoryKey = :repoKey"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":repoKey": &types.AttributeValueMemberS{Value: repositoryKey},
+				},
+				ExclusiveStartKey: startKey,
+				Limit:             aws.Int32(limit),
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			return result.Items, result.LastEvaluatedKey, nil
 		},
-	})
+	}
 
+	servers, cursor, err := ms.collectServers(ctx, l, page)
 	if err != nil {
-		return nil, fmt.Errorf("failed to scan MCP servers by user_id: %w", err)
+		return nil, "", fmt.Errorf("failed to query MCP servers by repository key: %w", err)
+	}
+	return servers, cursor, nil
+}
+
+// collectServers reads one page of a listing and unmarshals it
+func (ms *MCPServer) collectServers(ctx context.Context, l listing, page models.PageRequest) ([]*models.MCPServer, string, error) {
+	items, cursor, err := l.collect(ctx, page)
+	if err != nil {
+		return nil, "", err
 	}
 
-	servers := make([]*models.MCPServer, 0, len(result.Items))
-	for _, item := range result.Items {
+	servers := make([]*models.MCPServer, 0, len(items))
+	for _, item := range items {
 		server, err := ms.unmarshalMCPServer(item)
 		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal MCP server: %w", err)
+			return nil, "", fmt.Errorf("failed to unmarshal MCP server: %w", err)
 		}
 		servers = append(servers, server)
 	}
 
-	return servers, nil
+	return servers, cursor, nil
 }
 
-// UpdateMCP updates an existing MCP server in DynamoDB
+// UpdateMCP updates an existing MCP server in DynamoDB.
+// The write only succeeds if the stored Version still equals server.Version;
+// otherwise a *ConflictError is returned. On success server.Version is incremented.
 func (ms *MCPServer) UpdateMCP(ctx context.Context, server *models.MCPServer) error {
 	logger.WithFields(map[string]interface{}{
 		"server_id": server.ServerId,
@@ -148,13 +208,47 @@ func (ms *MCPServer) UpdateMCP(ctx context.Context, server *models.MCPServer) er
 		return fmt.Errorf("failed to marshal environment variables: %w", err)
 	}
 
-	// Update the MCP server using UpdateItem
+	branchesList, err := attributevalue.Marshal(server.AutoBuildBranches)
+	if err != nil {
+		return fmt.Errorf("failed to marshal auto-build branches: %w", err)
+	}
+
+	exprAttrVals := map[string]types.AttributeValue{
+		":name":        &types.AttributeValueMemberS{Value: server.Name},
+		":desc":        &types.AttributeValueMemberS{Value: server.Description},
+		":repo":        &types.AttributeValueMemberS{Value: server.Repository},
+		":status":      &types.AttributeValueMemberS{Value: server.Status},
+		":envs":        &types.AttributeValueMemberL{Value: envsList},
+		":updated_at":  &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", server.UpdatedAt.Unix())},
+		":ecrRepoName": &types.AttributeValueMemberS{Value: server.ECRRepositoryName},
+		":ecrRepoURI":  &types.AttributeValueMemberS{Value: server.ECRRepositoryURI},
+		":registry":    &types.AttributeValueMemberS{Value: server.Registry},
+		":builder":     &types.AttributeValueMemberS{Value: server.Builder},
+		":webhook":     &types.AttributeValueMemberS{Value: server.WebhookSecret},
+		":branches":    branchesList,
+	}
+	for name, value := range versionValues(server.Version) {
+		exprAttrVals[name] = value
+	}
+
+	// RepositoryKey keys a sparse index and index keys cannot be empty, so a
+	// server without a webhook secret has the attribute removed instead
+	updateExpr := "SET #name = :name, #desc = :desc, #repo = :repo, #status = :status, #envs = :envs, #ecrRepoName = :ecrRepoName, #ecrRepoURI = :ecrRepoURI, #registry = :registry, #builder = :builder, #webhook = :webhook, #branches = :branches, #version = :nextVersion, UpdatedAt = :updated_at"
+	if repoKey := server.WebhookRepositoryKey(); repoKey != "" {
+		updateExpr += ", #repoKey = :repoKey"
+		exprAttrVals[":repoKey"] = &types.AttributeValueMemberS{Value: repoKey}
+	} else {
+		updateExpr += " REMOVE #repoKey"
+	}
+
+	// Update the MCP server using UpdateItem, only if nobody wrote it since it was read
 	_, err = ms.client.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(ms.tableName),
 		Key: map[string]types.AttributeValue{
 			"ServerId": &types.AttributeValueMemberS{Value: server.ServerId},
 		},
-		UpdateExpression: aws.String("SET #name = :name, #desc = :desc, #repo = :repo, #status = :status, #envs = :envs, #ecrRepoName = :ecrRepoName, #ecrRepoURI = :ecrRepoURI, UpdatedAt = :updated_at"),
+		UpdateExpression:    aws.String(updateExpr),
+		ConditionExpression: aws.String("attribute_exists(ServerId) AND " + versionCondition(server.Version)),
 		ExpressionAttributeNames: map[string]string{
 			"#name":        "Name",
 			"#desc":        "Description",
@@ -163,24 +257,35 @@ func (ms *MCPServer) UpdateMCP(ctx context.Context, server *models.MCPServer) er
 			"#envs":        "Envs",
 			"#ecrRepoName": "ECRRepositoryName",
 			"#ecrRepoURI":  "ECRRepositoryURI",
+			"#registry":    "Registry",
+			"#builder":     "Builder",
+			"#webhook":     "WebhookSecret",
+			"#branches":    "AutoBuildBranches",
+			"#repoKey":     "RepositoryKey",
+			"#version":     "Version",
 		},
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":name":        &types.AttributeValueMemberS{Value: server.Name},
-			":desc":        &types.AttributeValueMemberS{Value: server.Description},
-			":repo":        &types.AttributeValueMemberS{Value: server.Repository},
-			":status":      &types.AttributeValueMemberS{Value: server.Status},
-			":envs":        &types.AttributeValueMemberL{Value: envsList},
-			":updated_at":  &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", server.UpdatedAt.Unix())},
-			":ecrRepoName": &types.AttributeValueMemberS{Value: server.ECRRepositoryName},
-			":ecrRepoURI":  &types.AttributeValueMemberS{Value: server.ECRRepositoryURI},
-		},
+		ExpressionAttributeValues:           exprAttrVals,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
 	})
 
 	if err != nil {
 		var ccf *types.ConditionalCheckFailedException
 		if errors.As(err, &ccf) {
-			logger.WithField("server_id", server.ServerId).Warn("MCP server not found during update")
-			return ErrNotFound
+			if len(ccf.Item) == 0 {
+				logger.WithField("server_id", server.ServerId).Warn("MCP server not found during update")
+				return ErrNotFound
+			}
+			conflict := &ConflictError{
+				Key:             server.ServerId,
+				ExpectedVersion: server.Version,
+				ActualVersion:   storedVersion(ccf.Item),
+			}
+			logger.WithFields(map[string]interface{}{
+				"server_id":        server.ServerId,
+				"expected_version": conflict.ExpectedVersion,
+				"stored_version":   conflict.ActualVersion,
+			}).Warn("MCP server update rejected: modified concurrently")
+			return conflict
 		}
 		logger.WithFields(map[string]interface{}{
 			"server_id": server.ServerId,
@@ -188,10 +293,12 @@ func (ms *MCPServer) UpdateMCP(ctx context.Context, server *models.MCPServer) er
 		}).Error("Failed to update MCP server in DynamoDB")
 		return fmt.Errorf("failed to update MCP server: %w", err)
 	}
+	server.Version++
 
 	logger.WithFields(map[string]interface{}{
 		"server_id": server.ServerId,
 		"name":      server.Name,
+		"version":   server.Version,
 	}).Info("MCP server updated successfully in DynamoDB")
 
 	return nil
@@ -248,6 +355,11 @@ func (ops *MCPServer) unmarshalMCPServer(item map[string]types.AttributeValue) (
 		EnvironmentVariables []models.EnvironmentVariable `dynamodbav:"Envs"`
 		ECRRepositoryName    string                       `dynamodbav:"ECRRepositoryName"`
 		ECRRepositoryURI     string                       `dynamodbav:"ECRRepositoryURI"`
+		Registry             string                       `dynamodbav:"Registry"`
+		Builder              string                       `dynamodbav:"Builder"`
+		WebhookSecret        string                       `dynamodbav:"WebhookSecret"`
+		AutoBuildBranches    []string                     `dynamodbav:"AutoBuildBranches"`
+		Version              int64                        `dynamodbav:"Version"`
 		CreatedAt            int64                        `dynamodbav:"CreatedAt"`
 		UpdatedAt            int64                        `dynamodbav:"UpdatedAt"`
 	}
@@ -268,6 +380,11 @@ func (ops *MCPServer) unmarshalMCPServer(item map[string]types.AttributeValue) (
 		EnvironmentVariables: temp.EnvironmentVariables,
 		ECRRepositoryName:    temp.ECRRepositoryName,
 		ECRRepositoryURI:     temp.ECRRepositoryURI,
+		Registry:             temp.Registry,
+		Builder:              temp.Builder,
+		WebhookSecret:        temp.WebhookSecret,
+		AutoBuildBranches:    temp.AutoBuildBranches,
+		Version:              temp.Version,
 		CreatedAt:            time.Unix(temp.CreatedAt, 0),
 		UpdatedAt:            time.Unix(temp.UpdatedAt, 0),
 	}
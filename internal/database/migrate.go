@@ -0,0 +1,384 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/imyashkale/buildserver/internal/logger"
+)
+
+const (
+	// migrationPollInterval is how often table and index status is checked while waiting
+	migrationPollInterval = 2 * time.Second
+
+	// migrationWaitTimeout bounds the wait for a table or index to become active.
+	// Building an index on a large table can take a while.
+	migrationWaitTimeout = 30 * time.Minute
+)
+
+// schemaAPI is the part of the DynamoDB API the migrator uses
+type schemaAPI interface {
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	UpdateTable(ctx context.Context, params *dynamodb.UpdateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+// AppliedMigration is the record of a migration in the migrations table
+type AppliedMigration struct {
+	Version     int    `dynamodbav:"Version"`
+	Description string `dynamodbav:"Description"`
+	AppliedAt   int64  `dynamodbav:"AppliedAt"`
+}
+
+// Migrator creates and updates the tables to the current SchemaVersion and
+// records each applied migration in its own table
+type Migrator struct {
+	api             schemaAPI
+	names           TableNames
+	migrationsTable string
+	migrations      []Migration
+	pollInterval    time.Duration
+	waitTimeout     time.Duration
+}
+
+// NewMigrator creates a migrator for the given tables. Applied migrations are
+// recorded in migrationsTable, which is created on first use.
+func NewMigrator(client *Client, names TableNames, migrationsTable string) *Migrator {
+	return &Migrator{
+		api:             client.DynamoDB,
+		names:           names,
+		migrationsTable: migrationsTable,
+		migrations:      Migrations,
+		pollInterval:    migrationPollInterval,
+		waitTimeout:     migrationWaitTimeout,
+	}
+}
+
+// Pending returns the migrations that have not been applied yet, in order
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.Applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[int]bool, len(applied))
+	for _, record := range applied {
+		done[record.Version] = true
+	}
+
+	pending := make([]Migration, 0)
+	for _, migration := range m.migrations {
+		if !done[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Applied returns the recorded migrations, oldest first. A missing
+// migrations table means nothing has been applied.
+func (m *Migrator) Applied(ctx context.Context) ([]AppliedMigration, error) {
+	exists, err := m.tableExists(ctx, m.migrationsTable)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	applied := make([]AppliedMigration, 0)
+	paginator := dynamodb.NewScanPaginator(m.api, &dynamodb.ScanInput{
+		TableName:      aws.String(m.migrationsTable),
+		ConsistentRead: aws.Bool(true),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		for _, item := range page.Items {
+			var record AppliedMigration
+			if err := attributevalue.UnmarshalMap(item, &record); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal applied migration: %w", err)
+			}
+			applied = append(applied, record)
+		}
+	}
+
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].Version < applied[j].Version
+	})
+	return applied, nil
+}
+
+// Migrate applies every pending migration in order and records it. It stops
+// at the first failing step; running it again resumes from that migration.
+func (m *Migrator) Migrate(ctx context.Context) ([]Migration, error) {
+	if err := m.ensureTable(ctx, m.migrationsTable, KeyAttribute{Name: "Version", Type: types.ScalarAttributeTypeN}, nil); err != nil {
+		return nil, fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]Migration, 0, len(pending))
+	for _, migration := range pending {
+		logger.WithFields(map[string]interface{}{
+			"version":     migration.Version,
+			"description": migration.Description,
+		}).Info("Applying schema migration")
+
+		for _, step := range migration.Steps {
+			logger.WithField("version", migration.Version).Info(step.Describe(m.names))
+			if err := step.apply(ctx, m); err != nil {
+				return applied, fmt.Errorf("migration %d (%s): %s: %w", migration.Version, migration.Description, step.Describe(m.names), err)
+			}
+		}
+
+		record, err := attributevalue.MarshalMap(AppliedMigration{
+			Version:     migration.Version,
+			Description: migration.Description,
+			AppliedAt:   time.Now().Unix(),
+		})
+		if err != nil {
+			return applied, fmt.Errorf("failed to marshal migration record: %w", err)
+		}
+		if _, err := m.api.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName: aws.String(m.migrationsTable),
+			Item:      record,
+		}); err != nil {
+			return applied, fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+		}
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// Describe summarizes the step
+func (s createTableStep) Describe(names TableNames) string {
+	keys := s.partitionKey.Name
+	if s.sortKey != nil {
+		keys += ", " + s.sortKey.Name
+	}
+	return fmt.Sprintf("create table %s (%s)", names.name(s.table), keys)
+}
+
+func (s createTableStep) apply(ctx context.Context, m *Migrator) error {
+	return m.ensureTable(ctx, m.names.name(s.table), s.partitionKey, s.sortKey)
+}
+
+// Describe summarizes the step
+func (s addIndexStep) Describe(names TableNames) string {
+	keys := make([]string, 0, 2)
+	for _, key := range s.index.KeyAttributes() {
+		keys = append(keys, key.Name)
+	}
+	return fmt.Sprintf("add index %s (%s) to %s", s.index.Name, strings.Join(keys, ", "), names.name(s.table))
+}
+
+func (s addIndexStep) apply(ctx context.Context, m *Migrator) error {
+	return m.ensureIndex(ctx, m.names.name(s.table), s.index)
+}
+
+// Describe summarizes the step
+func (s enableTTLStep) Describe(names TableNames) string {
+	return fmt.Sprintf("enable TTL on %s.%s", names.name(s.table), s.attribute)
+}
+
+func (s enableTTLStep) apply(ctx context.Context, m *Migrator) error {
+	return m.ensureTTL(ctx, m.names.name(s.table), s.attribute)
+}
+
+// ensureTable creates a table unless it exists. An existing table must have
+// the same primary key.
+func (m *Migrator) ensureTable(ctx context.Context, name string, partitionKey KeyAttribute, sortKey *KeyAttribute) error {
+	description, err := m.describeTable(ctx, name)
+	if err != nil {
+		return err
+	}
+	if description != nil {
+		return checkKeySchema(name, description.KeySchema, partitionKey, sortKey)
+	}
+
+	index := IndexDefinition{PartitionKey: partitionKey, SortKey: sortKey}
+	keySchema := index.GlobalSecondaryIndex().KeySchema
+	_, err = m.api.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:            aws.String(name),
+		KeySchema:            keySchema,
+		AttributeDefinitions: index.AttributeDefinitions(),
+		BillingMode:          types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		var inUse *types.ResourceInUseException
+		if !errors.As(err, &inUse) {
+			return fmt.Errorf("failed to create table %s: %w", name, err)
+		}
+		// Another migrate run created it concurrently
+	}
+
+	return m.waitUntil(ctx, name, func(table *types.TableDescription) bool {
+		return table.TableStatus == types.TableStatusActive
+	})
+}
+
+// ensureIndex adds a global secondary index unless the table already has it.
+// An existing index must have the same key.
+func (m *Migrator) ensureIndex(ctx context.Context, tableName string, index IndexDefinition) error {
+	description, err := m.describeTable(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	if description == nil {
+		return fmt.Errorf("table %s does not exist", tableName)
+	}
+
+	for _, existing := range description.GlobalSecondaryIndexes {
+		if aws.ToString(existing.IndexName) == index.Name {
+			if err := checkKeySchema(tableName+" index "+index.Name, existing.KeySchema, index.PartitionKey, index.SortKey); err != nil {
+				return err
+			}
+			return m.waitForIndex(ctx, tableName, index.Name)
+		}
+	}
+
+	gsi := index.GlobalSecondaryIndex()
+	_, err = m.api.UpdateTable(ctx, &dynamodb.UpdateTableInput{
+		TableName:            aws.String(tableName),
+		AttributeDefinitions: index.AttributeDefinitions(),
+		GlobalSecondaryIndexUpdates: []types.GlobalSecondaryIndexUpdate{
+			{
+				Create: &types.CreateGlobalSecondaryIndexAction{
+					IndexName:  gsi.IndexName,
+					KeySchema:  gsi.KeySchema,
+					Projection: gsi.Projection,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add index %s to %s: %w", index.Name, tableName, err)
+	}
+
+	return m.waitForIndex(ctx, tableName, index.Name)
+}
+
+// waitForIndex waits until the index has been built
+func (m *Migrator) waitForIndex(ctx context.Context, tableName, indexName string) error {
+	return m.waitUntil(ctx, tableName, func(table *types.TableDescription) bool {
+		if table.TableStatus != types.TableStatusActive {
+			return false
+		}
+		for _, index := range table.GlobalSecondaryIndexes {
+			if aws.ToString(index.IndexName) == indexName {
+				return index.IndexStatus == types.IndexStatusActive
+			}
+		}
+		return false
+	})
+}
+
+// ensureTTL enables time to live on attribute unless it is already enabled
+func (m *Migrator) ensureTTL(ctx context.Context, tableName, attribute string) error {
+	result, err := m.api.DescribeTimeToLive(ctx, &dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe TTL of %s: %w", tableName, err)
+	}
+
+	if ttl := result.TimeToLiveDescription; ttl != nil {
+		switch ttl.TimeToLiveStatus {
+		case types.TimeToLiveStatusEnabled, types.TimeToLiveStatusEnabling:
+			if current := aws.ToString(ttl.AttributeName); current != attribute {
+				return fmt.Errorf("TTL of %s is already enabled on %s", tableName, current)
+			}
+			return nil
+		}
+	}
+
+	_, err = m.api.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(attribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable TTL on %s: %w", tableName, err)
+	}
+	return nil
+}
+
+// waitUntil polls the table description until done returns true
+func (m *Migrator) waitUntil(ctx context.Context, tableName string, done func(*types.TableDescription) bool) error {
+	deadline := time.Now().Add(m.waitTimeout)
+	for {
+		description, err := m.describeTable(ctx, tableName)
+		if err != nil {
+			return err
+		}
+		if description != nil && done(description) {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for table %s", tableName)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(m.pollInterval):
+		}
+	}
+}
+
+// tableExists reports whether a table exists
+func (m *Migrator) tableExists(ctx context.Context, name string) (bool, error) {
+	description, err := m.describeTable(ctx, name)
+	return description != nil, err
+}
+
+// describeTable returns the table description, or nil if the table does not exist
+func (m *Migrator) describeTable(ctx context.Context, name string) (*types.TableDescription, error) {
+	result, err := m.api.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(name),
+	})
+	if err != nil {
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to describe table %s: %w", name, err)
+	}
+	return result.Table, nil
+}
+
+// checkKeySchema returns an error if an existing key differs from the expected one
+func checkKeySchema(what string, keySchema []types.KeySchemaElement, partitionKey KeyAttribute, sortKey *KeyAttribute) error {
+	expected := []string{partitionKey.Name + " " + string(types.KeyTypeHash)}
+	if sortKey != nil {
+		expected = append(expected, sortKey.Name+" "+string(types.KeyTypeRange))
+	}
+
+	actual := make([]string, 0, len(keySchema))
+	for _, element := range keySchema {
+		actual = append(actual, aws.ToString(element.AttributeName)+" "+string(element.KeyType))
+	}
+
+	if strings.Join(actual, ", ") != strings.Join(expected, ", ") {
+		return fmt.Errorf("%s has key [%s], expected [%s]", what, strings.Join(actual, ", "), strings.Join(expected, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeSchemaAPI keeps table descriptions in memory. New tables and indexes
+// report CREATING on the first describe so the migrator has to wait for them.
+type fakeSchemaAPI struct {
+	mu       sync.Mutex
+	tables   map[string]*types.TableDescription
+	creating map[string]bool
+	ttl      map[string]string
+	items    map[string][]map[string]types.AttributeValue
+}
+
+func newFakeSchemaAPI() *fakeSchemaAPI {
+	return &fakeSchemaAPI{
+		tables:   make(map[string]*types.TableDescription),
+		creating: make(map[string]bool),
+		ttl:      make(map[string]string),
+		items:    make(map[string][]map[string]types.AttributeValue),
+	}
+}
+
+func (f *fakeSchemaAPI) CreateTable(ctx context.Context, in *dynamodb.CreateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.ToString(in.TableName)
+	if _, ok := f.tables[name]; ok {
+		return nil, &types.ResourceInUseException{}
+	}
+	f.tables[name] = &types.TableDescription{
+		TableName:   in.TableName,
+		KeySchema:   in.KeySchema,
+		TableStatus: types.TableStatusCreating,
+	}
+	f.creating[name] = true
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (f *fakeSchemaAPI) DescribeTable(ctx context.Context, in *dynamodb.DescribeTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.ToString(in.TableName)
+	table, ok := f.tables[name]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{}
+	}
+	described := *table
+	described.GlobalSecondaryIndexes = append([]types.GlobalSecondaryIndexDescription(nil), table.GlobalSecondaryIndexes...)
+
+	// Everything finishes creating after it has been seen once
+	if f.creating[name] {
+		f.creating[name] = false
+		table.TableStatus = types.TableStatusActive
+		for i := range table.GlobalSecondaryIndexes {
+			table.GlobalSecondaryIndexes[i].IndexStatus = types.IndexStatusActive
+		}
+	}
+	return &dynamodb.DescribeTableOutput{Table: &described}, nil
+}
+
+func (f *fakeSchemaAPI) UpdateTable(ctx context.Context, in *dynamodb.UpdateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateTableOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.ToString(in.TableName)
+	table := f.tables[name]
+	for _, update := range in.GlobalSecondaryIndexUpdates {
+		table.GlobalSecondaryIndexes = append(table.GlobalSecondaryIndexes, types.GlobalSecondaryIndexDescription{
+			IndexName:   update.Create.IndexName,
+			KeySchema:   update.Create.KeySchema,
+			IndexStatus: types.IndexStatusCreating,
+		})
+	}
+	f.creating[name] = true
+	return &dynamodb.UpdateTableOutput{}, nil
+}
+
+func (f *fakeSchemaAPI) DescribeTimeToLive(ctx context.Context, in *dynamodb.DescribeTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	description := &types.TimeToLiveDescription{TimeToLiveStatus: types.TimeToLiveStatusDisabled}
+	if attribute, ok := f.ttl[aws.ToString(in.TableName)]; ok {
+		description = &types.TimeToLiveDescription{
+			AttributeName:    aws.String(attribute),
+			TimeToLiveStatus: types.TimeToLiveStatusEnabled,
+		}
+	}
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: description}, nil
+}
+
+func (f *fakeSchemaAPI) UpdateTimeToLive(ctx context.Context, in *dynamodb.UpdateTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.ttl[aws.ToString(in.TableName)] = aws.ToString(in.TimeToLiveSpecification.AttributeName)
+	return &dynamodb.UpdateTimeToLiveOutput{}, nil
+}
+
+func (f *fakeSchemaAPI) PutItem(ctx context.Context, in *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	name := aws.ToString(in.TableName)
+	f.items[name] = append(f.items[name], in.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeSchemaAPI) Scan(ctx context.Context, in *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return &dynamodb.ScanOutput{Items: f.items[aws.ToString(in.TableName)]}, nil
+}
+
+// indexNames returns the GSI names of a table
+func (f *fakeSchemaAPI) indexNames(table string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	names := make([]string, 0)
+	for _, index := range f.tables[table].GlobalSecondaryIndexes {
+		names = append(names, aws.ToString(index.IndexName))
+	}
+	return names
+}
+
+var testTableNames = TableNames{
+	MCPServers:        "McpServers",
+	Deployments:       "Deployments",
+	GitHubConnections: "GitHubConnections",
+	GitHubOAuthStates: "GitHubOAuthStates",
+	BuildJobs:         "BuildJobs",
+}
+
+func newTestMigrator(api schemaAPI) *Migrator {
+	return &Migrator{
+		api:             api,
+		names:           testTableNames,
+		migrationsTable: "SchemaMigrations",
+		migrations:      Migrations,
+		waitTimeout:     migrationWaitTimeout,
+	}
+}
+
+func TestMigrator_CreatesSchemaOnce(t *testing.T) {
+	api := newFakeSchemaAPI()
+	migrator := newTestMigrator(api)
+	ctx := context.Background()
+
+	applied, err := migrator.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if len(applied) != SchemaVersion || applied[len(applied)-1].Version != SchemaVersion {
+		t.Fatalf("Expected migrations 1 to %d, got %d", SchemaVersion, len(applied))
+	}
+
+	for _, name := range []string{"McpServers", "Deployments", "GitHubConnections", "GitHubOAuthStates", "BuildJobs", "SchemaMigrations"} {
+		if _, ok := api.tables[name]; !ok {
+			t.Errorf("Expected table %s to be created", name)
+		}
+	}
+	if got := strings.Join(api.indexNames("McpServers"), ","); got != MCPUserIdIndex+","+MCPRepositoryKeyIndex {
+		t.Errorf("Unexpected McpServers indexes: %s", got)
+	}
+	if got := strings.Join(api.indexNames("Deployments"), ","); got != DeploymentUserIdIndex+","+DeploymentServerIdIndex {
+		t.Errorf("Unexpected Deployments indexes: %s", got)
+	}
+	if got := strings.Join(api.indexNames("BuildJobs"), ","); got != JobStatusIndex {
+		t.Errorf("Unexpected BuildJobs indexes: %s", got)
+	}
+	if api.ttl["BuildJobs"] != "ExpiresAt" || api.ttl["GitHubOAuthStates"] != "ExpiresAt" {
+		t.Errorf("Expected TTL on ExpiresAt, got %v", api.ttl)
+	}
+
+	records, err := migrator.Applied(ctx)
+	if err != nil || len(records) != SchemaVersion {
+		t.Fatalf("Expected %d recorded migrations, got %d (%v)", SchemaVersion, len(records), err)
+	}
+
+	again, err := migrator.Migrate(ctx)
+	if err != nil || len(again) != 0 {
+		t.Errorf("Expected a second run to apply nothing, got %d migrations (%v)", len(again), err)
+	}
+}
+
+func TestMigrator_UpdatesExistingTables(t *testing.T) {
+	api := newFakeSchemaAPI()
+	ctx := context.Background()
+
+	// A Deployments table created by hand, with one of its indexes
+	api.tables["Deployments"] = &types.TableDescription{
+		TableName:   aws.String("Deployments"),
+		TableStatus: types.TableStatusActive,
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("ServerId"), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String("DeploymentId"), KeyType: types.KeyTypeRange},
+		},
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndexDescription{{
+			IndexName:   aws.String(DeploymentUserIdIndex),
+			IndexStatus: types.IndexStatusActive,
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("UserId"), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String("CreatedAt"), KeyType: types.KeyTypeRange},
+			},
+		}},
+	}
+
+	if _, err := newTestMigrator(api).Migrate(ctx); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if got := strings.Join(api.indexNames("Deployments"), ","); got != DeploymentUserIdIndex+","+DeploymentServerIdIndex {
+		t.Errorf("Expected the missing index to be added, got %s", got)
+	}
+}
+
+func TestMigrator_RejectsMismatchedKeys(t *testing.T) {
+	api := newFakeSchemaAPI()
+	ctx := context.Background()
+
+	api.tables["McpServers"] = &types.TableDescription{
+		TableName:   aws.String("McpServers"),
+		TableStatus: types.TableStatusActive,
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String("Id"), KeyType: types.KeyTypeHash},
+		},
+	}
+
+	migrator := newTestMigrator(api)
+	if _, err := migrator.Migrate(ctx); err == nil || !strings.Contains(err.Error(), "McpServers has key") {
+		t.Fatalf("Expected a key mismatch error, got %v", err)
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil || len(pending) != SchemaVersion {
+		t.Errorf("Expected the failed migration to stay pending, got %d pending (%v)", len(pending), err)
+	}
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+const (
+	// DefaultPageLimit is the page size used when a request does not set one
+	DefaultPageLimit = 100
+
+	// MaxPageLimit caps the page size of every listing
+	MaxPageLimit = 1000
+)
+
+// ErrInvalidCursor is returned for a cursor that was not produced by the same listing
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// cursorValue is a key attribute stored in a cursor. Key attributes are
+// always strings or numbers.
+type cursorValue struct {
+	S *string `json:"s,omitempty"`
+	N *string `json:"n,omitempty"`
+}
+
+// listing describes a paginated query or scan
+type listing struct {
+	// keys are the attributes that identify a position in the listing: the
+	// table key plus the key of the index being queried
+	keys []string
+
+	// partition is the partition key and value being queried; a cursor from
+	// another partition is rejected. Empty for a scan.
+	partition map[string]string
+
+	// fetch reads one page starting after startKey and returns its items and
+	// LastEvaluatedKey
+	fetch func(ctx context.Context, startKey map[string]types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error)
+}
+
+// collect reads pages until it has page.Limit items or the listing ends. A
+// filter expression can make DynamoDB return short or empty pages, so several
+// requests may be needed. The returned cursor is empty on the last page; it
+// points at the last item returned rather than at DynamoDB's LastEvaluatedKey,
+// so items read past the limit are not skipped.
+func (l listing) collect(ctx context.Context, page models.PageRequest) ([]map[string]types.AttributeValue, string, error) {
+	limit := page.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	limit = min(limit, MaxPageLimit)
+
+	startKey, err := l.decodeCursor(page.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	collected := make([]map[string]types.AttributeValue, 0, limit)
+	for {
+		items, lastKey, err := l.fetch(ctx, startKey, int32(limit))
+		if err != nil {
+			return nil, "", err
+		}
+
+		for i, item := range items {
+			collected = append(collected, item)
+			if len(collected) < limit {
+				continue
+			}
+			if i == len(items)-1 && lastKey == nil {
+				return collected, "", nil
+			}
+			cursor, err := l.encodeCursor(item)
+			if err != nil {
+				return nil, "", err
+			}
+			return collected, cursor, nil
+		}
+
+		if lastKey == nil {
+			return collected, "", nil
+		}
+		startKey = lastKey
+	}
+}
+
+// encodeCursor turns the position of item into an opaque token
+func (l listing) encodeCursor(item map[string]types.AttributeValue) (string, error) {
+	position := make(map[string]cursorValue, len(l.keys))
+	for _, name := range l.keys {
+		switch v := item[name].(type) {
+		case *types.AttributeValueMemberS:
+			position[name] = cursorValue{S: &v.Value}
+		case *types.AttributeValueMemberN:
+			position[name] = cursorValue{N: &v.Value}
+		default:
+			return "", fmt.Errorf("cannot build cursor: key attribute %s is missing or not a string or number", name)
+		}
+	}
+
+	data, err := json.Marshal(position)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor turns a token from encodeCursor back into an ExclusiveStartKey.
+// An empty cursor starts at the beginning and returns nil.
+func (l listing) decodeCursor(cursor string) (map[string]types.AttributeValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var position map[string]cursorValue
+	if err := json.Unmarshal(data, &position); err != nil || len(position) != len(l.keys) {
+		return nil, ErrInvalidCursor
+	}
+
+	startKey := make(map[string]types.AttributeValue, len(position))
+	for _, name := range l.keys {
+		value, ok := position[name]
+		switch {
+		case ok && value.S != nil && value.N == nil:
+			startKey[name] = &types.AttributeValueMemberS{Value: *value.S}
+		case ok && value.N != nil && value.S == nil:
+			startKey[name] = &types.AttributeValueMemberN{Value: *value.N}
+		default:
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	// A cursor must not move a query into another user's or server's partition
+	for name, expected := range l.partition {
+		if s, ok := startKey[name].(*types.AttributeValueMemberS); !ok || s.Value != expected {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return startKey, nil
+}
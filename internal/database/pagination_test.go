@@ -0,0 +1,155 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// fakeIndex serves a sorted partition the way a DynamoDB query does: at most
+// limit items are evaluated per request, and the filter may drop some of them
+type fakeIndex struct {
+	items    []map[string]types.AttributeValue
+	keep     func(i int) bool
+	requests int
+}
+
+func newFakeIndex(userId string, n int) *fakeIndex {
+	index := &fakeIndex{keep: func(int) bool { return true }}
+	for i := 0; i < n; i++ {
+		index.items = append(index.items, map[string]types.AttributeValue{
+			"ServerId":  &types.AttributeValueMemberS{Value: fmt.Sprintf("server-%02d", i)},
+			"UserId":    &types.AttributeValueMemberS{Value: userId},
+			"CreatedAt": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", 1000+i)},
+		})
+	}
+	return index
+}
+
+func (f *fakeIndex) listing(userId string) listing {
+	return listing{
+		keys:      []string{"ServerId", "UserId", "CreatedAt"},
+		partition: map[string]string{"UserId": userId},
+		fetch: func(ctx context.Context, startKey map[string]types.AttributeValue, limit int32) ([]map[string]types.AttributeValue, map[string]types.AttributeValue, error) {
+			f.requests++
+			start := 0
+			if startKey != nil {
+				id := startKey["ServerId"].(*types.AttributeValueMemberS).Value
+				for i, item := range f.items {
+					if item["ServerId"].(*types.AttributeValueMemberS).Value == id {
+						start = i + 1
+					}
+				}
+			}
+
+			end := min(start+int(limit), len(f.items))
+			var page []map[string]types.AttributeValue
+			for i := start; i < end; i++ {
+				if f.keep(i) {
+					page = append(page, f.items[i])
+				}
+			}
+			var lastKey map[string]types.AttributeValue
+			if end < len(f.items) {
+				lastKey = f.items[end-1]
+			}
+			return page, lastKey, nil
+		},
+	}
+}
+
+func serverIds(items []map[string]types.AttributeValue) []string {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item["ServerId"].(*types.AttributeValueMemberS).Value)
+	}
+	return ids
+}
+
+func TestListing_PagesThroughFilteredResults(t *testing.T) {
+	index := newFakeIndex("user-1", 20)
+	// Keep every third item, so most DynamoDB pages come back short
+	index.keep = func(i int) bool { return i%3 == 0 }
+	l := index.listing("user-1")
+
+	var all []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("Listing did not end")
+		}
+		items, next, err := l.collect(context.Background(), models.PageRequest{Limit: 3, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("collect failed: %v", err)
+		}
+		if len(items) > 3 {
+			t.Fatalf("Expected at most 3 items per page, got %d", len(items))
+		}
+		all = append(all, serverIds(items)...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	expected := []string{"server-00", "server-03", "server-06", "server-09", "server-12", "server-15", "server-18"}
+	if fmt.Sprint(all) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, all)
+	}
+}
+
+func TestListing_LastPageHasNoCursor(t *testing.T) {
+	index := newFakeIndex("user-1", 4)
+	items, next, err := index.listing("user-1").collect(context.Background(), models.PageRequest{Limit: 4})
+	if err != nil {
+		t.Fatalf("collect failed: %v", err)
+	}
+	if len(items) != 4 || next != "" {
+		t.Errorf("Expected 4 items and no cursor, got %d items and cursor %q", len(items), next)
+	}
+}
+
+func TestListing_RejectsForeignCursors(t *testing.T) {
+	index := newFakeIndex("user-1", 10)
+	_, cursor, err := index.listing("user-1").collect(context.Background(), models.PageRequest{Limit: 2})
+	if err != nil || cursor == "" {
+		t.Fatalf("Expected a cursor, got %q (%v)", cursor, err)
+	}
+
+	for name, bad := range map[string]string{
+		"other user": cursor,
+		"garbage":    "not a cursor",
+		"empty json": "e30",
+	} {
+		l := index.listing("user-1")
+		if name == "other user" {
+			l = index.listing("user-2")
+		}
+		if _, _, err := l.collect(context.Background(), models.PageRequest{Cursor: bad}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", name, err)
+		}
+	}
+}
+
+func TestCreatedAtRange(t *testing.T) {
+	day := time.Date(2024, 11, 11, 0, 0, 0, 0, time.UTC)
+
+	from, to, ok := CreatedAtRange(models.DeploymentFilter{CreatedAfter: day, CreatedBefore: day.AddDate(0, 0, 1)})
+	if !ok || from != day.Unix() || to != day.Unix()+86399 {
+		t.Errorf("Expected [%d, %d], got [%d, %d] (ok=%v)", day.Unix(), day.Unix()+86399, from, to, ok)
+	}
+
+	from, _, _ = CreatedAtRange(models.DeploymentFilter{CreatedAfter: day.Add(500 * time.Millisecond)})
+	if from != day.Unix()+1 {
+		t.Errorf("Expected a fractional start to round up to %d, got %d", day.Unix()+1, from)
+	}
+
+	if _, _, ok := CreatedAtRange(models.DeploymentFilter{Status: models.DeploymentStatusQueued}); ok {
+		t.Error("Expected no range for a filter without dates")
+	}
+}
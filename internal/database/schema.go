@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SchemaVersion is the version of the newest migration. The migrate command
+// brings the tables up to this version.
+const SchemaVersion = 4
+
+// JobStatusIndex is the GSI on the build jobs table keyed by Status and EnqueuedAt
+const JobStatusIndex = "StatusIndex"
+
+// TableNames holds the configured name of every table the server uses
+type TableNames struct {
+	MCPServers        string
+	Deployments       string
+	GitHubConnections string
+	GitHubOAuthStates string
+	BuildJobs         string
+}
+
+// table identifies one of the tables in TableNames
+type table int
+
+const (
+	mcpServersTable table = iota
+	deploymentsTable
+	githubConnectionsTable
+	githubOAuthStatesTable
+	buildJobsTable
+)
+
+// name returns the configured name of t
+func (n TableNames) name(t table) string {
+	switch t {
+	case mcpServersTable:
+		return n.MCPServers
+	case deploymentsTable:
+		return n.Deployments
+	case githubConnectionsTable:
+		return n.GitHubConnections
+	case githubOAuthStatesTable:
+		return n.GitHubOAuthStates
+	default:
+		return n.BuildJobs
+	}
+}
+
+// Migration is one version of the schema. Its steps only create what is
+// missing, so a migration also brings tables that were set up by hand in
+// line, and can safely be run again after a partial failure.
+type Migration struct {
+	Version     int
+	Description string
+	Steps       []MigrationStep
+}
+
+// MigrationStep is a single schema change within a migration
+type MigrationStep interface {
+	// Describe returns a one-line summary of the step for the given table names
+	Describe(names TableNames) string
+
+	apply(ctx context.Context, m *Migrator) error
+}
+
+// createTableStep creates a table with its primary key
+type createTableStep struct {
+	table        table
+	partitionKey KeyAttribute
+	sortKey      *KeyAttribute
+}
+
+// addIndexStep adds a global secondary index to a table
+type addIndexStep struct {
+	table table
+	index IndexDefinition
+}
+
+// enableTTLStep turns on time to live for a table
+type enableTTLStep struct {
+	table     table
+	attribute string
+}
+
+// Migrations lists every schema version in order. Released migrations must
+// not be changed; add a new one instead.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Create tables",
+		Steps: []MigrationStep{
+			createTableStep{
+				table:        mcpServersTable,
+				partitionKey: KeyAttribute{Name: "ServerId", Type: types.ScalarAttributeTypeS},
+			},
+			createTableStep{
+				table:        deploymentsTable,
+				partitionKey: KeyAttribute{Name: "ServerId", Type: types.ScalarAttributeTypeS},
+				sortKey:      &KeyAttribute{Name: "DeploymentId", Type: types.ScalarAttributeTypeS},
+			},
+			createTableStep{
+				table:        githubConnectionsTable,
+				partitionKey: KeyAttribute{Name: "Id", Type: types.ScalarAttributeTypeS},
+			},
+			createTableStep{
+				table:        githubOAuthStatesTable,
+				partitionKey: KeyAttribute{Name: "Id", Type: types.ScalarAttributeTypeS},
+			},
+			createTableStep{
+				table:        buildJobsTable,
+				partitionKey: KeyAttribute{Name: "JobId", Type: types.ScalarAttributeTypeS},
+			},
+			addIndexStep{
+				table: buildJobsTable,
+				index: IndexDefinition{
+					Name:         JobStatusIndex,
+					PartitionKey: KeyAttribute{Name: "Status", Type: types.ScalarAttributeTypeS},
+					SortKey:      &KeyAttribute{Name: "EnqueuedAt", Type: types.ScalarAttributeTypeN},
+				},
+			},
+		},
+	},
+	{
+		Version:     2,
+		Description: "Add UserId and ServerId query indexes",
+		Steps: []MigrationStep{
+			addIndexStep{table: mcpServersTable, index: MCPServerIndexes[0]},
+			addIndexStep{table: deploymentsTable, index: DeploymentIndexes[0]},
+			addIndexStep{table: deploymentsTable, index: DeploymentIndexes[1]},
+			addIndexStep{table: githubConnectionsTable, index: GitHubConnectionIndexes[0]},
+		},
+	},
+	{
+		Version:     3,
+		Description: "Expire OAuth states and finished build jobs",
+		Steps: []MigrationStep{
+			enableTTLStep{table: githubOAuthStatesTable, attribute: "ExpiresAt"},
+			enableTTLStep{table: buildJobsTable, attribute: "ExpiresAt"},
+		},
+	},
+	{
+		Version:     4,
+		Description: "Add repository key index for GitHub webhooks",
+		Steps: []MigrationStep{
+			addIndexStep{table: mcpServersTable, index: MCPServerIndexes[1]},
+		},
+	},
+}
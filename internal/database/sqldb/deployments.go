@@ -0,0 +1,315 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/database"
+	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+const deploymentColumns = `server_id, deployment_id, user_id, branch, commit_hash, status,
+	stages, logs, log_ref, image_uri, image_digest_uri, image, manifest, server_json, version, created_at, updated_at`
+
+// Deployments handles deployment rows
+type Deployments struct {
+	db *DB
+}
+
+// NewDeployments creates deployment operations on db
+func NewDeployments(db *DB) *Deployments {
+	return &Deployments{db: db}
+}
+
+// CreateDeployment inserts a new deployment at version 0. Returns
+// database.ErrAlreadyExists if the deployment ID is taken for its server.
+func (do *Deployments) CreateDeployment(ctx context.Context, deployment *models.Deployment) error {
+	stages, logs, logRef, image, manifest, serverJSON, err := marshalDeploymentFields(deployment)
+	if err != nil {
+		return err
+	}
+
+	result, err := do.db.ExecContext(ctx, `INSERT INTO deployments (`+deploymentColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, 0, $15, $16)
+		ON CONFLICT (server_id, deployment_id) DO NOTHING`,
+		deployment.ServerId, deployment.DeploymentId, deployment.UserId, deployment.Branch,
+		deployment.CommitHash, string(deployment.Status), stages, logs, logRef, deployment.ImageURI,
+		deployment.ImageDigestURI, image, manifest, serverJSON, deployment.CreatedAt.Unix(), deployment.UpdatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return database.ErrAlreadyExists
+	}
+	deployment.Version = 0
+
+	return nil
+}
+
+// GetDeployment retrieves a deployment by server ID and deployment ID
+func (do *Deployments) GetDeployment(ctx context.Context, serverId, deploymentId string) (*models.Deployment, error) {
+	row := do.db.QueryRowContext(ctx, `SELECT `+deploymentColumns+` FROM deployments
+		WHERE server_id = $1 AND deployment_id = $2`, serverId, deploymentId)
+	deployment, err := scanDeployment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.WithFields(map[string]interface{}{
+			"server_id":     serverId,
+			"deployment_id": deploymentId,
+		}).Warn("Deployment not found")
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+	return deployment, nil
+}
+
+// GetDeploymentsByUserId returns one page of a user's deployments matching
+// filter, newest first
+func (do *Deployments) GetDeploymentsByUserId(ctx context.Context, userId string, filter models.DeploymentFilter, page models.PageRequest) ([]*models.Deployment, string, error) {
+	return do.queryDeployments(ctx, userId, "", filter, page)
+}
+
+// GetDeploymentsByUserIdAndServerId returns one page of a user's deployments
+// of one MCP server matching filter, newest first
+func (do *Deployments) GetDeploymentsByUserIdAndServerId(ctx context.Context, userId, serverId string, filter models.DeploymentFilter, page models.PageRequest) ([]*models.Deployment, string, error) {
+	return do.queryDeployments(ctx, userId, serverId, filter, page)
+}
+
+// queryDeployments lists a user's deployments, restricted to one server
+// unless serverId is empty
+func (do *Deployments) queryDeployments(ctx context.Context, userId, serverId string, filter models.DeploymentFilter, page models.PageRequest) ([]*models.Deployment, string, error) {
+	partition := userId + "/" + serverId
+	after, err := decodeCursor(page.Cursor, partition)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var q query
+	q.where("user_id = " + q.arg(userId))
+	if serverId != "" {
+		q.where("server_id = " + q.arg(serverId))
+	}
+	if filter.Status != "" {
+		q.where("status = " + q.arg(string(filter.Status)))
+	}
+	if filter.Branch != "" {
+		q.where("branch = " + q.arg(filter.Branch))
+	}
+	if from, to, ok := database.CreatedAtRange(filter); ok {
+		q.where(fmt.Sprintf("created_at BETWEEN %s AND %s", q.arg(from), q.arg(to)))
+	}
+	if after != nil {
+		q.where(fmt.Sprintf("(created_at, server_id, deployment_id) < (%s, %s, %s)",
+			q.arg(after.CreatedAt), q.arg(after.ServerId), q.arg(after.DeploymentId)))
+	}
+	limit := pageLimit(page)
+	statement := q.build(`SELECT `+deploymentColumns+` FROM deployments`,
+		"ORDER BY created_at DESC, server_id DESC, deployment_id DESC LIMIT "+q.arg(limit+1))
+
+	rows, err := do.db.QueryContext(ctx, statement, q.args...)
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"user_id":   userId,
+			"server_id": serverId,
+			"error":     err.Error(),
+		}).Error("Failed to list deployments")
+		return nil, "", fmt.Errorf("failed to list deployments: %w", err)
+	}
+	defer rows.Close()
+
+	deployments := make([]*models.Deployment, 0)
+	for rows.Next() {
+		deployment, err := scanDeployment(rows)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read deployment: %w", err)
+		}
+		deployments = append(deployments, deployment)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to list deployments: %w", err)
+	}
+
+	if len(deployments) <= limit {
+		return deployments, "", nil
+	}
+	deployments = deployments[:limit]
+	last := deployments[limit-1]
+	return deployments, encodeCursor(position{
+		Partition:    partition,
+		CreatedAt:    last.CreatedAt.Unix(),
+		ServerId:     last.ServerId,
+		DeploymentId: last.DeploymentId,
+	}), nil
+}
+
+// UpdateDeployment updates a deployment with all fields including stages and logs.
+// The write only succeeds while the stored status is still expected and the
+// stored version still equals deployment.Version. A changed status returns
+// database.ErrStatusConflict, any other concurrent write a *database.ConflictError.
+// On success deployment.Version is incremented.
+func (do *Deployments) UpdateDeployment(ctx context.Context, deployment *models.Deployment, expected models.DeploymentStatus) error {
+	stages, logs, logRef, image, manifest, serverJSON, err := marshalDeploymentFields(deployment)
+	if err != nil {
+		return err
+	}
+
+	result, err := do.db.ExecContext(ctx, `UPDATE deployments SET
+		status = $1, stages = $2, logs = $3, log_ref = $4, image_uri = $5, image_digest_uri = $6,
+		image = $7, manifest = $8, server_json = $9, updated_at = $10, version = version + 1
+		WHERE server_id = $11 AND deployment_id = $12 AND status = $13 AND version = $14`,
+		string(deployment.Status), stages, logs, logRef, deployment.ImageURI, deployment.ImageDigestURI,
+		image, manifest, serverJSON, deployment.UpdatedAt.Unix(), deployment.ServerId, deployment.DeploymentId, string(expected), deployment.Version,
+	)
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"server_id":     deployment.ServerId,
+			"deployment_id": deployment.DeploymentId,
+			"error":         err.Error(),
+		}).Error("Failed to update deployment")
+		return fmt.Errorf("failed to update deployment: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update deployment: %w", err)
+	}
+	if updated == 0 {
+		logger.WithFields(map[string]interface{}{
+			"server_id":        deployment.ServerId,
+			"deployment_id":    deployment.DeploymentId,
+			"status":           deployment.Status,
+			"expected_status":  expected,
+			"expected_version": deployment.Version,
+		}).Warn("Deployment update rejected: deployment missing or modified concurrently")
+		return do.conflictError(ctx, deployment, expected)
+	}
+	deployment.Version++
+
+	return nil
+}
+
+// conflictError tells a missing deployment, a changed status and a newer
+// version apart after an update matched no row
+func (do *Deployments) conflictError(ctx context.Context, deployment *models.Deployment, expected models.DeploymentStatus) error {
+	var status string
+	var version int64
+	err := do.db.QueryRowContext(ctx, `SELECT status, version FROM deployments
+		WHERE server_id = $1 AND deployment_id = $2`, deployment.ServerId, deployment.DeploymentId).Scan(&status, &version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read deployment version: %w", err)
+	}
+	if models.DeploymentStatus(status) != expected {
+		return database.ErrStatusConflict
+	}
+	return &database.ConflictError{
+		Key:             deployment.ServerId + "/" + deployment.DeploymentId,
+		ExpectedVersion: deployment.Version,
+		ActualVersion:   version,
+	}
+}
+
+// marshalDeploymentFields encodes the JSON columns of a deployment. logRef,
+// image, manifest and serverJSON are nil when the deployment has none.
+func marshalDeploymentFields(deployment *models.Deployment) (stages, logs string, logRef, image, manifest, serverJSON *string, err error) {
+	stagesJSON, err := json.Marshal(deployment.Stages)
+	if err != nil {
+		return "", "", nil, nil, nil, nil, fmt.Errorf("failed to marshal stages: %w", err)
+	}
+	logsJSON, err := json.Marshal(deployment.BuildLogs)
+	if err != nil {
+		return "", "", nil, nil, nil, nil, fmt.Errorf("failed to marshal logs: %w", err)
+	}
+	if deployment.LogRef != nil {
+		if logRef, err = marshalNullable(deployment.LogRef); err != nil {
+			return "", "", nil, nil, nil, nil, fmt.Errorf("failed to marshal log reference: %w", err)
+		}
+	}
+	if deployment.Image != nil {
+		if image, err = marshalNullable(deployment.Image); err != nil {
+			return "", "", nil, nil, nil, nil, fmt.Errorf("failed to marshal image metadata: %w", err)
+		}
+	}
+	if deployment.Manifest != nil {
+		if manifest, err = marshalNullable(deployment.Manifest); err != nil {
+			return "", "", nil, nil, nil, nil, fmt.Errorf("failed to marshal manifest: %w", err)
+		}
+	}
+	if deployment.ServerJSON != nil {
+		if serverJSON, err = marshalNullable(deployment.ServerJSON); err != nil {
+			return "", "", nil, nil, nil, nil, fmt.Errorf("failed to marshal server.json: %w", err)
+		}
+	}
+	return string(stagesJSON), string(logsJSON), logRef, image, manifest, serverJSON, nil
+}
+
+// marshalNullable encodes v for a nullable JSON column
+func marshalNullable(v interface{}) (*string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	encoded := string(data)
+	return &encoded, nil
+}
+
+// scanDeployment reads a row of deploymentColumns
+func scanDeployment(row rowScanner) (*models.Deployment, error) {
+	var deployment models.Deployment
+	var status, stages, logs string
+	var logRef, image, manifest, serverJSON sql.NullString
+	var createdAt, updatedAt int64
+	err := row.Scan(
+		&deployment.ServerId, &deployment.DeploymentId, &deployment.UserId, &deployment.Branch,
+		&deployment.CommitHash, &status, &stages, &logs, &logRef, &deployment.ImageURI,
+		&deployment.ImageDigestURI, &image, &manifest, &serverJSON, &deployment.Version, &createdAt, &updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	deployment.Status = models.DeploymentStatus(status)
+	if err := json.Unmarshal([]byte(stages), &deployment.Stages); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal stages: %w", err)
+	}
+	if err := json.Unmarshal([]byte(logs), &deployment.BuildLogs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal logs: %w", err)
+	}
+	if logRef.Valid {
+		deployment.LogRef = &models.LogReference{}
+		if err := json.Unmarshal([]byte(logRef.String), deployment.LogRef); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal log reference: %w", err)
+		}
+	}
+	if image.Valid {
+		deployment.Image = &models.ImageMetadata{}
+		if err := json.Unmarshal([]byte(image.String), deployment.Image); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal image metadata: %w", err)
+		}
+	}
+	if manifest.Valid {
+		deployment.Manifest = &models.MCPManifest{}
+		if err := json.Unmarshal([]byte(manifest.String), deployment.Manifest); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal manifest: %w", err)
+		}
+	}
+	if serverJSON.Valid {
+		deployment.ServerJSON = &models.RegistryServer{}
+		if err := json.Unmarshal([]byte(serverJSON.String), deployment.ServerJSON); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal server.json: %w", err)
+		}
+	}
+	deployment.CreatedAt = time.Unix(createdAt, 0)
+	deployment.UpdatedAt = time.Unix(updatedAt, 0)
+
+	return &deployment, nil
+}
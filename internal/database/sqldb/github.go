@@ -0,0 +1,93 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/database"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// GitHub handles GitHub connection and OAuth state rows
+type GitHub struct {
+	db *DB
+}
+
+// NewGitHub creates GitHub operations on db
+func NewGitHub(db *DB) *GitHub {
+	return &GitHub{db: db}
+}
+
+// CreateGitHubConnection stores a user's GitHub connection. Returns
+// database.ErrGitHubConnectionAlreadyExists if the user is already connected.
+func (g *GitHub) CreateGitHubConnection(ctx context.Context, connection *models.GitHubConnection) error {
+	userData, err := json.Marshal(connection.GitHubUserData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal github user data: %w", err)
+	}
+
+	result, err := g.db.ExecContext(ctx, `INSERT INTO github_connections
+		(id, user_id, github_user_id, github_username, access_token, github_user_data, connected_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT DO NOTHING`,
+		connection.Id, connection.UserId, connection.GitHubUserId, connection.GitHubUsername,
+		connection.AccessToken, string(userData), connection.ConnectedAt.Unix(), connection.UpdatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create github connection: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return database.ErrGitHubConnectionAlreadyExists
+	}
+	return nil
+}
+
+// GetGitHubConnectionByUserId retrieves a user's GitHub connection
+func (g *GitHub) GetGitHubConnectionByUserId(ctx context.Context, userId string) (*models.GitHubConnection, error) {
+	var connection models.GitHubConnection
+	var userData string
+	var connectedAt, updatedAt int64
+	err := g.db.QueryRowContext(ctx, `SELECT id, user_id, github_user_id, github_username, access_token,
+		github_user_data, connected_at, updated_at FROM github_connections WHERE user_id = $1`, userId).Scan(
+		&connection.Id, &connection.UserId, &connection.GitHubUserId, &connection.GitHubUsername,
+		&connection.AccessToken, &userData, &connectedAt, &updatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, database.ErrGitHubConnectionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query github connection: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(userData), &connection.GitHubUserData); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal github user data: %w", err)
+	}
+	connection.ConnectedAt = time.Unix(connectedAt, 0)
+	connection.UpdatedAt = time.Unix(updatedAt, 0)
+
+	return &connection, nil
+}
+
+// GetOAuthState retrieves an OAuth state by state token
+func (g *GitHub) GetOAuthState(ctx context.Context, stateToken string) (*models.OAuthState, error) {
+	var state models.OAuthState
+	var createdAt, expiresAt int64
+	err := g.db.QueryRowContext(ctx, `SELECT id, user_id, state_token, created_at, expires_at
+		FROM github_oauth_states WHERE state_token = $1`, stateToken).Scan(
+		&state.Id, &state.UserId, &state.StateToken, &createdAt, &expiresAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, database.ErrOAuthStateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query oauth state: %w", err)
+	}
+
+	state.CreatedAt = time.Unix(createdAt, 0)
+	state.ExpiresAt = time.Unix(expiresAt, 0)
+	return &state, nil
+}
@@ -0,0 +1,283 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/database"
+	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+const mcpColumns = `server_id, user_id, name, description, repository, status, envs,
+	ecr_repository_name, ecr_repository_uri, registry, builder, webhook_secret, auto_build_branches,
+	version, created_at, updated_at`
+
+// mcpInsertColumns are mcpColumns plus the columns that are only written
+const mcpInsertColumns = mcpColumns + `, repository_key`
+
+// MCPServers handles MCP server rows
+type MCPServers struct {
+	db *DB
+}
+
+// NewMCPServers creates MCP server operations on db
+func NewMCPServers(db *DB) *MCPServers {
+	return &MCPServers{db: db}
+}
+
+// CreateMCP inserts a new MCP server at version 0. Returns
+// database.ErrAlreadyExists if the server ID is taken.
+func (ms *MCPServers) CreateMCP(ctx context.Context, server *models.MCPServer) error {
+	envs, err := json.Marshal(server.EnvironmentVariables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal environment variables: %w", err)
+	}
+	branches, err := marshalBranches(server.AutoBuildBranches)
+	if err != nil {
+		return err
+	}
+
+	result, err := ms.db.ExecContext(ctx, `INSERT INTO mcp_servers (`+mcpInsertColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, 0, $14, $15, $16)
+		ON CONFLICT (server_id) DO NOTHING`,
+		server.ServerId, server.UserId, server.Name, server.Description, server.Repository,
+		server.Status, string(envs), server.ECRRepositoryName, server.ECRRepositoryURI, server.Registry,
+		server.Builder, server.WebhookSecret, branches, server.CreatedAt.Unix(), server.UpdatedAt.Unix(),
+		repositoryKey(server),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create MCP server: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return database.ErrAlreadyExists
+	}
+	server.Version = 0
+
+	return nil
+}
+
+// GetMCP retrieves an MCP server by ID
+func (ms *MCPServers) GetMCP(ctx context.Context, serverId string) (*models.MCPServer, error) {
+	row := ms.db.QueryRowContext(ctx, `SELECT `+mcpColumns+` FROM mcp_servers WHERE server_id = $1`, serverId)
+	server, err := scanMCPServer(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		logger.WithField("server_id", serverId).Warn("MCP server not found")
+		return nil, database.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get MCP server: %w", err)
+	}
+	return server, nil
+}
+
+// GetAllMCPs returns one page of all MCP servers ordered by ID
+func (ms *MCPServers) GetAllMCPs(ctx context.Context, page models.PageRequest) ([]*models.MCPServer, string, error) {
+	after, err := decodeCursor(page.Cursor, "")
+	if err != nil {
+		return nil, "", err
+	}
+
+	var q query
+	if after != nil {
+		q.where("server_id > " + q.arg(after.ServerId))
+	}
+	limit := pageLimit(page)
+	statement := q.build(`SELECT `+mcpColumns+` FROM mcp_servers`, "ORDER BY server_id LIMIT "+q.arg(limit+1))
+
+	servers, err := ms.queryServers(ctx, statement, q.args)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(servers) <= limit {
+		return servers, "", nil
+	}
+	servers = servers[:limit]
+	return servers, encodeCursor(position{ServerId: servers[limit-1].ServerId}), nil
+}
+
+// GetMCPsByUserId returns one page of a user's MCP servers, newest first
+func (ms *MCPServers) GetMCPsByUserId(ctx context.Context, userId string, page models.PageRequest) ([]*models.MCPServer, string, error) {
+	after, err := decodeCursor(page.Cursor, userId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var q query
+	q.where("user_id = " + q.arg(userId))
+	if after != nil {
+		q.where(fmt.Sprintf("(created_at, server_id) < (%s, %s)", q.arg(after.CreatedAt), q.arg(after.ServerId)))
+	}
+	limit := pageLimit(page)
+	statement := q.build(`SELECT `+mcpColumns+` FROM mcp_servers`, "ORDER BY created_at DESC, server_id DESC LIMIT "+q.arg(limit+1))
+
+	servers, err := ms.queryServers(ctx, statement, q.args)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(servers) <= limit {
+		return servers, "", nil
+	}
+	servers = servers[:limit]
+	last := servers[limit-1]
+	return servers, encodeCursor(position{Partition: userId, CreatedAt: last.CreatedAt.Unix(), ServerId: last.ServerId}), nil
+}
+
+// GetMCPsByRepositoryKey returns one page of the servers with a webhook secret
+// that are built from a repository, ordered by ID
+func (ms *MCPServers) GetMCPsByRepositoryKey(ctx context.Context, repositoryKey string, page models.PageRequest) ([]*models.MCPServer, string, error) {
+	after, err := decodeCursor(page.Cursor, repositoryKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var q query
+	q.where("repository_key = " + q.arg(repositoryKey))
+	if after != nil {
+		q.where("server_id > " + q.arg(after.ServerId))
+	}
+	limit := pageLimit(page)
+	statement := q.build(`SELECT `+mcpColumns+` FROM mcp_servers`, "ORDER BY server_id LIMIT "+q.arg(limit+1))
+
+	servers, err := ms.queryServers(ctx, statement, q.args)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(servers) <= limit {
+		return servers, "", nil
+	}
+	servers = servers[:limit]
+	return servers, encodeCursor(position{Partition: repositoryKey, ServerId: servers[limit-1].ServerId}), nil
+}
+
+// queryServers runs a SELECT of mcpColumns
+func (ms *MCPServers) queryServers(ctx context.Context, statement string, args []interface{}) ([]*models.MCPServer, error) {
+	rows, err := ms.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list MCP servers: %w", err)
+	}
+	defer rows.Close()
+
+	servers := make([]*models.MCPServer, 0)
+	for rows.Next() {
+		server, err := scanMCPServer(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read MCP server: %w", err)
+		}
+		servers = append(servers, server)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list MCP servers: %w", err)
+	}
+	return servers, nil
+}
+
+// UpdateMCP updates an existing MCP server.
+// The write only succeeds if the stored version still equals server.Version;
+// otherwise a *database.ConflictError is returned. On success server.Version is incremented.
+func (ms *MCPServers) UpdateMCP(ctx context.Context, server *models.MCPServer) error {
+	envs, err := json.Marshal(server.EnvironmentVariables)
+	if err != nil {
+		return fmt.Errorf("failed to marshal environment variables: %w", err)
+	}
+	branches, err := marshalBranches(server.AutoBuildBranches)
+	if err != nil {
+		return err
+	}
+
+	result, err := ms.db.ExecContext(ctx, `UPDATE mcp_servers SET
+		name = $1, description = $2, repository = $3, status = $4, envs = $5,
+		ecr_repository_name = $6, ecr_repository_uri = $7, registry = $8, builder = $9, updated_at = $10,
+		webhook_secret = $11, auto_build_branches = $12, repository_key = $13, version = version + 1
+		WHERE server_id = $14 AND version = $15`,
+		server.Name, server.Description, server.Repository, server.Status, string(envs),
+		server.ECRRepositoryName, server.ECRRepositoryURI, server.Registry, server.Builder, server.UpdatedAt.Unix(),
+		server.WebhookSecret, branches, repositoryKey(server), server.ServerId, server.Version,
+	)
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"server_id": server.ServerId,
+			"error":     err.Error(),
+		}).Error("Failed to update MCP server")
+		return fmt.Errorf("failed to update MCP server: %w", err)
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update MCP server: %w", err)
+	}
+	if updated == 0 {
+		// Nothing matched: the server is gone or has a newer version
+		var stored int64
+		err := ms.db.QueryRowContext(ctx, `SELECT version FROM mcp_servers WHERE server_id = $1`, server.ServerId).Scan(&stored)
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read MCP server version: %w", err)
+		}
+		logger.WithFields(map[string]interface{}{
+			"server_id":        server.ServerId,
+			"expected_version": server.Version,
+			"stored_version":   stored,
+		}).Warn("MCP server update rejected: modified concurrently")
+		return &database.ConflictError{Key: server.ServerId, ExpectedVersion: server.Version, ActualVersion: stored}
+	}
+	server.Version++
+
+	return nil
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMCPServer reads a row of mcpColumns
+func scanMCPServer(row rowScanner) (*models.MCPServer, error) {
+	var server models.MCPServer
+	var envs, branches string
+	var createdAt, updatedAt int64
+	err := row.Scan(
+		&server.ServerId, &server.UserId, &server.Name, &server.Description, &server.Repository,
+		&server.Status, &envs, &server.ECRRepositoryName, &server.ECRRepositoryURI, &server.Registry,
+		&server.Builder, &server.WebhookSecret, &branches, &server.Version, &createdAt, &updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(envs), &server.EnvironmentVariables); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal environment variables: %w", err)
+	}
+	if err := json.Unmarshal([]byte(branches), &server.AutoBuildBranches); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal auto-build branches: %w", err)
+	}
+	server.CreatedAt = time.Unix(createdAt, 0)
+	server.UpdatedAt = time.Unix(updatedAt, 0)
+
+	return &server, nil
+}
+
+// repositoryKey returns the server's webhook repository key, NULL for a
+// server without a webhook secret
+func repositoryKey(server *models.MCPServer) sql.NullString {
+	key := server.WebhookRepositoryKey()
+	return sql.NullString{String: key, Valid: key != ""}
+}
+
+// marshalBranches encodes auto-build branch patterns as a JSON array, [] when there are none
+func marshalBranches(branches []string) (string, error) {
+	if branches == nil {
+		branches = []string{}
+	}
+	data, err := json.Marshal(branches)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal auto-build branches: %w", err)
+	}
+	return string(data), nil
+}
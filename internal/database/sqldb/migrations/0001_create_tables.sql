@@ -0,0 +1,58 @@
+-- Tables mirror the DynamoDB schema in dbschema.md. Timestamps are Unix
+-- seconds, nested values (stages, logs, envs) are JSON text.
+
+CREATE TABLE mcp_servers (
+    server_id           TEXT PRIMARY KEY,
+    user_id             TEXT NOT NULL,
+    name                TEXT NOT NULL,
+    description         TEXT NOT NULL DEFAULT '',
+    repository          TEXT NOT NULL,
+    status              TEXT NOT NULL,
+    envs                TEXT NOT NULL DEFAULT '[]',
+    ecr_repository_name TEXT NOT NULL DEFAULT '',
+    ecr_repository_uri  TEXT NOT NULL DEFAULT '',
+    version             BIGINT NOT NULL DEFAULT 0,
+    created_at          BIGINT NOT NULL,
+    updated_at          BIGINT NOT NULL
+);
+
+CREATE INDEX mcp_servers_user_id_created_at ON mcp_servers (user_id, created_at);
+
+CREATE TABLE deployments (
+    server_id     TEXT NOT NULL,
+    deployment_id TEXT NOT NULL,
+    user_id       TEXT NOT NULL,
+    branch        TEXT NOT NULL,
+    commit_hash   TEXT NOT NULL,
+    status        TEXT NOT NULL,
+    stages        TEXT NOT NULL DEFAULT '{}',
+    logs          TEXT NOT NULL DEFAULT '[]',
+    log_ref       TEXT,
+    image_uri     TEXT NOT NULL DEFAULT '',
+    version       BIGINT NOT NULL DEFAULT 0,
+    created_at    BIGINT NOT NULL,
+    updated_at    BIGINT NOT NULL,
+    PRIMARY KEY (server_id, deployment_id)
+);
+
+CREATE INDEX deployments_user_id_created_at ON deployments (user_id, created_at);
+CREATE INDEX deployments_server_id_created_at ON deployments (server_id, created_at);
+
+CREATE TABLE github_connections (
+    id               TEXT PRIMARY KEY,
+    user_id          TEXT NOT NULL UNIQUE,
+    github_user_id   BIGINT NOT NULL,
+    github_username  TEXT NOT NULL,
+    access_token     TEXT NOT NULL,
+    github_user_data TEXT NOT NULL DEFAULT '{}',
+    connected_at     BIGINT NOT NULL,
+    updated_at       BIGINT NOT NULL
+);
+
+CREATE TABLE github_oauth_states (
+    id          TEXT PRIMARY KEY,
+    state_token TEXT NOT NULL UNIQUE,
+    user_id     TEXT NOT NULL,
+    created_at  BIGINT NOT NULL,
+    expires_at  BIGINT NOT NULL
+);
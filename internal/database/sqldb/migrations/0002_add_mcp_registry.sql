@@ -0,0 +1,4 @@
+-- Registry backend chosen for an MCP server's images; empty uses the
+-- build server's default.
+
+ALTER TABLE mcp_servers ADD COLUMN registry TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- Immutable reference and metadata of the image a deployment pushed. image
+-- holds models.ImageMetadata as JSON and is NULL until the push completed.
+
+ALTER TABLE deployments ADD COLUMN image_digest_uri TEXT NOT NULL DEFAULT '';
+ALTER TABLE deployments ADD COLUMN image TEXT;
@@ -0,0 +1,4 @@
+-- Builder backend chosen for an MCP server's images; empty uses the build
+-- server's default.
+
+ALTER TABLE mcp_servers ADD COLUMN builder TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- Tools, resources and prompts an MCP server offered when its image was
+-- verified. manifest holds models.MCPManifest as JSON and is NULL for
+-- deployments that were not verified or did not complete.
+
+ALTER TABLE deployments ADD COLUMN manifest TEXT;
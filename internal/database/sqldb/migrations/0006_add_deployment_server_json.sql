@@ -0,0 +1,4 @@
+-- MCP registry server.json generated for a deployment. server_json holds
+-- models.RegistryServer as JSON and is NULL until the image was pushed.
+
+ALTER TABLE deployments ADD COLUMN server_json TEXT;
@@ -0,0 +1,6 @@
+-- GitHub push webhook settings of an MCP server. webhook_secret is encrypted
+-- like GitHub access tokens and empty when push builds are off;
+-- auto_build_branches holds the branch patterns as a JSON array.
+
+ALTER TABLE mcp_servers ADD COLUMN webhook_secret TEXT NOT NULL DEFAULT '';
+ALTER TABLE mcp_servers ADD COLUMN auto_build_branches TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,5 @@
+-- Repository a GitHub webhook is matched against, e.g. "github.com/acme/weather".
+-- Only set for servers with a webhook secret; NULL otherwise.
+
+ALTER TABLE mcp_servers ADD COLUMN repository_key TEXT;
+CREATE INDEX mcp_servers_repository_key ON mcp_servers (repository_key, server_id);
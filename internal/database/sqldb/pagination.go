@@ -0,0 +1,81 @@
+package sqldb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/imyashkale/buildserver/internal/database"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// position identifies a row in a listing ordered by created_at and key. The
+// partition (user or server ID) the listing is restricted to is part of it,
+// so a cursor cannot be replayed against another user's listing.
+type position struct {
+	Partition    string `json:"p,omitempty"`
+	CreatedAt    int64  `json:"c,omitempty"`
+	ServerId     string `json:"s"`
+	DeploymentId string `json:"d,omitempty"`
+}
+
+// pageLimit returns the number of rows to return for page
+func pageLimit(page models.PageRequest) int {
+	if page.Limit <= 0 {
+		return database.DefaultPageLimit
+	}
+	return min(page.Limit, database.MaxPageLimit)
+}
+
+// encodeCursor turns a position into an opaque token
+func encodeCursor(p position) string {
+	data, _ := json.Marshal(p)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor turns a token from encodeCursor back into a position. It
+// returns nil for an empty cursor and database.ErrInvalidCursor for one that
+// was issued for another partition.
+func decodeCursor(cursor, partition string) (*position, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, database.ErrInvalidCursor
+	}
+	var p position
+	if err := json.Unmarshal(data, &p); err != nil || p.ServerId == "" || p.Partition != partition {
+		return nil, database.ErrInvalidCursor
+	}
+	return &p, nil
+}
+
+// query builds a SQL statement with $n placeholders, which both SQLite and
+// Postgres accept. Placeholders are numbered in the order they are added.
+type query struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds a query argument and returns its placeholder
+func (q *query) arg(value interface{}) string {
+	q.args = append(q.args, value)
+	return "$" + strconv.Itoa(len(q.args))
+}
+
+// where adds a condition joined to the others with AND
+func (q *query) where(condition string) {
+	q.conditions = append(q.conditions, condition)
+}
+
+// build returns the statement: selectFrom, the conditions, then suffix
+func (q *query) build(selectFrom, suffix string) string {
+	statement := selectFrom
+	if len(q.conditions) > 0 {
+		statement += " WHERE " + strings.Join(q.conditions, " AND ")
+	}
+	return statement + " " + suffix
+}
@@ -0,0 +1,288 @@
+// Package sqldb stores MCP servers, deployments and GitHub connections in a
+// SQL database, as an alternative to DynamoDB for on-prem and local use.
+// The SQL is written to run unchanged on SQLite and Postgres.
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/logger"
+
+	// Database drivers
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// BackendSQLite stores everything in a single SQLite file
+	BackendSQLite = "sqlite"
+
+	// BackendPostgres connects to a Postgres server
+	BackendPostgres = "postgres"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// DB is a SQL database holding the build server's tables
+type DB struct {
+	*sql.DB
+	backend string
+}
+
+// Open connects to the database of the given backend. Call Migrate before
+// using the tables. For SQLite the DSN is a file path, optionally with go-sqlite3
+// query parameters; for Postgres it is a connection URL.
+func Open(ctx context.Context, backend, dsn string) (*DB, error) {
+	var driver string
+	switch backend {
+	case BackendSQLite:
+		driver = "sqlite3"
+		if err := createParentDir(dsn); err != nil {
+			return nil, err
+		}
+		dsn = sqliteDSN(dsn)
+	case BackendPostgres:
+		driver = "postgres"
+	default:
+		return nil, fmt.Errorf("unsupported SQL backend %q", backend)
+	}
+
+	conn, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s database: %w", backend, err)
+	}
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to %s database: %w", backend, err)
+	}
+
+	return &DB{DB: conn, backend: backend}, nil
+}
+
+// createParentDir creates the directory of a SQLite database file, which
+// SQLite does not do itself. URIs and in-memory databases are left alone.
+func createParentDir(dsn string) error {
+	path, _, _ := strings.Cut(dsn, "?")
+	if path == "" || path == ":memory:" || strings.HasPrefix(path, "file:") {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create database directory: %w", err)
+	}
+	return nil
+}
+
+// sqliteDSN adds the settings the server relies on unless the DSN sets them:
+// a busy timeout so concurrent writers wait instead of failing, and WAL so
+// readers do not block the build workers
+func sqliteDSN(dsn string) string {
+	params := []string{}
+	if !strings.Contains(dsn, "_busy_timeout") {
+		params = append(params, "_busy_timeout=5000")
+	}
+	if !strings.Contains(dsn, "_journal_mode") {
+		params = append(params, "_journal_mode=WAL")
+	}
+	if len(params) == 0 {
+		return dsn
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + strings.Join(params, "&")
+}
+
+// Backend returns the backend name, "sqlite" or "postgres"
+func (db *DB) Backend() string {
+	return db.backend
+}
+
+// Migrate applies the embedded migrations that have not been applied yet, in
+// order, each in its own transaction, and returns their names
+func (db *DB) Migrate(ctx context.Context) ([]string, error) {
+	pending, err := db.pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make([]string, 0, len(pending))
+	for _, migration := range pending {
+		if err := db.apply(ctx, migration); err != nil {
+			return applied, err
+		}
+		logger.WithFields(map[string]interface{}{
+			"backend":   db.backend,
+			"migration": migration.name,
+		}).Info("Applied SQL migration")
+		applied = append(applied, migration.name)
+	}
+
+	return applied, nil
+}
+
+// MigrationStatus returns the names of the applied and the pending migrations
+func (db *DB) MigrationStatus(ctx context.Context) (applied, pending []string, err error) {
+	migrations, err := db.pending(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, migration := range migrations {
+		pending = append(pending, migration.name)
+	}
+
+	rows, err := db.QueryContext(ctx, `SELECT name FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		applied = append(applied, name)
+	}
+	return applied, pending, rows.Err()
+}
+
+// pending creates the schema_migrations table if needed and returns the
+// embedded migrations it does not list
+func (db *DB) pending(ctx context.Context) ([]sqlMigration, error) {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at BIGINT NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	done := make(map[int]bool)
+	rows, err := db.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		done[version] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+
+	migrations, err := embeddedMigrations()
+	if err != nil {
+		return nil, err
+	}
+	pending := make([]sqlMigration, 0)
+	for _, migration := range migrations {
+		if !done[migration.version] {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// apply runs one migration and records it in the same transaction
+func (db *DB) apply(ctx context.Context, migration sqlMigration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start migration %s: %w", migration.name, err)
+	}
+	defer tx.Rollback()
+
+	for _, statement := range migration.statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migration %s failed: %w", migration.name, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`,
+		migration.version, migration.name, time.Now().Unix(),
+	); err != nil {
+		return fmt.Errorf("failed to record migration %s: %w", migration.name, err)
+	}
+
+	return tx.Commit()
+}
+
+// sqlMigration is one embedded migration file
+type sqlMigration struct {
+	version    int
+	name       string
+	statements []string
+}
+
+// embeddedMigrations returns the migration files ordered by the version
+// number their name starts with, e.g. 0001_create_tables.sql
+func embeddedMigrations() ([]sqlMigration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+
+	migrations := make([]sqlMigration, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s does not start with a version number", name)
+		}
+
+		content, err := migrationFiles.ReadFile("migrations/" + name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", name, err)
+		}
+		migrations = append(migrations, sqlMigration{
+			version:    version,
+			name:       strings.TrimSuffix(name, ".sql"),
+			statements: splitStatements(string(content)),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// splitStatements splits a migration file into statements on semicolons at
+// the end of a line and drops "--" comment lines. Migrations must not put
+// semicolons at line ends inside string literals.
+func splitStatements(content string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
@@ -0,0 +1,290 @@
+package sqldb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/database"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// openTestDB opens a migrated SQLite database in a temporary directory
+func openTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := Open(context.Background(), BackendSQLite, filepath.Join(t.TempDir(), "nested", "test.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	return db
+}
+
+func TestMigrate_AppliesEachMigrationOnce(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+
+	applied, err := db.Migrate(ctx)
+	if err != nil {
+		t.Fatalf("second Migrate: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Fatalf("second Migrate applied %v, want nothing", applied)
+	}
+
+	done, pending, err := db.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	migrations, _ := embeddedMigrations()
+	if len(done) != len(migrations) || len(pending) != 0 {
+		t.Fatalf("status = %v applied, %v pending; want all %d applied", done, pending, len(migrations))
+	}
+}
+
+func TestUpdateMCP_RejectsStaleVersion(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	servers := NewMCPServers(db)
+
+	now := time.Unix(1700000000, 0)
+	server := &models.MCPServer{
+		ServerId:             "server-1",
+		UserId:               "user-1",
+		Name:                 "weather",
+		Repository:           "https://github.com/acme/weather",
+		Status:               "active",
+		EnvironmentVariables: []models.EnvironmentVariable{{Name: "API_KEY", Value: "secret", IsSecret: true}},
+		Registry:             "oci",
+		Builder:              "buildctl",
+		CreatedAt:            now,
+		UpdatedAt:            now,
+	}
+	if err := servers.CreateMCP(ctx, server); err != nil {
+		t.Fatalf("CreateMCP: %v", err)
+	}
+	if err := servers.CreateMCP(ctx, server); !errors.Is(err, database.ErrAlreadyExists) {
+		t.Fatalf("second CreateMCP = %v, want ErrAlreadyExists", err)
+	}
+
+	stale, err := servers.GetMCP(ctx, "server-1")
+	if err != nil {
+		t.Fatalf("GetMCP: %v", err)
+	}
+
+	server.Status = "deploying"
+	server.WebhookSecret = "encrypted-secret"
+	server.AutoBuildBranches = []string{"main", "release/*"}
+	if err := servers.UpdateMCP(ctx, server); err != nil {
+		t.Fatalf("UpdateMCP: %v", err)
+	}
+	if server.Version != 1 {
+		t.Fatalf("Version = %d after update, want 1", server.Version)
+	}
+
+	stale.Status = "failed"
+	err = servers.UpdateMCP(ctx, stale)
+	var conflict *database.ConflictError
+	if !errors.As(err, &conflict) || conflict.ActualVersion != 1 || conflict.ExpectedVersion != 0 {
+		t.Fatalf("stale UpdateMCP = %v, want a conflict at version 1", err)
+	}
+
+	stored, _ := servers.GetMCP(ctx, "server-1")
+	if stored.Status != "deploying" || stored.Registry != "oci" || stored.Builder != "buildctl" || len(stored.EnvironmentVariables) != 1 || !stored.EnvironmentVariables[0].IsSecret {
+		t.Fatalf("stored server = %+v", stored)
+	}
+	if stored.WebhookSecret != "encrypted-secret" || len(stored.AutoBuildBranches) != 2 || stored.AutoBuildBranches[1] != "release/*" {
+		t.Fatalf("stored webhook settings = %q, %v", stored.WebhookSecret, stored.AutoBuildBranches)
+	}
+
+	missing := &models.MCPServer{ServerId: "missing"}
+	if err := servers.UpdateMCP(ctx, missing); !errors.Is(err, database.ErrNotFound) {
+		t.Fatalf("UpdateMCP of a missing server = %v, want ErrNotFound", err)
+	}
+}
+
+func TestGetMCPsByRepositoryKey_ListsWebhookServers(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	servers := NewMCPServers(db)
+
+	for _, server := range []*models.MCPServer{
+		{ServerId: "server-1", Repository: "https://github.com/acme/weather", WebhookSecret: "secret"},
+		{ServerId: "server-2", Repository: "https://GitHub.com/Acme/Weather.git", WebhookSecret: "secret"},
+		{ServerId: "server-3", Repository: "https://github.com/acme/weather"},
+		{ServerId: "server-4", Repository: "https://github.com/acme/other", WebhookSecret: "secret"},
+	} {
+		if err := servers.CreateMCP(ctx, server); err != nil {
+			t.Fatalf("CreateMCP %s: %v", server.ServerId, err)
+		}
+	}
+	list := func(page models.PageRequest) ([]string, string) {
+		t.Helper()
+		found, cursor, err := servers.GetMCPsByRepositoryKey(ctx, "github.com/acme/weather", page)
+		if err != nil {
+			t.Fatalf("GetMCPsByRepositoryKey: %v", err)
+		}
+		var ids []string
+		for _, server := range found {
+			ids = append(ids, server.ServerId)
+		}
+		return ids, cursor
+	}
+
+	first, cursor := list(models.PageRequest{Limit: 1})
+	second, last := list(models.PageRequest{Limit: 1, Cursor: cursor})
+	if fmt.Sprint(first, second) != "[server-1] [server-2]" || cursor == "" || last != "" {
+		t.Fatalf("Pages = %v %v (cursors %q, %q), want server-1 then server-2", first, second, cursor, last)
+	}
+	if _, _, err := servers.GetMCPsByRepositoryKey(ctx, "github.com/acme/other", models.PageRequest{Cursor: cursor}); !errors.Is(err, database.ErrInvalidCursor) {
+		t.Errorf("Cursor of another repository = %v, want ErrInvalidCursor", err)
+	}
+
+	// Removing the webhook secret takes the server out of the index
+	server, _ := servers.GetMCP(ctx, "server-2")
+	server.WebhookSecret = ""
+	if err := servers.UpdateMCP(ctx, server); err != nil {
+		t.Fatalf("UpdateMCP: %v", err)
+	}
+	if ids, _ := list(models.PageRequest{}); fmt.Sprint(ids) != "[server-1]" {
+		t.Errorf("Servers after removing a secret = %v, want [server-1]", ids)
+	}
+}
+
+func TestUpdateDeployment_TellsConflictsApart(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	deployments := NewDeployments(db)
+
+	deployment := &models.Deployment{
+		ServerId:     "server-1",
+		DeploymentId: "deployment-1",
+		UserId:       "user-1",
+		Branch:       "main",
+		CommitHash:   "abc123",
+		Status:       models.DeploymentStatusQueued,
+		CreatedAt:    time.Unix(1700000000, 0),
+		UpdatedAt:    time.Unix(1700000000, 0),
+	}
+	if err := deployments.CreateDeployment(ctx, deployment); err != nil {
+		t.Fatalf("CreateDeployment: %v", err)
+	}
+
+	stale := *deployment
+	deployment.Status = models.DeploymentStatusInProgress
+	deployment.Stages = map[string]*models.BuildStageStatus{"clone": {Status: models.StageStatusInProgress}}
+	deployment.LogRef = &models.LogReference{Store: "fs", Key: "server-1/deployment-1", Entries: 3}
+	deployment.ImageDigestURI = "registry.example.com/mcp-server-1@sha256:abc"
+	deployment.Image = &models.ImageMetadata{Digest: "sha256:abc", Size: 300, LayerCount: 2, LayerSizes: []int64{200, 100}, BaseImage: "node:20-alpine"}
+	deployment.Manifest = &models.MCPManifest{
+		ServerName: "weather",
+		Tools:      []models.MCPTool{{Name: "get_forecast", InputSchema: json.RawMessage(`{"type":"object"}`)}},
+	}
+	deployment.ServerJSON = &models.RegistryServer{
+		Schema:   models.ServerJSONSchema,
+		Name:     "io.github.example/weather",
+		Packages: []models.RegistryPackage{{RegistryType: "oci", Identifier: "mcp-server-1", Transport: models.RegistryTransport{Type: "stdio"}}},
+	}
+	if err := deployments.UpdateDeployment(ctx, deployment, models.DeploymentStatusQueued); err != nil {
+		t.Fatalf("UpdateDeployment: %v", err)
+	}
+
+	// The status moved on since stale was read
+	stale.Status = models.DeploymentStatusCancelled
+	if err := deployments.UpdateDeployment(ctx, &stale, models.DeploymentStatusQueued); !errors.Is(err, database.ErrStatusConflict) {
+		t.Fatalf("UpdateDeployment with a changed status = %v, want ErrStatusConflict", err)
+	}
+
+	// Same status, older version
+	stale.Status = models.DeploymentStatusInProgress
+	err := deployments.UpdateDeployment(ctx, &stale, models.DeploymentStatusInProgress)
+	var conflict *database.ConflictError
+	if !errors.As(err, &conflict) || errors.Is(err, database.ErrStatusConflict) {
+		t.Fatalf("UpdateDeployment with an old version = %v, want a version conflict", err)
+	}
+
+	stored, err := deployments.GetDeployment(ctx, "server-1", "deployment-1")
+	if err != nil {
+		t.Fatalf("GetDeployment: %v", err)
+	}
+	if stored.Version != 1 || stored.LogRef == nil || stored.LogRef.Entries != 3 || stored.Stages["clone"].Status != models.StageStatusInProgress {
+		t.Fatalf("stored deployment = %+v", stored)
+	}
+	if stored.ImageDigestURI != deployment.ImageDigestURI || stored.Image == nil || stored.Image.BaseImage != "node:20-alpine" || len(stored.Image.LayerSizes) != 2 {
+		t.Fatalf("stored image = %s %+v", stored.ImageDigestURI, stored.Image)
+	}
+	if stored.Manifest == nil || len(stored.Manifest.Tools) != 1 || string(stored.Manifest.Tools[0].InputSchema) != `{"type":"object"}` {
+		t.Fatalf("stored manifest = %+v", stored.Manifest)
+	}
+	if stored.ServerJSON == nil || stored.ServerJSON.Schema != models.ServerJSONSchema || len(stored.ServerJSON.Packages) != 1 {
+		t.Fatalf("stored server.json = %+v", stored.ServerJSON)
+	}
+}
+
+func TestGetDeploymentsByUserId_PagesNewestFirst(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	deployments := NewDeployments(db)
+
+	// Ten deployments one minute apart, alternating branches, over two servers
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < 10; i++ {
+		branch := "main"
+		if i%2 == 1 {
+			branch = "dev"
+		}
+		created := start.Add(time.Duration(i) * time.Minute)
+		err := deployments.CreateDeployment(ctx, &models.Deployment{
+			ServerId:     fmt.Sprintf("server-%d", i%2),
+			DeploymentId: fmt.Sprintf("deployment-%d", i),
+			UserId:       "user-1",
+			Branch:       branch,
+			Status:       models.DeploymentStatusCompleted,
+			CreatedAt:    created,
+			UpdatedAt:    created,
+		})
+		if err != nil {
+			t.Fatalf("CreateDeployment: %v", err)
+		}
+	}
+
+	var ids []string
+	page := models.PageRequest{Limit: 2}
+	filter := models.DeploymentFilter{Branch: "main", CreatedAfter: start.Add(2 * time.Minute)}
+	for {
+		items, cursor, err := deployments.GetDeploymentsByUserId(ctx, "user-1", filter, page)
+		if err != nil {
+			t.Fatalf("GetDeploymentsByUserId: %v", err)
+		}
+		for _, d := range items {
+			ids = append(ids, d.DeploymentId)
+		}
+		if cursor == "" {
+			break
+		}
+		page.Cursor = cursor
+	}
+
+	want := []string{"deployment-8", "deployment-6", "deployment-4", "deployment-2"}
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Fatalf("listed %v, want %v", ids, want)
+	}
+
+	// A cursor only works for the listing it came from
+	_, cursor, _ := deployments.GetDeploymentsByUserId(ctx, "user-1", models.DeploymentFilter{}, models.PageRequest{Limit: 1})
+	if _, _, err := deployments.GetDeploymentsByUserId(ctx, "user-2", models.DeploymentFilter{}, models.PageRequest{Cursor: cursor}); !errors.Is(err, database.ErrInvalidCursor) {
+		t.Fatalf("foreign cursor = %v, want ErrInvalidCursor", err)
+	}
+	if _, _, err := deployments.GetDeploymentsByUserIdAndServerId(ctx, "user-1", "server-0", models.DeploymentFilter{}, models.PageRequest{Cursor: cursor}); !errors.Is(err, database.ErrInvalidCursor) {
+		t.Fatalf("cursor of another listing = %v, want ErrInvalidCursor", err)
+	}
+}
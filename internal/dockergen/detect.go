@@ -0,0 +1,270 @@
+package dockergen
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/imyashkale/buildserver/internal/mhiveconfig"
+)
+
+// Project is what detection found out about a server's source. It is the
+// data the Dockerfile templates are rendered with.
+type Project struct {
+	Runtime    string   // node, python or go
+	Entrypoint []string // command that starts the server, from mhive.config.yaml or detected
+	Port       int      // port the server listens on; 0 for stdio servers
+
+	// Node
+	PackageManager string // npm, yarn or pnpm
+	LockFile       string // lock file of the package manager; empty when there is none
+	InstallCommand string // installs all dependencies from the lock file
+	BuildScript    bool   // package.json has a build script
+	PruneCommand   string // removes development dependencies after the build
+
+	// Python
+	Requirements bool // dependencies come from requirements.txt rather than pyproject.toml
+
+	// Go
+	GoVersion string // language version from go.mod, e.g. "1.25"
+	GoPackage string // main package to build, e.g. "./cmd/server"
+}
+
+// markers are the files each runtime is detected by
+var markers = map[string][]string{
+	mhiveconfig.RuntimeNode:   {"package.json"},
+	mhiveconfig.RuntimePython: {"pyproject.toml", "requirements.txt"},
+	mhiveconfig.RuntimeGo:     {"go.mod"},
+}
+
+var (
+	// goVersionPattern matches the go directive of a go.mod file
+	goVersionPattern = regexp.MustCompile(`(?m)^go\s+(\d+\.\d+)`)
+
+	// commandPattern matches the directory names of cmd/ that are built
+	commandPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// Detect inspects the build context directory. The runtime and entrypoint of
+// the config win over detection; the rest is read from the project files.
+func Detect(dir string, config *mhiveconfig.Config) (*Project, error) {
+	project := &Project{Runtime: config.Runtime, Entrypoint: config.Entrypoint}
+	if config.Transport != mhiveconfig.TransportStdio {
+		project.Port = config.Port
+	}
+
+	if project.Runtime == "" {
+		runtime, err := detectRuntime(dir)
+		if err != nil {
+			return nil, err
+		}
+		project.Runtime = runtime
+	}
+
+	var err error
+	switch project.Runtime {
+	case mhiveconfig.RuntimeNode:
+		err = detectNode(dir, project)
+	case mhiveconfig.RuntimePython:
+		err = detectPython(dir, project)
+	case mhiveconfig.RuntimeGo:
+		err = detectGo(dir, config.Name, project)
+	default:
+		return nil, fmt.Errorf("runtime %s needs a Dockerfile in the repository", project.Runtime)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return project, nil
+}
+
+// detectRuntime picks the runtime whose marker files are present
+func detectRuntime(dir string) (string, error) {
+	var found []string
+	for runtime, files := range markers {
+		for _, file := range files {
+			if fileExists(dir, file) {
+				found = append(found, runtime)
+				break
+			}
+		}
+	}
+	sort.Strings(found)
+
+	switch len(found) {
+	case 0:
+		return "", errors.New("no Dockerfile, and the runtime cannot be detected: add package.json, pyproject.toml, requirements.txt or go.mod, or a Dockerfile")
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("no Dockerfile, and the project looks like %s: set runtime in %s", strings.Join(found, " and "), mhiveconfig.FileName)
+	}
+}
+
+// detectNode reads package.json and the lock file
+func detectNode(dir string, project *Project) error {
+	data, err := readFile(dir, "package.json")
+	if err != nil {
+		return fmt.Errorf("runtime node needs package.json: %w", err)
+	}
+	var pkg struct {
+		Name    string            `json:"name"`
+		Main    string            `json:"main"`
+		Bin     json.RawMessage   `json:"bin"`
+		Scripts map[string]string `json:"scripts"`
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return fmt.Errorf("invalid package.json: %w", err)
+	}
+
+	switch {
+	case fileExists(dir, "pnpm-lock.yaml"):
+		project.PackageManager, project.LockFile = "pnpm", "pnpm-lock.yaml"
+		project.InstallCommand = "corepack enable && pnpm install --frozen-lockfile"
+		project.PruneCommand = "pnpm prune --prod"
+	case fileExists(dir, "yarn.lock"):
+		project.PackageManager, project.LockFile = "yarn", "yarn.lock"
+		project.InstallCommand = "corepack enable && yarn install --frozen-lockfile"
+		project.PruneCommand = "yarn install --production --frozen-lockfile --ignore-scripts"
+	case fileExists(dir, "package-lock.json"):
+		project.PackageManager, project.LockFile = "npm", "package-lock.json"
+		project.InstallCommand = "npm ci"
+		project.PruneCommand = "npm prune --omit=dev"
+	default:
+		project.PackageManager = "npm"
+		project.InstallCommand = "npm install"
+		project.PruneCommand = "npm prune --omit=dev"
+	}
+	_, project.BuildScript = pkg.Scripts["build"]
+
+	if project.Entrypoint != nil {
+		return nil
+	}
+	// A single bin, or the one named after the package, is the server
+	var bin string
+	if json.Unmarshal(pkg.Bin, &bin) != nil {
+		var bins map[string]string
+		json.Unmarshal(pkg.Bin, &bins)
+		if len(bins) == 1 {
+			for _, path := range bins {
+				bin = path
+			}
+		} else {
+			bin = bins[pkg.Name]
+		}
+	}
+	switch {
+	case bin != "":
+		project.Entrypoint = []string{"node", bin}
+	case pkg.Main != "":
+		project.Entrypoint = []string{"node", pkg.Main}
+	case pkg.Scripts["start"] != "":
+		project.Entrypoint = []string{project.PackageManager, "start"}
+	case fileExists(dir, "index.js"):
+		project.Entrypoint = []string{"node", "index.js"}
+	default:
+		return fmt.Errorf("cannot tell how to start the server from package.json: add bin, main or a start script, or set entrypoint in %s", mhiveconfig.FileName)
+	}
+	return nil
+}
+
+// detectPython reads pyproject.toml or requirements.txt
+func detectPython(dir string, project *Project) error {
+	hasProject := fileExists(dir, "pyproject.toml")
+	project.Requirements = !hasProject
+	if !hasProject && !fileExists(dir, "requirements.txt") {
+		return errors.New("runtime python needs pyproject.toml or requirements.txt")
+	}
+
+	if project.Entrypoint != nil {
+		return nil
+	}
+	if hasProject {
+		if script := firstProjectScript(dir); script != "" {
+			project.Entrypoint = []string{script}
+			return nil
+		}
+	}
+	for _, file := range []string{"server.py", "main.py", "app.py"} {
+		if fileExists(dir, file) {
+			project.Entrypoint = []string{"python", file}
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot tell how to start the server: add a [project.scripts] entry, server.py or main.py, or set entrypoint in %s", mhiveconfig.FileName)
+}
+
+// firstProjectScript returns the first console script of [project.scripts]
+// in pyproject.toml. Only the simple `name = "module:function"` form is read.
+func firstProjectScript(dir string) string {
+	data, err := readFile(dir, "pyproject.toml")
+	if err != nil {
+		return ""
+	}
+	inScripts := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inScripts = line == "[project.scripts]"
+			continue
+		}
+		if name, _, ok := strings.Cut(line, "="); inScripts && ok && !strings.HasPrefix(line, "#") {
+			return strings.Trim(strings.TrimSpace(name), `"'`)
+		}
+	}
+	return ""
+}
+
+// detectGo reads go.mod and finds the main package: the module root, or the
+// only command under cmd/ (the one named after the server when there are several)
+func detectGo(dir, name string, project *Project) error {
+	data, err := readFile(dir, "go.mod")
+	if err != nil {
+		return fmt.Errorf("runtime go needs go.mod: %w", err)
+	}
+	project.GoVersion = "1.25"
+	if match := goVersionPattern.FindSubmatch(data); match != nil {
+		project.GoVersion = string(match[1])
+	}
+	if project.Entrypoint == nil {
+		project.Entrypoint = []string{"/server"}
+	}
+
+	if fileExists(dir, "main.go") {
+		project.GoPackage = "."
+		return nil
+	}
+	commands, _ := filepath.Glob(filepath.Join(dir, "cmd", "*", "main.go"))
+	switch {
+	case len(commands) == 1 && commandPattern.MatchString(filepath.Base(filepath.Dir(commands[0]))):
+		project.GoPackage = "./cmd/" + filepath.Base(filepath.Dir(commands[0]))
+	case fileExists(dir, filepath.Join("cmd", name, "main.go")):
+		project.GoPackage = "./cmd/" + name
+	default:
+		return errors.New("cannot find the main package: expected main.go at the module root or a single cmd/<name>/main.go")
+	}
+	return nil
+}
+
+// fileExists reports whether a regular file exists at dir/name. Symlinks do
+// not count: they could lead to files of the build server.
+func fileExists(dir, name string) bool {
+	info, err := os.Lstat(filepath.Join(dir, name))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// readFile reads a regular file of the project
+func readFile(dir, name string) ([]byte, error) {
+	if !fileExists(dir, name) {
+		return nil, fmt.Errorf("%s not found", name)
+	}
+	return os.ReadFile(filepath.Join(dir, name))
+}
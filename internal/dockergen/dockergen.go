@@ -0,0 +1,113 @@
+// Package dockergen generates a Dockerfile for MCP server repositories that
+// do not have one. It detects the runtime and entrypoint of the project and
+// renders a multi-stage template that runs the server as an unprivileged user.
+package dockergen
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/imyashkale/buildserver/internal/mhiveconfig"
+)
+
+// BuiltinTemplate is the Source of a Dockerfile rendered from a template
+// that ships with the build server
+const BuiltinTemplate = "built-in"
+
+//go:embed templates/*.Dockerfile.tmpl
+var builtinTemplates embed.FS
+
+// organisationPattern matches the organisations templates can be overridden
+// for; anything else could escape the templates directory
+var organisationPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]*$`)
+
+// Generator renders Dockerfiles from the built-in templates or from overrides
+// in a templates directory. A template for runtime node is looked up as
+//
+//	<dir>/<organisation>/node.Dockerfile.tmpl
+//	<dir>/node.Dockerfile.tmpl
+//
+// and the built-in one is used when neither exists.
+type Generator struct {
+	dir string
+}
+
+// New creates a generator with overrides in dir; an empty dir uses the built-in templates only
+func New(dir string) *Generator {
+	return &Generator{dir: dir}
+}
+
+// Result is a generated Dockerfile
+type Result struct {
+	Dockerfile []byte
+	Project    *Project
+	Source     string // template path, or BuiltinTemplate
+}
+
+// Generate detects the project in the build context directory and renders
+// the template for its runtime. organisation is the owner of the repository.
+func (g *Generator) Generate(dir string, config *mhiveconfig.Config, organisation string) (*Result, error) {
+	project, err := Detect(dir, config)
+	if err != nil {
+		return nil, err
+	}
+
+	text, source, err := g.template(project.Runtime, organisation)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(project.Runtime).Option("missingkey=error").Funcs(template.FuncMap{
+		"json": toJSON,
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Dockerfile template %s: %w", source, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, project); err != nil {
+		return nil, fmt.Errorf("failed to render Dockerfile template %s: %w", source, err)
+	}
+	return &Result{Dockerfile: out.Bytes(), Project: project, Source: source}, nil
+}
+
+// template returns the template text for a runtime and where it came from
+func (g *Generator) template(runtime, organisation string) (string, string, error) {
+	name := runtime + ".Dockerfile.tmpl"
+	if g.dir != "" {
+		var candidates []string
+		if organisation = strings.ToLower(organisation); organisationPattern.MatchString(organisation) {
+			candidates = append(candidates, filepath.Join(g.dir, organisation, name))
+		}
+		candidates = append(candidates, filepath.Join(g.dir, name))
+
+		for _, path := range candidates {
+			data, err := os.ReadFile(path)
+			if err == nil {
+				return string(data), path, nil
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				return "", "", fmt.Errorf("failed to read Dockerfile template: %w", err)
+			}
+		}
+	}
+
+	data, err := builtinTemplates.ReadFile("templates/" + name)
+	if err != nil {
+		return "", "", fmt.Errorf("no Dockerfile template for runtime %s", runtime)
+	}
+	return string(data), BuiltinTemplate, nil
+}
+
+// toJSON renders a value as JSON, e.g. a command in exec form
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
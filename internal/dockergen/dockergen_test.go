@@ -0,0 +1,205 @@
+package dockergen
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/mhiveconfig"
+)
+
+// writeFiles creates files under dir, with parent directories
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// parseConfig parses a mhive.config.yaml
+func parseConfig(t *testing.T, yaml string) *mhiveconfig.Config {
+	t.Helper()
+	config, _, err := mhiveconfig.Parse([]byte(yaml), "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	return config
+}
+
+func TestGenerate(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		config string
+		want   []string // lines of the Dockerfile
+	}{
+		{
+			name: "node with pnpm and a build script",
+			files: map[string]string{
+				"package.json":   `{"name": "weather", "bin": {"weather": "dist/cli.js", "other": "dist/other.js"}, "scripts": {"build": "tsc"}}`,
+				"pnpm-lock.yaml": "lockfileVersion: 9\n",
+			},
+			config: "name: weather\ntransport: streamable-http\nport: 8080\n",
+			want: []string{
+				"FROM node:${NODE_VERSION}-alpine AS build",
+				"COPY package.json pnpm-lock.yaml ./",
+				"RUN corepack enable && pnpm install --frozen-lockfile",
+				"RUN pnpm run build",
+				"RUN pnpm prune --prod",
+				"USER node",
+				"EXPOSE 8080",
+				`ENTRYPOINT ["node","dist/cli.js"]`,
+			},
+		},
+		{
+			name:   "node without a lock file",
+			files:  map[string]string{"package.json": `{"main": "index.js"}`},
+			config: "name: weather\nruntime: node\n",
+			want:   []string{"COPY package.json ./", "RUN npm install", "RUN npm prune --omit=dev", `ENTRYPOINT ["node","index.js"]`},
+		},
+		{
+			name: "python project with a console script",
+			files: map[string]string{
+				"pyproject.toml": "[project]\nname = \"weather\"\n\n[project.scripts]\nweather-mcp = \"weather.server:main\"\n",
+			},
+			config: "name: weather\n",
+			want:   []string{"RUN pip install .", "USER 10001", `ENTRYPOINT ["weather-mcp"]`},
+		},
+		{
+			name:   "python requirements with the config's entrypoint",
+			files:  map[string]string{"requirements.txt": "mcp\n", "main.py": ""},
+			config: "name: weather\nentrypoint: [python, -m, weather]\n",
+			want:   []string{"COPY requirements.txt ./", "RUN pip install -r requirements.txt", `ENTRYPOINT ["python","-m","weather"]`},
+		},
+		{
+			name:   "go command",
+			files:  map[string]string{"go.mod": "module example.com/weather\n\ngo 1.24.2\n", "cmd/weather/main.go": "package main\n"},
+			config: "name: weather\n",
+			want: []string{
+				"ARG GO_VERSION=1.24",
+				`RUN CGO_ENABLED=0 go build -trimpath -ldflags="-s -w" -o /out/server ./cmd/weather`,
+				"FROM gcr.io/distroless/static-debian12:nonroot",
+				`ENTRYPOINT ["/server"]`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			result, err := New("").Generate(dir, parseConfig(t, tt.config), "acme")
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			if result.Source != BuiltinTemplate {
+				t.Errorf("Source = %q", result.Source)
+			}
+			lines := strings.Split(string(result.Dockerfile), "\n")
+			for _, want := range tt.want {
+				found := false
+				for _, line := range lines {
+					found = found || line == want
+				}
+				if !found {
+					t.Errorf("Dockerfile lacks %q:\n%s", want, result.Dockerfile)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		config string
+		want   string
+	}{
+		{name: "nothing to detect", files: map[string]string{"README.md": ""}, config: "name: weather\n", want: "runtime cannot be detected"},
+		{
+			name:   "ambiguous runtime",
+			files:  map[string]string{"package.json": "{}", "go.mod": "module weather\n"},
+			config: "name: weather\n",
+			want:   "looks like go and node: set runtime",
+		},
+		{name: "custom runtime", files: map[string]string{"package.json": "{}"}, config: "name: weather\nruntime: custom\n", want: "runtime custom needs a Dockerfile"},
+		{name: "no entrypoint", files: map[string]string{"package.json": `{"name": "weather"}`}, config: "name: weather\n", want: "set entrypoint"},
+		{name: "no main package", files: map[string]string{"go.mod": "module weather\n"}, config: "name: weather\n", want: "cannot find the main package"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, tt.files)
+
+			_, err := New("").Generate(dir, parseConfig(t, tt.config), "acme")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Generate error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerate_SymlinksAreNotFollowed(t *testing.T) {
+	outside := t.TempDir()
+	writeFiles(t, outside, map[string]string{"package.json": `{"main": "secret.js"}`})
+	dir := t.TempDir()
+	if err := os.Symlink(filepath.Join(outside, "package.json"), filepath.Join(dir, "package.json")); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := New("").Generate(dir, parseConfig(t, "name: weather\nruntime: node\n"), "")
+	if err == nil || !strings.Contains(err.Error(), "package.json not found") {
+		t.Fatalf("Generate error = %v, want package.json not found", err)
+	}
+}
+
+func TestGenerate_TemplateOverrides(t *testing.T) {
+	templates := t.TempDir()
+	writeFiles(t, templates, map[string]string{
+		"node.Dockerfile.tmpl":        "FROM registry.internal/node:22\nENTRYPOINT {{json .Entrypoint}}\n",
+		"acme/node.Dockerfile.tmpl":   "FROM registry.acme.internal/node:22\nENTRYPOINT {{json .Entrypoint}}\n",
+		"broken/node.Dockerfile.tmpl": "FROM {{.Missing}}\n",
+	})
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"package.json": `{"main": "index.js"}`, "requirements.txt": ""})
+	config := parseConfig(t, "name: weather\nruntime: node\n")
+	generator := New(templates)
+
+	tests := []struct {
+		organisation string
+		wantSource   string
+		wantFrom     string
+	}{
+		{organisation: "Acme", wantSource: filepath.Join(templates, "acme", "node.Dockerfile.tmpl"), wantFrom: "FROM registry.acme.internal/node:22"},
+		{organisation: "globex", wantSource: filepath.Join(templates, "node.Dockerfile.tmpl"), wantFrom: "FROM registry.internal/node:22"},
+		{organisation: "../acme", wantSource: filepath.Join(templates, "node.Dockerfile.tmpl"), wantFrom: "FROM registry.internal/node:22"},
+	}
+	for _, tt := range tests {
+		result, err := generator.Generate(dir, config, tt.organisation)
+		if err != nil {
+			t.Fatalf("Generate(%s): %v", tt.organisation, err)
+		}
+		if result.Source != tt.wantSource || !strings.HasPrefix(string(result.Dockerfile), tt.wantFrom+"\n") {
+			t.Errorf("Generate(%s) from %s:\n%s", tt.organisation, result.Source, result.Dockerfile)
+		}
+	}
+
+	// Runtimes without an override use the built-in template
+	config.Runtime = mhiveconfig.RuntimePython
+	writeFiles(t, dir, map[string]string{"main.py": ""})
+	if result, err := generator.Generate(dir, config, "acme"); err != nil || result.Source != BuiltinTemplate {
+		t.Errorf("Generate(python) = %v, want the built-in template", err)
+	}
+
+	if _, err := generator.Generate(dir, parseConfig(t, "name: weather\nruntime: node\n"), "broken"); err == nil || !strings.Contains(err.Error(), "failed to render") {
+		t.Errorf("Generate(broken) error = %v, want a render error", err)
+	}
+}
@@ -1,14 +1,23 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/models"
 	"github.com/imyashkale/buildserver/internal/queue"
 	"github.com/imyashkale/buildserver/internal/repository"
 )
 
+// errDeploymentNotQueued stops recording a cancellation for a deployment that
+// is no longer queued
+var errDeploymentNotQueued = errors.New("deployment is no longer queued")
+
 // BuildHandler handles build-related requests
 type BuildHandler struct {
 	mcpRepo        repository.MCPRepository
@@ -186,6 +195,58 @@ func (h *BuildHandler) InitiateBuild(c *gin.Context) {
 		return
 	}
 
+	// Only a queued deployment, or a failed or cancelled one being retried, can be built
+	if !deployment.Status.IsBuildable() {
+		logger.WithFields(map[string]interface{}{
+			"user_id":       userIdStr,
+			"server_id":     serverId,
+			"deployment_id": deploymentId,
+			"status":        deployment.Status,
+		}).Warn("Build initiation failed: deployment is not buildable")
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "deployment_not_buildable",
+			"message": fmt.Sprintf("Deployment is %s and cannot be built", deployment.Status),
+		})
+		return
+	}
+
+	// A retry moves the deployment back to queued. The write is conditional on
+	// the status and version read above, so only one of several concurrent requests wins.
+	retriedFrom, retriedStages := deployment.Status, deployment.Stages
+	if deployment.Status != models.DeploymentStatusQueued {
+		previous := deployment.Status
+		deployment.Status = models.DeploymentStatusQueued
+		deployment.Stages = nil
+		deployment.UpdatedAt = time.Now()
+
+		if err := h.deploymentRepo.Update(ctx, deployment, previous); err != nil {
+			if errors.Is(err, repository.ErrConflict) {
+				logger.WithFields(map[string]interface{}{
+					"user_id":       userIdStr,
+					"server_id":     serverId,
+					"deployment_id": deploymentId,
+				}).Warn("Build initiation failed: deployment modified concurrently")
+				c.JSON(http.StatusConflict, gin.H{
+					"error":   "deployment_not_buildable",
+					"message": "Deployment changed while the build was being initiated",
+				})
+				return
+			}
+
+			logger.WithFields(map[string]interface{}{
+				"user_id":       userIdStr,
+				"server_id":     serverId,
+				"deployment_id": deploymentId,
+				"error":         err.Error(),
+			}).Error("Build initiation failed: could not requeue deployment")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "update_failed",
+				"message": "Failed to queue deployment",
+			})
+			return
+		}
+	}
+
 	// Enqueue build job (async execution)
 	job := &queue.BuildJob{
 		DeploymentID: deploymentId,
@@ -196,7 +257,35 @@ func (h *BuildHandler) InitiateBuild(c *gin.Context) {
 	}
 
 	// Enqueue the job for asynchronous processing
-	h.jobQueue.Enqueue(job)
+	if err := h.jobQueue.Enqueue(ctx, job); err != nil {
+		if errors.Is(err, queue.ErrJobExists) {
+			logger.WithFields(map[string]interface{}{
+				"user_id":       userIdStr,
+				"server_id":     serverId,
+				"deployment_id": deploymentId,
+			}).Warn("Build initiation failed: build already queued")
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "build_already_queued",
+				"message": "A build for this deployment is already queued or running",
+			})
+			return
+		}
+
+		logger.WithFields(map[string]interface{}{
+			"user_id":       userIdStr,
+			"server_id":     serverId,
+			"deployment_id": deploymentId,
+			"error":         err.Error(),
+		}).Error("Build initiation failed: could not enqueue build job")
+		if retriedFrom != models.DeploymentStatusQueued {
+			h.restoreRetried(ctx, deployment, retriedFrom, retriedStages)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "enqueue_failed",
+			"message": "Failed to queue build",
+		})
+		return
+	}
 
 	logger.WithFields(map[string]interface{}{
 		"user_id":       userIdStr,
@@ -208,3 +297,205 @@ func (h *BuildHandler) InitiateBuild(c *gin.Context) {
 		"message": "Build initiated successfully",
 	})
 }
+
+// restoreRetried puts a deployment moved to queued for a retry back into its
+// previous status when no job could be enqueued for it, so it does not stay
+// queued with nothing to build it and can be retried again
+func (h *BuildHandler) restoreRetried(ctx context.Context, deployment *models.Deployment, status models.DeploymentStatus, stages map[string]*models.BuildStageStatus) {
+	deployment.Status = status
+	deployment.Stages = stages
+	deployment.UpdatedAt = time.Now()
+	if err := h.deploymentRepo.Update(ctx, deployment, models.DeploymentStatusQueued); err != nil {
+		logger.WithFields(map[string]interface{}{
+			"server_id":     deployment.ServerId,
+			"deployment_id": deployment.DeploymentId,
+			"status":        status,
+			"error":         err.Error(),
+		}).Error("Failed to restore deployment status after enqueue failure")
+	}
+}
+
+// CancelBuild cancels a queued build or stops a running one
+func (h *BuildHandler) CancelBuild(c *gin.Context) {
+	logger.Debug("CancelBuild handler invoked")
+
+	// Get user ID from context (set by auth middleware)
+	userId, exists := c.Get("user_id")
+	if !exists {
+		logger.Warn("Build cancellation failed: user_id not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "User ID not found in context",
+		})
+		return
+	}
+
+	userIdStr, ok := userId.(string)
+	if !ok {
+		logger.Error("Build cancellation failed: invalid user_id format in context")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Invalid user ID format",
+		})
+		return
+	}
+
+	serverId := c.Param("server_id")
+	deploymentId := c.Param("deployment_id")
+
+	if serverId == "" || deploymentId == "" {
+		logger.WithField("user_id", userIdStr).Warn("Build cancellation failed: server_id and deployment_id are required")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Server ID and deployment ID are required",
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Validate MCP server ownership
+	mcp, err := h.mcpRepo.Get(ctx, serverId)
+	if err != nil || mcp == nil {
+		logger.WithFields(map[string]interface{}{
+			"user_id":   userIdStr,
+			"server_id": serverId,
+			"error":     err,
+		}).Warn("Build cancellation failed: MCP server not found")
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "mcp_server_not_found",
+			"message": "MCP server not found",
+		})
+		return
+	}
+
+	if mcp.UserId != userIdStr {
+		logger.WithFields(map[string]interface{}{
+			"user_id":      userIdStr,
+			"server_id":    serverId,
+			"mcp_owner_id": mcp.UserId,
+		}).Warn("Build cancellation failed: permission denied for MCP server")
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "You don't have permission to cancel builds for this MCP server",
+		})
+		return
+	}
+
+	// Validate deployment ownership
+	deployment, err := h.deploymentRepo.Get(ctx, serverId, deploymentId)
+	if err != nil || deployment == nil {
+		logger.WithFields(map[string]interface{}{
+			"user_id":       userIdStr,
+			"server_id":     serverId,
+			"deployment_id": deploymentId,
+			"error":         err,
+		}).Warn("Build cancellation failed: deployment not found")
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "deployment_not_found",
+			"message": "Deployment not found",
+		})
+		return
+	}
+
+	if deployment.UserId != userIdStr {
+		logger.WithFields(map[string]interface{}{
+			"user_id":             userIdStr,
+			"server_id":           serverId,
+			"deployment_id":       deploymentId,
+			"deployment_owner_id": deployment.UserId,
+		}).Warn("Build cancellation failed: permission denied for deployment")
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "You don't have permission to cancel this deployment",
+		})
+		return
+	}
+
+	job := &queue.BuildJob{
+		DeploymentID: deploymentId,
+		ServerID:     serverId,
+	}
+
+	previous, err := h.jobQueue.Cancel(ctx, job.ID(), userIdStr)
+	if err != nil {
+		if errors.Is(err, queue.ErrJobNotAvailable) {
+			logger.WithFields(map[string]interface{}{
+				"user_id":       userIdStr,
+				"server_id":     serverId,
+				"deployment_id": deploymentId,
+				"status":        deployment.Status,
+			}).Warn("Build cancellation failed: no queued or running build")
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "build_not_active",
+				"message": "There is no queued or running build for this deployment",
+			})
+			return
+		}
+
+		logger.WithFields(map[string]interface{}{
+			"user_id":       userIdStr,
+			"server_id":     serverId,
+			"deployment_id": deploymentId,
+			"error":         err.Error(),
+		}).Error("Build cancellation failed: could not cancel build job")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "cancel_failed",
+			"message": "Failed to cancel build",
+		})
+		return
+	}
+
+	// A running build records its own cancellation once its stage is stopped.
+	// A queued build never starts, so record it here.
+	// The deployment is reloaded if another writer got there first.
+	if previous == queue.JobStatusQueued {
+		_, err := repository.UpdateDeploymentWithRetry(ctx, h.deploymentRepo, serverId, deploymentId, func(d *models.Deployment) error {
+			if d.Status != models.DeploymentStatusQueued {
+				return errDeploymentNotQueued
+			}
+			now := time.Now()
+			if d.Stages == nil {
+				d.Stages = make(map[string]*models.BuildStageStatus)
+			}
+			d.Stages["queue"] = &models.BuildStageStatus{
+				Status:      models.StageStatusCancelled,
+				CompletedAt: &now,
+				CancelledBy: userIdStr,
+			}
+			d.Status = models.DeploymentStatusCancelled
+			d.UpdatedAt = now
+			return nil
+		})
+		if errors.Is(err, errDeploymentNotQueued) {
+			logger.WithFields(map[string]interface{}{
+				"user_id":       userIdStr,
+				"server_id":     serverId,
+				"deployment_id": deploymentId,
+			}).Warn("Deployment left queued status before its cancellation was recorded")
+		} else if err != nil {
+			logger.WithFields(map[string]interface{}{
+				"user_id":       userIdStr,
+				"server_id":     serverId,
+				"deployment_id": deploymentId,
+				"error":         err.Error(),
+			}).Error("Failed to mark deployment as cancelled")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "update_failed",
+				"message": "Build was cancelled but the deployment could not be updated",
+			})
+			return
+		}
+	}
+
+	logger.WithFields(map[string]interface{}{
+		"user_id":       userIdStr,
+		"server_id":     serverId,
+		"deployment_id": deploymentId,
+		"job_status":    previous,
+	}).Info("Build cancelled successfully")
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Build cancellation requested",
+	})
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/queue"
+	"github.com/imyashkale/buildserver/internal/repository"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve runs a request through handler registered on route, authenticated as
+// user the way the authentication middleware would; an empty user is anonymous
+func serve(handler gin.HandlerFunc, route, user string, req *http.Request) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(req.Method, route, func(c *gin.Context) {
+		if user != "" {
+			c.Set("user_id", user)
+		}
+	}, handler)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// errorCode returns the "error" field of a JSON error response
+func errorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Response is not JSON: %s", w.Body.String())
+	}
+	return body.Error
+}
+
+// createServer stores an MCP server owned by userId
+func createServer(t *testing.T, repo *repository.MemoryMCPRepository, serverId, userId string) {
+	t.Helper()
+	if err := repo.Create(context.Background(), &models.MCPServer{ServerId: serverId, UserId: userId, Name: serverId}); err != nil {
+		t.Fatalf("Failed to create server %s: %v", serverId, err)
+	}
+}
+
+// createDeployment stores a deployment of user-1 with the given status
+func createDeployment(t *testing.T, repo repository.DeploymentRepository, serverId, deploymentId string, status models.DeploymentStatus) {
+	t.Helper()
+	err := repo.Create(context.Background(), &models.Deployment{
+		ServerId:     serverId,
+		DeploymentId: deploymentId,
+		UserId:       "user-1",
+		Branch:       "main",
+		CommitHash:   "abc123",
+		Status:       status,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create deployment %s: %v", deploymentId, err)
+	}
+}
+
+// buildFixture is a build handler over in-memory repositories and job queue
+type buildFixture struct {
+	handler        *BuildHandler
+	mcpRepo        *repository.MemoryMCPRepository
+	deploymentRepo *repository.MemoryDeploymentRepository
+	jobQueue       *queue.JobQueue
+}
+
+func newBuildFixture(t *testing.T) *buildFixture {
+	t.Helper()
+	f := &buildFixture{
+		mcpRepo:        repository.NewMemoryMCPRepository(),
+		deploymentRepo: repository.NewMemoryDeploymentRepository(),
+		jobQueue:       queue.NewJobQueue(10, queue.NewMemoryJobStore()),
+	}
+	f.handler = NewBuildHandler(f.mcpRepo, f.deploymentRepo, repository.NewMemoryGitHubRepository(), f.jobQueue)
+	createServer(t, f.mcpRepo, "server-1", "user-1")
+	createServer(t, f.mcpRepo, "server-2", "user-2")
+	return f
+}
+
+// failingJobStore is a job store that cannot persist new jobs
+type failingJobStore struct {
+	*queue.MemoryJobStore
+}
+
+func (failingJobStore) Save(ctx context.Context, job *queue.BuildJob) error {
+	return errors.New("job store unavailable")
+}
+
+func TestInitiateBuild_RestoresRetryWhenEnqueueFails(t *testing.T) {
+	for _, status := range []models.DeploymentStatus{models.DeploymentStatusFailed, models.DeploymentStatusCancelled} {
+		t.Run(string(status), func(t *testing.T) {
+			ctx := context.Background()
+			mcpRepo := repository.NewMemoryMCPRepository()
+			deploymentRepo := repository.NewMemoryDeploymentRepository()
+			githubRepo := repository.NewMemoryGitHubRepository()
+			jobQueue := queue.NewJobQueue(10, failingJobStore{queue.NewMemoryJobStore()})
+			defer jobQueue.Close()
+			handler := NewBuildHandler(mcpRepo, deploymentRepo, githubRepo, jobQueue)
+			createServer(t, mcpRepo, "server-1", "user-1")
+			if err := githubRepo.CreateConnection(ctx, &models.GitHubConnection{Id: "conn-1", UserId: "user-1"}); err != nil {
+				t.Fatal(err)
+			}
+			createDeployment(t, deploymentRepo, "server-1", "deploy-1", status)
+			_, err := repository.UpdateDeploymentWithRetry(ctx, deploymentRepo, "server-1", "deploy-1", func(d *models.Deployment) error {
+				d.Stages = map[string]*models.BuildStageStatus{"clone": {Status: models.StageStatusFailed}}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/build/server-1/deploy-1/initiate", nil)
+			w := serve(handler.InitiateBuild, "/build/:server_id/:deployment_id/initiate", "user-1", req)
+			if w.Code != http.StatusInternalServerError || errorCode(t, w) != "enqueue_failed" {
+				t.Fatalf("InitiateBuild = %d: %s", w.Code, w.Body.String())
+			}
+
+			// The deployment is not left queued without a job and can be retried again
+			deployment, _ := deploymentRepo.Get(ctx, "server-1", "deploy-1")
+			if deployment.Status != status || deployment.Stages["clone"] == nil {
+				t.Errorf("Deployment after failed enqueue = %s with stages %v, want %s with its stages", deployment.Status, deployment.Stages, status)
+			}
+		})
+	}
+}
+
+// cancel posts a cancellation of a deployment as user
+func (f *buildFixture) cancel(user, serverId, deploymentId string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/build/"+serverId+"/"+deploymentId+"/cancel", nil)
+	return serve(f.handler.CancelBuild, "/build/:server_id/:deployment_id/cancel", user, req)
+}
+
+func TestCancelBuild_QueuedBuild(t *testing.T) {
+	f := newBuildFixture(t)
+	defer f.jobQueue.Close()
+	createDeployment(t, f.deploymentRepo, "server-1", "deploy-1", models.DeploymentStatusQueued)
+	job := &queue.BuildJob{ServerID: "server-1", DeploymentID: "deploy-1", UserID: "user-1"}
+	if err := f.jobQueue.Enqueue(context.Background(), job); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	if w := f.cancel("user-1", "server-1", "deploy-1"); w.Code != http.StatusAccepted {
+		t.Fatalf("Status = %d: %s", w.Code, w.Body.String())
+	}
+
+	// The build never starts, so the handler records the cancellation
+	deployment, _ := f.deploymentRepo.Get(context.Background(), "server-1", "deploy-1")
+	if deployment.Status != models.DeploymentStatusCancelled {
+		t.Errorf("Deployment status = %s, want cancelled", deployment.Status)
+	}
+	if stage := deployment.Stages["queue"]; stage == nil || stage.Status != models.StageStatusCancelled || stage.CancelledBy != "user-1" {
+		t.Errorf("Queue stage = %+v", stage)
+	}
+
+	// Cancelling again finds no active build
+	if w := f.cancel("user-1", "server-1", "deploy-1"); w.Code != http.StatusConflict || errorCode(t, w) != "build_not_active" {
+		t.Errorf("Second cancel = %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCancelBuild_RunningBuild(t *testing.T) {
+	f := newBuildFixture(t)
+	createDeployment(t, f.deploymentRepo, "server-1", "deploy-1", models.DeploymentStatusInProgress)
+
+	started, cancelledBy := make(chan struct{}), make(chan string, 1)
+	workerPool := queue.NewWorkerPool(f.jobQueue, 1)
+	workerPool.Start(func(ctx context.Context, job *queue.BuildJob) error {
+		close(started)
+		<-ctx.Done()
+		by, _ := queue.CancelledBy(ctx)
+		cancelledBy <- by
+		return ctx.Err()
+	})
+	defer func() {
+		f.jobQueue.Close()
+		workerPool.Wait()
+	}()
+	if err := f.jobQueue.Enqueue(context.Background(), &queue.BuildJob{ServerID: "server-1", DeploymentID: "deploy-1", UserID: "user-1"}); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	<-started
+
+	if w := f.cancel("user-1", "server-1", "deploy-1"); w.Code != http.StatusAccepted {
+		t.Fatalf("Status = %d: %s", w.Code, w.Body.String())
+	}
+
+	// The running build is stopped and records the cancellation itself
+	select {
+	case by := <-cancelledBy:
+		if by != "user-1" {
+			t.Errorf("CancelledBy = %q, want user-1", by)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("The running build was not stopped")
+	}
+	deployment, _ := f.deploymentRepo.Get(context.Background(), "server-1", "deploy-1")
+	if deployment.Status != models.DeploymentStatusInProgress {
+		t.Errorf("Handler changed the running deployment to %s", deployment.Status)
+	}
+}
+
+func TestCancelBuild_Rejects(t *testing.T) {
+	tests := []struct {
+		name         string
+		user         string
+		serverId     string
+		deploymentId string
+		wantStatus   int
+		wantError    string
+	}{
+		{"anonymous", "", "server-1", "deploy-1", http.StatusUnauthorized, "unauthorized"},
+		{"finished deployment", "user-1", "server-1", "deploy-1", http.StatusConflict, "build_not_active"},
+		{"unknown server", "user-1", "missing", "deploy-1", http.StatusNotFound, "mcp_server_not_found"},
+		{"another user's server", "user-1", "server-2", "deploy-2", http.StatusForbidden, "forbidden"},
+		{"unknown deployment", "user-1", "server-1", "missing", http.StatusNotFound, "deployment_not_found"},
+		{"another user's deployment", "user-1", "server-1", "deploy-3", http.StatusForbidden, "forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newBuildFixture(t)
+			defer f.jobQueue.Close()
+			createDeployment(t, f.deploymentRepo, "server-1", "deploy-1", models.DeploymentStatusCompleted)
+			createDeployment(t, f.deploymentRepo, "server-2", "deploy-2", models.DeploymentStatusQueued)
+			if err := f.deploymentRepo.Create(context.Background(), &models.Deployment{
+				ServerId: "server-1", DeploymentId: "deploy-3", UserId: "user-2", Status: models.DeploymentStatusQueued,
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			w := f.cancel(tt.user, tt.serverId, tt.deploymentId)
+			if w.Code != tt.wantStatus || errorCode(t, w) != tt.wantError {
+				t.Errorf("Cancel = %d %s, want %d %s", w.Code, w.Body.String(), tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+}
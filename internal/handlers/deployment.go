@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/logstore"
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/repository"
+	"github.com/imyashkale/buildserver/internal/services"
+)
+
+const (
+	defaultDeploymentListLimit = 20
+	maxDeploymentListLimit     = 100
+)
+
+// DeploymentHandler handles deployment read requests
+type DeploymentHandler struct {
+	mcpRepo        repository.MCPRepository
+	deploymentRepo repository.DeploymentRepository
+	logHub         *services.LogHub
+	logStore       logstore.LogStore
+}
+
+// NewDeploymentHandler creates a new deployment handler
+func NewDeploymentHandler(
+	mcpRepo repository.MCPRepository,
+	deploymentRepo repository.DeploymentRepository,
+	logHub *services.LogHub,
+	logStore logstore.LogStore,
+) *DeploymentHandler {
+	return &DeploymentHandler{
+		mcpRepo:        mcpRepo,
+		deploymentRepo: deploymentRepo,
+		logHub:         logHub,
+		logStore:       logStore,
+	}
+}
+
+// GetDeployment returns a single deployment with its stages and the tail of its build log
+func (h *DeploymentHandler) GetDeployment(c *gin.Context) {
+	userId, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	deployment, ok := h.loadDeployment(c, userId, c.Param("server_id"), c.Param("deployment_id"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, deployment.ToResponse())
+}
+
+// ListDeployments returns the caller's deployments, optionally scoped to one MCP server.
+// Query parameters: status, branch, from, to (RFC3339 or YYYY-MM-DD), limit,
+// cursor (next_cursor of the previous page).
+func (h *DeploymentHandler) ListDeployments(c *gin.Context) {
+	userId, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	filter, err := parseDeploymentFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	page, err := parsePageRequest(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ctx := c.Request.Context()
+	serverId := c.Param("server_id")
+
+	var result *models.DeploymentPage
+	if serverId != "" {
+		if !h.authorizeServer(c, userId, serverId) {
+			return
+		}
+		result, err = h.deploymentRepo.ListByUserIdAndServerId(ctx, userId, serverId, filter, page)
+	} else {
+		result, err = h.deploymentRepo.ListByUserId(ctx, userId, filter, page)
+	}
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Invalid cursor",
+		})
+		return
+	}
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"user_id":   userId,
+			"server_id": serverId,
+			"error":     err.Error(),
+		}).Error("Failed to list deployments")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to list deployments",
+		})
+		return
+	}
+
+	response := models.DeploymentListResponse{
+		Deployments: make([]models.DeploymentResponse, 0, len(result.Deployments)),
+		Limit:       page.Limit,
+		NextCursor:  result.NextCursor,
+		HasMore:     result.NextCursor != "",
+	}
+	for _, deployment := range result.Deployments {
+		item := deployment.ToResponse()
+		// Logs can be large; they are only returned by the single deployment endpoint
+		item.BuildLogs = nil
+		response.Deployments = append(response.Deployments, item)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// loadDeployment fetches a deployment after checking that both the MCP server
+// and the deployment belong to the user. It writes the error response and
+// returns false otherwise; another user's deployment is forbidden, as in InitiateBuild.
+func (h *DeploymentHandler) loadDeployment(c *gin.Context, userId, serverId, deploymentId string) (*models.Deployment, bool) {
+	if !h.authorizeServer(c, userId, serverId) {
+		return nil, false
+	}
+
+	deployment, err := h.deploymentRepo.Get(c.Request.Context(), serverId, deploymentId)
+	if err != nil || deployment == nil {
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			logger.WithFields(map[string]interface{}{
+				"user_id":       userId,
+				"server_id":     serverId,
+				"deployment_id": deploymentId,
+				"error":         err.Error(),
+			}).Error("Failed to get deployment")
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "internal_error",
+				"message": "Failed to get deployment",
+			})
+			return nil, false
+		}
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "deployment_not_found",
+			"message": "Deployment not found",
+		})
+		return nil, false
+	}
+
+	if deployment.UserId != userId {
+		logger.WithFields(map[string]interface{}{
+			"user_id":             userId,
+			"server_id":           serverId,
+			"deployment_id":       deploymentId,
+			"deployment_owner_id": deployment.UserId,
+		}).Warn("Deployment request failed: permission denied for deployment")
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "You don't have permission to access this deployment",
+		})
+		return nil, false
+	}
+
+	return deployment, true
+}
+
+// authorizeServer checks that the MCP server exists and belongs to the user.
+// It writes the error response and returns false otherwise; another user's
+// server is forbidden.
+func (h *DeploymentHandler) authorizeServer(c *gin.Context, userId, serverId string) bool {
+	mcp, err := h.mcpRepo.Get(c.Request.Context(), serverId)
+	if err != nil || mcp == nil {
+		logger.WithFields(map[string]interface{}{
+			"user_id":   userId,
+			"server_id": serverId,
+			"error":     err,
+		}).Warn("Deployment request failed: MCP server not found")
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "mcp_server_not_found",
+			"message": "MCP server not found",
+		})
+		return false
+	}
+
+	if mcp.UserId != userId {
+		logger.WithFields(map[string]interface{}{
+			"user_id":      userId,
+			"server_id":    serverId,
+			"mcp_owner_id": mcp.UserId,
+		}).Warn("Deployment request failed: permission denied for MCP server")
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "You don't have permission to access this MCP server",
+		})
+		return false
+	}
+
+	return true
+}
+
+// userIDFromContext returns the authenticated user ID set by the auth middleware.
+// It writes the error response and returns false if it is missing.
+func userIDFromContext(c *gin.Context) (string, bool) {
+	userId, exists := c.Get("user_id")
+	if !exists {
+		logger.Warn("Request failed: user_id not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "unauthorized",
+			"message": "User ID not found in context",
+		})
+		return "", false
+	}
+
+	userIdStr, ok := userId.(string)
+	if !ok {
+		logger.Error("Request failed: invalid user_id format in context")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Invalid user ID format",
+		})
+		return "", false
+	}
+
+	return userIdStr, true
+}
+
+// parseDeploymentFilter reads the status, branch, from and to query parameters
+func parseDeploymentFilter(c *gin.Context) (models.DeploymentFilter, error) {
+	filter := models.DeploymentFilter{
+		Status: models.DeploymentStatus(c.Query("status")),
+		Branch: c.Query("branch"),
+	}
+
+	if filter.Status != "" && !filter.Status.IsValid() {
+		return filter, errors.New("invalid status filter")
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, _, err := parseFilterTime(from)
+		if err != nil {
+			return filter, errors.New("invalid from date, expected RFC3339 or YYYY-MM-DD")
+		}
+		filter.CreatedAfter = t
+	}
+
+	if to := c.Query("to"); to != "" {
+		t, dateOnly, err := parseFilterTime(to)
+		if err != nil {
+			return filter, errors.New("invalid to date, expected RFC3339 or YYYY-MM-DD")
+		}
+		// A plain date includes the whole day
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.CreatedBefore = t
+	}
+
+	return filter, nil
+}
+
+// parseFilterTime parses an RFC3339 timestamp or a plain date
+func parseFilterTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	return t, true, err
+}
+
+// parsePageRequest reads the limit and cursor query parameters
+func parsePageRequest(c *gin.Context) (models.PageRequest, error) {
+	page := models.PageRequest{
+		Limit:  defaultDeploymentListLimit,
+		Cursor: c.Query("cursor"),
+	}
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return page, errors.New("limit must be a positive integer")
+		}
+		page.Limit = min(n, maxDeploymentListLimit)
+	}
+
+	return page, nil
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+const (
+	defaultLogPageLimit = 200
+	maxLogPageLimit     = 1000
+
+	// logCursorPrefix versions the cursor format so it can change without breaking clients
+	logCursorPrefix = "v1:"
+)
+
+// GetLogs returns one page of a deployment's full build log.
+// Query parameters: cursor (next_cursor of the previous page), limit.
+func (h *DeploymentHandler) GetLogs(c *gin.Context) {
+	userId, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	offset, err := decodeLogCursor(c.Query("cursor"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	limit := defaultLogPageLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "bad_request",
+				"message": "limit must be a positive integer",
+			})
+			return
+		}
+		limit = min(n, maxLogPageLimit)
+	}
+
+	deployment, ok := h.loadDeployment(c, userId, c.Param("server_id"), c.Param("deployment_id"))
+	if !ok {
+		return
+	}
+
+	entries, more, err := h.readLogs(c.Request.Context(), deployment, offset, limit)
+	if err != nil {
+		logger.WithFields(map[string]interface{}{
+			"user_id":       userId,
+			"server_id":     deployment.ServerId,
+			"deployment_id": deployment.DeploymentId,
+			"error":         err.Error(),
+		}).Error("Failed to read build logs")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to read build logs",
+		})
+		return
+	}
+
+	response := models.BuildLogPageResponse{
+		Entries: entries,
+		HasMore: more,
+	}
+	if more {
+		response.NextCursor = encodeLogCursor(offset + len(entries))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// readLogs returns up to limit entries of the full build log starting at offset.
+// Deployments without a log reference only have the log kept on the record.
+func (h *DeploymentHandler) readLogs(ctx context.Context, deployment *models.Deployment, offset, limit int) ([]models.BuildLogEntry, bool, error) {
+	if ref := deployment.LogRef; ref != nil {
+		if ref.Store == h.logStore.Name() {
+			return h.logStore.Read(ctx, ref.Key, offset, limit)
+		}
+		logger.WithFields(map[string]interface{}{
+			"server_id":     deployment.ServerId,
+			"deployment_id": deployment.DeploymentId,
+			"log_store":     ref.Store,
+		}).Warn("Build log is held by a log store that is not configured, serving the stored tail")
+	}
+
+	logs := deployment.BuildLogs
+	if offset >= len(logs) {
+		return []models.BuildLogEntry{}, false, nil
+	}
+	end := min(offset+limit, len(logs))
+	return logs[offset:end], end < len(logs), nil
+}
+
+// encodeLogCursor returns the opaque cursor for a log offset
+func encodeLogCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(logCursorPrefix + strconv.Itoa(offset)))
+}
+
+// decodeLogCursor returns the log offset encoded in a cursor; an empty cursor is the start of the log
+func decodeLogCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	invalid := errors.New("invalid cursor")
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, invalid
+	}
+	value, ok := strings.CutPrefix(string(data), logCursorPrefix)
+	if !ok {
+		return 0, invalid
+	}
+	offset, err := strconv.Atoi(value)
+	if err != nil || offset < 0 {
+		return 0, invalid
+	}
+	return offset, nil
+}
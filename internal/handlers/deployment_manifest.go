@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/services"
+)
+
+// GetManifest returns the tools, resources and prompts the deployment's
+// server offered when its image was verified
+func (h *DeploymentHandler) GetManifest(c *gin.Context) {
+	userId, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	deployment, ok := h.loadDeployment(c, userId, c.Param("server_id"), c.Param("deployment_id"))
+	if !ok {
+		return
+	}
+	if deployment.Manifest == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "manifest_not_found",
+			"message": "Deployment has no manifest; it was not verified or has not completed",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ManifestResponse{
+		ServerId:     deployment.ServerId,
+		DeploymentId: deployment.DeploymentId,
+		CommitHash:   deployment.CommitHash,
+		Manifest:     deployment.Manifest,
+	})
+}
+
+// CompareManifests lists the changes from the manifest of the deployment
+// given by the base query parameter to the manifest of this deployment,
+// flagging the ones that break existing clients. Both deployments must
+// belong to the same MCP server.
+func (h *DeploymentHandler) CompareManifests(c *gin.Context) {
+	userId, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	baseId := c.Query("base")
+	if baseId == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "base is required: the deployment ID to compare against",
+		})
+		return
+	}
+
+	serverId := c.Param("server_id")
+	deployment, ok := h.loadDeployment(c, userId, serverId, c.Param("deployment_id"))
+	if !ok {
+		return
+	}
+	base, ok := h.loadDeployment(c, userId, serverId, baseId)
+	if !ok {
+		return
+	}
+
+	for _, d := range []*models.Deployment{base, deployment} {
+		if d.Manifest == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "manifest_not_found",
+				"message": "Deployment " + d.DeploymentId + " has no manifest to compare",
+			})
+			return
+		}
+	}
+
+	changes := services.CompareManifests(base.Manifest, deployment.Manifest)
+	response := models.ManifestComparison{
+		ServerId:         serverId,
+		BaseDeploymentId: base.DeploymentId,
+		DeploymentId:     deployment.DeploymentId,
+		Changes:          make([]models.ManifestChange, 0, len(changes)),
+	}
+	for _, change := range changes {
+		response.Breaking = response.Breaking || change.Breaking
+		response.Changes = append(response.Changes, change)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
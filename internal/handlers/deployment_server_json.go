@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetServerJSON downloads the MCP registry server.json generated for the
+// deployment's image, ready to publish with the registry's publisher CLI
+func (h *DeploymentHandler) GetServerJSON(c *gin.Context) {
+	userId, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	deployment, ok := h.loadDeployment(c, userId, c.Param("server_id"), c.Param("deployment_id"))
+	if !ok {
+		return
+	}
+	if deployment.ServerJSON == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "server_json_not_found",
+			"message": "Deployment has no server.json; its image has not been pushed",
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="server.json"`)
+	c.IndentedJSON(http.StatusOK, deployment.ServerJSON)
+}
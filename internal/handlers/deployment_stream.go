@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/services"
+)
+
+const (
+	// logStreamPollInterval is how often the stream re-reads a deployment that is not running in this process
+	logStreamPollInterval = 2 * time.Second
+
+	// logStreamKeepAlive is how often a comment is sent to keep idle connections open
+	logStreamKeepAlive = 15 * time.Second
+
+	// logStreamBuffer is how many entries a live follower may fall behind before it has to replay
+	logStreamBuffer = 256
+
+	// logStreamPageSize is how many persisted entries are read from the log store at a time
+	logStreamPageSize = 500
+)
+
+// logStream writes build log entries as Server-Sent Events. Event IDs are
+// "<attempt>:<seq>", the build attempt that logged the entry and its sequence
+// number in that attempt's log, so a client can resume with Last-Event-ID
+// after reconnecting. A retried build starts a new log with a higher attempt,
+// which is replayed from its start.
+type logStream struct {
+	c       *gin.Context
+	attempt int // attempt of the last entry sent
+	seq     int // sequence number of the last entry sent
+}
+
+// StreamLogs streams a deployment's build log over Server-Sent Events.
+// Earlier entries are replayed on connect, and a final "status" event carries
+// the terminal deployment status.
+func (h *DeploymentHandler) StreamLogs(c *gin.Context) {
+	userId, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+
+	serverId := c.Param("server_id")
+	deploymentId := c.Param("deployment_id")
+
+	deployment, ok := h.loadDeployment(c, userId, serverId, deploymentId)
+	if !ok {
+		return
+	}
+
+	stream := &logStream{c: c}
+	stream.attempt, stream.seq = parseLastEventID(c)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	logger.WithFields(map[string]interface{}{
+		"user_id":       userId,
+		"server_id":     serverId,
+		"deployment_id": deploymentId,
+		"last_event_id": stream.eventID(),
+	}).Debug("Build log stream opened")
+
+	ctx := c.Request.Context()
+	keepAlive := time.NewTicker(logStreamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		// Follow the build live if it is running in this process
+		if live := h.logHub.Get(serverId, deploymentId); live != nil {
+			if status, done := stream.follow(ctx, live, keepAlive.C); done {
+				stream.sendStatus(status)
+				return
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		// Otherwise replay what has been persisted so far
+		if err := h.sendPersistedLogs(ctx, stream, deployment); err != nil {
+			logger.WithFields(map[string]interface{}{
+				"server_id":     serverId,
+				"deployment_id": deploymentId,
+				"error":         err.Error(),
+			}).Warn("Build log stream stopped: failed to read build logs")
+			return
+		}
+		if deployment.Status.IsTerminal() {
+			stream.sendStatus(string(deployment.Status))
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-keepAlive.C:
+			stream.sendKeepAlive()
+		case <-time.After(logStreamPollInterval):
+		}
+
+		refreshed, err := h.deploymentRepo.Get(ctx, serverId, deploymentId)
+		if err != nil || refreshed == nil {
+			if ctx.Err() == nil {
+				logger.WithFields(map[string]interface{}{
+					"server_id":     serverId,
+					"deployment_id": deploymentId,
+					"error":         err,
+				}).Warn("Build log stream stopped: failed to reload deployment")
+			}
+			return
+		}
+		deployment = refreshed
+	}
+}
+
+// sendPersistedLogs sends the persisted entries after the last one the client has seen
+func (h *DeploymentHandler) sendPersistedLogs(ctx context.Context, s *logStream, deployment *models.Deployment) error {
+	// The log store holds the log of the latest attempt only, so reading
+	// resumes after the last entry sent if that is still the attempt stored.
+	// The tail kept on the deployment record is small and read in full.
+	offset := 0
+	if ref := deployment.LogRef; ref != nil && ref.Store == h.logStore.Name() && ref.Attempt == s.attempt {
+		offset = s.seq
+	}
+
+	resumed := offset > 0
+	for {
+		entries, more, err := h.readLogs(ctx, deployment, offset, logStreamPageSize)
+		if err != nil {
+			return err
+		}
+		if resumed && len(entries) > 0 && entries[0].Attempt != s.attempt {
+			// A retry replaced the log after the deployment was read
+			offset, resumed = 0, false
+			continue
+		}
+		resumed = false
+
+		for i, entry := range entries {
+			if entry.Seq == 0 {
+				// Logged before entries were numbered
+				entry.Seq = offset + i + 1
+			}
+			s.send(entry)
+		}
+		offset += len(entries)
+		if !more || len(entries) == 0 {
+			return nil
+		}
+	}
+}
+
+// follow streams entries from a live logger. It returns the final status and
+// true once the build has finished, or false if the follower fell behind or
+// the client went away.
+func (s *logStream) follow(ctx context.Context, live *services.BuildLogger, keepAlive <-chan time.Time) (string, bool) {
+	backlog, entries, unsubscribe := live.Subscribe(logStreamBuffer)
+	defer unsubscribe()
+
+	for _, entry := range backlog {
+		s.send(entry)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", false
+		case <-keepAlive:
+			s.sendKeepAlive()
+		case entry, ok := <-entries:
+			if !ok {
+				return live.Status()
+			}
+			s.send(entry)
+		}
+	}
+}
+
+// send writes a single log event, unless the client has already seen the
+// entry. Entries of an earlier attempt than the one followed are skipped.
+func (s *logStream) send(entry models.BuildLogEntry) {
+	if entry.Attempt < s.attempt || (entry.Attempt == s.attempt && entry.Seq <= s.seq) {
+		return
+	}
+	s.attempt, s.seq = entry.Attempt, entry.Seq
+
+	s.c.Render(-1, sse.Event{
+		Id:    s.eventID(),
+		Event: "log",
+		Data:  entry,
+	})
+	s.c.Writer.Flush()
+}
+
+// eventID returns the ID of the last entry sent
+func (s *logStream) eventID() string {
+	return fmt.Sprintf("%d:%d", s.attempt, s.seq)
+}
+
+// sendStatus writes the final event carrying the terminal status
+func (s *logStream) sendStatus(status string) {
+	s.c.Render(-1, sse.Event{
+		Event: "status",
+		Data: gin.H{
+			"server_id":     s.c.Param("server_id"),
+			"deployment_id": s.c.Param("deployment_id"),
+			"status":        status,
+		},
+	})
+	s.c.Writer.Flush()
+}
+
+// sendKeepAlive writes an SSE comment so proxies do not close an idle stream
+func (s *logStream) sendKeepAlive() {
+	s.c.Writer.WriteString(": keep-alive\n\n")
+	s.c.Writer.Flush()
+}
+
+// parseLastEventID reads the attempt and sequence number to resume after from
+// the Last-Event-ID header (or the last_event_id query parameter for clients
+// that cannot set headers). A missing or malformed ID replays the whole log.
+func parseLastEventID(c *gin.Context) (int, int) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+
+	attemptValue, seqValue, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, 0
+	}
+	attempt, err := strconv.Atoi(attemptValue)
+	if err != nil || attempt < 0 {
+		return 0, 0
+	}
+	seq, err := strconv.Atoi(seqValue)
+	if err != nil || seq < 0 {
+		return 0, 0
+	}
+	return attempt, seq
+}
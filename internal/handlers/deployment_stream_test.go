@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/logstore"
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/services"
+)
+
+// sseEvent is one event of a Server-Sent Events response
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// stream requests the log stream of a server-1 deployment as user-1, resuming after lastEventID
+func (f *deploymentFixture) stream(t *testing.T, deploymentId, lastEventID string) []sseEvent {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/deployments/server-1/"+deploymentId+"/logs/stream", nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	w := serve(f.handler.StreamLogs, "/deployments/:server_id/:deployment_id/logs/stream", "user-1", req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("StreamLogs = %d: %s", w.Code, w.Body.String())
+	}
+
+	var events []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(w.Body.String()), "\n\n") {
+		var event sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			field, value, _ := strings.Cut(line, ":")
+			switch field {
+			case "id":
+				event.id = value
+			case "event":
+				event.event = value
+			case "data":
+				event.data = value
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// streamed returns the IDs and messages of the log events, and the status carried by the final event
+func streamed(t *testing.T, events []sseEvent) (string, string) {
+	t.Helper()
+	var logs []string
+	for _, event := range events[:len(events)-1] {
+		var entry models.BuildLogEntry
+		if event.event != "log" || json.Unmarshal([]byte(event.data), &entry) != nil {
+			t.Fatalf("Unexpected event %+v before the status event", event)
+		}
+		logs = append(logs, event.id+" "+entry.Message)
+	}
+
+	last := events[len(events)-1]
+	var status struct {
+		Status string `json:"status"`
+	}
+	if last.event != "status" || last.id != "" || json.Unmarshal([]byte(last.data), &status) != nil {
+		t.Fatalf("Stream did not end with a status event: %+v", last)
+	}
+	return strings.Join(logs, ", "), status.Status
+}
+
+// numbered returns entries first..last of a build attempt's log
+func numbered(attempt, first, last int) []models.BuildLogEntry {
+	var entries []models.BuildLogEntry
+	for seq := first; seq <= last; seq++ {
+		entries = append(entries, models.BuildLogEntry{Stage: "build_image", Level: "info", Message: fmt.Sprintf("line %d", seq), Attempt: attempt, Seq: seq})
+	}
+	return entries
+}
+
+func TestStreamLogs_ReplaysPersistedLog(t *testing.T) {
+	f := newDeploymentFixture(t)
+
+	// The second attempt of a retried build replaced the first attempt's log
+	stored := f.add(t, "server-1", "stored", "user-1", models.DeploymentStatusCompleted)
+	key := logstore.Key("server-1", "stored")
+	if err := f.logStore.Append(context.Background(), key, 0, numbered(2, 1, 3)); err != nil {
+		t.Fatal(err)
+	}
+	stored.LogRef = &models.LogReference{Store: f.logStore.Name(), Key: key, Entries: 3, Attempt: 2}
+
+	// The log store was unavailable, so the record holds the size-limited log
+	// that starts with a notice standing in for the dropped entries 1-6
+	truncated := f.add(t, "server-1", "truncated", "user-1", models.DeploymentStatusFailed)
+	notice := models.BuildLogEntry{Stage: "system", Level: "warning", Message: "truncated", Attempt: 1, Seq: 6}
+	truncated.BuildLogs = append([]models.BuildLogEntry{notice}, numbered(1, 7, 9)...)
+
+	for _, deployment := range []*models.Deployment{stored, truncated} {
+		if err := f.deploymentRepo.Update(context.Background(), deployment, deployment.Status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		deployment  string
+		lastEventID string
+		wantLogs    string
+		wantStatus  string
+	}{
+		{"full replay", "stored", "", "2:1 line 1, 2:2 line 2, 2:3 line 3", "completed"},
+		{"resume", "stored", "2:1", "2:2 line 2, 2:3 line 3", "completed"},
+		{"resume at the end", "stored", "2:3", "", "completed"},
+		{"resume from the previous attempt", "stored", "1:2", "2:1 line 1, 2:2 line 2, 2:3 line 3", "completed"},
+		{"malformed ID", "stored", "2", "2:1 line 1, 2:2 line 2, 2:3 line 3", "completed"},
+		{"full truncated replay", "truncated", "", "1:6 truncated, 1:7 line 7, 1:8 line 8, 1:9 line 9", "failed"},
+		{"resume before the truncation", "truncated", "1:2", "1:6 truncated, 1:7 line 7, 1:8 line 8, 1:9 line 9", "failed"},
+		{"resume after the truncation", "truncated", "1:6", "1:7 line 7, 1:8 line 8, 1:9 line 9", "failed"},
+		{"resume within the tail", "truncated", "1:8", "1:9 line 9", "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs, status := streamed(t, f.stream(t, tt.deployment, tt.lastEventID))
+			if logs != tt.wantLogs || status != tt.wantStatus {
+				t.Errorf("Streamed %q then %s, want %q then %s", logs, status, tt.wantLogs, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestStreamLogs_FollowsLiveBuild(t *testing.T) {
+	f := newDeploymentFixture(t)
+	f.add(t, "server-1", "deploy-1", "user-1", models.DeploymentStatusInProgress)
+
+	live := services.NewBuildLogger()
+	live.SetAttempt(1)
+	f.logHub.Register("server-1", "deploy-1", live)
+	live.LogInfo("clone", "line 1")
+	live.LogInfo("clone", "line 2")
+
+	done := make(chan []sseEvent)
+	go func() { done <- f.stream(t, "deploy-1", "1:1") }()
+
+	live.LogInfo("build_image", "line 3")
+	live.Finish(string(models.DeploymentStatusCompleted))
+
+	logs, status := streamed(t, <-done)
+	if want := "1:2 line 2, 1:3 line 3"; logs != want || status != "completed" {
+		t.Errorf("Streamed %q then %s, want %q then completed", logs, status, want)
+	}
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/logstore"
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/repository"
+	"github.com/imyashkale/buildserver/internal/services"
+)
+
+// deploymentFixture is a deployment handler over in-memory repositories and a
+// file log store. user-1 owns server-1 and server-3, user-2 owns server-2.
+type deploymentFixture struct {
+	handler        *DeploymentHandler
+	mcpRepo        *repository.MemoryMCPRepository
+	deploymentRepo *repository.MemoryDeploymentRepository
+	logHub         *services.LogHub
+	logStore       logstore.LogStore
+	created        time.Time
+}
+
+func newDeploymentFixture(t *testing.T) *deploymentFixture {
+	t.Helper()
+	logStore, err := logstore.NewFileLogStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create log store: %v", err)
+	}
+	f := &deploymentFixture{
+		mcpRepo:        repository.NewMemoryMCPRepository(),
+		deploymentRepo: repository.NewMemoryDeploymentRepository(),
+		logHub:         services.NewLogHub(),
+		logStore:       logStore,
+		created:        time.Date(2024, 11, 11, 10, 0, 0, 0, time.UTC),
+	}
+	f.handler = NewDeploymentHandler(f.mcpRepo, f.deploymentRepo, f.logHub, logStore)
+	createServer(t, f.mcpRepo, "server-1", "user-1")
+	createServer(t, f.mcpRepo, "server-2", "user-2")
+	createServer(t, f.mcpRepo, "server-3", "user-1")
+	return f
+}
+
+// add stores a deployment, each one created a minute after the previous one
+func (f *deploymentFixture) add(t *testing.T, serverId, deploymentId, userId string, status models.DeploymentStatus) *models.Deployment {
+	t.Helper()
+	f.created = f.created.Add(time.Minute)
+	deployment := &models.Deployment{
+		ServerId:     serverId,
+		DeploymentId: deploymentId,
+		UserId:       userId,
+		Branch:       "main",
+		CommitHash:   "abc123",
+		Status:       status,
+		CreatedAt:    f.created,
+		UpdatedAt:    f.created,
+	}
+	if err := f.deploymentRepo.Create(context.Background(), deployment); err != nil {
+		t.Fatalf("Failed to create deployment %s: %v", deploymentId, err)
+	}
+	return deployment
+}
+
+func TestGetDeployment_OnlyOwnDeployments(t *testing.T) {
+	f := newDeploymentFixture(t)
+	f.add(t, "server-1", "deploy-1", "user-1", models.DeploymentStatusCompleted)
+	f.add(t, "server-1", "deploy-other", "user-2", models.DeploymentStatusCompleted)
+	f.add(t, "server-2", "deploy-2", "user-2", models.DeploymentStatusCompleted)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantError  string
+	}{
+		{"/deployments/server-1/deploy-1", http.StatusOK, ""},
+		{"/deployments/server-1/deploy-other", http.StatusForbidden, "forbidden"},
+		{"/deployments/server-1/missing", http.StatusNotFound, "deployment_not_found"},
+		{"/deployments/server-2/deploy-2", http.StatusForbidden, "forbidden"},
+		{"/deployments/missing/deploy-1", http.StatusNotFound, "mcp_server_not_found"},
+	}
+	for _, tt := range tests {
+		w := f.getDeployment(tt.path, "user-1")
+		if w.Code != tt.wantStatus {
+			t.Errorf("GET %s = %d, want %d: %s", tt.path, w.Code, tt.wantStatus, w.Body.String())
+			continue
+		}
+		if tt.wantError != "" && errorCode(t, w) != tt.wantError {
+			t.Errorf("GET %s error = %s, want %s", tt.path, errorCode(t, w), tt.wantError)
+		}
+	}
+
+	if w := f.getDeployment("/deployments/server-1/deploy-1", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Anonymous GET = %d, want 401", w.Code)
+	}
+}
+
+func TestListDeployments_FiltersAndPages(t *testing.T) {
+	f := newDeploymentFixture(t)
+	f.add(t, "server-1", "s1-completed-1", "user-1", models.DeploymentStatusCompleted)
+	f.add(t, "server-1", "s1-failed", "user-1", models.DeploymentStatusFailed)
+	f.add(t, "server-3", "s3-completed", "user-1", models.DeploymentStatusCompleted)
+	f.add(t, "server-1", "s1-completed-2", "user-1", models.DeploymentStatusCompleted)
+	f.add(t, "server-2", "s2-completed", "user-2", models.DeploymentStatusCompleted)
+	f.add(t, "server-1", "s1-other-user", "user-2", models.DeploymentStatusCompleted)
+
+	tests := []struct {
+		name  string
+		route string
+		query string
+		want  []string // newest first
+	}{
+		{"all of the user's", "/deployments", "", []string{"s1-completed-2", "s3-completed", "s1-failed", "s1-completed-1"}},
+		{"by status", "/deployments", "status=completed", []string{"s1-completed-2", "s3-completed", "s1-completed-1"}},
+		{"by server", "/deployments/server-1", "", []string{"s1-completed-2", "s1-failed", "s1-completed-1"}},
+		{"by server and status", "/deployments/server-1", "status=failed", []string{"s1-failed"}},
+		{"by date", "/deployments", "from=2024-11-11T10:02:00Z&to=2024-11-11T10:03:00Z", []string{"s1-failed"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Page through with a page size of 2 so every listing needs its cursor
+			var got []string
+			query := url.Values{}
+			if tt.query != "" {
+				query, _ = url.ParseQuery(tt.query)
+			}
+			query.Set("limit", "2")
+			for page := 0; ; page++ {
+				if page > len(tt.want) {
+					t.Fatalf("Listing did not end after %d pages", page)
+				}
+				w := f.list(tt.route, query.Encode())
+				if w.Code != http.StatusOK {
+					t.Fatalf("List = %d: %s", w.Code, w.Body.String())
+				}
+				var response models.DeploymentListResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatal(err)
+				}
+				for _, deployment := range response.Deployments {
+					got = append(got, deployment.DeploymentId)
+					if deployment.BuildLogs != nil {
+						t.Errorf("List item %s carries build logs", deployment.DeploymentId)
+					}
+				}
+				if response.HasMore != (response.NextCursor != "") {
+					t.Errorf("has_more = %v with next_cursor %q", response.HasMore, response.NextCursor)
+				}
+				if !response.HasMore {
+					break
+				}
+				query.Set("cursor", response.NextCursor)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Listed %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListDeployments_Rejects(t *testing.T) {
+	f := newDeploymentFixture(t)
+	f.add(t, "server-1", "deploy-1", "user-1", models.DeploymentStatusCompleted)
+	f.add(t, "server-1", "deploy-2", "user-1", models.DeploymentStatusCompleted)
+
+	// A cursor of the user-wide listing
+	w := f.list("/deployments", "limit=1")
+	var first models.DeploymentListResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil || first.NextCursor == "" {
+		t.Fatalf("First page = %s", w.Body.String())
+	}
+
+	tests := []struct {
+		name       string
+		route      string
+		query      string
+		wantStatus int
+		wantError  string
+	}{
+		{"malformed cursor", "/deployments", "cursor=not-a-cursor", http.StatusBadRequest, "bad_request"},
+		{"cursor of another listing", "/deployments/server-1", "cursor=" + first.NextCursor, http.StatusBadRequest, "bad_request"},
+		{"invalid status", "/deployments", "status=done", http.StatusBadRequest, "bad_request"},
+		{"invalid limit", "/deployments", "limit=0", http.StatusBadRequest, "bad_request"},
+		{"invalid date", "/deployments", "from=yesterday", http.StatusBadRequest, "bad_request"},
+		{"another user's server", "/deployments/server-2", "", http.StatusForbidden, "forbidden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := f.list(tt.route, tt.query)
+			if w.Code != tt.wantStatus || errorCode(t, w) != tt.wantError {
+				t.Errorf("List = %d %s, want %d %s", w.Code, w.Body.String(), tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestGetLogs_PagesThroughTheFullLog(t *testing.T) {
+	f := newDeploymentFixture(t)
+	stored := f.add(t, "server-1", "stored", "user-1", models.DeploymentStatusCompleted)
+	tail := f.add(t, "server-1", "tail-only", "user-1", models.DeploymentStatusCompleted)
+
+	// One deployment offloaded five entries to the log store, the other predates it
+	entries := make([]models.BuildLogEntry, 5)
+	for i := range entries {
+		entries[i] = models.BuildLogEntry{Stage: "clone", Level: "info", Message: fmt.Sprintf("line %d", i)}
+	}
+	key := logstore.Key("server-1", "stored")
+	if err := f.logStore.Append(context.Background(), key, 0, entries); err != nil {
+		t.Fatal(err)
+	}
+	stored.LogRef = &models.LogReference{Store: f.logStore.Name(), Key: key, Entries: len(entries)}
+	stored.BuildLogs = entries[3:]
+	tail.BuildLogs = entries
+	for _, deployment := range []*models.Deployment{stored, tail} {
+		if err := f.deploymentRepo.Update(context.Background(), deployment, deployment.Status); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, deploymentId := range []string{"stored", "tail-only"} {
+		t.Run(deploymentId, func(t *testing.T) {
+			var got []string
+			cursor := ""
+			for page := 0; page < 5; page++ {
+				w := f.logs(deploymentId, "limit=2&cursor="+cursor)
+				if w.Code != http.StatusOK {
+					t.Fatalf("GetLogs = %d: %s", w.Code, w.Body.String())
+				}
+				var response models.BuildLogPageResponse
+				if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+					t.Fatal(err)
+				}
+				for _, entry := range response.Entries {
+					got = append(got, entry.Message)
+				}
+				if !response.HasMore {
+					break
+				}
+				cursor = response.NextCursor
+			}
+			if want := "[line 0 line 1 line 2 line 3 line 4]"; fmt.Sprint(got) != want {
+				t.Errorf("Read %v, want %s", got, want)
+			}
+		})
+	}
+
+	tests := []struct {
+		name       string
+		deployment string
+		query      string
+		wantStatus int
+		wantError  string
+	}{
+		{"malformed cursor", "stored", "cursor=bm9wZQ", http.StatusBadRequest, "bad_request"},
+		{"negative cursor", "stored", "cursor=" + encodeLogCursor(-1), http.StatusBadRequest, "bad_request"},
+		{"invalid limit", "stored", "limit=-1", http.StatusBadRequest, "bad_request"},
+		{"unknown deployment", "missing", "", http.StatusNotFound, "deployment_not_found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := f.logs(tt.deployment, tt.query)
+			if w.Code != tt.wantStatus || errorCode(t, w) != tt.wantError {
+				t.Errorf("GetLogs = %d %s, want %d %s", w.Code, w.Body.String(), tt.wantStatus, tt.wantError)
+			}
+		})
+	}
+}
+
+// getDeployment requests a single deployment as user
+func (f *deploymentFixture) getDeployment(path, user string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	return serve(f.handler.GetDeployment, "/deployments/:server_id/:deployment_id", user, req)
+}
+
+// list requests a deployment listing as user-1
+func (f *deploymentFixture) list(path, query string) *httptest.ResponseRecorder {
+	route := "/deployments"
+	if path != route {
+		route = "/deployments/:server_id"
+	}
+	req := httptest.NewRequest(http.MethodGet, path+"?"+query, nil)
+	return serve(f.handler.ListDeployments, route, "user-1", req)
+}
+
+// logs requests a page of a server-1 deployment's log as user-1
+func (f *deploymentFixture) logs(deploymentId, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/deployments/server-1/"+deploymentId+"/logs?"+query, nil)
+	return serve(f.handler.GetLogs, "/deployments/:server_id/:deployment_id/logs", "user-1", req)
+}
@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/imyashkale/buildserver/internal/mhiveconfig"
+)
+
+// SchemaHandler serves the JSON Schemas of the files the build server reads
+type SchemaHandler struct{}
+
+// NewSchemaHandler creates a new schema handler
+func NewSchemaHandler() *SchemaHandler {
+	return &SchemaHandler{}
+}
+
+// MhiveConfig returns the JSON Schema of mhive.config.yaml
+func (h *SchemaHandler) MhiveConfig(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, "application/schema+json", mhiveconfig.JSONSchema())
+}
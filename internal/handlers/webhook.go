@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/repository"
+	"github.com/imyashkale/buildserver/internal/services"
+)
+
+// maxWebhookPayload is the largest payload GitHub sends
+const maxWebhookPayload = 25 << 20
+
+// WebhookHandler receives webhooks from GitHub
+type WebhookHandler struct {
+	webhookService *services.WebhookService
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(webhookService *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// GitHub handles a GitHub webhook delivery. It is not behind the
+// authentication middleware; the delivery's signature authenticates it.
+func (h *WebhookHandler) GitHub(c *gin.Context) {
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookPayload))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Failed to read the webhook payload",
+		})
+		return
+	}
+
+	delivery := services.GitHubDelivery{
+		ID:        c.GetHeader("X-GitHub-Delivery"),
+		Event:     c.GetHeader("X-GitHub-Event"),
+		Signature: c.GetHeader("X-Hub-Signature-256"),
+		Payload:   payload,
+	}
+	fields := map[string]interface{}{
+		"delivery_id": delivery.ID,
+		"event":       delivery.Event,
+	}
+
+	response, err := h.webhookService.HandleGitHubDelivery(c.Request.Context(), delivery)
+	switch {
+	case errors.Is(err, services.ErrWebhookPayload):
+		fields["error"] = err.Error()
+		logger.WithFields(fields).Warn("GitHub webhook rejected: invalid delivery")
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_webhook",
+			"message": err.Error(),
+		})
+	case errors.Is(err, services.ErrWebhookSignature):
+		logger.WithFields(fields).Warn("GitHub webhook rejected: signature does not match")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "invalid_signature",
+			"message": "X-Hub-Signature-256 does not match the webhook secret of any MCP server of the repository",
+		})
+	case errors.Is(err, services.ErrWebhookNoServer):
+		logger.WithFields(fields).Warn("GitHub webhook rejected: no MCP server for the repository")
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "mcp_not_found",
+			"message": "No MCP server with a webhook secret is built from this repository",
+		})
+	case err != nil:
+		fields["error"] = err.Error()
+		logger.WithFields(fields).Error("GitHub webhook failed")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "webhook_failed",
+			"message": "Failed to handle the webhook; redeliver it to retry",
+		})
+	case queuedBuild(response):
+		c.JSON(http.StatusAccepted, response)
+	default:
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// queuedBuild reports whether the delivery queued a build for any server
+func queuedBuild(response *models.WebhookResponse) bool {
+	for _, build := range response.Builds {
+		if build.Status == models.WebhookBuildQueued {
+			return true
+		}
+	}
+	return false
+}
+
+// SetSecret sets or removes the GitHub webhook secret of one of the user's
+// MCP servers. The secret is never returned; the response only tells whether
+// one is set.
+func (h *WebhookHandler) SetSecret(c *gin.Context) {
+	userId, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+	serverId := c.Param("server_id")
+	fields := map[string]interface{}{
+		"user_id":   userId,
+		"server_id": serverId,
+	}
+
+	var req models.SetWebhookSecretRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Request body must be JSON with a secret",
+		})
+		return
+	}
+
+	server, err := h.webhookService.SetWebhookSecret(c.Request.Context(), userId, serverId, req.Secret)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		logger.WithFields(fields).Warn("Webhook secret not set: MCP server not found")
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "mcp_server_not_found",
+			"message": "MCP server not found",
+		})
+		return
+	case errors.Is(err, services.ErrWebhookForbidden):
+		logger.WithFields(fields).Warn("Webhook secret not set: permission denied for MCP server")
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "You don't have permission to access this MCP server",
+		})
+		return
+	case errors.Is(err, services.ErrWebhookSecret):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_webhook_secret",
+			"message": err.Error(),
+		})
+		return
+	case err != nil:
+		fields["error"] = err.Error()
+		logger.WithFields(fields).Error("Failed to set webhook secret")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to set the webhook secret",
+		})
+		return
+	}
+
+	fields["webhook_enabled"] = server.WebhookSecret != ""
+	logger.WithFields(fields).Info("Webhook secret updated")
+	c.JSON(http.StatusOK, server.ToResponse())
+}
+
+// SetAutoBuildBranches sets the branch patterns pushes to which build one of
+// the user's MCP servers
+func (h *WebhookHandler) SetAutoBuildBranches(c *gin.Context) {
+	userId, ok := userIDFromContext(c)
+	if !ok {
+		return
+	}
+	serverId := c.Param("server_id")
+	fields := map[string]interface{}{
+		"user_id":   userId,
+		"server_id": serverId,
+	}
+
+	var req models.SetAutoBuildBranchesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "bad_request",
+			"message": "Request body must be JSON with a list of branches",
+		})
+		return
+	}
+
+	server, err := h.webhookService.SetAutoBuildBranches(c.Request.Context(), userId, serverId, req.Branches)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		logger.WithFields(fields).Warn("Auto-build branches not set: MCP server not found")
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "mcp_server_not_found",
+			"message": "MCP server not found",
+		})
+		return
+	case errors.Is(err, services.ErrWebhookForbidden):
+		logger.WithFields(fields).Warn("Auto-build branches not set: permission denied for MCP server")
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "forbidden",
+			"message": "You don't have permission to access this MCP server",
+		})
+		return
+	case errors.Is(err, services.ErrAutoBuildBranches):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_auto_build_branches",
+			"message": err.Error(),
+		})
+		return
+	case err != nil:
+		fields["error"] = err.Error()
+		logger.WithFields(fields).Error("Failed to set auto-build branches")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "internal_error",
+			"message": "Failed to set the auto-build branches",
+		})
+		return
+	}
+
+	fields["auto_build_branches"] = server.AutoBuildBranches
+	logger.WithFields(fields).Info("Auto-build branches updated")
+	c.JSON(http.StatusOK, server.ToResponse())
+}
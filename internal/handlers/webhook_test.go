@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/queue"
+	"github.com/imyashkale/buildserver/internal/repository"
+	"github.com/imyashkale/buildserver/internal/services"
+)
+
+// fakeCipher marks secrets as encrypted without encrypting them
+type fakeCipher struct{}
+
+func (fakeCipher) EncryptToken(token string) (string, error) {
+	return "encrypted:" + token, nil
+}
+
+func (fakeCipher) DecryptToken(encryptedToken string) (string, error) {
+	return strings.TrimPrefix(encryptedToken, "encrypted:"), nil
+}
+
+// webhookFixture is a webhook handler over in-memory repositories and job queue
+type webhookFixture struct {
+	handler        *WebhookHandler
+	mcpRepo        *repository.MemoryMCPRepository
+	deploymentRepo *repository.MemoryDeploymentRepository
+	jobQueue       *queue.JobQueue
+}
+
+func newWebhookFixture(t *testing.T) *webhookFixture {
+	t.Helper()
+	f := &webhookFixture{
+		mcpRepo:        repository.NewMemoryMCPRepository(),
+		deploymentRepo: repository.NewMemoryDeploymentRepository(),
+		jobQueue:       queue.NewJobQueue(10, queue.NewMemoryJobStore()),
+	}
+	t.Cleanup(f.jobQueue.Close)
+	f.handler = NewWebhookHandler(services.NewWebhookService(f.mcpRepo, f.deploymentRepo, fakeCipher{}, f.jobQueue))
+	createServer(t, f.mcpRepo, "server-1", "user-1")
+	createServer(t, f.mcpRepo, "server-2", "user-2")
+	return f
+}
+
+// setSecret puts a webhook secret request body for a server as user
+func (f *webhookFixture) setSecret(user, serverId, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/mcp/"+serverId+"/webhook-secret", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return serve(f.handler.SetSecret, "/mcp/:server_id/webhook-secret", user, req)
+}
+
+// storedSecret returns the webhook secret stored for a server
+func (f *webhookFixture) storedSecret(t *testing.T, serverId string) string {
+	t.Helper()
+	server, err := f.mcpRepo.Get(context.Background(), serverId)
+	if err != nil {
+		t.Fatalf("Get %s: %v", serverId, err)
+	}
+	return server.WebhookSecret
+}
+
+func TestSetSecret_StoresEncryptedSecret(t *testing.T) {
+	f := newWebhookFixture(t)
+
+	tests := []struct {
+		name        string
+		body        string
+		wantStored  string
+		wantEnabled bool
+	}{
+		{"set", `{"secret": "s3cret"}`, "encrypted:s3cret", true},
+		{"rotate", `{"secret": "n3w-s3cret"}`, "encrypted:n3w-s3cret", true},
+		{"remove", `{"secret": ""}`, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := f.setSecret("user-1", "server-1", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Status = %d: %s", w.Code, w.Body.String())
+			}
+			if strings.Contains(w.Body.String(), "s3cret") {
+				t.Errorf("Response echoes the secret: %s", w.Body.String())
+			}
+			var response models.MCPServerResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.WebhookEnabled != tt.wantEnabled {
+				t.Errorf("Response = %s, want webhook_enabled %v", w.Body.String(), tt.wantEnabled)
+			}
+			if stored := f.storedSecret(t, "server-1"); stored != tt.wantStored {
+				t.Errorf("Stored secret = %q, want %q", stored, tt.wantStored)
+			}
+		})
+	}
+}
+
+func TestSetSecret_Rejects(t *testing.T) {
+	tests := []struct {
+		name       string
+		user       string
+		serverId   string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"anonymous", "", "server-1", `{"secret": "s3cret"}`, http.StatusUnauthorized, "unauthorized"},
+		{"unknown server", "user-1", "missing", `{"secret": "s3cret"}`, http.StatusNotFound, "mcp_server_not_found"},
+		{"another user's server", "user-1", "server-2", `{"secret": "s3cret"}`, http.StatusForbidden, "forbidden"},
+		{"malformed body", "user-1", "server-1", `{"secret": 1}`, http.StatusBadRequest, "bad_request"},
+		{"secret too long", "user-1", "server-1", `{"secret": "` + strings.Repeat("x", 257) + `"}`, http.StatusBadRequest, "invalid_webhook_secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newWebhookFixture(t)
+
+			w := f.setSecret(tt.user, tt.serverId, tt.body)
+			if w.Code != tt.wantStatus || errorCode(t, w) != tt.wantError {
+				t.Errorf("SetSecret = %d %s, want %d %s", w.Code, w.Body.String(), tt.wantStatus, tt.wantError)
+			}
+			for _, serverId := range []string{"server-1", "server-2"} {
+				if stored := f.storedSecret(t, serverId); stored != "" {
+					t.Errorf("Rejected request stored secret %q for %s", stored, serverId)
+				}
+			}
+		})
+	}
+}
+
+// setBranches puts an auto-build branches request body for a server as user
+func (f *webhookFixture) setBranches(user, serverId, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/mcp/"+serverId+"/auto-build-branches", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return serve(f.handler.SetAutoBuildBranches, "/mcp/:server_id/auto-build-branches", user, req)
+}
+
+func TestSetAutoBuildBranches_StoresPatterns(t *testing.T) {
+	f := newWebhookFixture(t)
+
+	tests := []struct {
+		name string
+		body string
+		want []string
+	}{
+		{"set", `{"branches": ["main", "release/*"]}`, []string{"main", "release/*"}},
+		{"reset to the default branch", `{"branches": []}`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := f.setBranches("user-1", "server-1", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("Status = %d: %s", w.Code, w.Body.String())
+			}
+			var response models.MCPServerResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || fmt.Sprint(response.AutoBuildBranches) != fmt.Sprint(tt.want) {
+				t.Errorf("Response = %s, want auto_build_branches %v", w.Body.String(), tt.want)
+			}
+			server, err := f.mcpRepo.Get(context.Background(), "server-1")
+			if err != nil || fmt.Sprint(server.AutoBuildBranches) != fmt.Sprint(tt.want) {
+				t.Errorf("Stored branches = %v, %v; want %v", server.AutoBuildBranches, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetAutoBuildBranches_Rejects(t *testing.T) {
+	tooMany := `{"branches": ["b"` + strings.Repeat(`, "b"`, 20) + `]}`
+	tests := []struct {
+		name       string
+		user       string
+		serverId   string
+		body       string
+		wantStatus int
+		wantError  string
+	}{
+		{"anonymous", "", "server-1", `{"branches": ["main"]}`, http.StatusUnauthorized, "unauthorized"},
+		{"unknown server", "user-1", "missing", `{"branches": ["main"]}`, http.StatusNotFound, "mcp_server_not_found"},
+		{"another user's server", "user-1", "server-2", `{"branches": ["main"]}`, http.StatusForbidden, "forbidden"},
+		{"missing branches", "user-1", "server-1", `{}`, http.StatusBadRequest, "bad_request"},
+		{"malformed pattern", "user-1", "server-1", `{"branches": ["release/["]}`, http.StatusBadRequest, "invalid_auto_build_branches"},
+		{"empty pattern", "user-1", "server-1", `{"branches": [""]}`, http.StatusBadRequest, "invalid_auto_build_branches"},
+		{"too many patterns", "user-1", "server-1", tooMany, http.StatusBadRequest, "invalid_auto_build_branches"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newWebhookFixture(t)
+
+			w := f.setBranches(tt.user, tt.serverId, tt.body)
+			if w.Code != tt.wantStatus || errorCode(t, w) != tt.wantError {
+				t.Errorf("SetAutoBuildBranches = %d %s, want %d %s", w.Code, w.Body.String(), tt.wantStatus, tt.wantError)
+			}
+			for _, serverId := range []string{"server-1", "server-2"} {
+				if server, _ := f.mcpRepo.Get(context.Background(), serverId); len(server.AutoBuildBranches) != 0 {
+					t.Errorf("Rejected request stored branches %v for %s", server.AutoBuildBranches, serverId)
+				}
+			}
+		})
+	}
+}
+
+// enableWebhook makes server-1 receive pushes of github.com/acme/weather to release branches
+func (f *webhookFixture) enableWebhook(t *testing.T) {
+	t.Helper()
+	_, err := repository.UpdateMCPWithRetry(context.Background(), f.mcpRepo, "server-1", func(server *models.MCPServer) error {
+		server.Repository = "https://github.com/acme/weather"
+		server.WebhookSecret = "encrypted:s3cret"
+		server.AutoBuildBranches = []string{"release/*"}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// deliver posts a GitHub delivery signed with secret
+func (f *webhookFixture) deliver(event, deliveryId, secret, payload string) *httptest.ResponseRecorder {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(payload))
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", deliveryId)
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return serve(f.handler.GitHub, "/webhooks/github", "", req)
+}
+
+// push is the payload of a push of a commit to ref of a repository
+func push(repository, ref string) string {
+	return fmt.Sprintf(`{"ref": %q, "after": "%040x", "repository": {"html_url": %q, "default_branch": "main"}}`, ref, 0xabc, repository)
+}
+
+func TestGitHub_Deliveries(t *testing.T) {
+	weather := "https://github.com/acme/weather"
+	tests := []struct {
+		name       string
+		event      string
+		secret     string
+		payload    string
+		wantStatus int
+		wantError  string
+		wantBuild  models.WebhookBuildStatus
+	}{
+		{name: "matching branch", event: "push", secret: "s3cret", payload: push(weather, "refs/heads/release/1.2"), wantStatus: http.StatusAccepted, wantBuild: models.WebhookBuildQueued},
+		{name: "other branch", event: "push", secret: "s3cret", payload: push(weather, "refs/heads/main"), wantStatus: http.StatusOK, wantBuild: models.WebhookBuildSkipped},
+		{name: "non-push event", event: "issues", secret: "s3cret", payload: `{"action": "opened"}`, wantStatus: http.StatusOK},
+		{name: "bad signature", event: "push", secret: "guess", payload: push(weather, "refs/heads/release/1.2"), wantStatus: http.StatusUnauthorized, wantError: "invalid_signature"},
+		{name: "unknown repository", event: "push", secret: "s3cret", payload: push("https://github.com/acme/other", "refs/heads/release/1.2"), wantStatus: http.StatusNotFound, wantError: "mcp_not_found"},
+		{name: "malformed payload", event: "push", secret: "s3cret", payload: "{", wantStatus: http.StatusBadRequest, wantError: "invalid_webhook"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newWebhookFixture(t)
+			f.enableWebhook(t)
+
+			w := f.deliver(tt.event, "delivery-1", tt.secret, tt.payload)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Status = %d: %s", w.Code, w.Body.String())
+			}
+			if tt.wantError != "" {
+				if code := errorCode(t, w); code != tt.wantError {
+					t.Errorf("Error = %s, want %s", code, tt.wantError)
+				}
+				return
+			}
+
+			var response models.WebhookResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Response is not JSON: %s", w.Body.String())
+			}
+			var builds []models.WebhookBuildStatus
+			for _, build := range response.Builds {
+				builds = append(builds, build.Status)
+			}
+			var want []models.WebhookBuildStatus
+			if tt.wantBuild != "" {
+				want = append(want, tt.wantBuild)
+			}
+			if fmt.Sprint(builds) != fmt.Sprint(want) {
+				t.Errorf("Builds = %v, want %v", builds, want)
+			}
+		})
+	}
+}
+
+func TestGitHub_ReplayedDeliveryBuildsOnce(t *testing.T) {
+	f := newWebhookFixture(t)
+	f.enableWebhook(t)
+	payload := push("https://github.com/acme/weather", "refs/heads/release/1.2")
+
+	if w := f.deliver("push", "delivery-1", "s3cret", payload); w.Code != http.StatusAccepted {
+		t.Fatalf("First delivery = %d: %s", w.Code, w.Body.String())
+	}
+	// The same signed body under a delivery ID of the attacker's choosing
+	w := f.deliver("push", "delivery-2", "s3cret", payload)
+	var response models.WebhookResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK || len(response.Builds) != 1 || response.Builds[0].Status != models.WebhookBuildDuplicate {
+		t.Errorf("Replay = %d: %s", w.Code, w.Body.String())
+	}
+
+	page, err := f.deploymentRepo.ListByUserId(context.Background(), "user-1", models.DeploymentFilter{}, models.PageRequest{})
+	if err != nil || len(page.Deployments) != 1 {
+		t.Errorf("Deployments after a replay = %v, %v; want one", page, err)
+	}
+}
@@ -43,6 +43,9 @@ func Init(logLevel string) {
 	}
 	log.SetLevel(level)
 
+	// Mask registered secrets before anything is written
+	log.AddHook(redactHook{redactor: secrets})
+
 	log.Infof("Logger initialized with level: %s", logLevel)
 }
 
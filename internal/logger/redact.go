@@ -0,0 +1,249 @@
+package logger
+
+import (
+	"encoding/base64"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// RedactedText replaces every masked secret
+	RedactedText = "[REDACTED]"
+
+	// minSecretLength is the shortest value that is registered as a secret.
+	// Shorter values would mask too much unrelated text.
+	minSecretLength = 6
+
+	// minFragmentLength is the shortest piece of a secret that is masked at the
+	// start or end of a text, where a secret split across log lines ends up
+	minFragmentLength = 6
+)
+
+// secrets holds the values masked by the global logger
+var secrets = NewRedactor()
+
+// Redactor masks registered secret values, and their base64 and URL-encoded
+// forms, in text. It is safe for concurrent use.
+type Redactor struct {
+	mu       sync.RWMutex
+	counts   map[string]int
+	patterns []string
+}
+
+// NewRedactor creates an empty redactor
+func NewRedactor() *Redactor {
+	return &Redactor{counts: make(map[string]int)}
+}
+
+// Add registers secret values. Values shorter than six characters are ignored.
+func (r *Redactor) Add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, value := range values {
+		if len(value) >= minSecretLength {
+			r.counts[value]++
+		}
+	}
+	r.compile()
+}
+
+// Remove unregisters values added earlier. A value added several times stays
+// registered until it has been removed as often.
+func (r *Redactor) Remove(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, value := range values {
+		if r.counts[value] > 1 {
+			r.counts[value]--
+		} else {
+			delete(r.counts, value)
+		}
+	}
+	r.compile()
+}
+
+// compile rebuilds the match patterns; the caller holds mu
+func (r *Redactor) compile() {
+	seen := make(map[string]bool)
+	patterns := make([]string, 0, len(r.counts)*8)
+	for value := range r.counts {
+		for _, pattern := range encodedForms(value) {
+			if len(pattern) >= minSecretLength && !seen[pattern] {
+				seen[pattern] = true
+				patterns = append(patterns, pattern)
+			}
+		}
+	}
+
+	// Longest first so that overlapping forms are masked as a whole
+	sort.Slice(patterns, func(i, j int) bool {
+		return len(patterns[i]) > len(patterns[j])
+	})
+	r.patterns = patterns
+}
+
+// Redact returns text with every registered secret masked. Secrets broken
+// over several lines of text are found, and so are the parts of a secret at
+// the very start or end of text, which is how a secret split across separate
+// log lines shows up.
+func (r *Redactor) Redact(text string) string {
+	r.mu.RLock()
+	patterns := r.patterns
+	r.mu.RUnlock()
+
+	if len(patterns) == 0 || text == "" {
+		return text
+	}
+
+	// Match against the text without line breaks, remembering where each byte came from
+	joined := make([]byte, 0, len(text))
+	positions := make([]int, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\n' && text[i] != '\r' {
+			joined = append(joined, text[i])
+			positions = append(positions, i)
+		}
+	}
+	haystack := string(joined)
+	if haystack == "" {
+		return text
+	}
+
+	masked := make([]bool, len(text))
+	mask := func(from, to int) {
+		for i := from; i < to; i++ {
+			masked[positions[i]] = true
+		}
+	}
+
+	found := false
+	for _, pattern := range patterns {
+		for start := 0; ; {
+			i := strings.Index(haystack[start:], pattern)
+			if i < 0 {
+				break
+			}
+			mask(start+i, start+i+len(pattern))
+			start += i + len(pattern)
+			found = true
+		}
+
+		// A secret continued on the previous or the next log line
+		if n := overlapAtEnd(haystack, pattern); n > 0 {
+			mask(len(haystack)-n, len(haystack))
+			found = true
+		}
+		if n := overlapAtStart(haystack, pattern); n > 0 {
+			mask(0, n)
+			found = true
+		}
+	}
+
+	if !found {
+		return text
+	}
+
+	var b strings.Builder
+	b.Grow(len(text))
+	for i := 0; i < len(text); i++ {
+		if !masked[i] {
+			b.WriteByte(text[i])
+			continue
+		}
+		if i == 0 || !masked[i-1] {
+			b.WriteString(RedactedText)
+		}
+	}
+	return b.String()
+}
+
+// overlapAtEnd returns the length of the longest start of pattern that text
+// ends with, or 0 if it is shorter than minFragmentLength
+func overlapAtEnd(text, pattern string) int {
+	for i := max(0, len(text)-len(pattern)+1); i <= len(text)-minFragmentLength; i++ {
+		if text[i] == pattern[0] && strings.HasPrefix(pattern, text[i:]) {
+			return len(text) - i
+		}
+	}
+	return 0
+}
+
+// overlapAtStart returns the length of the longest end of pattern that text
+// starts with, or 0 if it is shorter than minFragmentLength
+func overlapAtStart(text, pattern string) int {
+	for i := 1; i <= len(pattern)-minFragmentLength; i++ {
+		if pattern[i] == text[0] && strings.HasPrefix(text, pattern[i:]) {
+			return len(pattern) - i
+		}
+	}
+	return 0
+}
+
+// encodedForms returns the forms a secret is likely to appear in: as is,
+// URL-encoded, and base64-encoded. Base64 output depends on where the secret
+// starts within the encoded data (e.g. "user:token" in a basic auth header),
+// so the stable part of the encoding is included for each of the three
+// possible alignments.
+func encodedForms(value string) []string {
+	forms := []string{value, url.QueryEscape(value), url.PathEscape(value)}
+
+	for offset := 0; offset < 3; offset++ {
+		data := append(make([]byte, offset), value...)
+		// Characters that only depend on bytes of the value
+		from := (offset*8 + 5) / 6
+		to := (offset + len(value)) * 8 / 6
+		for _, encoding := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding} {
+			forms = append(forms, encoding.EncodeToString(data)[from:to])
+		}
+	}
+
+	return forms
+}
+
+// RegisterSecrets masks values in everything the global logger writes until
+// the returned function is called
+func RegisterSecrets(values ...string) func() {
+	secrets.Add(values...)
+	var once sync.Once
+	return func() {
+		once.Do(func() { secrets.Remove(values...) })
+	}
+}
+
+// Redact masks the globally registered secrets in text
+func Redact(text string) string {
+	return secrets.Redact(text)
+}
+
+// redactHook masks registered secrets in log messages and string or error fields
+type redactHook struct {
+	redactor *Redactor
+}
+
+// Levels returns the levels the hook applies to
+func (h redactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire rewrites the entry before it is formatted
+func (h redactHook) Fire(entry *logrus.Entry) error {
+	entry.Message = h.redactor.Redact(entry.Message)
+
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			entry.Data[key] = h.redactor.Redact(v)
+		case error:
+			if text := v.Error(); h.redactor.Redact(text) != text {
+				entry.Data[key] = h.redactor.Redact(text)
+			}
+		}
+	}
+	return nil
+}
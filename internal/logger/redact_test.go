@@ -0,0 +1,124 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testToken = "ghp_R4nd0mT0k3nV4lu3+/With=Specials"
+
+// TestRedactor_EncodedForms tests that the raw, URL-encoded and base64 forms of a secret are masked
+func TestRedactor_EncodedForms(t *testing.T) {
+	r := NewRedactor()
+	r.Add(testToken)
+
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "raw", text: "cloning https://x-access-token:" + testToken + "@github.com/org/repo"},
+		{name: "query escaped", text: "GET /callback?token=" + url.QueryEscape(testToken) + "&state=1"},
+		{name: "path escaped", text: "GET /tokens/" + url.PathEscape(testToken) + "/info"},
+		{name: "base64", text: "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(testToken))},
+		{name: "base64 of user:token", text: "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte("x-access-token:"+testToken))},
+		{name: "base64 url alphabet", text: "auth=" + base64.URLEncoding.EncodeToString([]byte("ab"+testToken))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.Redact(tt.text)
+			if !strings.Contains(got, RedactedText) {
+				t.Fatalf("Redact(%q) = %q, expected the secret to be masked", tt.text, got)
+			}
+			for _, leaked := range []string{testToken, "R4nd0mT0k3n", url.QueryEscape(testToken)} {
+				if strings.Contains(got, leaked) {
+					t.Errorf("Redact(%q) = %q, still contains %q", tt.text, got, leaked)
+				}
+			}
+		})
+	}
+}
+
+// TestRedactor_SplitAcrossLines tests secrets broken over lines within one
+// text and over consecutive log lines
+func TestRedactor_SplitAcrossLines(t *testing.T) {
+	r := NewRedactor()
+	r.Add(testToken)
+
+	// Wrapped inside a single message, as base64 and terminal output do
+	wrapped := "token: " + testToken[:12] + "\n" + testToken[12:24] + "\r\n" + testToken[24:] + " end"
+	got := r.Redact(wrapped)
+	if got != "token: "+RedactedText+"\n"+RedactedText+"\r\n"+RedactedText+" end" {
+		t.Errorf("Redact(wrapped) = %q", got)
+	}
+
+	// Split over two separate log lines
+	first := r.Redact("remote: using credentials " + testToken[:15])
+	second := r.Redact(testToken[15:] + " for fetch")
+	if first != "remote: using credentials "+RedactedText {
+		t.Errorf("first half = %q", first)
+	}
+	if second != RedactedText+" for fetch" {
+		t.Errorf("second half = %q", second)
+	}
+
+	// Short fragments and unrelated text are left alone
+	if got := r.Redact("git ghp_"); got != "git ghp_" {
+		t.Errorf("Redact(short fragment) = %q", got)
+	}
+	if got := r.Redact("\n\n"); got != "\n\n" {
+		t.Errorf("Redact(newlines) = %q", got)
+	}
+}
+
+// TestRedactor_AddRemove tests reference counting and the minimum secret length
+func TestRedactor_AddRemove(t *testing.T) {
+	r := NewRedactor()
+	r.Add("abc", testToken, testToken)
+
+	if got := r.Redact("abc"); got != "abc" {
+		t.Errorf("short value was registered: %q", got)
+	}
+
+	r.Remove(testToken)
+	if got := r.Redact(testToken); got != RedactedText {
+		t.Errorf("secret added twice was released after one Remove: %q", got)
+	}
+
+	r.Remove(testToken)
+	if got := r.Redact(testToken); got != testToken {
+		t.Errorf("secret still masked after being removed: %q", got)
+	}
+}
+
+// TestGlobalLoggerRedaction tests that the global logger masks messages and fields
+func TestGlobalLoggerRedaction(t *testing.T) {
+	Init("INFO")
+	var buf bytes.Buffer
+	GetLogger().SetOutput(&buf)
+
+	release := RegisterSecrets(testToken)
+	WithFields(map[string]interface{}{
+		"url":   "https://x-access-token:" + testToken + "@github.com/org/repo",
+		"error": errors.New("clone failed for " + testToken),
+	}).Error("git clone failed: " + testToken)
+	release()
+
+	output := buf.String()
+	if strings.Contains(output, "R4nd0mT0k3n") {
+		t.Errorf("log output leaked the secret: %s", output)
+	}
+	if strings.Count(output, RedactedText) != 3 {
+		t.Errorf("expected message and both fields to be masked: %s", output)
+	}
+
+	buf.Reset()
+	Info(testToken)
+	if !strings.Contains(buf.String(), "R4nd0mT0k3n") {
+		t.Errorf("secret still masked after release: %s", buf.String())
+	}
+}
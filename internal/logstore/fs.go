@@ -0,0 +1,109 @@
+package logstore
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// FileLogStore keeps build logs as chunk files under a local directory
+type FileLogStore struct {
+	dir string
+}
+
+// NewFileLogStore creates a filesystem log store rooted at dir
+func NewFileLogStore(dir string) (*FileLogStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create log store directory: %w", err)
+	}
+	return &FileLogStore{dir: dir}, nil
+}
+
+// Name identifies the backend
+func (fs *FileLogStore) Name() string {
+	return "fs"
+}
+
+// Append writes a chunk file atomically
+func (fs *FileLogStore) Append(ctx context.Context, key string, start int, entries []models.BuildLogEntry) error {
+	data, err := encodeChunk(entries)
+	if err != nil {
+		return err
+	}
+
+	dir := fs.logDir(key)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	path := filepath.Join(dir, chunkName(start))
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write log chunk: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to commit log chunk: %w", err)
+	}
+	return nil
+}
+
+// Read returns up to limit entries starting at offset
+func (fs *FileLogStore) Read(ctx context.Context, key string, offset, limit int) ([]models.BuildLogEntry, bool, error) {
+	return readEntries(ctx, fs, key, offset, limit)
+}
+
+// Delete removes the log directory
+func (fs *FileLogStore) Delete(ctx context.Context, key string) error {
+	if err := os.RemoveAll(fs.logDir(key)); err != nil {
+		return fmt.Errorf("failed to delete log: %w", err)
+	}
+	return nil
+}
+
+// listChunks returns the start offsets of the chunk files of a log
+func (fs *FileLogStore) listChunks(ctx context.Context, key string) ([]int, error) {
+	files, err := os.ReadDir(fs.logDir(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log chunks: %w", err)
+	}
+
+	starts := make([]int, 0, len(files))
+	for _, file := range files {
+		if start, ok := parseChunkName(file.Name()); ok {
+			starts = append(starts, start)
+		}
+	}
+	return starts, nil
+}
+
+// readChunk reads one chunk file
+func (fs *FileLogStore) readChunk(ctx context.Context, key string, start int) ([]models.BuildLogEntry, error) {
+	f, err := os.Open(filepath.Join(fs.logDir(key), chunkName(start)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log chunk: %w", err)
+	}
+	defer f.Close()
+	return decodeChunk(f)
+}
+
+// logDir returns the directory of a log, escaping each key segment
+func (fs *FileLogStore) logDir(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segment = url.PathEscape(segment)
+		// Never let a key segment point outside the store
+		if segment == "." || segment == ".." || segment == "" {
+			segment = strings.ReplaceAll("_"+segment, ".", "%2E")
+		}
+		segments[i] = segment
+	}
+	return filepath.Join(append([]string{fs.dir}, segments...)...)
+}
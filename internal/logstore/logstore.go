@@ -0,0 +1,134 @@
+package logstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// LogStore keeps the full build log of a deployment outside the deployment record.
+// A log is written as a sequence of chunks; each chunk is named after the
+// offset of its first entry so that reads can start anywhere in the log.
+type LogStore interface {
+	// Append writes entries as the chunk starting at offset start.
+	// Writing the same chunk again replaces it, so retries are safe.
+	Append(ctx context.Context, key string, start int, entries []models.BuildLogEntry) error
+
+	// Read returns up to limit entries starting at offset, and whether more entries follow
+	Read(ctx context.Context, key string, offset, limit int) ([]models.BuildLogEntry, bool, error)
+
+	// Delete removes every chunk of a log
+	Delete(ctx context.Context, key string) error
+
+	// Name identifies the backend in deployment log references
+	Name() string
+}
+
+// chunkSuffix is the file extension of a chunk (JSON lines)
+const chunkSuffix = ".jsonl"
+
+// chunkBackend is the storage-specific part of a chunked log store
+type chunkBackend interface {
+	// listChunks returns the start offsets of all chunks of a log
+	listChunks(ctx context.Context, key string) ([]int, error)
+
+	// readChunk returns the entries stored in one chunk
+	readChunk(ctx context.Context, key string, start int) ([]models.BuildLogEntry, error)
+}
+
+// Key returns the log key of a deployment
+func Key(serverID, deploymentID string) string {
+	return serverID + "/" + deploymentID
+}
+
+// readEntries implements Read on top of a chunk backend
+func readEntries(ctx context.Context, backend chunkBackend, key string, offset, limit int) ([]models.BuildLogEntry, bool, error) {
+	starts, err := backend.listChunks(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	sort.Ints(starts)
+
+	entries := make([]models.BuildLogEntry, 0, limit)
+	for i, start := range starts {
+		// Skip chunks that end before the requested offset
+		if i+1 < len(starts) && starts[i+1] <= offset {
+			continue
+		}
+
+		chunk, err := backend.readChunk(ctx, key, start)
+		if err != nil {
+			return nil, false, err
+		}
+
+		for j, entry := range chunk {
+			if start+j < offset {
+				continue
+			}
+			if len(entries) == limit {
+				return entries, true, nil
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries, false, nil
+}
+
+// chunkName returns the object name of the chunk starting at start
+func chunkName(start int) string {
+	return fmt.Sprintf("%010d%s", start, chunkSuffix)
+}
+
+// parseChunkName returns the start offset encoded in a chunk name
+func parseChunkName(name string) (int, bool) {
+	if !strings.HasSuffix(name, chunkSuffix) {
+		return 0, false
+	}
+	start, err := strconv.Atoi(strings.TrimSuffix(name, chunkSuffix))
+	if err != nil || start < 0 {
+		return 0, false
+	}
+	return start, true
+}
+
+// encodeChunk serializes entries as JSON lines
+func encodeChunk(entries []models.BuildLogEntry) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return nil, fmt.Errorf("failed to encode log entry: %w", err)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeChunk parses JSON lines into entries
+func decodeChunk(r io.Reader) ([]models.BuildLogEntry, error) {
+	entries := make([]models.BuildLogEntry, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry models.BuildLogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to decode log entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read log chunk: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,191 @@
+package logstore
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// fakeS3 is a minimal S3-compatible server supporting the calls the store makes
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") == "" || r.Header.Get("X-Amz-Content-Sha256") == "" {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+
+	// Path-style: /bucket/key
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	key := ""
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		prefix := r.URL.Query().Get("prefix")
+		keys := make([]string, 0)
+		for k := range f.objects {
+			if strings.HasPrefix(k, prefix) {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+		}
+		for _, k := range keys {
+			result.Contents = append(result.Contents, struct {
+				Key string `xml:"Key"`
+			}{Key: k})
+		}
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+func newTestStores(t *testing.T) map[string]LogStore {
+	t.Helper()
+
+	fsStore, err := NewFileLogStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileLogStore() error = %v", err)
+	}
+
+	server := httptest.NewServer(&fakeS3{objects: make(map[string][]byte)})
+	t.Cleanup(server.Close)
+
+	awsCfg := aws.Config{
+		Region: "us-east-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "test", SecretAccessKey: "test"}, nil
+		}),
+	}
+	s3Store := NewS3LogStore(awsCfg, S3Config{
+		Bucket:   "build-logs",
+		Prefix:   "logs",
+		Endpoint: server.URL,
+	})
+
+	return map[string]LogStore{"fs": fsStore, "s3": s3Store}
+}
+
+func testEntries(from, to int) []models.BuildLogEntry {
+	entries := make([]models.BuildLogEntry, 0, to-from)
+	for i := from; i < to; i++ {
+		entries = append(entries, models.BuildLogEntry{
+			Timestamp: time.Unix(int64(i), 0).UTC(),
+			Stage:     "build_image",
+			Level:     "info",
+			Message:   fmt.Sprintf("line %d", i),
+		})
+	}
+	return entries
+}
+
+func TestLogStore_PagesAcrossChunks(t *testing.T) {
+	for name, store := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := Key("server-1", "deploy-1")
+
+			// Three chunks of uneven size, as written at stage boundaries
+			for _, chunk := range [][2]int{{0, 3}, {3, 10}, {10, 12}} {
+				if err := store.Append(ctx, key, chunk[0], testEntries(chunk[0], chunk[1])); err != nil {
+					t.Fatalf("Append(%d) error = %v", chunk[0], err)
+				}
+			}
+
+			var messages []string
+			offset := 0
+			for pages := 0; ; pages++ {
+				if pages > 10 {
+					t.Fatal("pagination did not terminate")
+				}
+				entries, more, err := store.Read(ctx, key, offset, 5)
+				if err != nil {
+					t.Fatalf("Read(%d) error = %v", offset, err)
+				}
+				for _, entry := range entries {
+					messages = append(messages, entry.Message)
+				}
+				offset += len(entries)
+				if !more {
+					break
+				}
+			}
+
+			if len(messages) != 12 {
+				t.Fatalf("read %d entries, want 12: %v", len(messages), messages)
+			}
+			for i, message := range messages {
+				if want := fmt.Sprintf("line %d", i); message != want {
+					t.Errorf("entry %d = %q, want %q", i, message, want)
+				}
+			}
+
+			// Reading from the middle of a chunk
+			entries, more, err := store.Read(ctx, key, 4, 2)
+			if err != nil || len(entries) != 2 || entries[0].Message != "line 4" || !more {
+				t.Errorf("Read(4, 2) = %v, %v, %v; want lines 4-5 with more", entries, more, err)
+			}
+		})
+	}
+}
+
+func TestLogStore_DeleteAndMissingLog(t *testing.T) {
+	for name, store := range newTestStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := Key("server-1", "deploy-2")
+
+			if err := store.Append(ctx, key, 0, testEntries(0, 2)); err != nil {
+				t.Fatalf("Append() error = %v", err)
+			}
+			if err := store.Delete(ctx, key); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+
+			entries, more, err := store.Read(ctx, key, 0, 10)
+			if err != nil || len(entries) != 0 || more {
+				t.Errorf("Read() after Delete = %v, %v, %v; want empty", entries, more, err)
+			}
+		})
+	}
+}
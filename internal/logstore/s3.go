@@ -0,0 +1,138 @@
+package logstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// S3Config configures an S3LogStore
+type S3Config struct {
+	Bucket string
+	Prefix string
+
+	// Endpoint overrides the AWS endpoint, e.g. "http://localhost:9000" for an
+	// S3-compatible server such as MinIO. Requests then use path-style addressing.
+	Endpoint string
+}
+
+// S3LogStore keeps build logs as chunk objects in an S3 bucket
+type S3LogStore struct {
+	cfg    S3Config
+	client *s3.Client
+}
+
+// NewS3LogStore creates an S3-backed log store using the region and
+// credentials of awsCfg
+func NewS3LogStore(awsCfg aws.Config, cfg S3Config) *S3LogStore {
+	client := s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if cfg.Endpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &S3LogStore{
+		cfg:    cfg,
+		client: client,
+	}
+}
+
+// Name identifies the backend
+func (s *S3LogStore) Name() string {
+	return "s3"
+}
+
+// Append uploads a chunk object
+func (s *S3LogStore) Append(ctx context.Context, key string, start int, entries []models.BuildLogEntry) error {
+	data, err := encodeChunk(entries)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.cfg.Bucket),
+		Key:         aws.String(s.chunkKey(key, start)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload log chunk: %w", err)
+	}
+	return nil
+}
+
+// Read returns up to limit entries starting at offset
+func (s *S3LogStore) Read(ctx context.Context, key string, offset, limit int) ([]models.BuildLogEntry, bool, error) {
+	return readEntries(ctx, s, key, offset, limit)
+}
+
+// Delete removes every chunk object of a log
+func (s *S3LogStore) Delete(ctx context.Context, key string) error {
+	starts, err := s.listChunks(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	for _, start := range starts {
+		_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(s.cfg.Bucket),
+			Key:    aws.String(s.chunkKey(key, start)),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete log chunk: %w", err)
+		}
+	}
+	return nil
+}
+
+// listChunks lists the chunk objects of a log
+func (s *S3LogStore) listChunks(ctx context.Context, key string) ([]int, error) {
+	prefix := s.logPrefix(key) + "/"
+	starts := make([]int, 0)
+
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.cfg.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list log chunks: %w", err)
+		}
+		for _, object := range page.Contents {
+			if start, ok := parseChunkName(strings.TrimPrefix(aws.ToString(object.Key), prefix)); ok {
+				starts = append(starts, start)
+			}
+		}
+	}
+	return starts, nil
+}
+
+// readChunk downloads one chunk object
+func (s *S3LogStore) readChunk(ctx context.Context, key string, start int) ([]models.BuildLogEntry, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.cfg.Bucket),
+		Key:    aws.String(s.chunkKey(key, start)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download log chunk: %w", err)
+	}
+	defer output.Body.Close()
+	return decodeChunk(output.Body)
+}
+
+// logPrefix returns the object prefix of a log
+func (s *S3LogStore) logPrefix(key string) string {
+	return path.Join(s.cfg.Prefix, key)
+}
+
+// chunkKey returns the object key of a chunk
+func (s *S3LogStore) chunkKey(key string, start int) string {
+	return s.logPrefix(key) + "/" + chunkName(start)
+}
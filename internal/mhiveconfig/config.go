@@ -0,0 +1,433 @@
+// Package mhiveconfig defines mhive.config.yaml, the file at the root of an
+// MCP server repository that tells the build server how to build and run it.
+package mhiveconfig
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the config file in the repository root
+const FileName = "mhive.config.yaml"
+
+// CurrentVersion is the newest schema version. A file without a version is read as
+// version 1, but leniently, because it may predate the schema; see Parse.
+const CurrentVersion = 1
+
+// Transports an MCP server can speak
+const (
+	TransportStdio          = "stdio"
+	TransportStreamableHTTP = "streamable-http"
+	TransportSSE            = "sse"
+)
+
+// Runtimes an MCP server can be written for. "custom" builds whatever the
+// repository's own Dockerfile describes.
+const (
+	RuntimeNode   = "node"
+	RuntimePython = "python"
+	RuntimeGo     = "go"
+	RuntimeCustom = "custom"
+)
+
+var (
+	transports = []string{TransportStdio, TransportStreamableHTTP, TransportSSE}
+	runtimes   = []string{RuntimeNode, RuntimePython, RuntimeGo, RuntimeCustom}
+
+	// namePattern matches a server name: lowercase letters, digits and inner dashes
+	namePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+	// stagePattern matches a Dockerfile stage name
+	stagePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+	// variablePattern matches an environment variable or build argument name
+	variablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+	// yamlLinePattern matches the position yaml.v3 puts in front of its errors
+	yamlLinePattern = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+	// nameSeparatorPattern matches the runs of characters DefaultName replaces with a dash
+	nameSeparatorPattern = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+//go:embed schema.json
+var schemaJSON []byte
+
+// JSONSchema returns the JSON Schema of the config file
+func JSONSchema() []byte {
+	return schemaJSON
+}
+
+// Config is a parsed mhive.config.yaml
+type Config struct {
+	Version    int      `yaml:"version"`
+	Name       string   `yaml:"name"`       // server name, e.g. "weather"
+	Runtime    string   `yaml:"runtime"`    // node, python, go or custom; detected from the repository when empty
+	Transport  string   `yaml:"transport"`  // stdio (default), streamable-http or sse
+	Port       int      `yaml:"port"`       // port the HTTP transports listen on
+	Entrypoint []string `yaml:"entrypoint"` // command that starts the server; empty uses the image's own
+	Env        []EnvVar `yaml:"env"`        // environment variables the server reads
+	Build      Build    `yaml:"build"`
+}
+
+// EnvVar declares an environment variable the server reads
+type EnvVar struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"` // the server does not start without it
+}
+
+// Build configures the image build. Paths are relative to the repository root.
+type Build struct {
+	Dockerfile string            `yaml:"dockerfile"` // defaults to Dockerfile in the context directory
+	Context    string            `yaml:"context"`    // defaults to the repository root
+	Target     string            `yaml:"target"`     // Dockerfile stage to build; defaults to the final stage
+	Args       map[string]string `yaml:"args"`       // build arguments passed to the Dockerfile
+}
+
+// RequiredEnv returns the names of the environment variables the server needs to start
+func (c *Config) RequiredEnv() []string {
+	var names []string
+	for _, env := range c.Env {
+		if env.Required {
+			names = append(names, env.Name)
+		}
+	}
+	return names
+}
+
+// FieldError is a problem with one field of the config file
+type FieldError struct {
+	Line    int    // 1-based line in the file; 0 when unknown
+	Field   string // dotted path of the field, e.g. "build.args.VERSION"; empty for the whole file
+	Message string
+}
+
+func (e FieldError) Error() string {
+	var b strings.Builder
+	b.WriteString(FileName)
+	if e.Line > 0 {
+		b.WriteString(":" + strconv.Itoa(e.Line))
+	}
+	b.WriteString(": ")
+	if e.Field != "" {
+		b.WriteString(e.Field + ": ")
+	}
+	b.WriteString(e.Message)
+	return b.String()
+}
+
+// ValidationError lists every problem found in a config file
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%s has %d errors, first: %s", FileName, len(e.Errors), e.Errors[0].Error())
+}
+
+// Parse decodes and validates a config file and fills in defaults. Problems
+// are returned as a *ValidationError.
+//
+// A file that declares a version is validated strictly. A file without one
+// may have been written before the schema existed, when any YAML mapping was
+// accepted, so its unknown fields are returned as warnings instead of errors,
+// and a missing or invalid name is replaced with DefaultName(defaultName)
+// with a warning.
+func Parse(data []byte, defaultName string) (*Config, []FieldError, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, nil, &ValidationError{Errors: yamlErrors(err)}
+	}
+	if len(root.Content) == 0 {
+		return nil, nil, &ValidationError{Errors: []FieldError{{Message: "file is empty"}}}
+	}
+	doc := root.Content[0]
+	if doc.Kind != yaml.MappingNode {
+		return nil, nil, &ValidationError{Errors: []FieldError{{Line: doc.Line, Message: "must be a mapping of fields"}}}
+	}
+
+	v := &validator{root: doc, unversioned: !declaresVersion(doc), defaultName: DefaultName(defaultName)}
+	v.unknownFields(doc, reflect.TypeOf(Config{}), "")
+
+	var cfg Config
+	if err := doc.Decode(&cfg); err != nil {
+		v.errors = append(v.errors, yamlErrors(err)...)
+	} else {
+		v.validate(&cfg)
+	}
+	sortByLine(v.warnings)
+	if len(v.errors) > 0 {
+		sortByLine(v.errors)
+		return nil, v.warnings, &ValidationError{Errors: v.errors}
+	}
+
+	cfg.applyDefaults()
+	return &cfg, v.warnings, nil
+}
+
+// DefaultName turns s, such as the display name of an MCP server, into a valid
+// server name, e.g. "Weather Server" into "weather-server". It returns an empty
+// string when s has no letters or digits.
+func DefaultName(s string) string {
+	name := strings.Trim(nameSeparatorPattern.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	return name
+}
+
+// declaresVersion reports whether a config file has a version field
+func declaresVersion(doc *yaml.Node) bool {
+	for i := 0; i+1 < len(doc.Content); i += 2 {
+		if doc.Content[i].Value == "version" {
+			return true
+		}
+	}
+	return false
+}
+
+// sortByLine orders field errors by the line they were found on
+func sortByLine(errs []FieldError) {
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Line < errs[j].Line })
+}
+
+// applyDefaults fills in the fields a valid config may leave out
+func (c *Config) applyDefaults() {
+	if c.Version == 0 {
+		c.Version = CurrentVersion
+	}
+	if c.Transport == "" {
+		c.Transport = TransportStdio
+	}
+	if c.Build.Context == "" {
+		c.Build.Context = "."
+	}
+	if c.Build.Dockerfile == "" {
+		c.Build.Dockerfile = path.Join(c.Build.Context, "Dockerfile")
+	}
+}
+
+// validator collects field errors with the line of the offending field
+type validator struct {
+	root     *yaml.Node
+	errors   []FieldError
+	warnings []FieldError
+
+	// unversioned is set for files without a version, which are checked leniently
+	unversioned bool
+	defaultName string
+}
+
+// fail records an error for a dotted field path
+func (v *validator) fail(field, format string, args ...interface{}) {
+	v.errors = append(v.errors, FieldError{
+		Line:    v.line(field),
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// line returns the line of a dotted field path, or of its closest parent that
+// exists. A missing top-level field has no line.
+func (v *validator) line(field string) int {
+	node := v.root
+	line := 0
+	for _, part := range strings.Split(field, ".") {
+		switch node.Kind {
+		case yaml.MappingNode:
+			var next *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == part {
+					next = node.Content[i+1]
+					line = node.Content[i].Line
+					break
+				}
+			}
+			if next == nil {
+				return line
+			}
+			node = next
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node.Content) {
+				return line
+			}
+			node = node.Content[i]
+			line = node.Line
+		default:
+			return line
+		}
+	}
+	return line
+}
+
+// unknownFields reports mapping keys that have no field in t. Typos such as
+// "trasnport" would otherwise be ignored silently.
+func (v *validator) unknownFields(node *yaml.Node, t reflect.Type, prefix string) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		if t.Kind() == reflect.Slice {
+			if node.Kind != yaml.SequenceNode {
+				return
+			}
+			for i, item := range node.Content {
+				v.unknownFields(item, t.Elem(), fmt.Sprintf("%s.%d", prefix, i))
+			}
+			return
+		}
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || node.Kind != yaml.MappingNode {
+		return
+	}
+
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		fields[name] = t.Field(i).Type
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		field := strings.TrimPrefix(prefix+"."+key.Value, ".")
+		fieldType, ok := fields[key.Value]
+		if !ok {
+			if v.unversioned {
+				v.warnings = append(v.warnings, FieldError{Line: key.Line, Field: field, Message: "unknown field, ignored"})
+			} else {
+				v.errors = append(v.errors, FieldError{Line: key.Line, Field: field, Message: "unknown field"})
+			}
+			continue
+		}
+		v.unknownFields(node.Content[i+1], fieldType, field)
+	}
+}
+
+// validate checks the values of a decoded config
+func (v *validator) validate(c *Config) {
+	if c.Version != 0 && c.Version != CurrentVersion {
+		v.fail("version", "unsupported version %d (supported: %d)", c.Version, CurrentVersion)
+	}
+
+	validName := len(c.Name) <= 63 && namePattern.MatchString(c.Name)
+	switch {
+	case !validName && v.unversioned && v.defaultName != "":
+		message := fmt.Sprintf("is missing, using %q", v.defaultName)
+		if c.Name != "" {
+			message = fmt.Sprintf("%q is not a valid name, using %q", c.Name, v.defaultName)
+		}
+		v.warnings = append(v.warnings, FieldError{Line: v.line("name"), Field: "name", Message: message})
+		c.Name = v.defaultName
+	case c.Name == "":
+		v.fail("name", "is required")
+	case !validName:
+		v.fail("name", "must be at most 63 lowercase letters, digits and dashes, starting and ending with a letter or digit (got %q)", c.Name)
+	}
+
+	if c.Runtime != "" && !contains(runtimes, c.Runtime) {
+		v.fail("runtime", "must be one of %s (got %q)", strings.Join(runtimes, ", "), c.Runtime)
+	}
+
+	if c.Transport != "" && !contains(transports, c.Transport) {
+		v.fail("transport", "must be one of %s (got %q)", strings.Join(transports, ", "), c.Transport)
+	}
+	httpTransport := c.Transport == TransportStreamableHTTP || c.Transport == TransportSSE
+	switch {
+	case c.Port < 0 || c.Port > 65535:
+		v.fail("port", "must be between 1 and 65535 (got %d)", c.Port)
+	case httpTransport && c.Port == 0:
+		v.fail("port", "is required for the %s transport", c.Transport)
+	}
+
+	for i, arg := range c.Entrypoint {
+		if strings.TrimSpace(arg) == "" {
+			v.fail(fmt.Sprintf("entrypoint.%d", i), "must not be empty")
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, env := range c.Env {
+		field := fmt.Sprintf("env.%d.name", i)
+		switch {
+		case env.Name == "":
+			v.fail(field, "is required")
+		case !variablePattern.MatchString(env.Name):
+			v.fail(field, "%q is not a valid environment variable name", env.Name)
+		case seen[env.Name]:
+			v.fail(field, "%s is declared more than once", env.Name)
+		}
+		seen[env.Name] = true
+	}
+
+	if err := relativePath(c.Build.Dockerfile); err != nil {
+		v.fail("build.dockerfile", "%v", err)
+	}
+	if err := relativePath(c.Build.Context); err != nil {
+		v.fail("build.context", "%v", err)
+	}
+	if c.Build.Target != "" && !stagePattern.MatchString(c.Build.Target) {
+		v.fail("build.target", "%q is not a valid Dockerfile stage name", c.Build.Target)
+	}
+	for name := range c.Build.Args {
+		if !variablePattern.MatchString(name) {
+			v.fail("build.args."+name, "%q is not a valid build argument name", name)
+		}
+	}
+}
+
+// relativePath checks that p stays inside the repository. Symlinks are
+// resolved when the path is used.
+func relativePath(p string) error {
+	switch {
+	case p == "":
+		return nil
+	case path.IsAbs(p) || strings.HasPrefix(p, `\`):
+		return errors.New("must be relative to the repository root")
+	case path.Clean(p) == ".." || strings.HasPrefix(path.Clean(p), "../"):
+		return errors.New("must not point outside the repository")
+	}
+	return nil
+}
+
+// yamlErrors turns a yaml.v3 error into field errors, keeping the line it reports
+func yamlErrors(err error) []FieldError {
+	var messages []string
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		messages = typeErr.Errors
+	} else {
+		messages = []string{err.Error()}
+	}
+
+	errs := make([]FieldError, 0, len(messages))
+	for _, message := range messages {
+		fieldErr := FieldError{Message: strings.TrimPrefix(message, "yaml: ")}
+		if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+			fieldErr.Line, _ = strconv.Atoi(match[1])
+			fieldErr.Message = match[2]
+		}
+		errs = append(errs, fieldErr)
+	}
+	return errs
+}
+
+// contains reports whether values holds value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package mhiveconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse_Defaults(t *testing.T) {
+	cfg, warnings, err := Parse([]byte("name: weather\nruntime: node\n"), "server-1")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.Version != CurrentVersion || cfg.Transport != TransportStdio || cfg.Build.Context != "." || cfg.Build.Dockerfile != "Dockerfile" {
+		t.Errorf("defaults not applied: %+v", cfg)
+	}
+	if cfg.Name != "weather" || len(warnings) != 0 {
+		t.Errorf("name = %q with warnings %v, want the file's name", cfg.Name, warnings)
+	}
+
+	cfg, _, err = Parse([]byte(`version: 1
+name: weather
+runtime: python
+transport: streamable-http
+port: 8080
+entrypoint: [python, -m, weather]
+env:
+  - name: API_KEY
+    required: true
+  - name: LOG_LEVEL
+build:
+  context: server
+  args:
+    PYTHON_VERSION: "3.12"
+`), "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if cfg.Build.Dockerfile != "server/Dockerfile" || cfg.Build.Args["PYTHON_VERSION"] != "3.12" {
+		t.Errorf("build = %+v", cfg.Build)
+	}
+	if got := cfg.RequiredEnv(); !reflect.DeepEqual(got, []string{"API_KEY"}) {
+		t.Errorf("RequiredEnv() = %v", got)
+	}
+}
+
+func TestParse_FieldErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string // one per expected error, in order
+	}{
+		{name: "empty", yaml: "", want: []string{"mhive.config.yaml: file is empty"}},
+		{name: "syntax", yaml: "name: weather\nruntime: [node\n", want: []string{"did not find expected"}},
+		{name: "not a mapping", yaml: "- weather\n", want: []string{"mhive.config.yaml:1: must be a mapping"}},
+		{
+			name: "wrong type",
+			yaml: "name: weather\nruntime: node\nport: http\n",
+			want: []string{"mhive.config.yaml:3: cannot unmarshal"},
+		},
+		{
+			name: "unknown fields",
+			yaml: "version: 1\nname: weather\nruntime: node\ntrasnport: sse\nbuild:\n  dockerfle: Dockerfile\n",
+			want: []string{"mhive.config.yaml:4: trasnport: unknown field", "mhive.config.yaml:6: build.dockerfle: unknown field"},
+		},
+		{
+			name: "versioned without name",
+			yaml: "version: 1\ntransport: stdio\n",
+			want: []string{"name: is required"},
+		},
+		{
+			name: "bad values",
+			yaml: "version: 2\nname: Weather_Server\nruntime: ruby\ntransport: sse\n",
+			want: []string{
+				"mhive.config.yaml: port: is required for the sse transport",
+				"mhive.config.yaml:1: version: unsupported version 2",
+				"mhive.config.yaml:2: name: must be",
+				"mhive.config.yaml:3: runtime: must be one of node, python, go, custom",
+			},
+		},
+		{
+			name: "env and build",
+			yaml: "name: weather\nruntime: go\nenv:\n  - name: API_KEY\n  - name: API_KEY\n  - name: 1BAD\nbuild:\n  dockerfile: ../Dockerfile\n  context: /src\n  target: 2nd\n",
+			want: []string{
+				"mhive.config.yaml:5: env.1.name: API_KEY is declared more than once",
+				"mhive.config.yaml:6: env.2.name: \"1BAD\" is not a valid",
+				"mhive.config.yaml:8: build.dockerfile: must not point outside the repository",
+				"mhive.config.yaml:9: build.context: must be relative",
+				"mhive.config.yaml:10: build.target: \"2nd\" is not a valid Dockerfile stage name",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		_, _, err := Parse([]byte(tt.yaml), "Weather Server")
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			t.Errorf("%s: Parse() error = %v, want a *ValidationError", tt.name, err)
+			continue
+		}
+		if len(validationErr.Errors) != len(tt.want) {
+			t.Errorf("%s: got %d errors %v, want %d", tt.name, len(validationErr.Errors), validationErr.Errors, len(tt.want))
+			continue
+		}
+		for i, want := range tt.want {
+			if got := validationErr.Errors[i].Error(); !strings.Contains(got, want) {
+				t.Errorf("%s: error %d = %q, want it to contain %q", tt.name, i, got, want)
+			}
+		}
+	}
+}
+
+// TestParse_Unversioned checks that files without a version, which may predate
+// the schema, are accepted with warnings where version 1 files fail
+func TestParse_Unversioned(t *testing.T) {
+	tests := []struct {
+		name         string
+		yaml         string
+		defaultName  string
+		wantName     string
+		wantWarnings []string // one per expected warning, in order
+		wantErr      string
+	}{
+		{
+			name:         "unknown fields",
+			yaml:         "name: weather\nruntime: node\ntrasnport: sse\nbuild:\n  dockerfle: Dockerfile\n",
+			wantName:     "weather",
+			wantWarnings: []string{"mhive.config.yaml:3: trasnport: unknown field, ignored", "mhive.config.yaml:5: build.dockerfle: unknown field, ignored"},
+		},
+		{
+			name:         "missing name",
+			yaml:         "runtime: node\n",
+			defaultName:  "Weather Server",
+			wantName:     "weather-server",
+			wantWarnings: []string{`mhive.config.yaml: name: is missing, using "weather-server"`},
+		},
+		{
+			name:         "invalid name",
+			yaml:         "runtime: node\nname: Weather_Server\n",
+			defaultName:  "server-1",
+			wantName:     "server-1",
+			wantWarnings: []string{`mhive.config.yaml:2: name: "Weather_Server" is not a valid name, using "server-1"`},
+		},
+		{
+			name:    "missing name without a default",
+			yaml:    "runtime: node\n",
+			wantErr: "name: is required",
+		},
+		{
+			name:         "invalid values still fail",
+			yaml:         "name: weather\nruntime: node\ntransport: sse\ncolour: blue\n",
+			wantWarnings: []string{"mhive.config.yaml:4: colour: unknown field, ignored"},
+			wantErr:      "port: is required for the sse transport",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, warnings, err := Parse([]byte(tt.yaml), tt.defaultName)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			} else if cfg.Name != tt.wantName || cfg.Version != CurrentVersion {
+				t.Errorf("name = %q, version = %d; want %q, %d", cfg.Name, cfg.Version, tt.wantName, CurrentVersion)
+			}
+
+			var got []string
+			for _, warning := range warnings {
+				got = append(got, warning.Error())
+			}
+			if !reflect.DeepEqual(got, tt.wantWarnings) {
+				t.Errorf("warnings = %q, want %q", got, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestDefaultName(t *testing.T) {
+	tests := map[string]string{
+		"weather":                      "weather",
+		"Weather Server":               "weather-server",
+		"  My_MCP  (v2) ":              "my-mcp-v2",
+		"---":                          "",
+		strings.Repeat("a", 62) + "-b": strings.Repeat("a", 62),
+	}
+	for in, want := range tests {
+		if got := DefaultName(in); got != want {
+			t.Errorf("DefaultName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestJSONSchema_MatchesConfig keeps the published schema in step with the Go types
+func TestJSONSchema_MatchesConfig(t *testing.T) {
+	var schema struct {
+		Properties map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			Items      struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"items"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(JSONSchema(), &schema); err != nil {
+		t.Fatalf("schema.json is not valid JSON: %v", err)
+	}
+
+	assertFields := func(name string, t2 reflect.Type, properties map[string]json.RawMessage) {
+		for i := 0; i < t2.NumField(); i++ {
+			field := t2.Field(i).Tag.Get("yaml")
+			if _, ok := properties[field]; !ok {
+				t.Errorf("%s: field %q is missing from schema.json", name, field)
+			}
+		}
+		if len(properties) != t2.NumField() {
+			t.Errorf("%s: schema.json has %d properties, the Go type %d", name, len(properties), t2.NumField())
+		}
+	}
+
+	root := make(map[string]json.RawMessage)
+	for name := range schema.Properties {
+		root[name] = nil
+	}
+	assertFields("config", reflect.TypeOf(Config{}), root)
+	assertFields("env", reflect.TypeOf(EnvVar{}), schema.Properties["env"].Items.Properties)
+	assertFields("build", reflect.TypeOf(Build{}), schema.Properties["build"].Properties)
+}
@@ -12,3 +12,9 @@ type Tag struct {
 	Name  string `json:"name" binding:"required"`
 	Color string `json:"color,omitempty"`
 }
+
+// PageRequest selects one page of a listing
+type PageRequest struct {
+	Limit  int    // maximum number of items; 0 uses the default page size
+	Cursor string // NextCursor of the previous page; empty for the first page
+}
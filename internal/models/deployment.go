@@ -4,32 +4,77 @@ import "time"
 
 // BuildStageStatus represents the status of a single build stage
 type BuildStageStatus struct {
-	Status      string     `json:"status" dynamodbav:"Status"` // "pending", "in_progress", "completed", "failed"
-	StartedAt   *time.Time `json:"started_at,omitempty" dynamodbav:"StartedAt"`
-	CompletedAt *time.Time `json:"completed_at,omitempty" dynamodbav:"CompletedAt"`
-	Error       string     `json:"error,omitempty" dynamodbav:"Error"`
+	Status      StageStatus `json:"status" dynamodbav:"Status"`
+	StartedAt   *time.Time  `json:"started_at,omitempty" dynamodbav:"StartedAt"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty" dynamodbav:"CompletedAt"`
+	Error       string      `json:"error,omitempty" dynamodbav:"Error"`
+	CancelledBy string      `json:"cancelled_by,omitempty" dynamodbav:"CancelledBy,omitempty"` // user ID that cancelled the stage
 }
 
 // BuildLogEntry represents a single log entry from the build process
 type BuildLogEntry struct {
-	Timestamp time.Time `json:"timestamp" dynamodbav:"Timestamp"`
-	Stage     string    `json:"stage" dynamodbav:"Stage"`
-	Level     string    `json:"level" dynamodbav:"Level"` // "info", "warning", "error"
-	Message   string    `json:"message" dynamodbav:"Message"`
+	Timestamp time.Time  `json:"timestamp" dynamodbav:"Timestamp"`
+	Stage     string     `json:"stage" dynamodbav:"Stage"`
+	Level     string     `json:"level" dynamodbav:"Level"` // "info", "warning", "error"
+	Message   string     `json:"message" dynamodbav:"Message"`
+	Step      *BuildStep `json:"step,omitempty" dynamodbav:"Step,omitempty"`       // set for Dockerfile step summaries
+	Attempt   int        `json:"attempt,omitempty" dynamodbav:"Attempt,omitempty"` // build attempt that logged the entry
+	Seq       int        `json:"seq,omitempty" dynamodbav:"Seq,omitempty"`         // 1-based position in the attempt's build log
+}
+
+// BuildStep describes a Dockerfile step reported by BuildKit
+type BuildStep struct {
+	Number      int    `json:"number" dynamodbav:"Number"`                              // 1-based step within its build stage
+	Total       int    `json:"total" dynamodbav:"Total"`                                // number of steps in the build stage
+	BuildStage  string `json:"build_stage,omitempty" dynamodbav:"BuildStage,omitempty"` // multi-stage build name, e.g. "builder"
+	Instruction string `json:"instruction" dynamodbav:"Instruction"`
+	Cached      bool   `json:"cached" dynamodbav:"Cached"`
+	DurationMs  int64  `json:"duration_ms" dynamodbav:"DurationMs"`
+}
+
+// LogReference points at the full build log held in a log store
+type LogReference struct {
+	Store   string `json:"store" dynamodbav:"Store"`     // log store backend, e.g. "fs" or "s3"
+	Key     string `json:"key" dynamodbav:"Key"`         // log key within the store
+	Entries int    `json:"entries" dynamodbav:"Entries"` // number of entries written so far
+	Attempt int    `json:"attempt" dynamodbav:"Attempt"` // build attempt that wrote the log; a retry starts a new log
+}
+
+// ImageMetadata describes the image a deployment pushed, so the exact bytes
+// deployed can be told apart after its tags have moved on
+type ImageMetadata struct {
+	Digest          string  `json:"digest" dynamodbav:"Digest"` // digest of the pushed manifest
+	Size            int64   `json:"size" dynamodbav:"Size"`     // compressed size of all layers in bytes
+	LayerCount      int     `json:"layer_count" dynamodbav:"LayerCount"`
+	LayerSizes      []int64 `json:"layer_sizes,omitempty" dynamodbav:"LayerSizes,omitempty"` // compressed size of each layer, base layer first
+	BaseImage       string  `json:"base_image,omitempty" dynamodbav:"BaseImage,omitempty"`   // FROM image of the final Dockerfile stage
+	BuildDurationMs int64   `json:"build_duration_ms" dynamodbav:"BuildDurationMs"`          // from the start of the clone to the end of the push
 }
 
 // Deployment represents the domain model for a deployment
 // This is a database-agnostic business entity
 type Deployment struct {
-	ServerId     string                       `dynamodbav:"ServerId"`
-	DeploymentId string                       `dynamodbav:"DeploymentId"`
-	UserId       string                       `dynamodbav:"UserId"` // Auth0 user ID
-	Branch       string                       `dynamodbav:"Branch"`
-	CommitHash   string                       `dynamodbav:"CommitHash"`
-	Status       string                       `dynamodbav:"Status"` // e.g., "queued", "in_progress", "completed", "failed"
-	Stages       map[string]*BuildStageStatus `dynamodbav:"Stages"`
-	BuildLogs    []BuildLogEntry              `dynamodbav:"Logs"`
-	ImageURI     string                       `dynamodbav:"ImageURI"`
-	CreatedAt    time.Time                    `dynamodbav:"CreatedAt"`
-	UpdatedAt    time.Time                    `dynamodbav:"UpdatedAt"`
+	ServerId       string                       `dynamodbav:"ServerId"`
+	DeploymentId   string                       `dynamodbav:"DeploymentId"`
+	UserId         string                       `dynamodbav:"UserId"` // Auth0 user ID
+	Branch         string                       `dynamodbav:"Branch"`
+	CommitHash     string                       `dynamodbav:"CommitHash"`
+	Status         DeploymentStatus             `dynamodbav:"Status"`
+	Stages         map[string]*BuildStageStatus `dynamodbav:"Stages"`
+	BuildLogs      []BuildLogEntry              `dynamodbav:"Logs"`           // tail of the build log; the full log lives in the log store
+	LogRef         *LogReference                `dynamodbav:"LogRef"`         // nil for deployments built before logs were offloaded
+	ImageURI       string                       `dynamodbav:"ImageURI"`       // repository and tag; the tag may move to a later build
+	ImageDigestURI string                       `dynamodbav:"ImageDigestURI"` // immutable repo@sha256: reference
+	Image          *ImageMetadata               `dynamodbav:"Image"`          // nil until the image was pushed
+	Manifest       *MCPManifest                 `dynamodbav:"Manifest"`       // nil unless the image was verified and pushed
+	ServerJSON     *RegistryServer              `dynamodbav:"ServerJSON"`     // MCP registry metadata; nil until the image was pushed
+	Version        int64                        `dynamodbav:"Version"`        // incremented on every write, for optimistic locking
+	CreatedAt      time.Time                    `dynamodbav:"CreatedAt"`
+	UpdatedAt      time.Time                    `dynamodbav:"UpdatedAt"`
+}
+
+// DeploymentPage is one page of a deployment listing
+type DeploymentPage struct {
+	Deployments []*Deployment
+	NextCursor  string // empty on the last page
 }
@@ -16,7 +16,7 @@ func (req *CreateDeploymentRequest) ToDomain() *Deployment {
 		ServerId:   req.ServerId,
 		Branch:     req.Branch,
 		CommitHash: req.CommitHash,
-		Status:     "queued", // Default status
+		Status:     DeploymentStatusQueued, // Default status
 		CreatedAt:  now,
 		UpdatedAt:  now,
 	}
@@ -24,36 +24,86 @@ func (req *CreateDeploymentRequest) ToDomain() *Deployment {
 
 // DeploymentResponse represents the response structure for a single deployment
 type DeploymentResponse struct {
-	ServerId   string                       `json:"server_id"`
-	UserId     string                       `json:"user_id,omitempty"`
-	Branch     string                       `json:"branch"`
-	CommitHash string                       `json:"commit_hash"`
-	Status     string                       `json:"status"`
-	Stages     map[string]*BuildStageStatus `json:"stages,omitempty"`
-	BuildLogs  []BuildLogEntry              `json:"build_logs,omitempty"`
-	ImageURI   string                       `json:"image_uri,omitempty"`
-	CreatedAt  time.Time                    `json:"created_at"`
-	UpdatedAt  time.Time                    `json:"updated_at"`
+	ServerId       string                       `json:"server_id"`
+	DeploymentId   string                       `json:"deployment_id"`
+	UserId         string                       `json:"user_id,omitempty"`
+	Branch         string                       `json:"branch"`
+	CommitHash     string                       `json:"commit_hash"`
+	Status         DeploymentStatus             `json:"status"`
+	Stages         map[string]*BuildStageStatus `json:"stages,omitempty"`
+	BuildLogs      []BuildLogEntry              `json:"build_logs,omitempty"`
+	LogEntries     int                          `json:"log_entries"` // size of the full build log
+	ImageURI       string                       `json:"image_uri,omitempty"`
+	ImageDigestURI string                       `json:"image_digest_uri,omitempty"` // immutable repo@sha256: reference
+	Image          *ImageMetadata               `json:"image,omitempty"`
+	CreatedAt      time.Time                    `json:"created_at"`
+	UpdatedAt      time.Time                    `json:"updated_at"`
 }
 
 // DeploymentListResponse represents the response structure for listing deployments
 type DeploymentListResponse struct {
 	Deployments []DeploymentResponse `json:"deployments"`
-	Total       int                  `json:"total"`
+	Limit       int                  `json:"limit"`
+	NextCursor  string               `json:"next_cursor,omitempty"` // pass as cursor to fetch the next page
+	HasMore     bool                 `json:"has_more"`
+}
+
+// BuildLogPageResponse represents one page of a deployment's full build log
+type BuildLogPageResponse struct {
+	Entries    []BuildLogEntry `json:"entries"`
+	NextCursor string          `json:"next_cursor,omitempty"` // pass as cursor to fetch the next page
+	HasMore    bool            `json:"has_more"`
+}
+
+// DeploymentFilter narrows a deployment listing. Zero values match everything.
+type DeploymentFilter struct {
+	Status        DeploymentStatus
+	Branch        string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+}
+
+// Matches reports whether a deployment satisfies the filter
+func (f DeploymentFilter) Matches(d *Deployment) bool {
+	if f.Status != "" && d.Status != f.Status {
+		return false
+	}
+	if f.Branch != "" && d.Branch != f.Branch {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && d.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !d.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	return true
 }
 
 // ToResponse converts a domain Deployment to a DeploymentResponse DTO
 func (d *Deployment) ToResponse() DeploymentResponse {
 	return DeploymentResponse{
-		ServerId:   d.ServerId,
-		UserId:     d.UserId,
-		Branch:     d.Branch,
-		CommitHash: d.CommitHash,
-		Status:     d.Status,
-		Stages:     d.Stages,
-		BuildLogs:  d.BuildLogs,
-		ImageURI:   d.ImageURI,
-		CreatedAt:  d.CreatedAt,
-		UpdatedAt:  d.UpdatedAt,
+		ServerId:       d.ServerId,
+		DeploymentId:   d.DeploymentId,
+		UserId:         d.UserId,
+		Branch:         d.Branch,
+		CommitHash:     d.CommitHash,
+		Status:         d.Status,
+		Stages:         d.Stages,
+		BuildLogs:      d.BuildLogs,
+		LogEntries:     d.LogEntries(),
+		ImageURI:       d.ImageURI,
+		ImageDigestURI: d.ImageDigestURI,
+		Image:          d.Image,
+		CreatedAt:      d.CreatedAt,
+		UpdatedAt:      d.UpdatedAt,
+	}
+}
+
+// LogEntries returns the number of entries in the full build log
+func (d *Deployment) LogEntries() int {
+	if d.LogRef != nil {
+		return d.LogRef.Entries
 	}
+	return len(d.BuildLogs)
 }
@@ -0,0 +1,94 @@
+package models
+
+import "encoding/json"
+
+// MCPManifest is what an MCP server offered when its image was verified:
+// the result of the MCP handshake the build performed with it
+type MCPManifest struct {
+	ProtocolVersion string        `json:"protocol_version" dynamodbav:"ProtocolVersion"` // negotiated MCP revision, e.g. "2025-06-18"
+	ServerName      string        `json:"server_name" dynamodbav:"ServerName"`
+	ServerVersion   string        `json:"server_version" dynamodbav:"ServerVersion"`
+	Tools           []MCPTool     `json:"tools" dynamodbav:"Tools"`
+	Resources       []MCPResource `json:"resources" dynamodbav:"Resources"`
+	Prompts         []MCPPrompt   `json:"prompts" dynamodbav:"Prompts"`
+}
+
+// MCPTool is a tool offered by an MCP server
+type MCPTool struct {
+	Name         string          `json:"name" dynamodbav:"Name"`
+	Title        string          `json:"title,omitempty" dynamodbav:"Title,omitempty"`
+	Description  string          `json:"description,omitempty" dynamodbav:"Description,omitempty"`
+	InputSchema  json.RawMessage `json:"input_schema,omitempty" dynamodbav:"InputSchema,omitempty"`   // JSON Schema of the arguments
+	OutputSchema json.RawMessage `json:"output_schema,omitempty" dynamodbav:"OutputSchema,omitempty"` // JSON Schema of structured results
+}
+
+// MCPResource is a resource offered by an MCP server
+type MCPResource struct {
+	URI         string `json:"uri" dynamodbav:"URI"`
+	Name        string `json:"name" dynamodbav:"Name"`
+	Title       string `json:"title,omitempty" dynamodbav:"Title,omitempty"`
+	Description string `json:"description,omitempty" dynamodbav:"Description,omitempty"`
+	MimeType    string `json:"mime_type,omitempty" dynamodbav:"MimeType,omitempty"`
+}
+
+// MCPPrompt is a prompt offered by an MCP server
+type MCPPrompt struct {
+	Name        string              `json:"name" dynamodbav:"Name"`
+	Title       string              `json:"title,omitempty" dynamodbav:"Title,omitempty"`
+	Description string              `json:"description,omitempty" dynamodbav:"Description,omitempty"`
+	Arguments   []MCPPromptArgument `json:"arguments,omitempty" dynamodbav:"Arguments,omitempty"`
+}
+
+// MCPPromptArgument is an argument of a prompt
+type MCPPromptArgument struct {
+	Name        string `json:"name" dynamodbav:"Name"`
+	Description string `json:"description,omitempty" dynamodbav:"Description,omitempty"`
+	Required    bool   `json:"required" dynamodbav:"Required"`
+}
+
+// ManifestChangeKind classifies a difference between two manifests
+type ManifestChangeKind string
+
+const (
+	ManifestChangeToolAdded         ManifestChangeKind = "tool_added"
+	ManifestChangeToolRemoved       ManifestChangeKind = "tool_removed"
+	ManifestChangeParameterAdded    ManifestChangeKind = "parameter_added"
+	ManifestChangeParameterRemoved  ManifestChangeKind = "parameter_removed"
+	ManifestChangeParameterRequired ManifestChangeKind = "parameter_required" // an existing or new parameter must now be passed
+	ManifestChangeParameterOptional ManifestChangeKind = "parameter_optional"
+	ManifestChangeTypeNarrowed      ManifestChangeKind = "type_narrowed" // fewer types or enum values are accepted
+	ManifestChangeTypeWidened       ManifestChangeKind = "type_widened"
+	ManifestChangeResourceAdded     ManifestChangeKind = "resource_added"
+	ManifestChangeResourceRemoved   ManifestChangeKind = "resource_removed"
+	ManifestChangePromptAdded       ManifestChangeKind = "prompt_added"
+	ManifestChangePromptRemoved     ManifestChangeKind = "prompt_removed"
+)
+
+// ManifestChange is one difference between the manifests of two deployments
+type ManifestChange struct {
+	Kind     ManifestChangeKind `json:"kind"`
+	Breaking bool               `json:"breaking"` // existing clients may fail against the newer deployment
+	Tool     string             `json:"tool,omitempty"`
+	Resource string             `json:"resource,omitempty"` // resource URI
+	Prompt   string             `json:"prompt,omitempty"`
+	Path     string             `json:"path,omitempty"` // dotted parameter path, e.g. "location.lat"; "[]" stands for array items
+	Message  string             `json:"message"`
+}
+
+// ManifestResponse is the API response for the manifest of a deployment
+type ManifestResponse struct {
+	ServerId     string       `json:"server_id"`
+	DeploymentId string       `json:"deployment_id"`
+	CommitHash   string       `json:"commit_hash"`
+	Manifest     *MCPManifest `json:"manifest"`
+}
+
+// ManifestComparison is the API response comparing the manifests of two
+// deployments of the same MCP server
+type ManifestComparison struct {
+	ServerId         string           `json:"server_id"`
+	BaseDeploymentId string           `json:"base_deployment_id"`
+	DeploymentId     string           `json:"deployment_id"`
+	Breaking         bool             `json:"breaking"` // at least one change is breaking
+	Changes          []ManifestChange `json:"changes"`
+}
@@ -1,6 +1,10 @@
 package models
 
-import "time"
+import (
+	"net/url"
+	"strings"
+	"time"
+)
 
 // MCPServer represents the domain model for an MCP server
 // This is a database-agnostic business entity
@@ -14,6 +18,41 @@ type MCPServer struct {
 	EnvironmentVariables []EnvironmentVariable `dynamodbav:"Envs"`
 	ECRRepositoryName    string                `dynamodbav:"ECRRepositoryName"`
 	ECRRepositoryURI     string                `dynamodbav:"ECRRepositoryURI"`
+	Registry             string                `dynamodbav:"Registry"`          // registry backend for the server's images; empty uses the default
+	Builder              string                `dynamodbav:"Builder"`           // builder backend for the server's images; empty uses the default
+	WebhookSecret        string                `dynamodbav:"WebhookSecret"`     // GitHub webhook secret, encrypted like GitHub access tokens; empty disables push builds
+	AutoBuildBranches    []string              `dynamodbav:"AutoBuildBranches"` // branch patterns pushes are built for, e.g. "release/*"; empty means the default branch
+	Version              int64                 `dynamodbav:"Version"`           // incremented on every write, for optimistic locking
 	CreatedAt            time.Time             `dynamodbav:"CreatedAt"`
 	UpdatedAt            time.Time             `dynamodbav:"UpdatedAt"`
 }
+
+// WebhookRepositoryKey returns the key the server is found by when a GitHub
+// webhook for its repository arrives. Only servers with a webhook secret have
+// one, which keeps the repository key index limited to them.
+func (s *MCPServer) WebhookRepositoryKey() string {
+	if s.WebhookSecret == "" {
+		return ""
+	}
+	return RepositoryKey(s.Repository)
+}
+
+// RepositoryKey identifies a repository regardless of scheme, case and a .git
+// suffix, e.g. "github.com/acme/weather"; empty for a URL that cannot be parsed
+func RepositoryKey(repositoryURL string) string {
+	parsed, err := url.Parse(repositoryURL)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	repoPath := strings.TrimSuffix(strings.Trim(parsed.Path, "/"), ".git")
+	if owner, _, _ := strings.Cut(repoPath, "/"); owner == "" {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname() + "/" + repoPath)
+}
+
+// MCPServerPage is one page of an MCP server listing
+type MCPServerPage struct {
+	Servers    []*MCPServer
+	NextCursor string // empty on the last page
+}
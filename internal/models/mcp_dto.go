@@ -9,6 +9,9 @@ type CreateMCPServerRequest struct {
 	Description          string                `json:"description"`
 	Repository           string                `json:"repository" binding:"required"`
 	EnvironmentVariables []EnvironmentVariable `json:"envs"`
+	Registry             string                `json:"registry" binding:"omitempty,oneof=ecr oci local"`
+	Builder              string                `json:"builder" binding:"omitempty,oneof=docker buildx buildctl"`
+	AutoBuildBranches    []string              `json:"auto_build_branches"`
 }
 
 // ToDomain converts CreateMCPServerRequest DTO to domain MCPServer model
@@ -21,6 +24,9 @@ func (req *CreateMCPServerRequest) ToDomain() *MCPServer {
 		Repository:           req.Repository,
 		Status:               "pending", // Default status
 		EnvironmentVariables: req.EnvironmentVariables,
+		Registry:             req.Registry,
+		Builder:              req.Builder,
+		AutoBuildBranches:    req.AutoBuildBranches,
 		CreatedAt:            now,
 		UpdatedAt:            now,
 	}
@@ -35,6 +41,10 @@ type MCPServerResponse struct {
 	Repository           string                `json:"repository"`
 	Status               string                `json:"status"`
 	EnvironmentVariables []EnvironmentVariable `json:"envs"`
+	Registry             string                `json:"registry,omitempty"`
+	Builder              string                `json:"builder,omitempty"`
+	WebhookEnabled       bool                  `json:"webhook_enabled"` // a webhook secret is set; the secret itself is never returned
+	AutoBuildBranches    []string              `json:"auto_build_branches,omitempty"`
 	CreatedAt            time.Time             `json:"created_at"`
 	UpdatedAt            time.Time             `json:"updated_at"`
 }
@@ -55,6 +65,10 @@ func (m *MCPServer) ToResponse() MCPServerResponse {
 		Repository:           m.Repository,
 		Status:               m.Status,
 		EnvironmentVariables: m.EnvironmentVariables,
+		Registry:             m.Registry,
+		Builder:              m.Builder,
+		WebhookEnabled:       m.WebhookSecret != "",
+		AutoBuildBranches:    m.AutoBuildBranches,
 		CreatedAt:            m.CreatedAt,
 		UpdatedAt:            m.UpdatedAt,
 	}
@@ -0,0 +1,64 @@
+package models
+
+// ServerJSONSchema is the MCP registry schema generated server.json files follow
+const ServerJSONSchema = "https://static.modelcontextprotocol.io/schemas/2025-09-29/server.schema.json"
+
+// RegistryServer is the server.json a deployment can be published to an MCP
+// registry with. Its JSON names follow the registry schema rather than the
+// snake_case used by the rest of the API.
+type RegistryServer struct {
+	Schema      string              `json:"$schema" dynamodbav:"Schema"`
+	Name        string              `json:"name" dynamodbav:"Name"` // reverse-DNS namespace and server name, e.g. "io.github.acme/weather"
+	Description string              `json:"description" dynamodbav:"Description"`
+	Version     string              `json:"version" dynamodbav:"Version"`
+	Repository  *RegistryRepository `json:"repository,omitempty" dynamodbav:"Repository,omitempty"`
+	Packages    []RegistryPackage   `json:"packages" dynamodbav:"Packages"`
+	Meta        *RegistryMeta       `json:"_meta,omitempty" dynamodbav:"Meta,omitempty"`
+}
+
+// RegistryRepository is the source repository of a server
+type RegistryRepository struct {
+	URL       string `json:"url" dynamodbav:"URL"`
+	Source    string `json:"source" dynamodbav:"Source"`                           // hosting service, e.g. "github"
+	Subfolder string `json:"subfolder,omitempty" dynamodbav:"Subfolder,omitempty"` // server directory within a monorepo
+}
+
+// RegistryPackage is a way to install and run a server; deployments publish
+// their image as an OCI package
+type RegistryPackage struct {
+	RegistryType         string                        `json:"registryType" dynamodbav:"RegistryType"`       // always "oci"
+	RegistryBaseURL      string                        `json:"registryBaseUrl" dynamodbav:"RegistryBaseURL"` // e.g. "https://ghcr.io"
+	Identifier           string                        `json:"identifier" dynamodbav:"Identifier"`           // repository within the registry
+	Version              string                        `json:"version" dynamodbav:"Version"`                 // image tag
+	Transport            RegistryTransport             `json:"transport" dynamodbav:"Transport"`
+	EnvironmentVariables []RegistryEnvironmentVariable `json:"environmentVariables,omitempty" dynamodbav:"EnvironmentVariables,omitempty"`
+}
+
+// RegistryTransport is how clients talk to a running package
+type RegistryTransport struct {
+	Type string `json:"type" dynamodbav:"Type"`                   // "stdio", "streamable-http" or "sse"
+	URL  string `json:"url,omitempty" dynamodbav:"URL,omitempty"` // endpoint of the HTTP transports
+}
+
+// RegistryEnvironmentVariable declares an environment variable a package reads.
+// Values are never included.
+type RegistryEnvironmentVariable struct {
+	Name        string `json:"name" dynamodbav:"Name"`
+	Description string `json:"description,omitempty" dynamodbav:"Description,omitempty"`
+	IsRequired  bool   `json:"isRequired" dynamodbav:"IsRequired"`
+	IsSecret    bool   `json:"isSecret" dynamodbav:"IsSecret"`
+}
+
+// RegistryMeta holds extension metadata of a server.json
+type RegistryMeta struct {
+	PublisherProvided *RegistryBuildInfo `json:"io.modelcontextprotocol.registry/publisher-provided,omitempty" dynamodbav:"PublisherProvided,omitempty"`
+}
+
+// RegistryBuildInfo ties a server.json to the build that produced it
+type RegistryBuildInfo struct {
+	ServerId       string `json:"serverId" dynamodbav:"ServerId"`
+	DeploymentId   string `json:"deploymentId" dynamodbav:"DeploymentId"`
+	CommitHash     string `json:"commitHash" dynamodbav:"CommitHash"`
+	ImageDigest    string `json:"imageDigest" dynamodbav:"ImageDigest"`
+	ImageDigestURI string `json:"imageDigestUri,omitempty" dynamodbav:"ImageDigestURI,omitempty"` // immutable repo@sha256: reference
+}
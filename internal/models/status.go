@@ -0,0 +1,109 @@
+package models
+
+// DeploymentStatus is the lifecycle state of a deployment
+type DeploymentStatus string
+
+const (
+	DeploymentStatusQueued     DeploymentStatus = "queued"
+	DeploymentStatusInProgress DeploymentStatus = "in_progress"
+	DeploymentStatusCompleted  DeploymentStatus = "completed"
+	DeploymentStatusFailed     DeploymentStatus = "failed"
+	DeploymentStatusCancelled  DeploymentStatus = "cancelled"
+)
+
+// deploymentTransitions lists the statuses each deployment status may move to
+var deploymentTransitions = map[DeploymentStatus][]DeploymentStatus{
+	DeploymentStatusQueued: {
+		DeploymentStatusInProgress,
+		DeploymentStatusCancelled,
+		// A retry whose job could not be enqueued returns to its previous status
+		DeploymentStatusFailed,
+	},
+	DeploymentStatusInProgress: {
+		// A build resumed by another worker after its lease expired
+		DeploymentStatusInProgress,
+		DeploymentStatusCompleted,
+		DeploymentStatusFailed,
+		DeploymentStatusCancelled,
+	},
+	// Failed and cancelled builds can be retried
+	DeploymentStatusFailed:    {DeploymentStatusQueued},
+	DeploymentStatusCancelled: {DeploymentStatusQueued},
+	DeploymentStatusCompleted: {},
+}
+
+// DeploymentStatuses returns every known deployment status
+func DeploymentStatuses() []DeploymentStatus {
+	return []DeploymentStatus{
+		DeploymentStatusQueued,
+		DeploymentStatusInProgress,
+		DeploymentStatusCompleted,
+		DeploymentStatusFailed,
+		DeploymentStatusCancelled,
+	}
+}
+
+// IsValid reports whether s is a known deployment status
+func (s DeploymentStatus) IsValid() bool {
+	_, ok := deploymentTransitions[s]
+	return ok
+}
+
+// CanTransitionTo reports whether a deployment in status s may move to next
+func (s DeploymentStatus) CanTransitionTo(next DeploymentStatus) bool {
+	for _, allowed := range deploymentTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsTerminal reports whether no build is queued or running for the deployment
+func (s DeploymentStatus) IsTerminal() bool {
+	return s == DeploymentStatusCompleted || s == DeploymentStatusFailed || s == DeploymentStatusCancelled
+}
+
+// IsBuildable reports whether a build may be initiated for a deployment in status s.
+// A queued deployment is waiting for its first build; failed and cancelled ones are retried.
+func (s DeploymentStatus) IsBuildable() bool {
+	return s == DeploymentStatusQueued || s.CanTransitionTo(DeploymentStatusQueued)
+}
+
+// StageStatus is the state of a single build stage
+type StageStatus string
+
+const (
+	StageStatusPending    StageStatus = "pending"
+	StageStatusInProgress StageStatus = "in_progress"
+	StageStatusCompleted  StageStatus = "completed"
+	StageStatusFailed     StageStatus = "failed"
+	StageStatusCancelled  StageStatus = "cancelled"
+)
+
+// stageTransitions lists the statuses each stage status may move to
+var stageTransitions = map[StageStatus][]StageStatus{
+	StageStatusPending: {
+		StageStatusInProgress,
+		// A build cancelled while queued never starts its stages
+		StageStatusCancelled,
+	},
+	StageStatusInProgress: {
+		StageStatusCompleted,
+		StageStatusFailed,
+		StageStatusCancelled,
+	},
+	StageStatusCompleted: {},
+	StageStatusFailed:    {},
+	StageStatusCancelled: {},
+}
+
+// CanTransitionTo reports whether a stage in status s may move to next
+func (s StageStatus) CanTransitionTo(next StageStatus) bool {
+	for _, allowed := range stageTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package models
+
+// WebhookBuildStatus is what a webhook delivery did for one MCP server
+type WebhookBuildStatus string
+
+const (
+	WebhookBuildQueued    WebhookBuildStatus = "queued"    // a deployment was created and its build queued
+	WebhookBuildDuplicate WebhookBuildStatus = "duplicate" // the delivery was already handled for the server
+	WebhookBuildSkipped   WebhookBuildStatus = "skipped"   // the branch is not built automatically
+)
+
+// WebhookBuild reports the outcome of a push for one MCP server
+type WebhookBuild struct {
+	ServerId     string             `json:"server_id"`
+	DeploymentId string             `json:"deployment_id,omitempty"`
+	Status       WebhookBuildStatus `json:"status"`
+	Reason       string             `json:"reason,omitempty"`
+}
+
+// WebhookResponse is the response to a GitHub webhook delivery
+type WebhookResponse struct {
+	Event      string         `json:"event"`
+	DeliveryId string         `json:"delivery_id"`
+	Message    string         `json:"message"`
+	Servers    []string       `json:"servers,omitempty"` // MCP servers whose secret verified the delivery
+	Builds     []WebhookBuild `json:"builds,omitempty"`
+}
+
+// SetWebhookSecretRequest is the request body for setting an MCP server's
+// GitHub webhook secret; an empty secret turns push builds off
+type SetWebhookSecretRequest struct {
+	Secret string `json:"secret"`
+}
+
+// SetAutoBuildBranchesRequest is the request body for setting the branch
+// patterns pushes to which build an MCP server; an empty list builds the
+// repository's default branch
+type SetAutoBuildBranchesRequest struct {
+	Branches []string `json:"branches" binding:"required"`
+}
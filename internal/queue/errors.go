@@ -1,6 +1,34 @@
 package queue
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 // ErrQueueClosed is returned when trying to enqueue to a closed queue
 var ErrQueueClosed = errors.New("queue is closed")
+
+var (
+	// ErrJobExists is returned when a job is already queued or running
+	ErrJobExists = errors.New("job already queued")
+	// ErrJobNotAvailable is returned when a job cannot be leased
+	ErrJobNotAvailable = errors.New("job not available")
+	// ErrLeaseLost is returned when a worker no longer holds a job's lease
+	ErrLeaseLost = errors.New("job lease lost")
+	// ErrJobCancelled matches every CancelledError
+	ErrJobCancelled = errors.New("job cancelled")
+)
+
+// CancelledError is the cause attached to a job's context when a user cancels it
+type CancelledError struct {
+	By string
+}
+
+func (e *CancelledError) Error() string {
+	return fmt.Sprintf("build cancelled by %s", e.By)
+}
+
+// Is makes errors.Is(err, ErrJobCancelled) true for any CancelledError
+func (e *CancelledError) Is(target error) bool {
+	return target == ErrJobCancelled
+}
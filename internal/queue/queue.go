@@ -1,7 +1,12 @@
 package queue
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
 	"sync"
+	"time"
 
 	"github.com/imyashkale/buildserver/internal/logger"
 )
@@ -15,29 +20,216 @@ type BuildJob struct {
 	CommitHash   string
 }
 
-// JobQueue manages the job queue with a channel-based system
+// ID returns the identifier of the job. There is at most one active job per deployment.
+func (j *BuildJob) ID() string {
+	return j.ServerID + "/" + j.DeploymentID
+}
+
+// JobQueue manages the job queue with a channel-based system.
+// Every job is persisted in a JobStore before it is dispatched so that
+// queued work can be restored after a restart.
 type JobQueue struct {
-	jobs chan *BuildJob
-	done chan bool
-	mu   sync.Mutex
+	jobs      chan *BuildJob
+	done      chan bool
+	mu        sync.RWMutex
+	closeOnce sync.Once
+	store     JobStore
+
+	runningMu  sync.Mutex
+	running    map[string]context.CancelCauseFunc
+	dispatched map[string]struct{} // jobs handed to the workers that no worker has picked up yet
 }
 
 // NewJobQueue creates a new job queue with the specified buffer size
-func NewJobQueue(bufferSize int) *JobQueue {
+func NewJobQueue(bufferSize int, store JobStore) *JobQueue {
 	return &JobQueue{
-		jobs: make(chan *BuildJob, bufferSize),
-		done: make(chan bool),
+		jobs:       make(chan *BuildJob, bufferSize),
+		done:       make(chan bool),
+		store:      store,
+		running:    make(map[string]context.CancelCauseFunc),
+		dispatched: make(map[string]struct{}),
 	}
 }
 
-// Enqueue adds a job to the queue
-func (jq *JobQueue) Enqueue(job *BuildJob) error {
+// Enqueue persists a job and adds it to the queue
+func (jq *JobQueue) Enqueue(ctx context.Context, job *BuildJob) error {
 	logger.WithFields(map[string]interface{}{
 		"deployment_id": job.DeploymentID,
 		"server_id":     job.ServerID,
 		"user_id":       job.UserID,
 	}).Debug("Enqueueing build job")
 
+	if jq.isClosed() {
+		return ErrQueueClosed
+	}
+
+	if err := jq.store.Save(ctx, job); err != nil {
+		logger.WithFields(map[string]interface{}{
+			"deployment_id": job.DeploymentID,
+			"server_id":     job.ServerID,
+			"error":         err.Error(),
+		}).Warn("Failed to persist build job")
+		return err
+	}
+
+	return jq.dispatch(job)
+}
+
+// Restore reloads pending jobs from the store and dispatches them to the
+// workers in the background. It returns the number of restored jobs.
+// Running jobs whose lease has not expired yet, such as the ones this node ran
+// before a quick restart, are left to Reap.
+func (jq *JobQueue) Restore(ctx context.Context) (int, error) {
+	records, err := jq.undispatched(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	go jq.dispatchRecords(records)
+
+	return len(records), nil
+}
+
+// Reap re-dispatches pending jobs every interval until the queue is closed.
+// It picks up the jobs of workers that stopped renewing their lease, on this
+// node or another one, once the lease has expired. Run it in its own goroutine.
+func (jq *JobQueue) Reap(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-jq.done:
+			return
+		case <-ticker.C:
+			records, err := jq.undispatched(context.Background())
+			if err != nil {
+				logger.WithFields(map[string]interface{}{
+					"error": err.Error(),
+				}).Warn("Failed to reap build jobs")
+				continue
+			}
+			if len(records) > 0 {
+				logger.WithFields(map[string]interface{}{
+					"jobs": len(records),
+				}).Info("Re-dispatching pending build jobs")
+				jq.dispatchRecords(records)
+			}
+		}
+	}
+}
+
+// undispatched returns the pending jobs in the store that this process has
+// neither handed to its workers nor is running
+func (jq *JobQueue) undispatched(ctx context.Context) ([]*JobRecord, error) {
+	records, err := jq.store.ListPending(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pending jobs: %w", err)
+	}
+
+	jq.runningMu.Lock()
+	defer jq.runningMu.Unlock()
+
+	pending := records[:0]
+	for _, record := range records {
+		id := record.Job.ID()
+		_, dispatched := jq.dispatched[id]
+		_, running := jq.running[id]
+		if !dispatched && !running {
+			pending = append(pending, record)
+		}
+	}
+	return pending, nil
+}
+
+// dispatchRecords dispatches the jobs of records in order until the queue is closed
+func (jq *JobQueue) dispatchRecords(records []*JobRecord) {
+	for _, record := range records {
+		job := record.Job
+		if err := jq.dispatch(&job); err != nil {
+			return
+		}
+	}
+}
+
+// Cancel cancels a queued job or stops a running one. It returns the status
+// the job was in: JobStatusQueued jobs will never run, JobStatusRunning jobs
+// have their context cancelled with a CancelledError carrying by.
+func (jq *JobQueue) Cancel(ctx context.Context, jobID, by string) (string, error) {
+	previous, err := jq.store.Cancel(ctx, jobID, by)
+	if err != nil {
+		return "", err
+	}
+
+	// Running here: stop it now instead of waiting for the next lease renewal
+	if previous == JobStatusRunning {
+		jq.runningMu.Lock()
+		cancel, ok := jq.running[jobID]
+		jq.runningMu.Unlock()
+		if ok {
+			cancel(&CancelledError{By: by})
+		}
+	}
+
+	return previous, nil
+}
+
+// attemptKey carries the attempt number of a job in its context
+type attemptKey struct{}
+
+// Attempt returns the attempt number of the job running with ctx, starting at 1.
+// A job is attempted again when the worker running it stopped renewing its lease.
+func Attempt(ctx context.Context) int {
+	if attempt, ok := ctx.Value(attemptKey{}).(int); ok {
+		return attempt
+	}
+	return 1
+}
+
+// CancelledBy reports who cancelled the job running with ctx, if it was cancelled by a user
+func CancelledBy(ctx context.Context) (string, bool) {
+	var cancelled *CancelledError
+	if errors.As(context.Cause(ctx), &cancelled) {
+		return cancelled.By, true
+	}
+	return "", false
+}
+
+// track registers the cancel function of a job running in this process
+func (jq *JobQueue) track(jobID string, cancel context.CancelCauseFunc) {
+	jq.runningMu.Lock()
+	defer jq.runningMu.Unlock()
+	jq.running[jobID] = cancel
+}
+
+// untrack removes a finished job from the running set
+func (jq *JobQueue) untrack(jobID string) {
+	jq.runningMu.Lock()
+	defer jq.runningMu.Unlock()
+	delete(jq.running, jobID)
+}
+
+// received records that a worker took a dispatched job off the channel
+func (jq *JobQueue) received(jobID string) {
+	jq.runningMu.Lock()
+	defer jq.runningMu.Unlock()
+	delete(jq.dispatched, jobID)
+}
+
+// dispatch hands a persisted job to the workers
+func (jq *JobQueue) dispatch(job *BuildJob) error {
+	// Hold the read lock so Close cannot close the jobs channel mid-send
+	jq.mu.RLock()
+	defer jq.mu.RUnlock()
+
+	if jq.isClosed() {
+		return ErrQueueClosed
+	}
+
+	jq.runningMu.Lock()
+	jq.dispatched[job.ID()] = struct{}{}
+	jq.runningMu.Unlock()
+
 	select {
 	case jq.jobs <- job:
 		logger.WithFields(map[string]interface{}{
@@ -46,6 +238,7 @@ func (jq *JobQueue) Enqueue(job *BuildJob) error {
 		}).Info("Build job enqueued successfully")
 		return nil
 	case <-jq.done:
+		jq.received(job.ID())
 		logger.WithFields(map[string]interface{}{
 			"deployment_id": job.DeploymentID,
 			"server_id":     job.ServerID,
@@ -65,18 +258,28 @@ func (jq *JobQueue) Jobs() <-chan *BuildJob {
 	return jq.jobs
 }
 
-// Close closes the queue
-func (jq *JobQueue) Close() {
-	jq.mu.Lock()
-	defer jq.mu.Unlock()
-
+// isClosed reports whether the queue has been closed
+func (jq *JobQueue) isClosed() bool {
 	select {
 	case <-jq.done:
-		return // Already closed
+		return true
 	default:
+		return false
+	}
+}
+
+// Close closes the queue. Jobs that are still persisted in the store are
+// picked up again by Restore on the next start, or by Reap on another node
+// once their lease has expired.
+func (jq *JobQueue) Close() {
+	jq.closeOnce.Do(func() {
+		// Signal pending dispatchers first, then wait for them before closing the channel
 		close(jq.done)
+
+		jq.mu.Lock()
+		defer jq.mu.Unlock()
 		close(jq.jobs)
-	}
+	})
 }
 
 // WorkerPool manages multiple workers processing jobs
@@ -86,20 +289,28 @@ type WorkerPool struct {
 	jobs    chan *BuildJob
 	wg      sync.WaitGroup
 	done    chan bool
+	owner   string
+	lease   time.Duration
+	renew   time.Duration // renewal interval, well below lease
 }
 
 // NewWorkerPool creates a new worker pool
 func NewWorkerPool(queue *JobQueue, numWorkers int) *WorkerPool {
+	hostname, _ := os.Hostname()
+
 	return &WorkerPool{
 		queue:   queue,
 		workers: numWorkers,
 		jobs:    queue.jobs,
 		done:    make(chan bool),
+		owner:   fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		lease:   DefaultLeaseDuration,
+		renew:   DefaultRenewInterval,
 	}
 }
 
 // Start starts all workers
-func (wp *WorkerPool) Start(handler func(*BuildJob) error) {
+func (wp *WorkerPool) Start(handler func(context.Context, *BuildJob) error) {
 	for i := 0; i < wp.workers; i++ {
 		wp.wg.Add(1)
 		go wp.worker(handler)
@@ -107,7 +318,7 @@ func (wp *WorkerPool) Start(handler func(*BuildJob) error) {
 }
 
 // worker processes jobs from the queue
-func (wp *WorkerPool) worker(handler func(*BuildJob) error) {
+func (wp *WorkerPool) worker(handler func(context.Context, *BuildJob) error) {
 	defer wp.wg.Done()
 
 	for {
@@ -118,25 +329,8 @@ func (wp *WorkerPool) worker(handler func(*BuildJob) error) {
 				return
 			}
 			if job != nil {
-				logger.WithFields(map[string]interface{}{
-					"deployment_id": job.DeploymentID,
-					"server_id":     job.ServerID,
-					"user_id":       job.UserID,
-				}).Info("Worker processing build job")
-
-				err := handler(job)
-				if err != nil {
-					logger.WithFields(map[string]interface{}{
-						"deployment_id": job.DeploymentID,
-						"server_id":     job.ServerID,
-						"error":         err.Error(),
-					}).Error("Worker failed to process build job")
-				} else {
-					logger.WithFields(map[string]interface{}{
-						"deployment_id": job.DeploymentID,
-						"server_id":     job.ServerID,
-					}).Info("Worker completed build job successfully")
-				}
+				wp.queue.received(job.ID())
+				wp.process(job, handler)
 			}
 		case <-wp.done:
 			logger.Debug("Worker exiting: stop signal received")
@@ -145,6 +339,116 @@ func (wp *WorkerPool) worker(handler func(*BuildJob) error) {
 	}
 }
 
+// process leases a job, runs the handler while renewing the lease and
+// records the outcome in the job store
+func (wp *WorkerPool) process(job *BuildJob, handler func(context.Context, *BuildJob) error) {
+	ctx := context.Background()
+	store := wp.queue.store
+
+	record, err := store.Acquire(ctx, job.ID(), wp.owner, wp.lease)
+	if err != nil {
+		if errors.Is(err, ErrJobNotAvailable) {
+			logger.WithFields(map[string]interface{}{
+				"deployment_id": job.DeploymentID,
+				"server_id":     job.ServerID,
+			}).Debug("Skipping build job: already finished or leased by another worker")
+		} else {
+			logger.WithFields(map[string]interface{}{
+				"deployment_id": job.DeploymentID,
+				"server_id":     job.ServerID,
+				"error":         err.Error(),
+			}).Error("Failed to acquire build job")
+		}
+		return
+	}
+
+	logger.WithFields(map[string]interface{}{
+		"deployment_id": job.DeploymentID,
+		"server_id":     job.ServerID,
+		"user_id":       job.UserID,
+		"attempt":       record.Attempts,
+	}).Info("Worker processing build job")
+
+	// The build runs with its own context so it can be cancelled on its own
+	jobCtx, cancel := context.WithCancelCause(context.WithValue(context.Background(), attemptKey{}, record.Attempts))
+	defer cancel(nil)
+	if record.CancelledBy != "" {
+		cancel(&CancelledError{By: record.CancelledBy})
+	}
+
+	wp.queue.track(job.ID(), cancel)
+	defer wp.queue.untrack(job.ID())
+
+	stopRenew := make(chan struct{})
+	renewDone := make(chan struct{})
+	go func() {
+		defer close(renewDone)
+		wp.renewLease(ctx, job, cancel, stopRenew)
+	}()
+
+	err = handler(jobCtx, job)
+
+	close(stopRenew)
+	<-renewDone
+
+	status, lastError := JobStatusCompleted, ""
+	if cause := context.Cause(jobCtx); err != nil && errors.Is(cause, ErrJobCancelled) {
+		status, lastError = JobStatusCancelled, cause.Error()
+		logger.WithFields(map[string]interface{}{
+			"deployment_id": job.DeploymentID,
+			"server_id":     job.ServerID,
+			"reason":        cause.Error(),
+		}).Info("Worker stopped cancelled build job")
+	} else if err != nil {
+		status, lastError = JobStatusFailed, err.Error()
+		logger.WithFields(map[string]interface{}{
+			"deployment_id": job.DeploymentID,
+			"server_id":     job.ServerID,
+			"error":         err.Error(),
+		}).Error("Worker failed to process build job")
+	} else {
+		logger.WithFields(map[string]interface{}{
+			"deployment_id": job.DeploymentID,
+			"server_id":     job.ServerID,
+		}).Info("Worker completed build job successfully")
+	}
+
+	if err := store.Complete(ctx, job.ID(), wp.owner, status, lastError); err != nil {
+		logger.WithFields(map[string]interface{}{
+			"deployment_id": job.DeploymentID,
+			"server_id":     job.ServerID,
+			"error":         err.Error(),
+		}).Error("Failed to record build job completion")
+	}
+}
+
+// renewLease periodically extends the job lease until stop is closed.
+// The job is cancelled if a cancellation was requested or the lease was lost.
+func (wp *WorkerPool) renewLease(ctx context.Context, job *BuildJob, cancel context.CancelCauseFunc, stop <-chan struct{}) {
+	ticker := time.NewTicker(wp.renew)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := wp.queue.store.Renew(ctx, job.ID(), wp.owner, wp.lease)
+			if errors.Is(err, ErrJobCancelled) || errors.Is(err, ErrLeaseLost) {
+				cancel(err)
+				return
+			}
+			if err != nil {
+				logger.WithFields(map[string]interface{}{
+					"deployment_id": job.DeploymentID,
+					"server_id":     job.ServerID,
+					"error":         err.Error(),
+				}).Warn("Failed to renew build job lease")
+			}
+		}
+	}
+}
+
 // Stop stops all workers
 func (wp *WorkerPool) Stop() {
 	close(wp.done)
@@ -0,0 +1,196 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// startWorkers runs handler on one worker with a short lease until the test ends
+func startWorkers(t *testing.T, jq *JobQueue, lease time.Duration, handler func(context.Context, *BuildJob) error) {
+	t.Helper()
+	wp := NewWorkerPool(jq, 1)
+	wp.lease, wp.renew = lease, lease/3
+	wp.Start(handler)
+	t.Cleanup(func() {
+		jq.Close()
+		wp.Wait()
+	})
+}
+
+// waitFor fails the test if ch does not receive within a few seconds
+func waitFor[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %s", what)
+		panic("unreachable")
+	}
+}
+
+func TestJobQueue_RestoreDispatchesPendingJobs(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+	for _, id := range []string{"queued", "interrupted", "leased"} {
+		if err := store.Save(ctx, testJob(id)); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	mustAcquire(t, store, "interrupted", -time.Minute)
+	mustAcquire(t, store, "leased", time.Minute)
+
+	jq := NewJobQueue(10, store)
+	defer jq.Close()
+	restored, err := jq.Restore(ctx)
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if restored != 2 {
+		t.Errorf("Restored %d jobs, want 2", restored)
+	}
+	for _, want := range []string{"queued", "interrupted"} {
+		if job := waitFor(t, jq.Jobs(), want); job.DeploymentID != want {
+			t.Errorf("Dispatched %s, want %s", job.DeploymentID, want)
+		}
+	}
+}
+
+func TestJobQueue_ReapPicksUpJobsOnceTheirLeaseExpires(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+	if err := store.Save(ctx, testJob("deploy-1")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// The node that ran the job restarted before its lease ran out
+	mustAcquire(t, store, "deploy-1", 200*time.Millisecond)
+
+	jq := NewJobQueue(10, store)
+	if restored, err := jq.Restore(ctx); err != nil || restored != 0 {
+		t.Fatalf("Restore = %d, %v; want the leased job left alone", restored, err)
+	}
+	attempts := make(chan int, 1)
+	startWorkers(t, jq, time.Minute, func(ctx context.Context, job *BuildJob) error {
+		attempts <- Attempt(ctx)
+		return nil
+	})
+	go jq.Reap(20 * time.Millisecond)
+
+	if attempt := waitFor(t, attempts, "the reaped job"); attempt != 2 {
+		t.Errorf("Attempt = %d, want 2", attempt)
+	}
+}
+
+func TestWorkerPool_RenewsLeaseWhileRunning(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+	jq := NewJobQueue(10, store)
+	lease := 30 * time.Millisecond
+
+	pendingWhileRunning := make(chan int, 1)
+	startWorkers(t, jq, lease, func(ctx context.Context, job *BuildJob) error {
+		time.Sleep(5 * lease)
+		records, _ := store.ListPending(ctx)
+		pendingWhileRunning <- len(records)
+		return ctx.Err()
+	})
+	if err := jq.Enqueue(ctx, testJob("deploy-1")); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	if pending := waitFor(t, pendingWhileRunning, "the build"); pending != 0 {
+		t.Errorf("%d jobs became pending while their worker renewed the lease", pending)
+	}
+}
+
+func TestWorkerPool_StopsJobWhenLeaseIsLost(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+	jq := NewJobQueue(10, store)
+	job := testJob("deploy-1")
+
+	started, cause := make(chan struct{}), make(chan error, 1)
+	startWorkers(t, jq, 30*time.Millisecond, func(ctx context.Context, job *BuildJob) error {
+		close(started)
+		<-ctx.Done()
+		cause <- context.Cause(ctx)
+		return ctx.Err()
+	})
+	if err := jq.Enqueue(ctx, job); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	waitFor(t, started, "the build to start")
+
+	// Another worker took the job over
+	store.mu.Lock()
+	store.records[job.ID()].LeaseOwner = "worker-2"
+	store.mu.Unlock()
+
+	if err := waitFor(t, cause, "the build to stop"); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Build stopped with %v, want ErrLeaseLost", err)
+	}
+}
+
+func TestJobQueue_CancelStopsRunningJob(t *testing.T) {
+	tests := []struct {
+		name   string
+		cancel func(jq *JobQueue, store JobStore, jobID string) (string, error)
+	}{
+		{"on this node", func(jq *JobQueue, store JobStore, jobID string) (string, error) {
+			return jq.Cancel(context.Background(), jobID, "user-1")
+		}},
+		{"on another node", func(jq *JobQueue, store JobStore, jobID string) (string, error) {
+			return store.Cancel(context.Background(), jobID, "user-1")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewMemoryJobStore()
+			jq := NewJobQueue(10, store)
+			job := testJob("deploy-1")
+
+			started, cancelledBy := make(chan struct{}), make(chan string, 1)
+			startWorkers(t, jq, 90*time.Millisecond, func(ctx context.Context, job *BuildJob) error {
+				close(started)
+				<-ctx.Done()
+				by, _ := CancelledBy(ctx)
+				cancelledBy <- by
+				return ctx.Err()
+			})
+			if err := jq.Enqueue(context.Background(), job); err != nil {
+				t.Fatalf("Enqueue: %v", err)
+			}
+			waitFor(t, started, "the build to start")
+
+			if previous, err := tt.cancel(jq, store, job.ID()); err != nil || previous != JobStatusRunning {
+				t.Fatalf("Cancel = %q, %v", previous, err)
+			}
+			if by := waitFor(t, cancelledBy, "the build to stop"); by != "user-1" {
+				t.Errorf("CancelledBy = %q, want user-1", by)
+			}
+		})
+	}
+}
+
+func TestJobQueue_CancelQueuedJob(t *testing.T) {
+	store := NewMemoryJobStore()
+	jq := NewJobQueue(10, store)
+	defer jq.Close()
+	job := testJob("deploy-1")
+	if err := jq.Enqueue(context.Background(), job); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	if previous, err := jq.Cancel(context.Background(), job.ID(), "user-1"); err != nil || previous != JobStatusQueued {
+		t.Fatalf("Cancel = %q, %v", previous, err)
+	}
+	// The dispatched job is skipped by the worker that picks it up
+	if _, err := store.Acquire(context.Background(), job.ID(), "worker-1", time.Minute); !errors.Is(err, ErrJobNotAvailable) {
+		t.Errorf("Acquire of a cancelled job = %v, want ErrJobNotAvailable", err)
+	}
+	if _, err := jq.Cancel(context.Background(), job.ID(), "user-1"); !errors.Is(err, ErrJobNotAvailable) {
+		t.Errorf("Second Cancel = %v, want ErrJobNotAvailable", err)
+	}
+}
@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Job statuses tracked by a JobStore
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// DefaultLeaseDuration is how long a worker owns a job before another
+// worker may pick it up again. Workers renew the lease while they run.
+const DefaultLeaseDuration = 2 * time.Minute
+
+// DefaultRenewInterval is how often a running job's lease is renewed. A
+// cancellation requested on another node is seen at the next renewal, so this
+// bounds how long a build keeps running after it was cancelled there.
+const DefaultRenewInterval = 10 * time.Second
+
+// JobRecord is the persisted state of a build job
+type JobRecord struct {
+	Job            BuildJob
+	Status         string
+	Attempts       int
+	LeaseOwner     string
+	LeaseExpiresAt time.Time
+	LastError      string
+	CancelledBy    string
+	EnqueuedAt     time.Time
+	UpdatedAt      time.Time
+}
+
+// JobStore persists build jobs so that queued work survives restarts
+type JobStore interface {
+	// Save stores a new job in the queued state.
+	// Returns ErrJobExists if the job is already queued or running.
+	Save(ctx context.Context, job *BuildJob) error
+
+	// Acquire leases a job to a worker and increments its attempt count.
+	// Returns ErrJobNotAvailable if the job is finished or leased by someone else.
+	Acquire(ctx context.Context, jobID, owner string, lease time.Duration) (*JobRecord, error)
+
+	// Renew extends the lease held by owner.
+	// Returns a *CancelledError if cancellation of the job was requested.
+	Renew(ctx context.Context, jobID, owner string, lease time.Duration) error
+
+	// Complete records the final status of a job
+	Complete(ctx context.Context, jobID, owner, status, lastError string) error
+
+	// Cancel cancels a queued job or flags a running job for cancellation and
+	// returns the status the job was in. Returns ErrJobNotAvailable if the job is
+	// not queued or running.
+	Cancel(ctx context.Context, jobID, by string) (string, error)
+
+	// ListPending returns queued jobs and running jobs whose lease has expired
+	ListPending(ctx context.Context) ([]*JobRecord, error)
+}
+
+// isActive reports whether the record still represents outstanding work
+func (r *JobRecord) isActive() bool {
+	return r.Status == JobStatusQueued || r.Status == JobStatusRunning
+}
+
+// isAcquirable reports whether a worker may lease the job at the given time
+func (r *JobRecord) isAcquirable(now time.Time) bool {
+	if r.Status == JobStatusQueued {
+		return true
+	}
+	return r.Status == JobStatusRunning && now.After(r.LeaseExpiresAt)
+}
+
+// newJobRecord creates a queued record for a job
+func newJobRecord(job *BuildJob) *JobRecord {
+	now := time.Now()
+	return &JobRecord{
+		Job:        *job,
+		Status:     JobStatusQueued,
+		EnqueuedAt: now,
+		UpdatedAt:  now,
+	}
+}
@@ -0,0 +1,374 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/imyashkale/buildserver/internal/database"
+	"github.com/imyashkale/buildserver/internal/logger"
+)
+
+const (
+	// JobStatusIndex is the GSI on the jobs table keyed by Status and EnqueuedAt
+	JobStatusIndex = database.JobStatusIndex
+
+	// finishedJobRetention is how long finished jobs are kept before the TTL removes them
+	finishedJobRetention = 7 * 24 * time.Hour
+)
+
+// DynamoJobStore persists jobs in a DynamoDB table. Leases are enforced
+// with conditional writes so several build servers can share one table.
+type DynamoJobStore struct {
+	client    *database.Client
+	tableName string
+}
+
+// jobItem is the DynamoDB representation of a JobRecord
+type jobItem struct {
+	JobId          string `dynamodbav:"JobId"`
+	DeploymentId   string `dynamodbav:"DeploymentId"`
+	ServerId       string `dynamodbav:"ServerId"`
+	UserId         string `dynamodbav:"UserId"`
+	Branch         string `dynamodbav:"Branch"`
+	CommitHash     string `dynamodbav:"CommitHash"`
+	Status         string `dynamodbav:"Status"`
+	Attempts       int    `dynamodbav:"Attempts"`
+	LeaseOwner     string `dynamodbav:"LeaseOwner,omitempty"`
+	LeaseExpiresAt int64  `dynamodbav:"LeaseExpiresAt,omitempty"`
+	LastError      string `dynamodbav:"LastError,omitempty"`
+	CancelledBy    string `dynamodbav:"CancelledBy,omitempty"`
+	EnqueuedAt     int64  `dynamodbav:"EnqueuedAt"`
+	UpdatedAt      int64  `dynamodbav:"UpdatedAt"`
+}
+
+// NewDynamoJobStore creates a DynamoDB-backed job store
+func NewDynamoJobStore(client *database.Client, tableName string) *DynamoJobStore {
+	return &DynamoJobStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// Save stores a new job in the queued state
+func (s *DynamoJobStore) Save(ctx context.Context, job *BuildJob) error {
+	record := newJobRecord(job)
+
+	item, err := attributevalue.MarshalMap(toJobItem(record))
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	_, err = s.client.DynamoDB.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.tableName),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(JobId) OR (#status <> :queued AND #status <> :running)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":queued":  &types.AttributeValueMemberS{Value: JobStatusQueued},
+			":running": &types.AttributeValueMemberS{Value: JobStatusRunning},
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrJobExists
+		}
+		logger.WithFields(map[string]interface{}{
+			"job_id": job.ID(),
+			"error":  err.Error(),
+		}).Error("Failed to save job to DynamoDB")
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+
+	return nil
+}
+
+// Acquire leases a job to a worker
+func (s *DynamoJobStore) Acquire(ctx context.Context, jobID, owner string, lease time.Duration) (*JobRecord, error) {
+	now := time.Now()
+
+	result, err := s.client.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"JobId": &types.AttributeValueMemberS{Value: jobID},
+		},
+		UpdateExpression:    aws.String("SET #status = :running, LeaseOwner = :owner, LeaseExpiresAt = :lease, UpdatedAt = :now ADD Attempts :one"),
+		ConditionExpression: aws.String("#status = :queued OR (#status = :running AND LeaseExpiresAt < :now)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":queued":  &types.AttributeValueMemberS{Value: JobStatusQueued},
+			":running": &types.AttributeValueMemberS{Value: JobStatusRunning},
+			":owner":   &types.AttributeValueMemberS{Value: owner},
+			":lease":   unixAttribute(now.Add(lease)),
+			":now":     unixAttribute(now),
+			":one":     &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return nil, ErrJobNotAvailable
+		}
+		return nil, fmt.Errorf("failed to acquire job: %w", err)
+	}
+
+	return unmarshalJobRecord(result.Attributes)
+}
+
+// Renew extends the lease held by owner
+func (s *DynamoJobStore) Renew(ctx context.Context, jobID, owner string, lease time.Duration) error {
+	now := time.Now()
+
+	_, err := s.client.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"JobId": &types.AttributeValueMemberS{Value: jobID},
+		},
+		UpdateExpression:                    aws.String("SET LeaseExpiresAt = :lease, UpdatedAt = :now"),
+		ConditionExpression:                 aws.String("#status = :running AND LeaseOwner = :owner AND attribute_not_exists(CancelledBy)"),
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":running": &types.AttributeValueMemberS{Value: JobStatusRunning},
+			":owner":   &types.AttributeValueMemberS{Value: owner},
+			":lease":   unixAttribute(now.Add(lease)),
+			":now":     unixAttribute(now),
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			if record, uerr := unmarshalJobRecord(ccf.Item); uerr == nil && record.CancelledBy != "" && record.LeaseOwner == owner {
+				return &CancelledError{By: record.CancelledBy}
+			}
+			return ErrLeaseLost
+		}
+		return fmt.Errorf("failed to renew job lease: %w", err)
+	}
+
+	return nil
+}
+
+// Complete records the final status of a job. Finished jobs expire via TTL.
+func (s *DynamoJobStore) Complete(ctx context.Context, jobID, owner, status, lastError string) error {
+	now := time.Now()
+
+	_, err := s.client.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"JobId": &types.AttributeValueMemberS{Value: jobID},
+		},
+		UpdateExpression:    aws.String("SET #status = :status, LastError = :lastError, UpdatedAt = :now, ExpiresAt = :expires REMOVE LeaseOwner, LeaseExpiresAt"),
+		ConditionExpression: aws.String("LeaseOwner = :owner"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status":    &types.AttributeValueMemberS{Value: status},
+			":lastError": &types.AttributeValueMemberS{Value: lastError},
+			":owner":     &types.AttributeValueMemberS{Value: owner},
+			":now":       unixAttribute(now),
+			":expires":   unixAttribute(now.Add(finishedJobRetention)),
+		},
+	})
+	if err != nil {
+		var ccf *types.ConditionalCheckFailedException
+		if errors.As(err, &ccf) {
+			return ErrLeaseLost
+		}
+		return fmt.Errorf("failed to complete job: %w", err)
+	}
+
+	return nil
+}
+
+// Cancel cancels a queued job or flags a running one. A worker on another
+// node notices the flag on its next lease renewal.
+func (s *DynamoJobStore) Cancel(ctx context.Context, jobID, by string) (string, error) {
+	now := time.Now()
+	key := map[string]types.AttributeValue{
+		"JobId": &types.AttributeValueMemberS{Value: jobID},
+	}
+
+	// A queued job is finished right away
+	_, err := s.client.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tableName),
+		Key:                 key,
+		UpdateExpression:    aws.String("SET #status = :cancelled, CancelledBy = :by, UpdatedAt = :now, ExpiresAt = :expires"),
+		ConditionExpression: aws.String("#status = :queued"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":cancelled": &types.AttributeValueMemberS{Value: JobStatusCancelled},
+			":queued":    &types.AttributeValueMemberS{Value: JobStatusQueued},
+			":by":        &types.AttributeValueMemberS{Value: by},
+			":now":       unixAttribute(now),
+			":expires":   unixAttribute(now.Add(finishedJobRetention)),
+		},
+	})
+	if err == nil {
+		return JobStatusQueued, nil
+	}
+
+	var ccf *types.ConditionalCheckFailedException
+	if !errors.As(err, &ccf) {
+		return "", fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	// Otherwise flag a running job for its worker
+	_, err = s.client.DynamoDB.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tableName),
+		Key:                 key,
+		UpdateExpression:    aws.String("SET CancelledBy = :by, UpdatedAt = :now"),
+		ConditionExpression: aws.String("#status = :running"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":running": &types.AttributeValueMemberS{Value: JobStatusRunning},
+			":by":      &types.AttributeValueMemberS{Value: by},
+			":now":     unixAttribute(now),
+		},
+	})
+	if err != nil {
+		if errors.As(err, &ccf) {
+			return "", ErrJobNotAvailable
+		}
+		return "", fmt.Errorf("failed to cancel job: %w", err)
+	}
+
+	return JobStatusRunning, nil
+}
+
+// ListPending returns queued jobs and running jobs with an expired lease, oldest first
+func (s *DynamoJobStore) ListPending(ctx context.Context) ([]*JobRecord, error) {
+	queued, err := s.queryByStatus(ctx, JobStatusQueued)
+	if err != nil {
+		return nil, err
+	}
+
+	running, err := s.queryByStatus(ctx, JobStatusRunning)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	pending := queued
+	for _, record := range running {
+		if record.isAcquirable(now) {
+			pending = append(pending, record)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].EnqueuedAt.Before(pending[j].EnqueuedAt)
+	})
+	return pending, nil
+}
+
+// queryByStatus reads every job with the given status from the status index
+func (s *DynamoJobStore) queryByStatus(ctx context.Context, status string) ([]*JobRecord, error) {
+	records := make([]*JobRecord, 0)
+
+	paginator := dynamodb.NewQueryPaginator(s.client.DynamoDB, &dynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		IndexName:              aws.String(JobStatusIndex),
+		KeyConditionExpression: aws.String("#status = :status"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: status},
+		},
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query %s jobs: %w", status, err)
+		}
+
+		for _, item := range page.Items {
+			record, err := unmarshalJobRecord(item)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+// toJobItem converts a JobRecord to its DynamoDB representation
+func toJobItem(record *JobRecord) jobItem {
+	item := jobItem{
+		JobId:        record.Job.ID(),
+		DeploymentId: record.Job.DeploymentID,
+		ServerId:     record.Job.ServerID,
+		UserId:       record.Job.UserID,
+		Branch:       record.Job.Branch,
+		CommitHash:   record.Job.CommitHash,
+		Status:       record.Status,
+		Attempts:     record.Attempts,
+		LeaseOwner:   record.LeaseOwner,
+		LastError:    record.LastError,
+		CancelledBy:  record.CancelledBy,
+		EnqueuedAt:   record.EnqueuedAt.Unix(),
+		UpdatedAt:    record.UpdatedAt.Unix(),
+	}
+	if !record.LeaseExpiresAt.IsZero() {
+		item.LeaseExpiresAt = record.LeaseExpiresAt.Unix()
+	}
+	return item
+}
+
+// unmarshalJobRecord converts a DynamoDB item to a JobRecord
+func unmarshalJobRecord(av map[string]types.AttributeValue) (*JobRecord, error) {
+	var item jobItem
+	if err := attributevalue.UnmarshalMap(av, &item); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+
+	record := &JobRecord{
+		Job: BuildJob{
+			DeploymentID: item.DeploymentId,
+			ServerID:     item.ServerId,
+			UserID:       item.UserId,
+			Branch:       item.Branch,
+			CommitHash:   item.CommitHash,
+		},
+		Status:      item.Status,
+		Attempts:    item.Attempts,
+		LeaseOwner:  item.LeaseOwner,
+		LastError:   item.LastError,
+		CancelledBy: item.CancelledBy,
+		EnqueuedAt:  time.Unix(item.EnqueuedAt, 0),
+		UpdatedAt:   time.Unix(item.UpdatedAt, 0),
+	}
+	if item.LeaseExpiresAt > 0 {
+		record.LeaseExpiresAt = time.Unix(item.LeaseExpiresAt, 0)
+	}
+	return record, nil
+}
+
+// unixAttribute formats a time as a DynamoDB number attribute
+func unixAttribute(t time.Time) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(t.Unix(), 10)}
+}
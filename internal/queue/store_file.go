@@ -0,0 +1,219 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/logger"
+)
+
+// FileJobStore persists jobs as JSON files in a local directory.
+// It is meant for single-node deployments and local development where
+// a DynamoDB table is not available. Finished jobs are removed from disk.
+// A change whose file cannot be written is rolled back in memory, so the
+// in-memory state never runs ahead of what a restart would load.
+type FileJobStore struct {
+	dir   string
+	state *MemoryJobStore
+}
+
+// NewFileJobStore opens (or creates) a file-backed job store in dir and
+// loads any jobs left behind by a previous run
+func NewFileJobStore(dir string) (*FileJobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create job store directory: %w", err)
+	}
+
+	fs := &FileJobStore{
+		dir:   dir,
+		state: NewMemoryJobStore(),
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job store directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read job file %s: %w", entry.Name(), err)
+		}
+
+		var record JobRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			logger.WithFields(map[string]interface{}{
+				"file":  entry.Name(),
+				"error": err.Error(),
+			}).Warn("Skipping unreadable job file")
+			continue
+		}
+		fs.state.records[record.Job.ID()] = &record
+	}
+
+	logger.WithFields(map[string]interface{}{
+		"dir":  dir,
+		"jobs": len(fs.state.records),
+	}).Info("File job store loaded")
+
+	return fs, nil
+}
+
+// Save stores a new job in the queued state
+func (fs *FileJobStore) Save(ctx context.Context, job *BuildJob) error {
+	fs.state.mu.Lock()
+	defer fs.state.mu.Unlock()
+
+	previous := fs.snapshot(job.ID())
+	record, err := fs.state.save(job)
+	if err != nil {
+		return err
+	}
+	if err := fs.write(record); err != nil {
+		fs.restore(job.ID(), previous)
+		return err
+	}
+	return nil
+}
+
+// Acquire leases a job to a worker
+func (fs *FileJobStore) Acquire(ctx context.Context, jobID, owner string, lease time.Duration) (*JobRecord, error) {
+	fs.state.mu.Lock()
+	defer fs.state.mu.Unlock()
+
+	previous := fs.snapshot(jobID)
+	record, err := fs.state.acquire(jobID, owner, lease)
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.write(record); err != nil {
+		fs.restore(jobID, previous)
+		return nil, err
+	}
+	copied := *record
+	return &copied, nil
+}
+
+// Renew extends the lease held by owner
+func (fs *FileJobStore) Renew(ctx context.Context, jobID, owner string, lease time.Duration) error {
+	fs.state.mu.Lock()
+	defer fs.state.mu.Unlock()
+
+	previous := fs.snapshot(jobID)
+	record, err := fs.state.renew(jobID, owner, lease)
+	if err != nil {
+		return err
+	}
+	if err := fs.write(record); err != nil {
+		fs.restore(jobID, previous)
+		return err
+	}
+	return nil
+}
+
+// Complete records the final status of a job and removes it from disk
+func (fs *FileJobStore) Complete(ctx context.Context, jobID, owner, status, lastError string) error {
+	fs.state.mu.Lock()
+	defer fs.state.mu.Unlock()
+
+	previous := fs.snapshot(jobID)
+	if _, err := fs.state.complete(jobID, owner, status, lastError); err != nil {
+		return err
+	}
+	if err := fs.remove(jobID); err != nil {
+		fs.restore(jobID, previous)
+		return err
+	}
+	return nil
+}
+
+// Cancel cancels a queued job or flags a running one. Cancelled queued jobs are removed from disk.
+func (fs *FileJobStore) Cancel(ctx context.Context, jobID, by string) (string, error) {
+	fs.state.mu.Lock()
+	defer fs.state.mu.Unlock()
+
+	before := fs.snapshot(jobID)
+	previous, record, err := fs.state.cancel(jobID, by)
+	if err != nil {
+		return "", err
+	}
+
+	if previous == JobStatusQueued {
+		err = fs.remove(jobID)
+	} else {
+		err = fs.write(record)
+	}
+	if err != nil {
+		fs.restore(jobID, before)
+		return "", err
+	}
+	return previous, nil
+}
+
+// ListPending returns jobs that still need to be processed, oldest first
+func (fs *FileJobStore) ListPending(ctx context.Context) ([]*JobRecord, error) {
+	return fs.state.ListPending(ctx)
+}
+
+// write atomically persists a record. The caller must hold fs.state.mu.
+func (fs *FileJobStore) write(record *JobRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	path := fs.path(record.Job.ID())
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write job file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to commit job file: %w", err)
+	}
+	return nil
+}
+
+// remove drops a finished record's file and then the record. The caller must hold fs.state.mu.
+func (fs *FileJobStore) remove(jobID string) error {
+	if err := os.Remove(fs.path(jobID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove job file: %w", err)
+	}
+	delete(fs.state.records, jobID)
+	return nil
+}
+
+// snapshot copies a job's record before a change, or returns nil when there
+// is none. The caller must hold fs.state.mu.
+func (fs *FileJobStore) snapshot(jobID string) *JobRecord {
+	record, ok := fs.state.records[jobID]
+	if !ok {
+		return nil
+	}
+	copied := *record
+	return &copied
+}
+
+// restore puts back the record taken by snapshot after its file could not be
+// changed. The caller must hold fs.state.mu.
+func (fs *FileJobStore) restore(jobID string, previous *JobRecord) {
+	if previous == nil {
+		delete(fs.state.records, jobID)
+		return
+	}
+	fs.state.records[jobID] = previous
+}
+
+// path returns the file path for a job ID
+func (fs *FileJobStore) path(jobID string) string {
+	return filepath.Join(fs.dir, url.PathEscape(jobID)+".json")
+}
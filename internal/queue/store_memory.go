@@ -0,0 +1,180 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryJobStore keeps jobs in memory only. Jobs are lost on restart,
+// so it is intended for tests and throwaway local runs. Finished jobs are
+// dropped so the store only holds outstanding work.
+type MemoryJobStore struct {
+	mu      sync.Mutex
+	records map[string]*JobRecord
+}
+
+// NewMemoryJobStore creates an empty in-memory job store
+func NewMemoryJobStore() *MemoryJobStore {
+	return &MemoryJobStore{
+		records: make(map[string]*JobRecord),
+	}
+}
+
+// Save stores a new job in the queued state
+func (s *MemoryJobStore) Save(ctx context.Context, job *BuildJob) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.save(job)
+	return err
+}
+
+// Acquire leases a job to a worker
+func (s *MemoryJobStore) Acquire(ctx context.Context, jobID, owner string, lease time.Duration) (*JobRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.acquire(jobID, owner, lease)
+	if err != nil {
+		return nil, err
+	}
+	copied := *record
+	return &copied, nil
+}
+
+// Renew extends the lease held by owner
+func (s *MemoryJobStore) Renew(ctx context.Context, jobID, owner string, lease time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.renew(jobID, owner, lease)
+	return err
+}
+
+// Complete records the final status of a job
+func (s *MemoryJobStore) Complete(ctx context.Context, jobID, owner, status, lastError string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.complete(jobID, owner, status, lastError); err != nil {
+		return err
+	}
+	delete(s.records, jobID)
+	return nil
+}
+
+// Cancel cancels a queued job or flags a running one
+func (s *MemoryJobStore) Cancel(ctx context.Context, jobID, by string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, _, err := s.cancel(jobID, by)
+	if err != nil {
+		return "", err
+	}
+	if previous == JobStatusQueued {
+		delete(s.records, jobID)
+	}
+	return previous, nil
+}
+
+// ListPending returns jobs that still need to be processed, oldest first
+func (s *MemoryJobStore) ListPending(ctx context.Context) ([]*JobRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.listPending(), nil
+}
+
+// save inserts a queued record. The caller must hold s.mu.
+func (s *MemoryJobStore) save(job *BuildJob) (*JobRecord, error) {
+	if existing, ok := s.records[job.ID()]; ok && existing.isActive() {
+		return nil, ErrJobExists
+	}
+
+	record := newJobRecord(job)
+	s.records[job.ID()] = record
+	return record, nil
+}
+
+// acquire leases a record to owner. The caller must hold s.mu.
+func (s *MemoryJobStore) acquire(jobID, owner string, lease time.Duration) (*JobRecord, error) {
+	record, ok := s.records[jobID]
+	now := time.Now()
+	if !ok || !record.isAcquirable(now) {
+		return nil, ErrJobNotAvailable
+	}
+
+	record.Status = JobStatusRunning
+	record.Attempts++
+	record.LeaseOwner = owner
+	record.LeaseExpiresAt = now.Add(lease)
+	record.UpdatedAt = now
+	return record, nil
+}
+
+// renew extends a lease. The caller must hold s.mu.
+func (s *MemoryJobStore) renew(jobID, owner string, lease time.Duration) (*JobRecord, error) {
+	record, ok := s.records[jobID]
+	if !ok || record.Status != JobStatusRunning || record.LeaseOwner != owner {
+		return nil, ErrLeaseLost
+	}
+	if record.CancelledBy != "" {
+		return nil, &CancelledError{By: record.CancelledBy}
+	}
+
+	now := time.Now()
+	record.LeaseExpiresAt = now.Add(lease)
+	record.UpdatedAt = now
+	return record, nil
+}
+
+// complete finishes a record. The caller must hold s.mu.
+func (s *MemoryJobStore) complete(jobID, owner, status, lastError string) (*JobRecord, error) {
+	record, ok := s.records[jobID]
+	if !ok || record.LeaseOwner != owner {
+		return nil, ErrLeaseLost
+	}
+
+	record.Status = status
+	record.LastError = lastError
+	record.LeaseOwner = ""
+	record.LeaseExpiresAt = time.Time{}
+	record.UpdatedAt = time.Now()
+	return record, nil
+}
+
+// cancel marks a queued record cancelled or flags a running record. The caller must hold s.mu.
+func (s *MemoryJobStore) cancel(jobID, by string) (string, *JobRecord, error) {
+	record, ok := s.records[jobID]
+	if !ok || !record.isActive() {
+		return "", nil, ErrJobNotAvailable
+	}
+
+	previous := record.Status
+	if previous == JobStatusQueued {
+		record.Status = JobStatusCancelled
+	}
+	record.CancelledBy = by
+	record.UpdatedAt = time.Now()
+	return previous, record, nil
+}
+
+// listPending returns copies of all acquirable records. The caller must hold s.mu.
+func (s *MemoryJobStore) listPending() []*JobRecord {
+	now := time.Now()
+	pending := make([]*JobRecord, 0)
+	for _, record := range s.records {
+		if record.isAcquirable(now) {
+			copied := *record
+			pending = append(pending, &copied)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].EnqueuedAt.Before(pending[j].EnqueuedAt)
+	})
+	return pending
+}
@@ -0,0 +1,368 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/imyashkale/buildserver/internal/database"
+)
+
+// storeFactories opens an empty store of every backend. DynamoJobStore runs
+// against DynamoDB Local when DYNAMODB_TEST_ENDPOINT is set.
+var storeFactories = map[string]func(t *testing.T) JobStore{
+	"memory": func(t *testing.T) JobStore {
+		return NewMemoryJobStore()
+	},
+	"file": func(t *testing.T) JobStore {
+		store, err := NewFileJobStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("NewFileJobStore: %v", err)
+		}
+		return store
+	},
+	"dynamodb": newDynamoTestStore,
+}
+
+// newDynamoTestStore creates a jobs table in DynamoDB Local that is dropped after the test
+func newDynamoTestStore(t *testing.T) JobStore {
+	endpoint := os.Getenv("DYNAMODB_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_TEST_ENDPOINT not set")
+	}
+	ctx := context.Background()
+	tableName := fmt.Sprintf("build-jobs-test-%d", time.Now().UnixNano())
+
+	client, err := database.NewClient(ctx, &database.Config{TableName: tableName, Region: "us-east-1", Endpoint: endpoint})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	index := database.IndexDefinition{
+		Name:         JobStatusIndex,
+		PartitionKey: database.KeyAttribute{Name: "Status", Type: types.ScalarAttributeTypeS},
+		SortKey:      &database.KeyAttribute{Name: "EnqueuedAt", Type: types.ScalarAttributeTypeN},
+	}
+	_, err = client.DynamoDB.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName:              aws.String(tableName),
+		BillingMode:            types.BillingModePayPerRequest,
+		KeySchema:              []types.KeySchemaElement{{AttributeName: aws.String("JobId"), KeyType: types.KeyTypeHash}},
+		AttributeDefinitions:   append(index.AttributeDefinitions(), types.AttributeDefinition{AttributeName: aws.String("JobId"), AttributeType: types.ScalarAttributeTypeS}),
+		GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{index.GlobalSecondaryIndex()},
+	})
+	if err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+	t.Cleanup(func() {
+		client.DynamoDB.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(tableName)})
+	})
+	return NewDynamoJobStore(client, tableName)
+}
+
+// testJob returns a build job of deployment id
+func testJob(id string) *BuildJob {
+	return &BuildJob{DeploymentID: id, ServerID: "server-1", UserID: "user-1", Branch: "main", CommitHash: "abc123"}
+}
+
+func TestJobStore_SaveRejectsActiveDuplicates(t *testing.T) {
+	for name, newStore := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			job := testJob("deploy-1")
+
+			if err := store.Save(ctx, job); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+			if err := store.Save(ctx, job); !errors.Is(err, ErrJobExists) {
+				t.Fatalf("Save of a queued job = %v, want ErrJobExists", err)
+			}
+			if _, err := store.Acquire(ctx, job.ID(), "worker-1", time.Minute); err != nil {
+				t.Fatalf("Acquire: %v", err)
+			}
+			if err := store.Save(ctx, job); !errors.Is(err, ErrJobExists) {
+				t.Fatalf("Save of a running job = %v, want ErrJobExists", err)
+			}
+
+			// A finished job may be queued again
+			if err := store.Complete(ctx, job.ID(), "worker-1", JobStatusFailed, "boom"); err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			if err := store.Save(ctx, job); err != nil {
+				t.Fatalf("Save after completion: %v", err)
+			}
+		})
+	}
+}
+
+func TestJobStore_Leases(t *testing.T) {
+	for name, newStore := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			job := testJob("deploy-1")
+			if err := store.Save(ctx, job); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			if _, err := store.Acquire(ctx, "server-1/missing", "worker-1", time.Minute); !errors.Is(err, ErrJobNotAvailable) {
+				t.Errorf("Acquire of an unknown job = %v, want ErrJobNotAvailable", err)
+			}
+			record, err := store.Acquire(ctx, job.ID(), "worker-1", time.Minute)
+			if err != nil {
+				t.Fatalf("Acquire: %v", err)
+			}
+			if record.Status != JobStatusRunning || record.Attempts != 1 || record.LeaseOwner != "worker-1" || record.Job != *job {
+				t.Errorf("Acquired record = %+v", record)
+			}
+			if _, err := store.Acquire(ctx, job.ID(), "worker-2", time.Minute); !errors.Is(err, ErrJobNotAvailable) {
+				t.Errorf("Acquire of a leased job = %v, want ErrJobNotAvailable", err)
+			}
+			if err := store.Renew(ctx, job.ID(), "worker-1", time.Minute); err != nil {
+				t.Errorf("Renew by the owner: %v", err)
+			}
+			if err := store.Renew(ctx, job.ID(), "worker-2", time.Minute); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("Renew by another worker = %v, want ErrLeaseLost", err)
+			}
+
+			// Once worker-1 stops renewing, the lease expires and worker-2 takes over
+			if err := store.Renew(ctx, job.ID(), "worker-1", -time.Minute); err != nil {
+				t.Fatalf("Renew: %v", err)
+			}
+			record, err = store.Acquire(ctx, job.ID(), "worker-2", time.Minute)
+			if err != nil {
+				t.Fatalf("Acquire of an expired lease: %v", err)
+			}
+			if record.Attempts != 2 || record.LeaseOwner != "worker-2" {
+				t.Errorf("Re-acquired record = %+v", record)
+			}
+			if err := store.Renew(ctx, job.ID(), "worker-1", time.Minute); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("Renew of a lost lease = %v, want ErrLeaseLost", err)
+			}
+			if err := store.Complete(ctx, job.ID(), "worker-1", JobStatusCompleted, ""); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("Complete of a lost lease = %v, want ErrLeaseLost", err)
+			}
+			if err := store.Complete(ctx, job.ID(), "worker-2", JobStatusCompleted, ""); err != nil {
+				t.Errorf("Complete: %v", err)
+			}
+			if _, err := store.Acquire(ctx, job.ID(), "worker-3", time.Minute); !errors.Is(err, ErrJobNotAvailable) {
+				t.Errorf("Acquire of a finished job = %v, want ErrJobNotAvailable", err)
+			}
+		})
+	}
+}
+
+func TestJobStore_ListPending(t *testing.T) {
+	for name, newStore := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			for _, id := range []string{"queued-1", "expired", "leased", "finished", "cancelled", "queued-2"} {
+				if err := store.Save(ctx, testJob(id)); err != nil {
+					t.Fatalf("Save(%s): %v", id, err)
+				}
+				time.Sleep(2 * time.Millisecond)
+			}
+			mustAcquire(t, store, "expired", -time.Minute)
+			mustAcquire(t, store, "leased", time.Minute)
+			mustAcquire(t, store, "finished", time.Minute)
+			if err := store.Complete(ctx, testJob("finished").ID(), "worker-1", JobStatusCompleted, ""); err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			if _, err := store.Cancel(ctx, testJob("cancelled").ID(), "user-1"); err != nil {
+				t.Fatalf("Cancel: %v", err)
+			}
+
+			records, err := store.ListPending(ctx)
+			if err != nil {
+				t.Fatalf("ListPending: %v", err)
+			}
+			got := make(map[string]bool)
+			for i, record := range records {
+				got[record.Job.DeploymentID] = true
+				if i > 0 && record.EnqueuedAt.Before(records[i-1].EnqueuedAt) {
+					t.Errorf("ListPending is not oldest first: %s before %s", records[i-1].Job.DeploymentID, record.Job.DeploymentID)
+				}
+			}
+			want := map[string]bool{"queued-1": true, "expired": true, "queued-2": true}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("ListPending = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestJobStore_Cancel(t *testing.T) {
+	for name, newStore := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			queued, running := testJob("queued"), testJob("running")
+			for _, job := range []*BuildJob{queued, running} {
+				if err := store.Save(ctx, job); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+			mustAcquire(t, store, "running", time.Minute)
+
+			// A queued job is finished right away and never runs
+			if previous, err := store.Cancel(ctx, queued.ID(), "user-1"); err != nil || previous != JobStatusQueued {
+				t.Errorf("Cancel(queued) = %q, %v", previous, err)
+			}
+			if _, err := store.Acquire(ctx, queued.ID(), "worker-1", time.Minute); !errors.Is(err, ErrJobNotAvailable) {
+				t.Errorf("Acquire of a cancelled job = %v, want ErrJobNotAvailable", err)
+			}
+
+			// A running job is flagged and its worker learns about it on renewal
+			if previous, err := store.Cancel(ctx, running.ID(), "user-1"); err != nil || previous != JobStatusRunning {
+				t.Errorf("Cancel(running) = %q, %v", previous, err)
+			}
+			var cancelled *CancelledError
+			if err := store.Renew(ctx, running.ID(), "worker-1", time.Minute); !errors.As(err, &cancelled) || cancelled.By != "user-1" {
+				t.Errorf("Renew of a cancelled job = %v, want a CancelledError by user-1", err)
+			}
+			if err := store.Complete(ctx, running.ID(), "worker-1", JobStatusCancelled, "cancelled"); err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+
+			if _, err := store.Cancel(ctx, running.ID(), "user-1"); !errors.Is(err, ErrJobNotAvailable) {
+				t.Errorf("Cancel of a finished job = %v, want ErrJobNotAvailable", err)
+			}
+			if _, err := store.Cancel(ctx, "server-1/missing", "user-1"); !errors.Is(err, ErrJobNotAvailable) {
+				t.Errorf("Cancel of an unknown job = %v, want ErrJobNotAvailable", err)
+			}
+		})
+	}
+}
+
+func TestMemoryJobStore_DropsFinishedJobs(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryJobStore()
+	for _, id := range []string{"completed", "cancelled"} {
+		if err := store.Save(ctx, testJob(id)); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	mustAcquire(t, store, "completed", time.Minute)
+	if err := store.Complete(ctx, testJob("completed").ID(), "worker-1", JobStatusCompleted, ""); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if _, err := store.Cancel(ctx, testJob("cancelled").ID(), "user-1"); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+
+	if len(store.records) != 0 {
+		t.Errorf("Store still holds %d finished jobs", len(store.records))
+	}
+}
+
+func TestFileJobStore_ReloadsFromDisk(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileJobStore(dir)
+	if err != nil {
+		t.Fatalf("NewFileJobStore: %v", err)
+	}
+	for _, id := range []string{"queued", "interrupted", "finished"} {
+		if err := store.Save(ctx, testJob(id)); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	mustAcquire(t, store, "interrupted", -time.Minute)
+	mustAcquire(t, store, "finished", time.Minute)
+	if err := store.Complete(ctx, testJob("finished").ID(), "worker-1", JobStatusCompleted, ""); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if err := os.WriteFile(dir+"/garbage.json", []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new process finds the outstanding jobs, including the lease of the interrupted one
+	reopened, err := NewFileJobStore(dir)
+	if err != nil {
+		t.Fatalf("Reopen: %v", err)
+	}
+	records, err := reopened.ListPending(ctx)
+	if err != nil {
+		t.Fatalf("ListPending: %v", err)
+	}
+	if len(records) != 2 || records[0].Job.DeploymentID != "queued" || records[1].Job.DeploymentID != "interrupted" {
+		t.Fatalf("Reloaded jobs = %+v", records)
+	}
+	if records[1].Status != JobStatusRunning || records[1].Attempts != 1 || records[1].Job != *testJob("interrupted") {
+		t.Errorf("Interrupted job = %+v", records[1])
+	}
+	if record, err := reopened.Acquire(ctx, testJob("interrupted").ID(), "worker-2", time.Minute); err != nil || record.Attempts != 2 {
+		t.Errorf("Acquire after reload = %+v, %v", record, err)
+	}
+}
+
+func TestFileJobStore_KeepsStateWhenWritesFail(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileJobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileJobStore: %v", err)
+	}
+	// block replaces a job's file with a directory that can be neither renamed over nor removed
+	block := func(id string) {
+		t.Helper()
+		path := store.path(testJob(id).ID())
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(path+"/blocked", 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []string{"queued", "running"} {
+		if err := store.Save(ctx, testJob(id)); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	mustAcquire(t, store, "running", time.Minute)
+	block("new")
+	block("queued")
+	block("running")
+
+	if err := store.Save(ctx, testJob("new")); err == nil {
+		t.Error("Save succeeded without writing the job file")
+	}
+	if _, err := store.Acquire(ctx, testJob("queued").ID(), "worker-1", time.Minute); err == nil {
+		t.Error("Acquire succeeded without writing the job file")
+	}
+	if _, err := store.Cancel(ctx, testJob("queued").ID(), "user-1"); err == nil {
+		t.Error("Cancel succeeded without removing the job file")
+	}
+	if err := store.Renew(ctx, testJob("running").ID(), "worker-1", time.Hour); err == nil {
+		t.Error("Renew succeeded without writing the job file")
+	}
+	if err := store.Complete(ctx, testJob("running").ID(), "worker-1", JobStatusCompleted, ""); err == nil {
+		t.Error("Complete succeeded without removing the job file")
+	}
+
+	// Every failed change was rolled back in memory
+	if _, ok := store.state.records[testJob("new").ID()]; ok {
+		t.Error("Failed Save left the job in memory")
+	}
+	queued := store.state.records[testJob("queued").ID()]
+	if queued == nil || queued.Status != JobStatusQueued || queued.Attempts != 0 || queued.CancelledBy != "" {
+		t.Errorf("Queued job after failed writes = %+v", queued)
+	}
+	running := store.state.records[testJob("running").ID()]
+	if running == nil || running.Status != JobStatusRunning || time.Until(running.LeaseExpiresAt) > time.Minute {
+		t.Errorf("Running job after failed writes = %+v", running)
+	}
+}
+
+// mustAcquire leases the job of deployment id to worker-1
+func mustAcquire(t *testing.T, store JobStore, id string, lease time.Duration) {
+	t.Helper()
+	if _, err := store.Acquire(context.Background(), testJob(id).ID(), "worker-1", lease); err != nil {
+		t.Fatalf("Acquire(%s): %v", id, err)
+	}
+}
@@ -2,15 +2,42 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/imyashkale/buildserver/internal/database"
 	"github.com/imyashkale/buildserver/internal/models"
 )
 
+var (
+	// ErrStatusConflict is returned when a deployment is no longer in the expected status.
+	// It matches ErrConflict.
+	ErrStatusConflict = database.ErrStatusConflict
+
+	// ErrInvalidTransition is returned for a status change the transition table does not allow
+	ErrInvalidTransition = errors.New("invalid deployment status transition")
+)
+
 // DeploymentRepository defines the interface for deployment operations
 type DeploymentRepository interface {
+	// Create stores a new deployment at version 0. Returns ErrAlreadyExists if
+	// the deployment ID is taken for its server.
+	Create(ctx context.Context, deployment *models.Deployment) error
+
 	Get(ctx context.Context, serverId, deploymentId string) (*models.Deployment, error)
-	Update(ctx context.Context, deployment *models.Deployment) error
+
+	// Update writes the deployment if its stored status is still expected and its
+	// stored Version still equals deployment.Version, and increments deployment.Version.
+	// deployment.Status must equal expected or be a valid transition from it.
+	Update(ctx context.Context, deployment *models.Deployment, expected models.DeploymentStatus) error
+
+	// ListByUserId returns one page of a user's deployments matching filter,
+	// newest first. Pass NextCursor of a page as page.Cursor to get the next
+	// one with the same filter; a foreign cursor returns ErrInvalidCursor.
+	ListByUserId(ctx context.Context, userId string, filter models.DeploymentFilter, page models.PageRequest) (*models.DeploymentPage, error)
+
+	// ListByUserIdAndServerId is ListByUserId for the deployments of one MCP server
+	ListByUserIdAndServerId(ctx context.Context, userId, serverId string, filter models.DeploymentFilter, page models.PageRequest) (*models.DeploymentPage, error)
 }
 
 // dynamoDeploymentRepository implements DeploymentRepository using DynamoDB
@@ -25,12 +52,47 @@ func NewDeploymentRepository(db *database.DeploymentOperations) DeploymentReposi
 	}
 }
 
+// Create stores a new deployment
+func (r *dynamoDeploymentRepository) Create(ctx context.Context, deployment *models.Deployment) error {
+	return r.db.CreateDeployment(ctx, deployment)
+}
+
 // Get retrieves a deployment by server ID and commit hash
 func (r *dynamoDeploymentRepository) Get(ctx context.Context, serverId, deploymentId string) (*models.Deployment, error) {
 	return r.db.GetDeployment(ctx, serverId, deploymentId)
 }
 
-// Update updates a deployment record with all fields
-func (r *dynamoDeploymentRepository) Update(ctx context.Context, deployment *models.Deployment) error {
-	return r.db.UpdateDeployment(ctx, deployment)
+// Update updates a deployment record with all fields, guarded by its current status
+func (r *dynamoDeploymentRepository) Update(ctx context.Context, deployment *models.Deployment, expected models.DeploymentStatus) error {
+	if err := ValidateTransition(expected, deployment.Status); err != nil {
+		return err
+	}
+	return r.db.UpdateDeployment(ctx, deployment, expected)
+}
+
+// ListByUserId returns one page of the deployments owned by a user
+func (r *dynamoDeploymentRepository) ListByUserId(ctx context.Context, userId string, filter models.DeploymentFilter, page models.PageRequest) (*models.DeploymentPage, error) {
+	deployments, cursor, err := r.db.GetDeploymentsByUserId(ctx, userId, filter, page)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DeploymentPage{Deployments: deployments, NextCursor: cursor}, nil
+}
+
+// ListByUserIdAndServerId returns one page of the deployments owned by a user for one MCP server
+func (r *dynamoDeploymentRepository) ListByUserIdAndServerId(ctx context.Context, userId, serverId string, filter models.DeploymentFilter, page models.PageRequest) (*models.DeploymentPage, error) {
+	deployments, cursor, err := r.db.GetDeploymentsByUserIdAndServerId(ctx, userId, serverId, filter, page)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DeploymentPage{Deployments: deployments, NextCursor: cursor}, nil
+}
+
+// ValidateTransition checks a status change against the transition table.
+// Writing a deployment without changing its status is always allowed.
+func ValidateTransition(from, to models.DeploymentStatus) error {
+	if from == to || from.CanTransitionTo(to) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
 }
@@ -11,12 +11,33 @@ import (
 var (
 	ErrNotFound      = database.ErrNotFound
 	ErrAlreadyExists = database.ErrAlreadyExists
+	ErrConflict      = database.ErrConflict
+	ErrInvalidCursor = database.ErrInvalidCursor
 )
 
+// ConflictError reports an update rejected because the record's Version changed
+// since it was read. errors.Is(err, ErrConflict) matches it.
+type ConflictError = database.ConflictError
+
 // MCPRepository defines the interface for MCP server operations
 type MCPRepository interface {
 	Get(ctx context.Context, id string) (*models.MCPServer, error)
+
+	// Update writes the server if its stored Version still equals server.Version,
+	// and increments server.Version. A concurrent write returns an ErrConflict.
 	Update(ctx context.Context, server *models.MCPServer) error
+
+	// List returns one page of all MCP servers. Pass NextCursor of a page as
+	// page.Cursor to get the next one; a foreign cursor returns ErrInvalidCursor.
+	List(ctx context.Context, page models.PageRequest) (*models.MCPServerPage, error)
+
+	// ListByUserId returns one page of a user's MCP servers, newest first
+	ListByUserId(ctx context.Context, userId string, page models.PageRequest) (*models.MCPServerPage, error)
+
+	// ListByRepositoryKey returns one page of the servers whose
+	// WebhookRepositoryKey is repositoryKey, i.e. the servers with a webhook
+	// secret that are built from the repository
+	ListByRepositoryKey(ctx context.Context, repositoryKey string, page models.PageRequest) (*models.MCPServerPage, error)
 }
 
 // dynamoMCPRepository implements MCPRepository using DynamoDB
@@ -40,3 +61,30 @@ func (r *dynamoMCPRepository) Get(ctx context.Context, id string) (*models.MCPSe
 func (r *dynamoMCPRepository) Update(ctx context.Context, server *models.MCPServer) error {
 	return r.db.UpdateMCP(ctx, server)
 }
+
+// List returns one page of all MCP servers
+func (r *dynamoMCPRepository) List(ctx context.Context, page models.PageRequest) (*models.MCPServerPage, error) {
+	servers, cursor, err := r.db.GetAllMCPs(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MCPServerPage{Servers: servers, NextCursor: cursor}, nil
+}
+
+// ListByUserId returns one page of a user's MCP servers
+func (r *dynamoMCPRepository) ListByUserId(ctx context.Context, userId string, page models.PageRequest) (*models.MCPServerPage, error) {
+	servers, cursor, err := r.db.GetMCPsByUserId(ctx, userId, page)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MCPServerPage{Servers: servers, NextCursor: cursor}, nil
+}
+
+// ListByRepositoryKey returns one page of the webhook servers of a repository
+func (r *dynamoMCPRepository) ListByRepositoryKey(ctx context.Context, repositoryKey string, page models.PageRequest) (*models.MCPServerPage, error) {
+	servers, cursor, err := r.db.GetMCPsByRepositoryKey(ctx, repositoryKey, page)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MCPServerPage{Servers: servers, NextCursor: cursor}, nil
+}
@@ -0,0 +1,422 @@
+package repository
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/imyashkale/buildserver/internal/database"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// MemoryMCPRepository is an MCPRepository held in memory. It keeps the
+// versioning rules of the database backends and is meant for tests and
+// local runs.
+type MemoryMCPRepository struct {
+	mu      sync.Mutex
+	servers map[string]*models.MCPServer
+}
+
+// NewMemoryMCPRepository creates an empty in-memory MCP repository
+func NewMemoryMCPRepository() *MemoryMCPRepository {
+	return &MemoryMCPRepository{
+		servers: make(map[string]*models.MCPServer),
+	}
+}
+
+// Create stores a new MCP server. Returns ErrAlreadyExists if the ID is taken.
+func (r *MemoryMCPRepository) Create(ctx context.Context, server *models.MCPServer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.servers[server.ServerId]; ok {
+		return ErrAlreadyExists
+	}
+	r.servers[server.ServerId] = cloneMCPServer(server)
+	return nil
+}
+
+// Get retrieves an MCP server by ID
+func (r *MemoryMCPRepository) Get(ctx context.Context, id string) (*models.MCPServer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	server, ok := r.servers[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneMCPServer(server), nil
+}
+
+// Update writes the server if its stored Version still equals server.Version
+func (r *MemoryMCPRepository) Update(ctx context.Context, server *models.MCPServer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.servers[server.ServerId]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Version != server.Version {
+		return &ConflictError{Key: server.ServerId, ExpectedVersion: server.Version, ActualVersion: stored.Version}
+	}
+
+	server.Version++
+	r.servers[server.ServerId] = cloneMCPServer(server)
+	return nil
+}
+
+// List returns one page of all MCP servers ordered by ID
+func (r *MemoryMCPRepository) List(ctx context.Context, page models.PageRequest) (*models.MCPServerPage, error) {
+	servers, cursor, err := r.list(page, "", byKey, func(s *models.MCPServer) bool { return true })
+	if err != nil {
+		return nil, err
+	}
+	return &models.MCPServerPage{Servers: servers, NextCursor: cursor}, nil
+}
+
+// ListByUserId returns one page of a user's MCP servers, newest first
+func (r *MemoryMCPRepository) ListByUserId(ctx context.Context, userId string, page models.PageRequest) (*models.MCPServerPage, error) {
+	servers, cursor, err := r.list(page, userId, newestFirst, func(s *models.MCPServer) bool { return s.UserId == userId })
+	if err != nil {
+		return nil, err
+	}
+	return &models.MCPServerPage{Servers: servers, NextCursor: cursor}, nil
+}
+
+// ListByRepositoryKey returns one page of the webhook servers of a repository, ordered by ID
+func (r *MemoryMCPRepository) ListByRepositoryKey(ctx context.Context, repositoryKey string, page models.PageRequest) (*models.MCPServerPage, error) {
+	servers, cursor, err := r.list(page, repositoryKey, byKey, func(s *models.MCPServer) bool {
+		return s.WebhookRepositoryKey() == repositoryKey
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &models.MCPServerPage{Servers: servers, NextCursor: cursor}, nil
+}
+
+// list returns one page of the servers that match, in the given order
+func (r *MemoryMCPRepository) list(page models.PageRequest, partition string, order positionOrder, match func(*models.MCPServer) bool) ([]*models.MCPServer, string, error) {
+	r.mu.Lock()
+	servers := make([]*models.MCPServer, 0)
+	for _, server := range r.servers {
+		if match(server) {
+			servers = append(servers, cloneMCPServer(server))
+		}
+	}
+	r.mu.Unlock()
+
+	return paginate(servers, func(s *models.MCPServer) memoryPosition {
+		return memoryPosition{Partition: partition, CreatedAt: s.CreatedAt.UnixNano(), Key: s.ServerId}
+	}, order, partition, page)
+}
+
+// MemoryDeploymentRepository is a DeploymentRepository held in memory. Like
+// the database backends it checks status transitions, the expected status and
+// the version on every update.
+type MemoryDeploymentRepository struct {
+	mu          sync.Mutex
+	deployments map[string]*models.Deployment
+}
+
+// NewMemoryDeploymentRepository creates an empty in-memory deployment repository
+func NewMemoryDeploymentRepository() *MemoryDeploymentRepository {
+	return &MemoryDeploymentRepository{
+		deployments: make(map[string]*models.Deployment),
+	}
+}
+
+// Create stores a new deployment. Returns ErrAlreadyExists if the deployment
+// ID is taken for its server.
+func (r *MemoryDeploymentRepository) Create(ctx context.Context, deployment *models.Deployment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := deploymentKey(deployment.ServerId, deployment.DeploymentId)
+	if _, ok := r.deployments[key]; ok {
+		return ErrAlreadyExists
+	}
+	r.deployments[key] = cloneDeployment(deployment)
+	return nil
+}
+
+// Get retrieves a deployment by server ID and deployment ID
+func (r *MemoryDeploymentRepository) Get(ctx context.Context, serverId, deploymentId string) (*models.Deployment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	deployment, ok := r.deployments[deploymentKey(serverId, deploymentId)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return cloneDeployment(deployment), nil
+}
+
+// Update writes the deployment if its stored status is still expected and its
+// stored Version still equals deployment.Version
+func (r *MemoryDeploymentRepository) Update(ctx context.Context, deployment *models.Deployment, expected models.DeploymentStatus) error {
+	if err := ValidateTransition(expected, deployment.Status); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := deploymentKey(deployment.ServerId, deployment.DeploymentId)
+	stored, ok := r.deployments[key]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.Status != expected {
+		return ErrStatusConflict
+	}
+	if stored.Version != deployment.Version {
+		return &ConflictError{Key: key, ExpectedVersion: deployment.Version, ActualVersion: stored.Version}
+	}
+
+	deployment.Version++
+	r.deployments[key] = cloneDeployment(deployment)
+	return nil
+}
+
+// ListByUserId returns one page of a user's deployments matching filter, newest first
+func (r *MemoryDeploymentRepository) ListByUserId(ctx context.Context, userId string, filter models.DeploymentFilter, page models.PageRequest) (*models.DeploymentPage, error) {
+	return r.list(page, userId+"/", func(d *models.Deployment) bool {
+		return d.UserId == userId && filter.Matches(d)
+	})
+}
+
+// ListByUserIdAndServerId returns one page of a user's deployments of one MCP
+// server matching filter, newest first
+func (r *MemoryDeploymentRepository) ListByUserIdAndServerId(ctx context.Context, userId, serverId string, filter models.DeploymentFilter, page models.PageRequest) (*models.DeploymentPage, error) {
+	return r.list(page, userId+"/"+serverId, func(d *models.Deployment) bool {
+		return d.UserId == userId && d.ServerId == serverId && filter.Matches(d)
+	})
+}
+
+// list returns one page of the deployments that match, newest first
+func (r *MemoryDeploymentRepository) list(page models.PageRequest, partition string, match func(*models.Deployment) bool) (*models.DeploymentPage, error) {
+	r.mu.Lock()
+	deployments := make([]*models.Deployment, 0)
+	for _, deployment := range r.deployments {
+		if match(deployment) {
+			deployments = append(deployments, cloneDeployment(deployment))
+		}
+	}
+	r.mu.Unlock()
+
+	deployments, cursor, err := paginate(deployments, func(d *models.Deployment) memoryPosition {
+		return memoryPosition{
+			Partition: partition,
+			CreatedAt: d.CreatedAt.UnixNano(),
+			Key:       deploymentKey(d.ServerId, d.DeploymentId),
+		}
+	}, newestFirst, partition, page)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DeploymentPage{Deployments: deployments, NextCursor: cursor}, nil
+}
+
+// MemoryGitHubRepository is a GitHubRepository held in memory
+type MemoryGitHubRepository struct {
+	mu          sync.Mutex
+	connections map[string]*models.GitHubConnection
+	states      map[string]*models.OAuthState
+}
+
+// NewMemoryGitHubRepository creates an empty in-memory GitHub repository
+func NewMemoryGitHubRepository() *MemoryGitHubRepository {
+	return &MemoryGitHubRepository{
+		connections: make(map[string]*models.GitHubConnection),
+		states:      make(map[string]*models.OAuthState),
+	}
+}
+
+// CreateConnection stores a user's GitHub connection. Returns
+// ErrGitHubConnectionAlreadyExists if the user is already connected.
+func (r *MemoryGitHubRepository) CreateConnection(ctx context.Context, connection *models.GitHubConnection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.connections[connection.UserId]; ok {
+		return ErrGitHubConnectionAlreadyExists
+	}
+	copied := *connection
+	r.connections[connection.UserId] = &copied
+	return nil
+}
+
+// CreateOAuthState stores an OAuth state token
+func (r *MemoryGitHubRepository) CreateOAuthState(ctx context.Context, state *models.OAuthState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	copied := *state
+	r.states[state.StateToken] = &copied
+	return nil
+}
+
+// GetConnectionByUserId retrieves a GitHub connection by user ID
+func (r *MemoryGitHubRepository) GetConnectionByUserId(ctx context.Context, userId string) (*models.GitHubConnection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	connection, ok := r.connections[userId]
+	if !ok {
+		return nil, ErrGitHubConnectionNotFound
+	}
+	copied := *connection
+	return &copied, nil
+}
+
+// GetOAuthState retrieves an OAuth state by state token
+func (r *MemoryGitHubRepository) GetOAuthState(ctx context.Context, stateToken string) (*models.OAuthState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	state, ok := r.states[stateToken]
+	if !ok {
+		return nil, ErrOAuthStateNotFound
+	}
+	copied := *state
+	return &copied, nil
+}
+
+// memoryPosition is the place of an item in an in-memory listing. It is
+// encoded into cursors together with the partition that was listed.
+type memoryPosition struct {
+	Partition string `json:"p,omitempty"`
+	CreatedAt int64  `json:"t"`
+	Key       string `json:"k"`
+}
+
+// positionOrder reports whether a is listed before b
+type positionOrder func(a, b memoryPosition) bool
+
+// newestFirst orders by creation time, newest first, then by key
+func newestFirst(a, b memoryPosition) bool {
+	if a.CreatedAt != b.CreatedAt {
+		return a.CreatedAt > b.CreatedAt
+	}
+	return a.Key > b.Key
+}
+
+// byKey orders by key
+func byKey(a, b memoryPosition) bool {
+	return a.Key < b.Key
+}
+
+// paginate sorts items and returns the page after page.Cursor, with the
+// cursor of the next page or "" on the last page
+func paginate[T any](items []T, position func(T) memoryPosition, order positionOrder, partition string, page models.PageRequest) ([]T, string, error) {
+	var after *memoryPosition
+	if page.Cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		var decoded memoryPosition
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded.Partition != partition {
+			return nil, "", ErrInvalidCursor
+		}
+		after = &decoded
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return order(position(items[i]), position(items[j]))
+	})
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(items), func(i int) bool {
+			return order(*after, position(items[i]))
+		})
+	}
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = database.DefaultPageLimit
+	}
+	limit = min(limit, database.MaxPageLimit)
+
+	end := min(start+limit, len(items))
+	if end == len(items) {
+		return items[start:end], "", nil
+	}
+
+	next := position(items[end-1])
+	data, err := json.Marshal(next)
+	if err != nil {
+		return nil, "", err
+	}
+	return items[start:end], base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// deploymentKey identifies a deployment across servers
+func deploymentKey(serverId, deploymentId string) string {
+	return serverId + "/" + deploymentId
+}
+
+// cloneMCPServer copies a server so that callers never share stored data
+func cloneMCPServer(server *models.MCPServer) *models.MCPServer {
+	copied := *server
+	copied.EnvironmentVariables = append([]models.EnvironmentVariable(nil), server.EnvironmentVariables...)
+	copied.AutoBuildBranches = append([]string(nil), server.AutoBuildBranches...)
+	return &copied
+}
+
+// cloneDeployment copies a deployment including its stages, logs, log reference and image metadata
+func cloneDeployment(deployment *models.Deployment) *models.Deployment {
+	copied := *deployment
+	if deployment.Stages != nil {
+		copied.Stages = make(map[string]*models.BuildStageStatus, len(deployment.Stages))
+		for name, stage := range deployment.Stages {
+			if stage != nil {
+				stageCopy := *stage
+				stage = &stageCopy
+			}
+			copied.Stages[name] = stage
+		}
+	}
+	copied.BuildLogs = append([]models.BuildLogEntry(nil), deployment.BuildLogs...)
+	if deployment.LogRef != nil {
+		logRef := *deployment.LogRef
+		copied.LogRef = &logRef
+	}
+	if deployment.Image != nil {
+		image := *deployment.Image
+		image.LayerSizes = append([]int64(nil), deployment.Image.LayerSizes...)
+		copied.Image = &image
+	}
+	if deployment.Manifest != nil {
+		// Tool schemas are never modified in place, so they are shared
+		manifest := *deployment.Manifest
+		manifest.Tools = append([]models.MCPTool(nil), deployment.Manifest.Tools...)
+		manifest.Resources = append([]models.MCPResource(nil), deployment.Manifest.Resources...)
+		manifest.Prompts = append([]models.MCPPrompt(nil), deployment.Manifest.Prompts...)
+		for i := range manifest.Prompts {
+			manifest.Prompts[i].Arguments = append([]models.MCPPromptArgument(nil), manifest.Prompts[i].Arguments...)
+		}
+		copied.Manifest = &manifest
+	}
+	if deployment.ServerJSON != nil {
+		serverJSON := *deployment.ServerJSON
+		if serverJSON.Repository != nil {
+			repository := *serverJSON.Repository
+			serverJSON.Repository = &repository
+		}
+		serverJSON.Packages = append([]models.RegistryPackage(nil), serverJSON.Packages...)
+		for i := range serverJSON.Packages {
+			serverJSON.Packages[i].EnvironmentVariables = append([]models.RegistryEnvironmentVariable(nil), serverJSON.Packages[i].EnvironmentVariables...)
+		}
+		if serverJSON.Meta != nil && serverJSON.Meta.PublisherProvided != nil {
+			buildInfo := *serverJSON.Meta.PublisherProvided
+			serverJSON.Meta = &models.RegistryMeta{PublisherProvided: &buildInfo}
+		}
+		copied.ServerJSON = &serverJSON
+	}
+	return &copied
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+func TestMemoryDeploymentRepository_PagesNewestFirst(t *testing.T) {
+	repo := NewMemoryDeploymentRepository()
+	ctx := context.Background()
+
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < 5; i++ {
+		err := repo.Create(ctx, &models.Deployment{
+			ServerId:     "server-1",
+			DeploymentId: fmt.Sprintf("deploy-%d", i),
+			UserId:       "user-1",
+			Status:       models.DeploymentStatusQueued,
+			CreatedAt:    start.Add(time.Duration(i) * time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("Create failed: %v", err)
+		}
+	}
+
+	var ids []string
+	page := models.PageRequest{Limit: 2}
+	for {
+		result, err := repo.ListByUserId(ctx, "user-1", models.DeploymentFilter{}, page)
+		if err != nil {
+			t.Fatalf("ListByUserId failed: %v", err)
+		}
+		for _, d := range result.Deployments {
+			ids = append(ids, d.DeploymentId)
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		page.Cursor = result.NextCursor
+	}
+	if want := "[deploy-4 deploy-3 deploy-2 deploy-1 deploy-0]"; fmt.Sprint(ids) != want {
+		t.Errorf("Expected %s, got %v", want, ids)
+	}
+
+	first, _ := repo.ListByUserId(ctx, "user-1", models.DeploymentFilter{}, models.PageRequest{Limit: 1})
+	if _, err := repo.ListByUserId(ctx, "user-2", models.DeploymentFilter{}, models.PageRequest{Cursor: first.NextCursor}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for another user's cursor, got %v", err)
+	}
+}
+
+func TestMemoryDeploymentRepository_UpdateIsConditional(t *testing.T) {
+	repo := NewMemoryDeploymentRepository()
+	ctx := context.Background()
+
+	queued := &models.Deployment{ServerId: "server-1", DeploymentId: "deploy-1", Status: models.DeploymentStatusQueued}
+	if err := repo.Create(ctx, queued); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+
+	started, _ := repo.Get(ctx, "server-1", "deploy-1")
+	started.Status = models.DeploymentStatusInProgress
+	started.Stages = map[string]*models.BuildStageStatus{"clone": {Status: models.StageStatusInProgress}}
+	if err := repo.Update(ctx, started, models.DeploymentStatusQueued); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	// Changing the caller's copy does not change what is stored
+	started.Stages["clone"].Status = models.StageStatusFailed
+	stored, _ := repo.Get(ctx, "server-1", "deploy-1")
+	if stored.Stages["clone"].Status != models.StageStatusInProgress || stored.Version != 1 {
+		t.Errorf("Expected the stored copy at version 1 with clone in progress, got %+v", stored)
+	}
+
+	queued.Status = models.DeploymentStatusCancelled
+	if err := repo.Update(ctx, queued, models.DeploymentStatusQueued); !errors.Is(err, ErrStatusConflict) {
+		t.Errorf("Expected ErrStatusConflict, got %v", err)
+	}
+	queued.Status = models.DeploymentStatusCompleted
+	if err := repo.Update(ctx, queued, models.DeploymentStatusQueued); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("Expected ErrInvalidTransition, got %v", err)
+	}
+}
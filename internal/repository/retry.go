@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+const (
+	// maxConflictAttempts is how often a read-modify-write is tried before a
+	// conflict is returned to the caller
+	maxConflictAttempts = 5
+
+	// conflictBackoff is the wait before the second attempt; it doubles after each conflict
+	conflictBackoff = 20 * time.Millisecond
+)
+
+// UpdateMCPWithRetry loads an MCP server, applies mutate and writes it back.
+// If another writer updated the server in between, the server is reloaded and
+// mutate applied again. mutate may therefore run more than once; an error from
+// it aborts the update and is returned as is.
+func UpdateMCPWithRetry(ctx context.Context, repo MCPRepository, id string, mutate func(*models.MCPServer) error) (*models.MCPServer, error) {
+	return retryOnConflict(ctx, func() (*models.MCPServer, error) {
+		server, err := repo.Get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := mutate(server); err != nil {
+			return nil, err
+		}
+		return server, repo.Update(ctx, server)
+	})
+}
+
+// UpdateDeploymentWithRetry loads a deployment, applies mutate and writes it
+// back, conditional on the status and version that were loaded. On a
+// conflicting write the deployment is reloaded and mutate applied again, so
+// mutate sees the latest status and can refuse a change by returning an error.
+func UpdateDeploymentWithRetry(ctx context.Context, repo DeploymentRepository, serverId, deploymentId string, mutate func(*models.Deployment) error) (*models.Deployment, error) {
+	return retryOnConflict(ctx, func() (*models.Deployment, error) {
+		deployment, err := repo.Get(ctx, serverId, deploymentId)
+		if err != nil {
+			return nil, err
+		}
+		expected := deployment.Status
+		if err := mutate(deployment); err != nil {
+			return nil, err
+		}
+		return deployment, repo.Update(ctx, deployment, expected)
+	})
+}
+
+// retryOnConflict runs attempt until it succeeds, fails with an error other
+// than ErrConflict, or maxConflictAttempts is reached
+func retryOnConflict[T any](ctx context.Context, attempt func() (T, error)) (T, error) {
+	var zero T
+	backoff := conflictBackoff
+	for i := 1; ; i++ {
+		result, err := attempt()
+		if err == nil {
+			return result, nil
+		}
+		if !errors.Is(err, ErrConflict) || i == maxConflictAttempts {
+			return zero, err
+		}
+
+		logger.WithFields(map[string]interface{}{
+			"attempt": i,
+			"error":   err.Error(),
+		}).Debug("Write conflict, reloading record and retrying")
+
+		select {
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
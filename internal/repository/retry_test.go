@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// racingMCPRepo counts writes to a MemoryMCPRepository. beforeUpdate runs
+// ahead of each write to simulate a concurrent writer.
+type racingMCPRepo struct {
+	*MemoryMCPRepository
+	updates      int
+	beforeUpdate func(r *racingMCPRepo)
+}
+
+func newRacingMCPRepo(t *testing.T, servers ...*models.MCPServer) *racingMCPRepo {
+	t.Helper()
+	repo := &racingMCPRepo{MemoryMCPRepository: NewMemoryMCPRepository()}
+	for _, server := range servers {
+		if err := repo.Create(context.Background(), server); err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+	}
+	return repo
+}
+
+func (r *racingMCPRepo) Update(ctx context.Context, server *models.MCPServer) error {
+	if r.beforeUpdate != nil {
+		r.beforeUpdate(r)
+	}
+	r.updates++
+	return r.MemoryMCPRepository.Update(ctx, server)
+}
+
+// write changes a server the way another writer would
+func (r *racingMCPRepo) write(id string, change func(*models.MCPServer)) {
+	server, _ := r.MemoryMCPRepository.Get(context.Background(), id)
+	change(server)
+	r.MemoryMCPRepository.Update(context.Background(), server)
+}
+
+func TestUpdateMCPWithRetry_ReappliesChangeAfterConflict(t *testing.T) {
+	repo := newRacingMCPRepo(t, &models.MCPServer{ServerId: "server-1", Name: "old name"})
+	// Another writer renames the server between the first read and write
+	repo.beforeUpdate = func(r *racingMCPRepo) {
+		r.beforeUpdate = nil
+		r.write("server-1", func(s *models.MCPServer) { s.Name = "new name" })
+	}
+
+	calls := 0
+	updated, err := UpdateMCPWithRetry(context.Background(), repo, "server-1", func(s *models.MCPServer) error {
+		calls++
+		s.ECRRepositoryURI = "registry/server-1"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UpdateMCPWithRetry failed: %v", err)
+	}
+
+	if calls != 2 || repo.updates != 2 {
+		t.Errorf("Expected the change to be applied and written twice, got %d calls and %d writes", calls, repo.updates)
+	}
+	stored, _ := repo.Get(context.Background(), "server-1")
+	if stored.Name != "new name" || stored.ECRRepositoryURI != "registry/server-1" {
+		t.Errorf("Expected both writes to be kept, got name %q and ECR URI %q", stored.Name, stored.ECRRepositoryURI)
+	}
+	if stored.Version != 2 || updated.Version != 2 {
+		t.Errorf("Expected version 2, got %d stored and %d returned", stored.Version, updated.Version)
+	}
+}
+
+func TestUpdateMCPWithRetry_GivesUp(t *testing.T) {
+	repo := newRacingMCPRepo(t, &models.MCPServer{ServerId: "server-1"})
+	repo.beforeUpdate = func(r *racingMCPRepo) {
+		r.write("server-1", func(s *models.MCPServer) {})
+	}
+
+	_, err := UpdateMCPWithRetry(context.Background(), repo, "server-1", func(s *models.MCPServer) error { return nil })
+	var conflict *ConflictError
+	if !errors.Is(err, ErrConflict) || !errors.As(err, &conflict) {
+		t.Fatalf("Expected a conflict error, got %v", err)
+	}
+	if repo.updates != maxConflictAttempts {
+		t.Errorf("Expected %d attempts, got %d", maxConflictAttempts, repo.updates)
+	}
+
+	// Errors other than conflicts and errors from the change are not retried
+	repo.updates = 0
+	if _, err := UpdateMCPWithRetry(context.Background(), repo, "missing", func(s *models.MCPServer) error { return nil }); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	refused := errors.New("refused")
+	if _, err := UpdateMCPWithRetry(context.Background(), repo, "server-1", func(s *models.MCPServer) error { return refused }); err != refused {
+		t.Errorf("Expected the change's error, got %v", err)
+	}
+	if repo.updates != 0 {
+		t.Errorf("Expected no writes, got %d", repo.updates)
+	}
+}
+
+func TestStatusConflictMatchesConflict(t *testing.T) {
+	if !errors.Is(ErrStatusConflict, ErrConflict) {
+		t.Error("Expected ErrStatusConflict to match ErrConflict")
+	}
+	if errors.Is(ErrConflict, ErrStatusConflict) {
+		t.Error("Expected a version conflict not to match ErrStatusConflict")
+	}
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/imyashkale/buildserver/internal/database/sqldb"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// sqlMCPRepository implements MCPRepository using a SQL database
+type sqlMCPRepository struct {
+	db *sqldb.MCPServers
+}
+
+// NewSQLMCPRepository creates a new SQL-backed MCP repository
+func NewSQLMCPRepository(db *sqldb.MCPServers) MCPRepository {
+	return &sqlMCPRepository{
+		db: db,
+	}
+}
+
+// Get retrieves an MCP server by ID
+func (r *sqlMCPRepository) Get(ctx context.Context, id string) (*models.MCPServer, error) {
+	return r.db.GetMCP(ctx, id)
+}
+
+// Update updates an existing MCP server
+func (r *sqlMCPRepository) Update(ctx context.Context, server *models.MCPServer) error {
+	return r.db.UpdateMCP(ctx, server)
+}
+
+// List returns one page of all MCP servers
+func (r *sqlMCPRepository) List(ctx context.Context, page models.PageRequest) (*models.MCPServerPage, error) {
+	servers, cursor, err := r.db.GetAllMCPs(ctx, page)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MCPServerPage{Servers: servers, NextCursor: cursor}, nil
+}
+
+// ListByUserId returns one page of a user's MCP servers
+func (r *sqlMCPRepository) ListByUserId(ctx context.Context, userId string, page models.PageRequest) (*models.MCPServerPage, error) {
+	servers, cursor, err := r.db.GetMCPsByUserId(ctx, userId, page)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MCPServerPage{Servers: servers, NextCursor: cursor}, nil
+}
+
+// ListByRepositoryKey returns one page of the webhook servers of a repository
+func (r *sqlMCPRepository) ListByRepositoryKey(ctx context.Context, repositoryKey string, page models.PageRequest) (*models.MCPServerPage, error) {
+	servers, cursor, err := r.db.GetMCPsByRepositoryKey(ctx, repositoryKey, page)
+	if err != nil {
+		return nil, err
+	}
+	return &models.MCPServerPage{Servers: servers, NextCursor: cursor}, nil
+}
+
+// sqlDeploymentRepository implements DeploymentRepository using a SQL database
+type sqlDeploymentRepository struct {
+	db *sqldb.Deployments
+}
+
+// NewSQLDeploymentRepository creates a new SQL-backed deployment repository
+func NewSQLDeploymentRepository(db *sqldb.Deployments) DeploymentRepository {
+	return &sqlDeploymentRepository{
+		db: db,
+	}
+}
+
+// Create stores a new deployment
+func (r *sqlDeploymentRepository) Create(ctx context.Context, deployment *models.Deployment) error {
+	return r.db.CreateDeployment(ctx, deployment)
+}
+
+// Get retrieves a deployment by server ID and deployment ID
+func (r *sqlDeploymentRepository) Get(ctx context.Context, serverId, deploymentId string) (*models.Deployment, error) {
+	return r.db.GetDeployment(ctx, serverId, deploymentId)
+}
+
+// Update updates a deployment record with all fields, guarded by its current status
+func (r *sqlDeploymentRepository) Update(ctx context.Context, deployment *models.Deployment, expected models.DeploymentStatus) error {
+	if err := ValidateTransition(expected, deployment.Status); err != nil {
+		return err
+	}
+	return r.db.UpdateDeployment(ctx, deployment, expected)
+}
+
+// ListByUserId returns one page of the deployments owned by a user
+func (r *sqlDeploymentRepository) ListByUserId(ctx context.Context, userId string, filter models.DeploymentFilter, page models.PageRequest) (*models.DeploymentPage, error) {
+	deployments, cursor, err := r.db.GetDeploymentsByUserId(ctx, userId, filter, page)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DeploymentPage{Deployments: deployments, NextCursor: cursor}, nil
+}
+
+// ListByUserIdAndServerId returns one page of the deployments owned by a user for one MCP server
+func (r *sqlDeploymentRepository) ListByUserIdAndServerId(ctx context.Context, userId, serverId string, filter models.DeploymentFilter, page models.PageRequest) (*models.DeploymentPage, error) {
+	deployments, cursor, err := r.db.GetDeploymentsByUserIdAndServerId(ctx, userId, serverId, filter, page)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DeploymentPage{Deployments: deployments, NextCursor: cursor}, nil
+}
+
+// sqlGitHubRepository implements GitHubRepository using a SQL database
+type sqlGitHubRepository struct {
+	db *sqldb.GitHub
+}
+
+// NewSQLGitHubRepository creates a new SQL-backed GitHub repository
+func NewSQLGitHubRepository(db *sqldb.GitHub) GitHubRepository {
+	return &sqlGitHubRepository{
+		db: db,
+	}
+}
+
+// GetConnectionByUserId retrieves a GitHub connection by user ID
+func (r *sqlGitHubRepository) GetConnectionByUserId(ctx context.Context, userId string) (*models.GitHubConnection, error) {
+	return r.db.GetGitHubConnectionByUserId(ctx, userId)
+}
+
+// GetOAuthState retrieves an OAuth state by state token
+func (r *sqlGitHubRepository) GetOAuthState(ctx context.Context, stateToken string) (*models.OAuthState, error) {
+	return r.db.GetOAuthState(ctx, stateToken)
+}
@@ -10,6 +10,9 @@ import (
 func Setup(
 	healthHandler *handlers.HealthHandler,
 	buildHandler *handlers.BuildHandler,
+	deploymentHandler *handlers.DeploymentHandler,
+	schemaHandler *handlers.SchemaHandler,
+	webhookHandler *handlers.WebhookHandler,
 ) *gin.Engine {
 
 	// Create a new Gin router
@@ -21,6 +24,14 @@ func Setup(
 	// API v1 routes
 	v1 := router.Group("/api/v1")
 
+	// Schemas are public so editors can fetch them without a token. They are
+	// registered before the authentication middleware, which only applies to
+	// routes added after it.
+	v1.GET("/schema/mhive-config", schemaHandler.MhiveConfig)
+
+	// GitHub cannot send a token; deliveries are verified by their signature
+	v1.POST("/webhooks/github", webhookHandler.GitHub)
+
 	// Apply authentication middleware to all routes
 	v1.Use(middleware.Authentication())
 
@@ -31,6 +42,27 @@ func Setup(
 	build := v1.Group("/build")
 	{
 		build.POST("/:server_id/:deployment_id/initiate", buildHandler.InitiateBuild)
+		build.POST("/:server_id/:deployment_id/cancel", buildHandler.CancelBuild)
+	}
+
+	// MCP server settings
+	mcp := v1.Group("/mcp")
+	{
+		mcp.PUT("/:server_id/webhook-secret", webhookHandler.SetSecret)
+		mcp.PUT("/:server_id/auto-build-branches", webhookHandler.SetAutoBuildBranches)
+	}
+
+	// Deployment routes
+	deployments := v1.Group("/deployments")
+	{
+		deployments.GET("", deploymentHandler.ListDeployments)
+		deployments.GET("/:server_id", deploymentHandler.ListDeployments)
+		deployments.GET("/:server_id/:deployment_id", deploymentHandler.GetDeployment)
+		deployments.GET("/:server_id/:deployment_id/logs", deploymentHandler.GetLogs)
+		deployments.GET("/:server_id/:deployment_id/logs/stream", deploymentHandler.StreamLogs)
+		deployments.GET("/:server_id/:deployment_id/manifest", deploymentHandler.GetManifest)
+		deployments.GET("/:server_id/:deployment_id/manifest/compare", deploymentHandler.CompareManifests)
+		deployments.GET("/:server_id/:deployment_id/server.json", deploymentHandler.GetServerJSON)
 	}
 
 	return router
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/mhiveconfig"
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/queue"
+)
+
+// BuildContext holds the state that belongs to a single build job.
+// A new BuildContext is created for every BuildJob so that concurrent
+// builds never share a logger, workspace or deployment record.
+type BuildContext struct {
+	Job        *queue.BuildJob
+	Deployment *models.Deployment
+	Server     *models.MCPServer   // loaded by the clone stage
+	Config     *mhiveconfig.Config // parsed mhive.config.yaml, set by the validate_config stage
+	Logger     *BuildLogger
+	WorkDir    string
+	OutputDir  string              // build outputs kept outside the clone, such as image archives
+	ContextDir string              // build context inside the clone, resolved by the validate_docker stage
+	Dockerfile string              // Dockerfile inside the clone, resolved by the validate_docker stage
+	BaseImage  string              // FROM image of the final Dockerfile stage, read by the validate_docker stage
+	StartedAt  time.Time           // when the clone stage started
+	Manifest   *models.MCPManifest // what the server offered in the verify_mcp stage
+
+	// storedStatus is the deployment status last written to the database
+	storedStatus models.DeploymentStatus
+
+	// flushedLogs is how many log entries have been written to the log store
+	flushedLogs int
+
+	// releaseSecrets unregisters the build's secrets from the global logger
+	releaseSecrets []func()
+}
+
+// NewBuildContext creates an isolated build context for a job
+func NewBuildContext(job *queue.BuildJob) *BuildContext {
+	workDir := filepath.Join(os.TempDir(), fmt.Sprintf("mcp-build-%s-%s", job.ServerID, job.DeploymentID))
+	return &BuildContext{
+		Job:       job,
+		Logger:    NewBuildLogger(),
+		WorkDir:   workDir,
+		OutputDir: workDir + "-out",
+	}
+}
+
+// ImageName returns the local Docker image name for the build
+func (bc *BuildContext) ImageName() string {
+	return fmt.Sprintf("%s:%s-%s", bc.Job.ServerID, bc.Job.Branch, shortCommit(bc.Job.CommitHash))
+}
+
+// AddSecret masks values in the build log and the application log for the rest of the build
+func (bc *BuildContext) AddSecret(values ...string) {
+	bc.Logger.AddSecret(values...)
+	bc.releaseSecrets = append(bc.releaseSecrets, logger.RegisterSecrets(values...))
+}
+
+// Cleanup removes the build workspace and outputs and releases the build's secrets
+func (bc *BuildContext) Cleanup() {
+	os.RemoveAll(bc.WorkDir)
+	os.RemoveAll(bc.OutputDir)
+	for _, release := range bc.releaseSecrets {
+		release()
+	}
+}
+
+// repoPath resolves a path from mhive.config.yaml against the clone. Symlinks
+// are followed, and the result must still be inside the clone so a repository
+// cannot make the build read files of the build server.
+func (bc *BuildContext) repoPath(rel string) (string, error) {
+	return confinedPath(bc.WorkDir, rel)
+}
+
+// confinedPath joins rel to root and resolves symlinks, failing when the
+// result is outside root or does not exist
+func confinedPath(root, rel string) (string, error) {
+	if filepath.IsAbs(rel) {
+		return "", fmt.Errorf("%s must be relative to the repository root", rel)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(realRoot, rel))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("%s not found in the repository", rel)
+		}
+		return "", err
+	}
+	inside, err := filepath.Rel(realRoot, resolved)
+	if err != nil || inside == ".." || strings.HasPrefix(inside, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s points outside the repository", rel)
+	}
+	return resolved, nil
+}
+
+// shortCommit returns the first 8 characters of a commit hash
+func shortCommit(commitHash string) string {
+	if len(commitHash) > 8 {
+		return commitHash[:8]
+	}
+	return commitHash
+}
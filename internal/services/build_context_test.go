@@ -0,0 +1,54 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestConfinedPath verifies that config paths cannot leave the clone, also not through symlinks
+func TestConfinedPath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	for _, dir := range []string{"servers/weather", "docker"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(root, "docker/Dockerfile"), []byte("FROM scratch\n"), 0o644)
+	os.WriteFile(filepath.Join(outside, "secret"), []byte("token\n"), 0o644)
+	os.Symlink("../../docker/Dockerfile", filepath.Join(root, "servers/weather/Dockerfile"))
+	os.Symlink(filepath.Join(outside, "secret"), filepath.Join(root, "servers/weather/escape"))
+	os.Symlink(outside, filepath.Join(root, "linked"))
+
+	tests := []struct {
+		rel     string
+		want    string // suffix of the resolved path
+		wantErr string
+	}{
+		{rel: ".", want: ""},
+		{rel: "servers/weather", want: "/servers/weather"},
+		{rel: "servers/weather/Dockerfile", want: "/docker/Dockerfile"},
+		{rel: "servers/weather/../../docker", want: "/docker"},
+		{rel: "missing", wantErr: "not found"},
+		{rel: "/etc/passwd", wantErr: "must be relative"},
+		{rel: "../" + filepath.Base(outside), wantErr: "outside the repository"},
+		{rel: "servers/weather/escape", wantErr: "outside the repository"},
+		{rel: "linked/secret", wantErr: "outside the repository"},
+	}
+
+	realRoot, _ := filepath.EvalSymlinks(root)
+	for _, tt := range tests {
+		got, err := confinedPath(root, tt.rel)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("confinedPath(%q) = %q, %v, want an error containing %q", tt.rel, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != realRoot+tt.want {
+			t.Errorf("confinedPath(%q) = %q, %v, want %q", tt.rel, got, err, realRoot+tt.want)
+		}
+	}
+}
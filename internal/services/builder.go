@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// Builder backend names, used in configuration and on MCP servers
+const (
+	BuilderDocker   = "docker"
+	BuilderBuildx   = "buildx"
+	BuilderBuildctl = "buildctl"
+)
+
+// buildLogStage is the build log stage builders report their progress under
+const buildLogStage = "build_image"
+
+// BuildRequest describes one image build
+type BuildRequest struct {
+	ContextDir string            // build context, the cloned repository
+	Dockerfile string            // path of the Dockerfile
+	Target     string            // Dockerfile stage to build; empty builds the final stage
+	BuildArgs  map[string]string // build arguments for ARG instructions
+	Image      string            // local image name, e.g. "server-1:main-abc12345"
+	OutputDir  string            // scratch directory for build outputs such as image archives
+	CacheKey   string            // names the server's build cache, e.g. "mcp-server-1"
+	Secrets    map[string]string // build secrets by ID, mounted with RUN --mount=type=secret,id=<ID>
+}
+
+// BuiltImage is an image produced by a Builder
+type BuiltImage struct {
+	Name    string // local image name
+	Archive string // `docker save` format archive written by daemonless builders; empty when the image is in the local Docker daemon
+}
+
+// Builder builds the images of MCP servers. Progress is written to the build
+// log, one structured step entry per Dockerfile step.
+type Builder interface {
+	// Name returns the backend name, e.g. "buildx"
+	Name() string
+
+	// Build builds the image described by req
+	Build(ctx context.Context, req BuildRequest, log *BuildLogger) (BuiltImage, error)
+}
+
+// BuilderOptions configures the builders
+type BuilderOptions struct {
+	Platform        string // target platform, e.g. "linux/amd64"; empty builds for the host
+	CacheRepository string // registry repository for the build cache, e.g. "ghcr.io/acme/buildcache"; buildx and buildctl only
+	BuildkitAddr    string // address of a running buildkitd; empty runs buildctl daemonless
+}
+
+// Builders holds the configured builder backends and picks the one each MCP
+// server uses
+type Builders struct {
+	backends    map[string]Builder
+	defaultName string
+}
+
+// NewBuilders creates the set of available builders. Servers that do not
+// choose a builder use defaultName, which must be one of them.
+func NewBuilders(defaultName string, builders ...Builder) (*Builders, error) {
+	set := &Builders{
+		backends:    make(map[string]Builder, len(builders)),
+		defaultName: defaultName,
+	}
+	for _, builder := range builders {
+		set.backends[builder.Name()] = builder
+	}
+	if _, ok := set.backends[defaultName]; !ok {
+		return nil, fmt.Errorf("default builder %q is not configured", defaultName)
+	}
+	return set, nil
+}
+
+// ForServer returns the builder the server selected, or the default one
+func (b *Builders) ForServer(server *models.MCPServer) (Builder, error) {
+	name := b.defaultName
+	if server != nil && server.Builder != "" {
+		name = server.Builder
+	}
+
+	builder, ok := b.backends[name]
+	if !ok {
+		return nil, fmt.Errorf("builder %q is not configured on this build server (available: %s)", name, strings.Join(b.Names(), ", "))
+	}
+	return builder, nil
+}
+
+// Names returns the names of the configured builders
+func (b *Builders) Names() []string {
+	names := make([]string, 0, len(b.backends))
+	for name := range b.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// secretArgs returns --secret flags that read each build secret from an
+// environment variable, and the variables to set. Values never appear on the
+// command line.
+func secretArgs(secrets map[string]string) (args, env []string) {
+	ids := make([]string, 0, len(secrets))
+	for id := range secrets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		variable := "BUILD_SECRET_" + id
+		args = append(args, "--secret", fmt.Sprintf("id=%s,env=%s", id, variable))
+		env = append(env, variable+"="+secrets[id])
+	}
+	return args, env
+}
+
+// buildArgPairs returns build arguments as sorted NAME=value pairs so the
+// command line is the same on every build
+func buildArgPairs(args map[string]string) []string {
+	pairs := make([]string, 0, len(args))
+	for name, value := range args {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// dockerBuildFlags returns the --target and --build-arg flags shared by
+// docker build and docker buildx build
+func dockerBuildFlags(req BuildRequest) []string {
+	var args []string
+	if req.Target != "" {
+		args = append(args, "--target", req.Target)
+	}
+	for _, pair := range buildArgPairs(req.BuildArgs) {
+		args = append(args, "--build-arg", pair)
+	}
+	return args
+}
+
+// runBuild runs a build command and streams its output into the build log
+// line by line while it runs. BuildKit progress becomes step entries.
+// Whatever the parser leaves after an oversized line is drained so the build
+// never blocks writing its output.
+func runBuild(ctx context.Context, runner CommandRunner, command Command, log *BuildLogger) error {
+	stdout, stdoutWriter := io.Pipe()
+	stderr, stderrWriter := io.Pipe()
+	parser := newDockerOutputParser(log, buildLogStage)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		parser.Consume(stdout, false)
+		io.Copy(io.Discard, stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		parser.Consume(stderr, true)
+		io.Copy(io.Discard, stderr)
+	}()
+
+	command.Stdout = stdoutWriter
+	command.Stderr = stderrWriter
+	err := runner.Run(ctx, command)
+	stdoutWriter.Close()
+	stderrWriter.Close()
+	wg.Wait()
+
+	return err
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// BuildctlBuilder builds with BuildKit's buildctl without a Docker daemon.
+// With no buildkitd address it runs buildctl-daemonless.sh, which starts a
+// short-lived buildkitd for the build, rootless when the server does not run
+// as root. The image is written to an archive that the registries push from.
+type BuildctlBuilder struct {
+	runner CommandRunner
+	opts   BuilderOptions
+}
+
+// NewBuildctlBuilder creates a builder that runs buildctl
+func NewBuildctlBuilder(runner CommandRunner, opts BuilderOptions) *BuildctlBuilder {
+	return &BuildctlBuilder{runner: runner, opts: opts}
+}
+
+// Name returns the builder backend name
+func (bb *BuildctlBuilder) Name() string {
+	return BuilderBuildctl
+}
+
+// Build builds the image into an archive in req.OutputDir
+func (bb *BuildctlBuilder) Build(ctx context.Context, req BuildRequest, log *BuildLogger) (BuiltImage, error) {
+	if err := os.MkdirAll(req.OutputDir, 0o755); err != nil {
+		return BuiltImage{}, fmt.Errorf("failed to create build output directory: %w", err)
+	}
+	archive := filepath.Join(req.OutputDir, "image.tar")
+
+	command := Command{Name: "buildctl-daemonless.sh", Args: []string{"build"}}
+	if bb.opts.BuildkitAddr != "" {
+		command = Command{Name: "buildctl", Args: []string{"--addr", bb.opts.BuildkitAddr, "build"}}
+	}
+
+	command.Args = append(command.Args,
+		"--progress=rawjson",
+		"--frontend", "dockerfile.v0",
+		"--local", "context="+req.ContextDir,
+		"--local", "dockerfile="+filepath.Dir(req.Dockerfile),
+		"--opt", "filename="+filepath.Base(req.Dockerfile),
+		"--output", fmt.Sprintf("type=docker,name=%s,dest=%s", req.Image, archive),
+	)
+	if bb.opts.Platform != "" {
+		command.Args = append(command.Args, "--opt", "platform="+bb.opts.Platform)
+	}
+	if req.Target != "" {
+		command.Args = append(command.Args, "--opt", "target="+req.Target)
+	}
+	for _, pair := range buildArgPairs(req.BuildArgs) {
+		command.Args = append(command.Args, "--opt", "build-arg:"+pair)
+	}
+	if ref := cacheRef(bb.opts.CacheRepository, req.CacheKey); ref != "" {
+		command.Args = append(command.Args,
+			"--import-cache", "type=registry,ref="+ref,
+			"--export-cache", "type=registry,ref="+ref+",mode=max",
+		)
+	}
+	secrets, env := secretArgs(req.Secrets)
+	command.Args = append(command.Args, secrets...)
+	command.Env = env
+
+	if err := runBuild(ctx, bb.runner, command, log); err != nil {
+		return BuiltImage{}, fmt.Errorf("buildctl build failed: %w", err)
+	}
+	return BuiltImage{Name: req.Image, Archive: archive}, nil
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"fmt"
+)
+
+// BuildxBuilder builds with `docker buildx build`, which can target another
+// platform and keep its cache in a registry so that builds on any worker
+// reuse it. The result is loaded into the local Docker daemon.
+type BuildxBuilder struct {
+	runner CommandRunner
+	opts   BuilderOptions
+}
+
+// NewBuildxBuilder creates a builder that runs docker buildx
+func NewBuildxBuilder(runner CommandRunner, opts BuilderOptions) *BuildxBuilder {
+	return &BuildxBuilder{runner: runner, opts: opts}
+}
+
+// Name returns the builder backend name
+func (bb *BuildxBuilder) Name() string {
+	return BuilderBuildx
+}
+
+// Build builds the image and loads it into the local daemon
+func (bb *BuildxBuilder) Build(ctx context.Context, req BuildRequest, log *BuildLogger) (BuiltImage, error) {
+	args := []string{"buildx", "build", "--progress=rawjson", "--load", "-t", req.Image, "-f", req.Dockerfile}
+	if bb.opts.Platform != "" {
+		args = append(args, "--platform", bb.opts.Platform)
+	}
+	args = append(args, dockerBuildFlags(req)...)
+	if ref := cacheRef(bb.opts.CacheRepository, req.CacheKey); ref != "" {
+		args = append(args,
+			"--cache-from", "type=registry,ref="+ref,
+			"--cache-to", "type=registry,ref="+ref+",mode=max",
+		)
+	}
+	secrets, env := secretArgs(req.Secrets)
+	args = append(append(args, secrets...), req.ContextDir)
+
+	err := runBuild(ctx, bb.runner, Command{Name: "docker", Args: args, Env: env}, log)
+	if err != nil {
+		return BuiltImage{}, fmt.Errorf("docker buildx build failed: %w", err)
+	}
+	return BuiltImage{Name: req.Image}, nil
+}
+
+// cacheRef returns the registry reference of a server's build cache, or ""
+// when no cache repository is configured
+func cacheRef(repository, key string) string {
+	if repository == "" || key == "" {
+		return ""
+	}
+	return repository + ":" + key
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"fmt"
+)
+
+// DockerBuilder builds with `docker build` against the local Docker daemon,
+// using BuildKit and the daemon's own layer cache. It needs access to a
+// (usually privileged) daemon.
+type DockerBuilder struct {
+	runner   CommandRunner
+	platform string
+}
+
+// NewDockerBuilder creates a builder that runs the docker CLI
+func NewDockerBuilder(runner CommandRunner, opts BuilderOptions) *DockerBuilder {
+	return &DockerBuilder{runner: runner, platform: opts.Platform}
+}
+
+// Name returns the builder backend name
+func (db *DockerBuilder) Name() string {
+	return BuilderDocker
+}
+
+// Build builds the image into the local daemon
+func (db *DockerBuilder) Build(ctx context.Context, req BuildRequest, log *BuildLogger) (BuiltImage, error) {
+	// Plain progress makes BuildKit print one line per event, which the parser turns into step entries
+	args := []string{"build", "--progress=plain", "-t", req.Image, "-f", req.Dockerfile}
+	if db.platform != "" {
+		args = append(args, "--platform", db.platform)
+	}
+	args = append(args, dockerBuildFlags(req)...)
+	secrets, env := secretArgs(req.Secrets)
+	args = append(append(args, secrets...), req.ContextDir)
+
+	err := runBuild(ctx, db.runner, Command{
+		Name: "docker",
+		Args: args,
+		Env:  append([]string{"DOCKER_BUILDKIT=1"}, env...),
+	}, log)
+	if err != nil {
+		return BuiltImage{}, fmt.Errorf("docker build failed: %w", err)
+	}
+	return BuiltImage{Name: req.Image}, nil
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// commandRecorder records commands and prints BuildKit progress on stderr
+type commandRecorder struct {
+	commands []Command
+	progress string
+}
+
+func (r *commandRecorder) Run(ctx context.Context, command Command) error {
+	r.commands = append(r.commands, command)
+	if command.Stderr != nil {
+		io.WriteString(command.Stderr, r.progress)
+	}
+	return nil
+}
+
+// TestBuilders_Commands verifies the command line of each backend and that
+// build secrets are passed through the environment only
+func TestBuilders_Commands(t *testing.T) {
+	opts := BuilderOptions{Platform: "linux/arm64", CacheRepository: "ghcr.io/acme/cache"}
+	req := BuildRequest{
+		ContextDir: "/work/src",
+		Dockerfile: "/work/src/docker/Dockerfile.prod",
+		Target:     "runtime",
+		BuildArgs:  map[string]string{"NODE_VERSION": "22", "APP": "weather"},
+		Image:      "server-1:main-abc",
+		OutputDir:  t.TempDir(),
+		CacheKey:   "mcp-server-1",
+		Secrets:    map[string]string{"NPM_TOKEN": "npm_secret"},
+	}
+
+	tests := []struct {
+		builder     func(CommandRunner) Builder
+		wantName    string
+		wantArgs    []string
+		wantArchive bool
+	}{
+		{
+			builder:  func(r CommandRunner) Builder { return NewDockerBuilder(r, opts) },
+			wantName: "docker",
+			wantArgs: []string{"build", "--progress=plain", "-f /work/src/docker/Dockerfile.prod", "--platform linux/arm64", "--target runtime --build-arg APP=weather --build-arg NODE_VERSION=22", "--secret id=NPM_TOKEN,env=BUILD_SECRET_NPM_TOKEN"},
+		},
+		{
+			builder:  func(r CommandRunner) Builder { return NewBuildxBuilder(r, opts) },
+			wantName: "docker",
+			wantArgs: []string{"buildx build", "--load", "--target runtime", "--cache-from type=registry,ref=ghcr.io/acme/cache:mcp-server-1", "--cache-to type=registry,ref=ghcr.io/acme/cache:mcp-server-1,mode=max"},
+		},
+		{
+			builder:     func(r CommandRunner) Builder { return NewBuildctlBuilder(r, opts) },
+			wantName:    "buildctl-daemonless.sh",
+			wantArgs:    []string{"build", "--local context=/work/src", "--local dockerfile=/work/src/docker", "--opt filename=Dockerfile.prod", "--opt platform=linux/arm64", "--opt target=runtime --opt build-arg:APP=weather --opt build-arg:NODE_VERSION=22", "type=docker,name=server-1:main-abc,dest="},
+			wantArchive: true,
+		},
+		{
+			builder: func(r CommandRunner) Builder {
+				return NewBuildctlBuilder(r, BuilderOptions{BuildkitAddr: "tcp://buildkitd:1234"})
+			},
+			wantName:    "buildctl",
+			wantArgs:    []string{"--addr tcp://buildkitd:1234 build"},
+			wantArchive: true,
+		},
+	}
+
+	for _, tt := range tests {
+		runner := &commandRecorder{progress: "#1 [1/1] FROM docker.io/library/alpine\n#1 DONE 0.1s\n"}
+		builder := tt.builder(runner)
+		log := NewBuildLogger()
+
+		image, err := builder.Build(context.Background(), req, log)
+		if err != nil {
+			t.Fatalf("%s: Build: %v", builder.Name(), err)
+		}
+		if image.Name != req.Image || (image.Archive != "") != tt.wantArchive {
+			t.Errorf("%s: image = %+v", builder.Name(), image)
+		}
+
+		if len(runner.commands) != 1 {
+			t.Fatalf("%s: ran %d commands", builder.Name(), len(runner.commands))
+		}
+		command := runner.commands[0]
+		line := strings.Join(command.Args, " ")
+		if command.Name != tt.wantName {
+			t.Errorf("%s: ran %s, want %s", builder.Name(), command.Name, tt.wantName)
+		}
+		for _, want := range tt.wantArgs {
+			if !strings.Contains(line, want) {
+				t.Errorf("%s: args %q lack %q", builder.Name(), line, want)
+			}
+		}
+		if strings.Contains(line, "npm_secret") {
+			t.Errorf("%s: secret value on the command line: %q", builder.Name(), line)
+		}
+		if !strings.Contains(strings.Join(command.Env, " "), "BUILD_SECRET_NPM_TOKEN=npm_secret") {
+			t.Errorf("%s: env %v lacks the build secret", builder.Name(), command.Env)
+		}
+
+		// Progress is reported as structured step entries
+		entries := log.GetLogs()
+		if len(entries) != 1 || entries[0].Step == nil || entries[0].Stage != buildLogStage {
+			t.Errorf("%s: log entries = %+v, want one step", builder.Name(), entries)
+		}
+	}
+}
+
+// TestBuilders_ForServer verifies that servers get the builder they selected, or the default one
+func TestBuilders_ForServer(t *testing.T) {
+	if _, err := NewBuilders(BuilderBuildx, &fakeBuilder{}); err == nil {
+		t.Fatal("Expected an error for a default builder that is not configured")
+	}
+
+	builders, err := NewBuilders(BuilderDocker, NewDockerBuilder(&fakeRunner{}, BuilderOptions{}), &fakeBuilder{})
+	if err != nil {
+		t.Fatalf("NewBuilders: %v", err)
+	}
+	if builder, _ := builders.ForServer(&models.MCPServer{}); builder.Name() != BuilderDocker {
+		t.Errorf("ForServer without a selection = %s, want docker", builder.Name())
+	}
+	if builder, _ := builders.ForServer(&models.MCPServer{Builder: "fake"}); builder.Name() != "fake" {
+		t.Errorf("ForServer(fake) = %s", builder.Name())
+	}
+	if _, err := builders.ForServer(&models.MCPServer{Builder: BuilderBuildctl}); err == nil || !strings.Contains(err.Error(), "docker, fake") {
+		t.Errorf("ForServer(buildctl) = %v, want an error listing the configured builders", err)
+	}
+}
+
+// TestExecuteBuild_RecordsBuildSteps builds with the default docker builder
+// and verifies that its BuildKit steps and image metadata are recorded
+func TestExecuteBuild_RecordsBuildSteps(t *testing.T) {
+	h := newHermeticPipeline(t, "server-1")
+	deployment := h.mustRun(t, "server-1")
+
+	var steps int
+	for _, entry := range deployment.BuildLogs {
+		if entry.Step != nil {
+			steps++
+		}
+	}
+	if steps != 2 {
+		t.Errorf("Expected two Dockerfile step entries, got %d", steps)
+	}
+	if image := deployment.Image; image == nil || image.BaseImage != "node:20-alpine" || image.BuildDurationMs < 0 {
+		t.Errorf("Expected the built image's metadata, got %+v", image)
+	}
+}
+
+// TestExecuteBuild_BuildsWithConfigSettings verifies that the build settings
+// of mhive.config.yaml reach the builder
+func TestExecuteBuild_BuildsWithConfigSettings(t *testing.T) {
+	h := newHermeticPipeline(t, "server-1")
+	h.updateServer(t, "server-1", func(server *models.MCPServer) { server.Builder = "fake" })
+	h.runner.files = map[string]string{
+		"mhive.config.yaml":         "name: weather\nruntime: node\nbuild:\n  context: servers/weather\n  dockerfile: docker/Dockerfile.weather\n  target: runtime\n  args:\n    NODE_VERSION: \"22\"\n",
+		"docker/Dockerfile.weather": "ARG NODE_VERSION=20\nFROM node:${NODE_VERSION}-alpine AS build\nFROM build AS runtime\nFROM build AS test\n",
+		"servers/weather/index.js":  "console.log('weather')\n",
+	}
+	deployment := h.mustRun(t, "server-1")
+	req := h.buildRequest(t)
+
+	if !strings.HasSuffix(req.ContextDir, "/servers/weather") || !strings.HasSuffix(req.Dockerfile, "/docker/Dockerfile.weather") ||
+		req.Target != "runtime" || fmt.Sprint(req.BuildArgs) != "map[NODE_VERSION:22]" {
+		t.Errorf("Expected the config's build settings, got %+v", req)
+	}
+	// The base image is the one of the target stage, with the ARG default
+	if deployment.Image == nil || deployment.Image.BaseImage != "node:20-alpine" {
+		t.Errorf("Expected base image node:20-alpine, got %+v", deployment.Image)
+	}
+}
+
+// TestExecuteBuild_UsesServerBuilderAndSecrets verifies that a server's
+// builder is used instead of the default and gets its secret variables
+func TestExecuteBuild_UsesServerBuilderAndSecrets(t *testing.T) {
+	h := newHermeticPipeline(t, "server-1")
+	h.updateServer(t, "server-1", func(server *models.MCPServer) {
+		server.Builder = "fake"
+		server.EnvironmentVariables = []models.EnvironmentVariable{
+			{Name: "NPM_TOKEN", Value: "npm_secret", IsSecret: true},
+			{Name: "LOG_LEVEL", Value: "debug"},
+		}
+	})
+	h.mustRun(t, "server-1")
+	req := h.buildRequest(t)
+
+	if req.Image != "server-1:main-00000000" || req.CacheKey != "mcp-server-1" || req.Dockerfile != filepath.Join(req.ContextDir, "Dockerfile") {
+		t.Errorf("Unexpected build request %+v", req)
+	}
+	if len(req.Secrets) != 1 || req.Secrets["NPM_TOKEN"] != "npm_secret" {
+		t.Errorf("Expected only the secret variable as a build secret, got %v", req.Secrets)
+	}
+	if h.ran("docker build") {
+		t.Error("Expected the default builder not to run")
+	}
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// maxOutputLineSize is the longest docker output line that is kept in one piece
+const maxOutputLineSize = 1024 * 1024
+
+var (
+	// ansiPattern matches terminal colour and cursor escape sequences
+	ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+	// plainProgressPattern matches a BuildKit --progress=plain line: "#5 ..."
+	plainProgressPattern = regexp.MustCompile(`^#(\d+) (.*)$`)
+
+	// plainDonePattern matches the end of a vertex: "DONE 2.3s"
+	plainDonePattern = regexp.MustCompile(`^DONE (\d+(?:\.\d+)?)s$`)
+
+	// plainOutputPattern matches vertex output prefixed with its elapsed time: "0.512 added 10 packages"
+	plainOutputPattern = regexp.MustCompile(`^\d+(?:\.\d+)? (.*)$`)
+
+	// stepNamePattern matches a Dockerfile step vertex name: "[builder 2/4] RUN go build"
+	stepNamePattern = regexp.MustCompile(`^\[(?:(\S+) )?(\d+)/(\d+)\] (.*)$`)
+)
+
+// dockerStep tracks a BuildKit vertex until it finishes
+type dockerStep struct {
+	step     *models.BuildStep
+	started  time.Time
+	reported bool
+}
+
+// rawSolveStatus is one line of BuildKit --progress=rawjson output
+type rawSolveStatus struct {
+	Vertexes []struct {
+		Digest    string     `json:"digest"`
+		Name      string     `json:"name"`
+		Started   *time.Time `json:"started"`
+		Completed *time.Time `json:"completed"`
+		Cached    bool       `json:"cached"`
+		Error     string     `json:"error"`
+	} `json:"vertexes"`
+	Logs []struct {
+		Vertex string `json:"vertex"`
+		Data   []byte `json:"data"`
+	} `json:"logs"`
+}
+
+// dockerOutputParser turns docker build output into build log entries.
+// BuildKit progress (plain or rawjson) becomes one summary entry per
+// Dockerfile step; any other stdout line is logged as info and any other
+// stderr line as a warning.
+type dockerOutputParser struct {
+	mu     sync.Mutex
+	logger *BuildLogger
+	stage  string
+	steps  map[string]*dockerStep
+}
+
+// newDockerOutputParser creates a parser that writes to the given logger stage
+func newDockerOutputParser(logger *BuildLogger, stage string) *dockerOutputParser {
+	return &dockerOutputParser{
+		logger: logger,
+		stage:  stage,
+		steps:  make(map[string]*dockerStep),
+	}
+}
+
+// Consume reads r line by line until EOF. It is safe to consume stdout and
+// stderr concurrently.
+func (p *dockerOutputParser) Consume(r io.Reader, stderr bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxOutputLineSize)
+	for scanner.Scan() {
+		p.Line(scanner.Text(), stderr)
+	}
+	return scanner.Err()
+}
+
+// Line handles a single line of output
+func (p *dockerOutputParser) Line(line string, stderr bool) {
+	line = cleanOutputLine(line)
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if strings.HasPrefix(line, "{") && p.rawJSON(line) {
+		return
+	}
+	if match := plainProgressPattern.FindStringSubmatch(line); match != nil {
+		p.plain(match[1], match[2])
+		return
+	}
+
+	if stderr {
+		p.logger.LogWarning(p.stage, line)
+	} else {
+		p.logger.LogInfo(p.stage, line)
+	}
+}
+
+// plain handles a --progress=plain line for vertex id
+func (p *dockerOutputParser) plain(id, rest string) {
+	if match := stepNamePattern.FindStringSubmatch(rest); match != nil {
+		// BuildKit repeats the header when output of parallel steps interleaves
+		if _, ok := p.steps[id]; !ok {
+			p.steps[id] = &dockerStep{step: parseStepName(match), started: time.Now()}
+		}
+		return
+	}
+
+	current := p.steps[id]
+
+	switch {
+	case rest == "CACHED":
+		if current != nil {
+			current.step.Cached = true
+			p.finish(current, "")
+		}
+	case plainDonePattern.MatchString(rest):
+		if current != nil {
+			seconds, _ := strconv.ParseFloat(plainDonePattern.FindStringSubmatch(rest)[1], 64)
+			current.step.DurationMs = int64(seconds * 1000)
+			p.finish(current, "")
+		}
+	case strings.HasPrefix(rest, "ERROR"):
+		if current != nil {
+			current.step.DurationMs = time.Since(current.started).Milliseconds()
+			p.finish(current, strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(rest, "ERROR"), ":")))
+		} else {
+			p.logger.LogError(p.stage, rest)
+		}
+	default:
+		// Step output is prefixed with the seconds since the step started
+		if match := plainOutputPattern.FindStringSubmatch(rest); match != nil {
+			rest = match[1]
+		}
+		p.logger.LogInfo(p.stage, rest)
+	}
+}
+
+// rawJSON handles a --progress=rawjson line. It returns false if the line is not a solve status.
+func (p *dockerOutputParser) rawJSON(line string) bool {
+	var status rawSolveStatus
+	if err := json.Unmarshal([]byte(line), &status); err != nil {
+		return false
+	}
+	if status.Vertexes == nil && status.Logs == nil {
+		return false
+	}
+
+	for _, vertex := range status.Vertexes {
+		current := p.steps[vertex.Digest]
+		if current == nil {
+			match := stepNamePattern.FindStringSubmatch(vertex.Name)
+			if match == nil {
+				continue
+			}
+			current = &dockerStep{step: parseStepName(match), started: time.Now()}
+			p.steps[vertex.Digest] = current
+		}
+		if vertex.Started != nil {
+			current.started = *vertex.Started
+		}
+		current.step.Cached = current.step.Cached || vertex.Cached
+
+		if vertex.Completed != nil {
+			if vertex.Started != nil {
+				current.step.DurationMs = vertex.Completed.Sub(*vertex.Started).Milliseconds()
+			}
+			p.finish(current, vertex.Error)
+		}
+	}
+
+	for _, entry := range status.Logs {
+		for _, text := range strings.Split(string(entry.Data), "\n") {
+			if text = cleanOutputLine(text); strings.TrimSpace(text) != "" {
+				p.logger.LogInfo(p.stage, text)
+			}
+		}
+	}
+
+	return true
+}
+
+// finish logs the summary of a step once
+func (p *dockerOutputParser) finish(current *dockerStep, errMessage string) {
+	if current.reported {
+		return
+	}
+	current.reported = true
+
+	step := *current.step
+	name := fmt.Sprintf("Step %d/%d", step.Number, step.Total)
+	if step.BuildStage != "" {
+		name = fmt.Sprintf("Step %d/%d (%s)", step.Number, step.Total, step.BuildStage)
+	}
+
+	switch {
+	case errMessage != "":
+		p.logger.LogStep(p.stage, LevelError, fmt.Sprintf("%s failed: %s: %s", name, step.Instruction, errMessage), &step)
+	case step.Cached:
+		p.logger.LogStep(p.stage, LevelInfo, fmt.Sprintf("%s: %s (cached)", name, step.Instruction), &step)
+	default:
+		duration := time.Duration(step.DurationMs) * time.Millisecond
+		p.logger.LogStep(p.stage, LevelInfo, fmt.Sprintf("%s: %s (%s)", name, step.Instruction, duration), &step)
+	}
+}
+
+// parseStepName converts a stepNamePattern match into a BuildStep
+func parseStepName(match []string) *models.BuildStep {
+	number, _ := strconv.Atoi(match[2])
+	total, _ := strconv.Atoi(match[3])
+	return &models.BuildStep{
+		Number:      number,
+		Total:       total,
+		BuildStage:  match[1],
+		Instruction: match[4],
+	}
+}
+
+// cleanOutputLine strips terminal escape codes and keeps only the last
+// carriage-return segment, which is what a terminal would display
+func cleanOutputLine(line string) string {
+	line = ansiPattern.ReplaceAllString(line, "")
+	line = strings.TrimRight(line, "\r")
+	if i := strings.LastIndex(line, "\r"); i >= 0 {
+		line = line[i+1:]
+	}
+	return strings.TrimRight(line, " \t")
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+func TestDockerOutputParser_PlainProgress(t *testing.T) {
+	logger := NewBuildLogger()
+	parser := newDockerOutputParser(logger, "build_image")
+
+	output := strings.Join([]string{
+		"#1 [internal] load build definition from Dockerfile",
+		"#1 transferring dockerfile: 180B done",
+		"#1 DONE 0.0s",
+		"#5 [1/3] FROM docker.io/library/node:20-alpine",
+		"#5 CACHED",
+		"#6 [builder 2/3] RUN npm ci",
+		"#6 0.512 \x1b[32madded 10 packages\x1b[0m",
+		"#6 DONE 2.5s",
+		"#7 [3/3] RUN npm test",
+		"#7 ERROR: process \"/bin/sh -c npm test\" did not complete successfully: exit code: 1",
+	}, "\n")
+	if err := parser.Consume(strings.NewReader(output), true); err != nil {
+		t.Fatalf("Consume() error = %v", err)
+	}
+
+	var steps []models.BuildLogEntry
+	for _, entry := range logger.GetLogs() {
+		if entry.Step != nil {
+			steps = append(steps, entry)
+		}
+		if entry.Level == LevelWarning {
+			t.Errorf("BuildKit progress logged as warning: %q", entry.Message)
+		}
+		if strings.Contains(entry.Message, "\x1b") {
+			t.Errorf("ANSI codes not stripped: %q", entry.Message)
+		}
+	}
+
+	if len(steps) != 3 {
+		t.Fatalf("got %d step entries, want 3: %+v", len(steps), steps)
+	}
+
+	if s := steps[0].Step; s.Number != 1 || s.Total != 3 || !s.Cached {
+		t.Errorf("step 1 = %+v, want cached 1/3", s)
+	}
+	if s := steps[1].Step; s.Number != 2 || s.BuildStage != "builder" || s.Cached || s.DurationMs != 2500 || s.Instruction != "RUN npm ci" {
+		t.Errorf("step 2 = %+v, want uncached builder 2/3 RUN npm ci taking 2500ms", s)
+	}
+	if steps[2].Level != LevelError || steps[2].Step.Number != 3 {
+		t.Errorf("step 3 = %+v, want error entry for step 3", steps[2])
+	}
+
+	found := false
+	for _, entry := range logger.GetLogs() {
+		if entry.Message == "added 10 packages" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("step output line not logged without its timestamp prefix")
+	}
+}
+
+func TestDockerOutputParser_RawJSON(t *testing.T) {
+	logger := NewBuildLogger()
+	parser := newDockerOutputParser(logger, "build_image")
+
+	data := base64.StdEncoding.EncodeToString([]byte("compiling\n"))
+	parser.Line(`{"vertexes":[{"digest":"sha256:a","name":"[2/2] RUN go build","started":"2024-01-01T00:00:00Z"}]}`, true)
+	parser.Line(`{"logs":[{"vertex":"sha256:a","stream":1,"data":"`+data+`"}]}`, true)
+	parser.Line(`{"vertexes":[{"digest":"sha256:a","name":"[2/2] RUN go build","started":"2024-01-01T00:00:00Z","completed":"2024-01-01T00:00:01.5Z"}]}`, true)
+
+	logs := logger.GetLogs()
+	if len(logs) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(logs), logs)
+	}
+	if logs[0].Message != "compiling" || logs[0].Level != LevelInfo {
+		t.Errorf("log entry = %+v, want info \"compiling\"", logs[0])
+	}
+	if s := logs[1].Step; s == nil || s.Number != 2 || s.DurationMs != 1500 || s.Cached {
+		t.Errorf("step entry = %+v, want 2/2 taking 1500ms", logs[1].Step)
+	}
+}
+
+func TestDockerOutputParser_UnrecognisedLines(t *testing.T) {
+	logger := NewBuildLogger()
+	parser := newDockerOutputParser(logger, "build_image")
+
+	parser.Line("Step 1/2 : FROM alpine", false)
+	parser.Line("WARNING: legacy builder is deprecated\r", true)
+	parser.Line("downloading 10%\rdownloading 100%", false)
+
+	logs := logger.GetLogs()
+	want := []struct{ level, message string }{
+		{LevelInfo, "Step 1/2 : FROM alpine"},
+		{LevelWarning, "WARNING: legacy builder is deprecated"},
+		{LevelInfo, "downloading 100%"},
+	}
+	if len(logs) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(logs), len(want))
+	}
+	for i, w := range want {
+		if logs[i].Level != w.level || logs[i].Message != w.message {
+			t.Errorf("entry %d = %s %q, want %s %q", i, logs[i].Level, logs[i].Message, w.level, w.message)
+		}
+	}
+}
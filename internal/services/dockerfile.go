@@ -0,0 +1,89 @@
+package services
+
+import (
+	"os"
+	"strings"
+)
+
+// dockerfileBaseImage returns the image the target stage of a Dockerfile is
+// built FROM, or the final stage's when target is empty. A stage built from an
+// earlier stage resolves to that stage's base, and ARGs declared before the
+// first FROM are substituted with their defaults. It returns "" when the
+// Dockerfile has no FROM instruction or no stage named target.
+func dockerfileBaseImage(dockerfile, target string) string {
+	args := make(map[string]string)
+	stages := make(map[string]string) // stage name -> base image
+	base := ""
+
+	for _, line := range dockerfileInstructions(dockerfile) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "ARG":
+			// Only ARGs before the first FROM can be used in FROM lines
+			if base == "" && len(fields) > 1 {
+				if name, value, ok := strings.Cut(fields[1], "="); ok {
+					args[name] = strings.Trim(value, `"'`)
+				}
+			}
+		case "FROM":
+			var image, alias string
+			for i := 1; i < len(fields); i++ {
+				switch {
+				case strings.HasPrefix(fields[i], "--"):
+					// Flags such as --platform
+				case image == "":
+					image = os.Expand(fields[i], func(name string) string {
+						if value, ok := args[name]; ok {
+							return value
+						}
+						return "${" + name + "}"
+					})
+				case strings.EqualFold(fields[i], "AS") && i+1 < len(fields):
+					alias = strings.ToLower(fields[i+1])
+					i++
+				}
+			}
+			if image == "" {
+				continue
+			}
+			if parent, ok := stages[strings.ToLower(image)]; ok {
+				image = parent
+			}
+			if alias != "" {
+				stages[alias] = image
+			}
+			base = image
+		}
+	}
+	if target != "" {
+		return stages[strings.ToLower(target)]
+	}
+	return base
+}
+
+// dockerfileInstructions splits a Dockerfile into instructions, joining
+// continued lines and dropping comments and blank lines
+func dockerfileInstructions(dockerfile string) []string {
+	var instructions []string
+	var current strings.Builder
+	for _, line := range strings.Split(dockerfile, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if continued, ok := strings.CutSuffix(line, "\\"); ok {
+			current.WriteString(continued + " ")
+			continue
+		}
+		current.WriteString(line)
+		instructions = append(instructions, current.String())
+		current.Reset()
+	}
+	if current.Len() > 0 {
+		instructions = append(instructions, current.String())
+	}
+	return instructions
+}
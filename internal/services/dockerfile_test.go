@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+func TestDockerfileBaseImage(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		target     string
+		want       string
+	}{
+		{name: "single stage", dockerfile: "FROM node:20-alpine\nCOPY . .\n", want: "node:20-alpine"},
+		{name: "no FROM", dockerfile: "# just a comment\n", want: ""},
+		{
+			name:       "final stage wins",
+			dockerfile: "FROM golang:1.25 AS build\nRUN go build\nFROM gcr.io/distroless/static\nCOPY --from=build /app /app\n",
+			want:       "gcr.io/distroless/static",
+		},
+		{
+			name:       "stage alias resolves to its base",
+			dockerfile: "FROM --platform=$BUILDPLATFORM python:3.12-slim as base\nFROM base AS runtime\nCMD [\"python\"]\n",
+			want:       "python:3.12-slim",
+		},
+		{
+			name:       "global ARG default",
+			dockerfile: "ARG NODE_VERSION=22\nARG VARIANT\nFROM \\\n  node:${NODE_VERSION}-$VARIANT\n",
+			want:       "node:22-${VARIANT}",
+		},
+		{
+			name:       "target stage",
+			dockerfile: "FROM golang:1.25 AS build\nFROM build AS test\nFROM gcr.io/distroless/static\n",
+			target:     "Test",
+			want:       "golang:1.25",
+		},
+		{name: "unknown target", dockerfile: "FROM golang:1.25 AS build\n", target: "runtime", want: ""},
+	}
+	for _, tt := range tests {
+		if got := dockerfileBaseImage(tt.dockerfile, tt.target); got != tt.want {
+			t.Errorf("%s: dockerfileBaseImage() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestExecuteBuild_GeneratesMissingDockerfile builds a repository without a
+// Dockerfile and verifies that one is generated outside the clone and logged
+func TestExecuteBuild_GeneratesMissingDockerfile(t *testing.T) {
+	h := newHermeticPipeline(t, "server-1")
+	h.updateServer(t, "server-1", func(server *models.MCPServer) { server.Builder = "fake" })
+	h.runner.files = map[string]string{
+		"mhive.config.yaml": "name: weather\n",
+		"package.json":      `{"name": "weather", "main": "server.js"}`,
+		"server.js":         "console.log('weather')\n",
+	}
+	deployment := h.mustRun(t, "server-1")
+	req := h.buildRequest(t)
+
+	if !strings.HasSuffix(req.Dockerfile, "-out/generated/Dockerfile") || strings.HasPrefix(req.Dockerfile, req.ContextDir+"/") {
+		t.Errorf("Expected the generated Dockerfile outside the clone, got %q", req.Dockerfile)
+	}
+	if deployment.Image == nil || deployment.Image.BaseImage != "node:22-alpine" {
+		t.Errorf("Expected base image node:22-alpine, got %+v", deployment.Image)
+	}
+
+	entries, _, err := h.logStore.Read(context.Background(), deployment.LogRef.Key, 0, 1000)
+	if err != nil {
+		t.Fatalf("Failed to read the build log: %v", err)
+	}
+	var messages []string
+	for _, entry := range entries {
+		if entry.Stage == "validate_docker" {
+			messages = append(messages, entry.Message)
+		}
+	}
+	log := strings.Join(messages, "\n")
+	for _, want := range []string{
+		"Detected runtime node, entrypoint node server.js",
+		"Generated Dockerfile from the node template (built-in):",
+		`  ENTRYPOINT ["node","server.js"]`,
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("Expected %q in the validate_docker log:\n%s", want, log)
+		}
+	}
+}
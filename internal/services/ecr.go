@@ -3,10 +3,10 @@ package services
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"os/exec"
+	"net/url"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -15,19 +15,21 @@ import (
 	"github.com/imyashkale/buildserver/internal/logger"
 )
 
-// ECRService handles ECR repository and image operations
+// ECRService handles ECR repository and image operations. It implements Registry.
 type ECRService struct {
 	ecrClient *ecr.Client
+	runner    CommandRunner
 	region    string
 	accountID string
 }
 
-// NewECRService creates a new ECR service
-func NewECRService(awsCfg aws.Config, accountID string) *ECRService {
+// NewECRService creates a new ECR service that runs docker through runner
+func NewECRService(awsCfg aws.Config, accountID string, runner CommandRunner) *ECRService {
 	ecrClient := ecr.NewFromConfig(awsCfg)
 
 	ecrService := &ECRService{
 		ecrClient: ecrClient,
+		runner:    runner,
 		region:    awsCfg.Region,
 		accountID: accountID,
 	}
@@ -40,7 +42,7 @@ func NewECRService(awsCfg aws.Config, accountID string) *ECRService {
 // GetOrCreateRepository gets or creates an ECR repository for the server
 // Repository name format: mcp-{server_id}
 func (es *ECRService) GetOrCreateRepository(ctx context.Context, serverID string) (string, error) {
-	repoName := fmt.Sprintf("mcp-%s", serverID)
+	repoName := repositoryName(serverID)
 
 	logger.WithFields(map[string]interface{}{
 		"server_id": serverID,
@@ -99,107 +101,77 @@ func (es *ECRService) GetRepositoryURI(repoName string) string {
 	return fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s", es.accountID, es.region, repoName)
 }
 
-// PushImage pushes a Docker image to ECR
+// PushImage pushes a Docker image to ECR over the registry API. Layers are
+// uploaded once and each tag is a manifest PUT.
 // Parameters:
 //   - ctx: context
 //   - repoName: ECR repository name
-//   - imageName: local Docker image name (e.g., "server-id:commit-hash")
+//   - image: built image (e.g., "server-id:commit-hash" in the local daemon)
 //   - tags: list of tags to apply (e.g., ["latest", "branch-commit"])
-func (es *ECRService) PushImage(ctx context.Context, repoName, imageName string, tags []string) (string, error) {
+func (es *ECRService) PushImage(ctx context.Context, repoName string, image BuiltImage, tags []string) (PushedImage, error) {
 	logger.WithFields(map[string]interface{}{
 		"repo_name":  repoName,
-		"image_name": imageName,
+		"image_name": image.Name,
 		"tags":       tags,
 	}).Debug("Pushing Docker image to ECR")
 
 	if len(tags) == 0 {
 		logger.WithField("repo_name", repoName).Error("Push image failed: no tags provided")
-		return "", fmt.Errorf("at least one tag must be provided")
+		return PushedImage{}, fmt.Errorf("at least one tag must be provided")
 	}
 
 	repoURI := es.GetRepositoryURI(repoName)
 
 	// Validate inputs
-	if imageName == "" {
+	if image.Name == "" {
 		logger.WithField("repo_name", repoName).Error("Push image failed: image name is empty")
-		return "", fmt.Errorf("image name cannot be empty")
+		return PushedImage{}, fmt.Errorf("image name cannot be empty")
 	}
 
 	if repoName == "" {
 		logger.Error("Push image failed: repository name is empty")
-		return "", fmt.Errorf("repository name cannot be empty")
+		return PushedImage{}, fmt.Errorf("repository name cannot be empty")
 	}
 
-	// Login to ECR (requires AWS CLI installed)
+	// Authenticate with ECR
 	logger.WithField("repo_name", repoName).Debug("Logging into ECR")
-	if err := es.loginToECR(ctx); err != nil {
+	client, release, err := es.loginToECR(ctx)
+	if err != nil {
 		logger.WithFields(map[string]interface{}{
 			"repo_name": repoName,
 			"error":     err.Error(),
 		}).Error("ECR login failed")
-		return "", fmt.Errorf("ECR login failed: %w", err)
-	}
-
-	// Tag the image for ECR
-	for _, tag := range tags {
-		fullImageName := fmt.Sprintf("%s:%s", repoURI, tag)
-		log.Printf("Tagging Docker image: %s -> %s", imageName, fullImageName)
-
-		cmd := exec.CommandContext(ctx, "docker", "tag", imageName, fullImageName)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
-			return "", fmt.Errorf("failed to tag Docker image %s as %s: %w", imageName, fullImageName, err)
-		}
+		return PushedImage{}, fmt.Errorf("ECR login failed: %w", err)
 	}
+	defer release()
 
-	// Push the image
-	for _, tag := range tags {
-		fullImageName := fmt.Sprintf("%s:%s", repoURI, tag)
-		log.Printf("Pushing Docker image: %s", fullImageName)
-
-		logger.WithFields(map[string]interface{}{
-			"repo_name":       repoName,
-			"full_image_name": fullImageName,
-			"tag":             tag,
-		}).Info("Pushing Docker image")
-
-		cmd := exec.CommandContext(ctx, "docker", "push", fullImageName)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
-			logger.WithFields(map[string]interface{}{
-				"repo_name":       repoName,
-				"full_image_name": fullImageName,
-				"error":           err.Error(),
-			}).Error("Failed to push Docker image")
-			return "", fmt.Errorf("failed to push Docker image %s: %w", fullImageName, err)
-		}
+	pushed, err := pushLocalImage(ctx, es.runner, client, ImageRepository{Name: repoName, URI: repoURI}, image, tags)
+	if err != nil {
+		return PushedImage{}, err
 	}
 
-	// Return the primary image URI (first tag or "latest")
-	primaryImageURI := fmt.Sprintf("%s:%s", repoURI, tags[0])
-	log.Printf("Successfully pushed image: %s", primaryImageURI)
+	log.Printf("Successfully pushed image: %s", pushed.URI)
 	logger.WithFields(map[string]interface{}{
 		"repo_name":   repoName,
-		"image_uri":   primaryImageURI,
+		"image_uri":   pushed.URI,
+		"digest":      pushed.Digest,
 		"tags_pushed": len(tags),
 	}).Info("Docker image pushed to ECR successfully")
-	return primaryImageURI, nil
+	return pushed, nil
 }
 
-// loginToECR authenticates with ECR
-func (es *ECRService) loginToECR(ctx context.Context) error {
+// loginToECR gets an ECR authorization token and returns a registry client
+// that holds it in memory. release unregisters the password from the log
+// redaction once the client is no longer used.
+func (es *ECRService) loginToECR(ctx context.Context) (client *ociClient, release func(), err error) {
 	// Get authorization token
 	authOutput, err := es.ecrClient.GetAuthorizationToken(ctx, &ecr.GetAuthorizationTokenInput{})
 	if err != nil {
-		return fmt.Errorf("failed to get ECR authorization token: %w", err)
+		return nil, nil, fmt.Errorf("failed to get ECR authorization token: %w", err)
 	}
 
 	if len(authOutput.AuthorizationData) == 0 {
-		return fmt.Errorf("no authorization data returned")
+		return nil, nil, fmt.Errorf("no authorization data returned")
 	}
 
 	authData := authOutput.AuthorizationData[0]
@@ -211,47 +183,105 @@ func (es *ECRService) loginToECR(ctx context.Context) error {
 	// Decode the base64 token
 	decodedBytes, err := base64.StdEncoding.DecodeString(encodedToken)
 	if err != nil {
-		return fmt.Errorf("failed to decode authorization token: %w", err)
+		return nil, nil, fmt.Errorf("failed to decode authorization token: %w", err)
 	}
 
 	decodedToken := string(decodedBytes)
 	parts := strings.Split(decodedToken, ":")
 	if len(parts) < 2 {
-		return fmt.Errorf("invalid authorization token format: expected username:password")
+		return nil, nil, fmt.Errorf("invalid authorization token format: expected username:password")
 	}
 
 	username := parts[0]
 	password := strings.Join(parts[1:], ":")
-	endpoint := *authData.ProxyEndpoint
-
-	// Docker login
-	cmd := exec.CommandContext(ctx, "docker", "login",
-		"-u", username,
-		"-p", password,
-		endpoint,
-	)
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("docker login to ECR failed: %w", err)
+	endpoint, err := url.Parse(aws.ToString(authData.ProxyEndpoint))
+	if err != nil || endpoint.Host == "" {
+		return nil, nil, fmt.Errorf("invalid ECR proxy endpoint %q", aws.ToString(authData.ProxyEndpoint))
 	}
 
-	return nil
+	// Keep the registry password out of the application log while it is in use
+	release = logger.RegisterSecrets(password)
+
+	// ECR answers with a basic auth challenge, so send the credentials up front
+	client = newOCIClient(endpoint, username, password)
+	client.basic = true
+	return client, release, nil
 }
 
 // DeleteImage deletes a specific image from ECR repository
 func (es *ECRService) DeleteImage(ctx context.Context, repoName, tag string) error {
-	_, err := es.ecrClient.BatchDeleteImage(ctx, &ecr.BatchDeleteImageInput{
+	return es.deleteImages(ctx, repoName, imageIdentifier(tag))
+}
+
+// Name returns the registry backend name
+func (es *ECRService) Name() string {
+	return RegistryECR
+}
+
+// EnsureRepository gets or creates the server's ECR repository
+func (es *ECRService) EnsureRepository(ctx context.Context, serverID string) (ImageRepository, error) {
+	repoName, err := es.GetOrCreateRepository(ctx, serverID)
+	if err != nil {
+		return ImageRepository{}, err
+	}
+	return ImageRepository{Name: repoName, URI: es.GetRepositoryURI(repoName)}, nil
+}
+
+// Push pushes a built image to the repository under each tag
+func (es *ECRService) Push(ctx context.Context, repo ImageRepository, image BuiltImage, tags []string) (PushedImage, error) {
+	return es.PushImage(ctx, repo.Name, image, tags)
+}
+
+// ResolveDigest returns the digest of the image a tag points at
+func (es *ECRService) ResolveDigest(ctx context.Context, repo ImageRepository, tag string) (string, error) {
+	output, err := es.ecrClient.DescribeImages(ctx, &ecr.DescribeImagesInput{
+		RepositoryName: aws.String(repo.Name),
+		ImageIds:       []types.ImageIdentifier{imageIdentifier(tag)},
+	})
+	if err != nil {
+		var notFound *types.ImageNotFoundException
+		if errors.As(err, &notFound) {
+			return "", fmt.Errorf("%w: %s:%s", ErrImageNotFound, repo.Name, tag)
+		}
+		return "", fmt.Errorf("failed to describe ECR image: %w", err)
+	}
+	if len(output.ImageDetails) == 0 || output.ImageDetails[0].ImageDigest == nil {
+		return "", fmt.Errorf("%w: %s:%s", ErrImageNotFound, repo.Name, tag)
+	}
+	return *output.ImageDetails[0].ImageDigest, nil
+}
+
+// Delete removes a tag or digest from the repository
+func (es *ECRService) Delete(ctx context.Context, repo ImageRepository, reference string) error {
+	return es.deleteImages(ctx, repo.Name, imageIdentifier(reference))
+}
+
+// deleteImages removes images from an ECR repository. BatchDeleteImage reports
+// per-image failures in its output rather than as an error.
+func (es *ECRService) deleteImages(ctx context.Context, repoName string, ids ...types.ImageIdentifier) error {
+	output, err := es.ecrClient.BatchDeleteImage(ctx, &ecr.BatchDeleteImageInput{
 		RepositoryName: aws.String(repoName),
-		ImageIds: []types.ImageIdentifier{
-			{
-				ImageTag: aws.String(tag),
-			},
-		},
+		ImageIds:       ids,
 	})
 
 	if err != nil {
 		return fmt.Errorf("failed to delete image from ECR: %w", err)
 	}
 
+	for _, failure := range output.Failures {
+		if failure.FailureCode == types.ImageFailureCodeImageNotFound {
+			return fmt.Errorf("%w: %s", ErrImageNotFound, aws.ToString(failure.FailureReason))
+		}
+		return fmt.Errorf("failed to delete image from ECR: %s: %s", failure.FailureCode, aws.ToString(failure.FailureReason))
+	}
+
 	return nil
 }
+
+// imageIdentifier identifies an ECR image by digest or by tag
+func imageIdentifier(reference string) types.ImageIdentifier {
+	if strings.HasPrefix(reference, "sha256:") {
+		return types.ImageIdentifier{ImageDigest: aws.String(reference)}
+	}
+	return types.ImageIdentifier{ImageTag: aws.String(reference)}
+}
@@ -0,0 +1,408 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/queue"
+	"github.com/imyashkale/buildserver/internal/repository"
+)
+
+// GitHub webhook events that are handled; others are acknowledged and ignored
+const (
+	GitHubEventPush = "push"
+	GitHubEventPing = "ping"
+)
+
+// WebhookDeploymentPrefix starts the ID of deployments created by a push. The
+// rest identifies the pushed commit and branch, which the signature covers, so
+// a redelivery or replay of the push finds the deployment of the first one.
+const WebhookDeploymentPrefix = "gh-"
+
+var (
+	// ErrWebhookPayload is returned for a delivery that is not a valid GitHub webhook
+	ErrWebhookPayload = errors.New("invalid webhook delivery")
+	// ErrWebhookSignature is returned when no server's secret produces the delivery's signature
+	ErrWebhookSignature = errors.New("webhook signature does not match")
+	// ErrWebhookNoServer is returned when no MCP server with a webhook secret uses the repository
+	ErrWebhookNoServer = errors.New("no MCP server receives webhooks for this repository")
+	// ErrWebhookSecret is returned for a webhook secret that cannot be stored
+	ErrWebhookSecret = errors.New("invalid webhook secret")
+	// ErrAutoBuildBranches is returned for auto-build branch patterns that cannot be stored
+	ErrAutoBuildBranches = errors.New("invalid auto-build branches")
+	// ErrWebhookForbidden is returned for the webhook settings of another user's MCP server
+	ErrWebhookForbidden = errors.New("MCP server belongs to another user")
+)
+
+// maxWebhookSecretLength is the longest webhook secret that is stored
+const maxWebhookSecretLength = 256
+
+// maxAutoBuildBranches is the most branch patterns a server builds pushes for
+const maxAutoBuildBranches = 20
+
+// maxBranchPatternLength is the longest branch pattern that is stored
+const maxBranchPatternLength = 255
+
+// deliveryIDPattern matches X-GitHub-Delivery, a GUID
+var deliveryIDPattern = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// webhookMaxServers is the most MCP servers a delivery is checked against
+const webhookMaxServers = 20
+
+// commitPattern matches a full SHA-1 or SHA-256 commit hash
+var commitPattern = regexp.MustCompile(`^([0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// zeroCommit is the after commit of a push that deleted its branch
+const zeroCommit = "0000000000000000000000000000000000000000"
+
+// GitHubDelivery is a webhook request as GitHub sent it
+type GitHubDelivery struct {
+	ID        string // X-GitHub-Delivery
+	Event     string // X-GitHub-Event
+	Signature string // X-Hub-Signature-256, "sha256=" and the hex HMAC of Payload
+	Payload   []byte
+}
+
+// githubWebhookPayload holds the fields of push and ping payloads that are used
+type githubWebhookPayload struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Deleted    bool   `json:"deleted"`
+	Repository *struct {
+		HTMLURL       string `json:"html_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+// WebhookService turns GitHub push webhooks into deployments and build jobs.
+// Each MCP server has its own webhook secret, so a delivery is only trusted
+// for the servers whose secret produces its signature.
+type WebhookService struct {
+	mcpRepo        repository.MCPRepository
+	deploymentRepo repository.DeploymentRepository
+	secrets        TokenCipher // encrypts and decrypts webhook secrets, which are stored like access tokens
+	jobQueue       *queue.JobQueue
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(
+	mcpRepo repository.MCPRepository,
+	deploymentRepo repository.DeploymentRepository,
+	secrets TokenCipher,
+	jobQueue *queue.JobQueue,
+) *WebhookService {
+	return &WebhookService{
+		mcpRepo:        mcpRepo,
+		deploymentRepo: deploymentRepo,
+		secrets:        secrets,
+		jobQueue:       jobQueue,
+	}
+}
+
+// HandleGitHubDelivery verifies a delivery and handles its event. A push to a
+// branch that matches a server's auto-build branches creates a queued
+// deployment and enqueues its build. Handling the same push again, whether
+// redelivered or replayed under another delivery ID, does not build twice.
+func (s *WebhookService) HandleGitHubDelivery(ctx context.Context, delivery GitHubDelivery) (*models.WebhookResponse, error) {
+	if !deliveryIDPattern.MatchString(delivery.ID) {
+		return nil, fmt.Errorf("%w: missing or malformed delivery ID", ErrWebhookPayload)
+	}
+	response := &models.WebhookResponse{Event: delivery.Event, DeliveryId: delivery.ID}
+	if delivery.Event != GitHubEventPush && delivery.Event != GitHubEventPing {
+		response.Message = fmt.Sprintf("Event %q is ignored", delivery.Event)
+		return response, nil
+	}
+	if delivery.Signature == "" {
+		return nil, fmt.Errorf("%w: X-Hub-Signature-256 is missing", ErrWebhookSignature)
+	}
+
+	var payload githubWebhookPayload
+	if err := json.Unmarshal(delivery.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWebhookPayload, err)
+	}
+	if payload.Repository == nil {
+		return nil, fmt.Errorf("%w: the payload has no repository; add the webhook to the repository rather than its organisation", ErrWebhookPayload)
+	}
+
+	servers, err := s.verifiedServers(ctx, payload.Repository.HTMLURL, delivery)
+	if err != nil {
+		return nil, err
+	}
+	for _, server := range servers {
+		response.Servers = append(response.Servers, server.ServerId)
+	}
+
+	if delivery.Event == GitHubEventPing {
+		response.Message = fmt.Sprintf("Webhook verified for %d MCP server(s)", len(servers))
+		return response, nil
+	}
+
+	branch, isBranch := strings.CutPrefix(payload.Ref, "refs/heads/")
+	switch {
+	case !isBranch:
+		response.Message = fmt.Sprintf("Only pushes to branches are built, not %s", payload.Ref)
+		return response, nil
+	case payload.Deleted || payload.After == zeroCommit:
+		response.Message = fmt.Sprintf("Branch %s was deleted", branch)
+		return response, nil
+	case !commitPattern.MatchString(payload.After):
+		return nil, fmt.Errorf("%w: after is not a commit hash", ErrWebhookPayload)
+	}
+	deploymentID := pushDeploymentID(payload.Ref, payload.After)
+
+	for _, server := range servers {
+		if !autoBuildBranch(server.AutoBuildBranches, branch, payload.Repository.DefaultBranch) {
+			response.Builds = append(response.Builds, models.WebhookBuild{
+				ServerId: server.ServerId,
+				Status:   models.WebhookBuildSkipped,
+				Reason:   fmt.Sprintf("Branch %s is not built automatically", branch),
+			})
+			continue
+		}
+
+		build, err := s.queueBuild(ctx, server, deploymentID, branch, payload.After)
+		if err != nil {
+			return nil, err
+		}
+		response.Builds = append(response.Builds, build)
+	}
+	response.Message = fmt.Sprintf("Push to %s handled for %d MCP server(s)", branch, len(servers))
+	return response, nil
+}
+
+// SetWebhookSecret stores the GitHub webhook secret of a user's MCP server,
+// encrypted like access tokens. An empty secret turns push builds off.
+// Another user's server is reported as ErrWebhookForbidden.
+func (s *WebhookService) SetWebhookSecret(ctx context.Context, userId, serverId, secret string) (*models.MCPServer, error) {
+	if len(secret) > maxWebhookSecretLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrWebhookSecret, maxWebhookSecretLength)
+	}
+	encrypted := ""
+	if secret != "" {
+		var err error
+		if encrypted, err = s.secrets.EncryptToken(secret); err != nil {
+			return nil, fmt.Errorf("failed to encrypt webhook secret: %w", err)
+		}
+	}
+
+	return repository.UpdateMCPWithRetry(ctx, s.mcpRepo, serverId, func(server *models.MCPServer) error {
+		if server.UserId != userId {
+			return ErrWebhookForbidden
+		}
+		server.WebhookSecret = encrypted
+		server.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// SetAutoBuildBranches stores the branch patterns pushes to which build a
+// user's MCP server. No patterns builds the repository's default branch.
+// Another user's server is reported as ErrWebhookForbidden.
+func (s *WebhookService) SetAutoBuildBranches(ctx context.Context, userId, serverId string, patterns []string) (*models.MCPServer, error) {
+	if len(patterns) > maxAutoBuildBranches {
+		return nil, fmt.Errorf("%w: more than %d patterns", ErrAutoBuildBranches, maxAutoBuildBranches)
+	}
+	for _, pattern := range patterns {
+		if pattern == "" || len(pattern) > maxBranchPatternLength {
+			return nil, fmt.Errorf("%w: patterns must have 1 to %d characters", ErrAutoBuildBranches, maxBranchPatternLength)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: %q is not a valid pattern", ErrAutoBuildBranches, pattern)
+		}
+	}
+
+	return repository.UpdateMCPWithRetry(ctx, s.mcpRepo, serverId, func(server *models.MCPServer) error {
+		if server.UserId != userId {
+			return ErrWebhookForbidden
+		}
+		server.AutoBuildBranches = append([]string(nil), patterns...)
+		server.UpdatedAt = time.Now()
+		return nil
+	})
+}
+
+// verifiedServers returns the servers of a repository whose webhook secret
+// produces the delivery's signature
+func (s *WebhookService) verifiedServers(ctx context.Context, repositoryURL string, delivery GitHubDelivery) ([]*models.MCPServer, error) {
+	candidates, err := s.serversForRepository(ctx, repositoryURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) == 0 {
+		return nil, ErrWebhookNoServer
+	}
+
+	var verified []*models.MCPServer
+	for _, server := range candidates {
+		secret, err := s.secrets.DecryptToken(server.WebhookSecret)
+		if err != nil {
+			logger.WithFields(map[string]interface{}{
+				"server_id": server.ServerId,
+				"error":     err.Error(),
+			}).Error("Failed to decrypt webhook secret")
+			continue
+		}
+		if validGitHubSignature(secret, delivery.Payload, delivery.Signature) {
+			verified = append(verified, server)
+		}
+	}
+	if len(verified) == 0 {
+		return nil, ErrWebhookSignature
+	}
+	return verified, nil
+}
+
+// serversForRepository returns the MCP servers with a webhook secret that
+// are built from the repository, from the repository key index. Deliveries
+// are not authenticated yet, so at most webhookMaxServers are returned to
+// bound the secrets each one makes us decrypt.
+func (s *WebhookService) serversForRepository(ctx context.Context, repositoryURL string) ([]*models.MCPServer, error) {
+	key := models.RepositoryKey(repositoryURL)
+	if key == "" {
+		return nil, fmt.Errorf("%w: repository URL %q", ErrWebhookPayload, repositoryURL)
+	}
+
+	result, err := s.mcpRepo.ListByRepositoryKey(ctx, key, models.PageRequest{Limit: webhookMaxServers})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list MCP servers of the repository: %w", err)
+	}
+	if result.NextCursor != "" {
+		logger.WithFields(map[string]interface{}{
+			"repository":  key,
+			"max_servers": webhookMaxServers,
+		}).Warn("More MCP servers receive webhooks for the repository than are checked; the others are not built")
+	}
+	return result.Servers, nil
+}
+
+// queueBuild creates the deployment of a push for a server and enqueues its
+// build. A push that was already handled finds the deployment of the first
+// delivery and only enqueues its build if that delivery did not get to, or
+// requeues it if its build failed or was cancelled.
+func (s *WebhookService) queueBuild(ctx context.Context, server *models.MCPServer, deploymentID, branch, commitHash string) (models.WebhookBuild, error) {
+	build := models.WebhookBuild{ServerId: server.ServerId, DeploymentId: deploymentID}
+	fields := map[string]interface{}{
+		"server_id":     server.ServerId,
+		"deployment_id": build.DeploymentId,
+		"branch":        branch,
+		"commit_hash":   commitHash,
+	}
+
+	now := time.Now()
+	deployment := &models.Deployment{
+		ServerId:     server.ServerId,
+		DeploymentId: build.DeploymentId,
+		UserId:       server.UserId,
+		Branch:       branch,
+		CommitHash:   commitHash,
+		Status:       models.DeploymentStatusQueued,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := s.deploymentRepo.Create(ctx, deployment); errors.Is(err, repository.ErrAlreadyExists) {
+		existing, err := s.deploymentRepo.Get(ctx, server.ServerId, build.DeploymentId)
+		if err != nil {
+			return build, fmt.Errorf("failed to load deployment of a repeated push: %w", err)
+		}
+		switch existing.Status {
+		case models.DeploymentStatusQueued:
+		case models.DeploymentStatusFailed, models.DeploymentStatusCancelled:
+			// Pushing the commit again rebuilds it, like a retry with the Initiate
+			// Build endpoint. The write is conditional on the status read, so only
+			// one of several concurrent deliveries requeues it.
+			previous := existing.Status
+			existing.Status = models.DeploymentStatusQueued
+			existing.Stages = nil
+			existing.UpdatedAt = now
+			if err := s.deploymentRepo.Update(ctx, existing, previous); errors.Is(err, repository.ErrConflict) {
+				logger.WithFields(fields).Info("Webhook push ignored: deployment requeued concurrently")
+				build.Status = models.WebhookBuildDuplicate
+				build.Reason = "The deployment of the commit changed while it was being rebuilt"
+				return build, nil
+			} else if err != nil {
+				return build, fmt.Errorf("failed to requeue deployment: %w", err)
+			}
+			build.Reason = fmt.Sprintf("Rebuilding the commit after a %s build", previous)
+		default:
+			logger.WithFields(fields).Info("Webhook push ignored: commit already built for the branch")
+			build.Status = models.WebhookBuildDuplicate
+			build.Reason = fmt.Sprintf("The deployment of the commit for the branch is %s", existing.Status)
+			return build, nil
+		}
+	} else if err != nil {
+		return build, fmt.Errorf("failed to create deployment: %w", err)
+	}
+
+	err := s.jobQueue.Enqueue(ctx, &queue.BuildJob{
+		DeploymentID: build.DeploymentId,
+		ServerID:     server.ServerId,
+		UserID:       server.UserId,
+		Branch:       branch,
+		CommitHash:   commitHash,
+	})
+	if errors.Is(err, queue.ErrJobExists) {
+		logger.WithFields(fields).Info("Webhook push ignored: build already queued")
+		build.Status = models.WebhookBuildDuplicate
+		build.Reason = "A build of the commit is already queued or running"
+		return build, nil
+	}
+	if err != nil {
+		return build, fmt.Errorf("failed to queue build: %w", err)
+	}
+
+	logger.WithFields(fields).Info("Build queued by GitHub push")
+	build.Status = models.WebhookBuildQueued
+	return build, nil
+}
+
+// pushDeploymentID returns the ID of the deployment of a push of commit to
+// ref: the prefix, the abbreviated commit and a hash of ref and commit. It is
+// built from the signed payload rather than X-GitHub-Delivery, which the
+// signature does not cover, so a captured delivery cannot be replayed under a
+// new ID to build the same commit again.
+func pushDeploymentID(ref, commit string) string {
+	sum := sha256.Sum256([]byte(ref + "\x00" + commit))
+	return WebhookDeploymentPrefix + commit[:12] + "-" + hex.EncodeToString(sum[:8])
+}
+
+// validGitHubSignature reports whether signature is "sha256=" followed by the
+// hex HMAC-SHA256 of payload with secret. The comparison takes constant time.
+func validGitHubSignature(secret string, payload []byte, signature string) bool {
+	digest, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok {
+		return false
+	}
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(sum, mac.Sum(nil))
+}
+
+// autoBuildBranch reports whether pushes to branch are built. Patterns use
+// path.Match syntax, so "release/*" matches release/1.2 but not release/1/2.
+// Without patterns only the repository's default branch is built.
+func autoBuildBranch(patterns []string, branch, defaultBranch string) bool {
+	if len(patterns) == 0 {
+		return branch == defaultBranch
+	}
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, branch); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/queue"
+	"github.com/imyashkale/buildserver/internal/repository"
+)
+
+// webhookFixture is a webhook service over in-memory repositories and queue
+type webhookFixture struct {
+	service        *WebhookService
+	mcpRepo        *repository.MemoryMCPRepository
+	deploymentRepo *repository.MemoryDeploymentRepository
+	jobQueue       *queue.JobQueue
+}
+
+func newWebhookFixture(t *testing.T, servers ...*models.MCPServer) *webhookFixture {
+	t.Helper()
+	f := &webhookFixture{
+		mcpRepo:        repository.NewMemoryMCPRepository(),
+		deploymentRepo: repository.NewMemoryDeploymentRepository(),
+		jobQueue:       queue.NewJobQueue(10, queue.NewMemoryJobStore()),
+	}
+	t.Cleanup(f.jobQueue.Close)
+	for _, server := range servers {
+		if err := f.mcpRepo.Create(context.Background(), server); err != nil {
+			t.Fatalf("Failed to create server %s: %v", server.ServerId, err)
+		}
+	}
+	// fakeDecrypter returns secrets as stored
+	f.service = NewWebhookService(f.mcpRepo, f.deploymentRepo, fakeDecrypter{}, f.jobQueue)
+	return f
+}
+
+// webhookServer is an MCP server of github.com/acme/weather with a webhook secret
+func webhookServer(serverId, secret string, branches ...string) *models.MCPServer {
+	return &models.MCPServer{
+		ServerId:          serverId,
+		UserId:            "user-" + serverId,
+		Repository:        "https://github.com/acme/weather.git",
+		WebhookSecret:     secret,
+		AutoBuildBranches: branches,
+	}
+}
+
+// signedDelivery signs a payload the way GitHub does
+func signedDelivery(id, event, secret, payload string) GitHubDelivery {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return GitHubDelivery{
+		ID:        id,
+		Event:     event,
+		Signature: "sha256=" + hex.EncodeToString(mac.Sum(nil)),
+		Payload:   []byte(payload),
+	}
+}
+
+// pushPayload is a push of commit to ref of github.com/Acme/Weather
+func pushPayload(ref, commit string) string {
+	return fmt.Sprintf(`{"ref": %q, "after": %q, "deleted": false, "repository": {"html_url": "https://github.com/Acme/Weather", "default_branch": "main"}}`, ref, commit)
+}
+
+var pushCommit = fmt.Sprintf("%040x", 0xabc)
+
+// pushDeployment is the ID of the deployment of a push of pushCommit to main
+var pushDeployment = pushDeploymentID("refs/heads/main", pushCommit)
+
+func TestHandleGitHubDelivery_QueuesPushOnce(t *testing.T) {
+	f := newWebhookFixture(t, webhookServer("server-1", "s3cret"))
+	delivery := signedDelivery("delivery-1", GitHubEventPush, "s3cret", pushPayload("refs/heads/main", pushCommit))
+
+	response, err := f.service.HandleGitHubDelivery(context.Background(), delivery)
+	if err != nil {
+		t.Fatalf("HandleGitHubDelivery: %v", err)
+	}
+	if len(response.Builds) != 1 || response.Builds[0].Status != models.WebhookBuildQueued || response.Builds[0].DeploymentId != pushDeployment {
+		t.Fatalf("Builds = %+v, want one queued build", response.Builds)
+	}
+
+	deployment, err := f.deploymentRepo.Get(context.Background(), "server-1", pushDeployment)
+	if err != nil {
+		t.Fatalf("Deployment was not created: %v", err)
+	}
+	if deployment.Status != models.DeploymentStatusQueued || deployment.Branch != "main" || deployment.CommitHash != pushCommit || deployment.UserId != "user-server-1" {
+		t.Errorf("Deployment = %+v", deployment)
+	}
+	job := f.jobQueue.Dequeue()
+	if job.ID() != "server-1/"+pushDeployment || job.UserID != "user-server-1" || job.Branch != "main" || job.CommitHash != pushCommit {
+		t.Errorf("Job = %+v", job)
+	}
+
+	// A redelivery finds the queued job and builds nothing
+	assertDuplicate := func(again GitHubDelivery) {
+		t.Helper()
+		response, err := f.service.HandleGitHubDelivery(context.Background(), again)
+		if err != nil {
+			t.Fatalf("Delivery %s: %v", again.ID, err)
+		}
+		if len(response.Builds) != 1 || response.Builds[0].Status != models.WebhookBuildDuplicate || response.Builds[0].DeploymentId != pushDeployment {
+			t.Errorf("Delivery %s builds = %+v, want a duplicate", again.ID, response.Builds)
+		}
+		if len(response.Builds) == 1 && response.Builds[0].Reason == "" {
+			t.Errorf("Delivery %s reports no reason for the duplicate", again.ID)
+		}
+		if queued := len(f.jobQueue.Jobs()); queued != 0 {
+			t.Errorf("Delivery %s queued %d more jobs", again.ID, queued)
+		}
+	}
+	assertDuplicate(delivery)
+
+	// Once building, a replay of the signed payload under a new delivery ID finds
+	// the deployment and builds nothing either
+	deployment.Status = models.DeploymentStatusInProgress
+	if err := f.deploymentRepo.Update(context.Background(), deployment, models.DeploymentStatusQueued); err != nil {
+		t.Fatal(err)
+	}
+	replay := delivery
+	replay.ID = "delivery-2"
+	assertDuplicate(replay)
+}
+
+func TestHandleGitHubDelivery_RedeliveryQueuesUnqueuedDeployment(t *testing.T) {
+	f := newWebhookFixture(t, webhookServer("server-1", "s3cret"))
+	// The first attempt stored the deployment but did not enqueue its build
+	createDeployment(t, f.deploymentRepo, "server-1", pushDeployment)
+
+	delivery := signedDelivery("delivery-1", GitHubEventPush, "s3cret", pushPayload("refs/heads/main", pushCommit))
+	response, err := f.service.HandleGitHubDelivery(context.Background(), delivery)
+	if err != nil {
+		t.Fatalf("HandleGitHubDelivery: %v", err)
+	}
+	if len(response.Builds) != 1 || response.Builds[0].Status != models.WebhookBuildQueued {
+		t.Fatalf("Builds = %+v, want the build queued", response.Builds)
+	}
+	if queued := len(f.jobQueue.Jobs()); queued != 1 {
+		t.Errorf("Queued %d jobs, want 1", queued)
+	}
+}
+
+func TestHandleGitHubDelivery_RebuildsFailedOrCancelledPush(t *testing.T) {
+	for _, status := range []models.DeploymentStatus{models.DeploymentStatusFailed, models.DeploymentStatusCancelled} {
+		t.Run(string(status), func(t *testing.T) {
+			f := newWebhookFixture(t, webhookServer("server-1", "s3cret"))
+			// The first push of the commit was built without success
+			createDeployment(t, f.deploymentRepo, "server-1", pushDeployment)
+			_, err := repository.UpdateDeploymentWithRetry(context.Background(), f.deploymentRepo, "server-1", pushDeployment, func(deployment *models.Deployment) error {
+				deployment.Status = status
+				deployment.Stages = map[string]*models.BuildStageStatus{"clone": {Status: models.StageStatusFailed}}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			delivery := signedDelivery("delivery-2", GitHubEventPush, "s3cret", pushPayload("refs/heads/main", pushCommit))
+			response, err := f.service.HandleGitHubDelivery(context.Background(), delivery)
+			if err != nil {
+				t.Fatalf("HandleGitHubDelivery: %v", err)
+			}
+			if len(response.Builds) != 1 || response.Builds[0].Status != models.WebhookBuildQueued || response.Builds[0].Reason == "" {
+				t.Fatalf("Builds = %+v, want a queued rebuild with a reason", response.Builds)
+			}
+			deployment, _ := f.deploymentRepo.Get(context.Background(), "server-1", pushDeployment)
+			if deployment.Status != models.DeploymentStatusQueued || deployment.Stages != nil {
+				t.Errorf("Deployment = %+v, want it queued with its stages cleared", deployment)
+			}
+			if queued := len(f.jobQueue.Jobs()); queued != 1 {
+				t.Errorf("Queued %d jobs, want 1", queued)
+			}
+		})
+	}
+}
+
+func TestHandleGitHubDelivery_BranchRulesAndSecrets(t *testing.T) {
+	f := newWebhookFixture(t,
+		webhookServer("releases", "s3cret", "release/*"),
+		webhookServer("default-branch", "s3cret"),
+		webhookServer("other-secret", "different", "release/*"),
+		webhookServer("no-webhook", "", "release/*"),
+	)
+	delivery := signedDelivery("delivery-2", GitHubEventPush, "s3cret", pushPayload("refs/heads/release/1.2", pushCommit))
+
+	response, err := f.service.HandleGitHubDelivery(context.Background(), delivery)
+	if err != nil {
+		t.Fatalf("HandleGitHubDelivery: %v", err)
+	}
+
+	got := make(map[string]models.WebhookBuildStatus)
+	for _, build := range response.Builds {
+		got[build.ServerId] = build.Status
+	}
+	want := map[string]models.WebhookBuildStatus{
+		"releases":       models.WebhookBuildQueued,
+		"default-branch": models.WebhookBuildSkipped,
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Builds = %v, want %v", got, want)
+	}
+	if queued := len(f.jobQueue.Jobs()); queued != 1 {
+		t.Errorf("Queued %d jobs, want 1", queued)
+	}
+}
+
+func TestHandleGitHubDelivery_ChecksAtMostMaxServers(t *testing.T) {
+	var servers []*models.MCPServer
+	for i := range webhookMaxServers + 5 {
+		servers = append(servers, webhookServer(fmt.Sprintf("server-%02d", i), "s3cret"))
+	}
+	f := newWebhookFixture(t, servers...)
+	delivery := signedDelivery("d-1", GitHubEventPing, "s3cret", `{"repository": {"html_url": "https://github.com/acme/weather"}}`)
+
+	response, err := f.service.HandleGitHubDelivery(context.Background(), delivery)
+	if err != nil {
+		t.Fatalf("HandleGitHubDelivery: %v", err)
+	}
+	if len(response.Servers) != webhookMaxServers {
+		t.Errorf("Verified %d servers, want %d", len(response.Servers), webhookMaxServers)
+	}
+}
+
+func TestHandleGitHubDelivery_Rejects(t *testing.T) {
+	push := pushPayload("refs/heads/main", pushCommit)
+	tests := []struct {
+		name     string
+		delivery GitHubDelivery
+		want     error
+	}{
+		{name: "wrong secret", delivery: signedDelivery("d-1", GitHubEventPush, "guess", push), want: ErrWebhookSignature},
+		{name: "no signature", delivery: GitHubDelivery{ID: "d-1", Event: GitHubEventPush, Payload: []byte(push)}, want: ErrWebhookSignature},
+		{name: "sha1 signature", delivery: GitHubDelivery{ID: "d-1", Event: GitHubEventPush, Signature: "sha1=abc", Payload: []byte(push)}, want: ErrWebhookSignature},
+		{name: "no delivery ID", delivery: signedDelivery("", GitHubEventPush, "s3cret", push), want: ErrWebhookPayload},
+		{name: "malformed delivery ID", delivery: signedDelivery("../d-1", GitHubEventPush, "s3cret", push), want: ErrWebhookPayload},
+		{name: "invalid JSON", delivery: signedDelivery("d-1", GitHubEventPush, "s3cret", "{"), want: ErrWebhookPayload},
+		{name: "malformed commit", delivery: signedDelivery("d-1", GitHubEventPush, "s3cret", pushPayload("refs/heads/main", "HEAD")), want: ErrWebhookPayload},
+		{name: "organisation hook", delivery: signedDelivery("d-1", GitHubEventPing, "s3cret", `{"zen": "Keep it simple."}`), want: ErrWebhookPayload},
+		{
+			name:     "unknown repository",
+			delivery: signedDelivery("d-1", GitHubEventPush, "s3cret", `{"ref": "refs/heads/main", "repository": {"html_url": "https://github.com/acme/other"}}`),
+			want:     ErrWebhookNoServer,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newWebhookFixture(t, webhookServer("server-1", "s3cret"))
+
+			if _, err := f.service.HandleGitHubDelivery(context.Background(), tt.delivery); !errors.Is(err, tt.want) {
+				t.Fatalf("HandleGitHubDelivery error = %v, want %v", err, tt.want)
+			}
+			if queued := len(f.jobQueue.Jobs()); queued != 0 {
+				t.Errorf("Queued %d jobs for a rejected delivery", queued)
+			}
+		})
+	}
+}
+
+func TestHandleGitHubDelivery_BuildsNothing(t *testing.T) {
+	tests := []struct {
+		name     string
+		delivery GitHubDelivery
+		servers  []string
+	}{
+		{name: "ping", delivery: signedDelivery("d-1", GitHubEventPing, "s3cret", `{"zen": "Keep it simple.", "repository": {"html_url": "https://github.com/acme/weather"}}`), servers: []string{"server-1"}},
+		{name: "other event", delivery: GitHubDelivery{ID: "d-1", Event: "issues", Payload: []byte("{}")}},
+		{name: "tag push", delivery: signedDelivery("d-1", GitHubEventPush, "s3cret", pushPayload("refs/tags/v1.0.0", pushCommit)), servers: []string{"server-1"}},
+		{name: "branch deletion", delivery: signedDelivery("d-1", GitHubEventPush, "s3cret", pushPayload("refs/heads/main", zeroCommit)), servers: []string{"server-1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newWebhookFixture(t, webhookServer("server-1", "s3cret"))
+
+			response, err := f.service.HandleGitHubDelivery(context.Background(), tt.delivery)
+			if err != nil {
+				t.Fatalf("HandleGitHubDelivery: %v", err)
+			}
+			if response.Message == "" || len(response.Builds) != 0 || fmt.Sprint(response.Servers) != fmt.Sprint(tt.servers) {
+				t.Errorf("Response = %+v", response)
+			}
+			if queued := len(f.jobQueue.Jobs()); queued != 0 {
+				t.Errorf("Queued %d jobs", queued)
+			}
+		})
+	}
+}
+
+func TestPushDeploymentID(t *testing.T) {
+	id := pushDeploymentID("refs/heads/main", pushCommit)
+	if !deliveryIDPattern.MatchString(id) || id[:15] != "gh-"+pushCommit[:12] {
+		t.Errorf("pushDeploymentID = %q", id)
+	}
+	others := []string{
+		pushDeploymentID("refs/heads/develop", pushCommit),
+		pushDeploymentID("refs/heads/main", fmt.Sprintf("%040x", 0xdef)),
+	}
+	for _, other := range others {
+		if other == id {
+			t.Errorf("Another push has the deployment ID %q", id)
+		}
+	}
+}
+
+func TestAutoBuildBranch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		branch   string
+		want     bool
+	}{
+		{nil, "main", true},
+		{nil, "develop", false},
+		{[]string{"develop"}, "main", false},
+		{[]string{"main", "release/*"}, "release/1.2", true},
+		{[]string{"release/*"}, "release/1/2", false},
+		{[]string{"feature-["}, "feature-[", false},
+		{[]string{"*"}, "feature/x", false},
+		{[]string{"*", "*/*"}, "feature/x", true},
+	}
+	for _, tt := range tests {
+		if got := autoBuildBranch(tt.patterns, tt.branch, "main"); got != tt.want {
+			t.Errorf("autoBuildBranch(%q, %q) = %v, want %v", tt.patterns, tt.branch, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package services
+
+import "sync"
+
+// LogHub tracks the BuildLogger of every build running in this process so
+// that clients can follow a build's log while it is produced
+type LogHub struct {
+	mu      sync.RWMutex
+	loggers map[string]*BuildLogger
+}
+
+// NewLogHub creates an empty log hub
+func NewLogHub() *LogHub {
+	return &LogHub{
+		loggers: make(map[string]*BuildLogger),
+	}
+}
+
+// Register makes a build's logger available to followers
+func (h *LogHub) Register(serverID, deploymentID string, bl *BuildLogger) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.loggers[logHubKey(serverID, deploymentID)] = bl
+}
+
+// Unregister removes a build's logger, unless it has already been replaced by a newer build
+func (h *LogHub) Unregister(serverID, deploymentID string, bl *BuildLogger) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	key := logHubKey(serverID, deploymentID)
+	if h.loggers[key] == bl {
+		delete(h.loggers, key)
+	}
+}
+
+// Get returns the logger of a running build, or nil if the build is not running here
+func (h *LogHub) Get(serverID, deploymentID string) *BuildLogger {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.loggers[logHubKey(serverID, deploymentID)]
+}
+
+// logHubKey builds the map key for a deployment
+func logHubKey(serverID, deploymentID string) string {
+	return serverID + "/" + deploymentID
+}
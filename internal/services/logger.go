@@ -4,6 +4,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/imyashkale/buildserver/internal/logger"
 	"github.com/imyashkale/buildserver/internal/models"
 )
 
@@ -17,41 +18,166 @@ const (
 
 // BuildLogger handles structured logging for build operations
 type BuildLogger struct {
-	logs  []models.BuildLogEntry
-	mu    sync.Mutex
-	stage string
+	logs    []models.BuildLogEntry
+	mu      sync.Mutex
+	stage   string
+	attempt int
+
+	// Secrets of this build, masked in every entry before it is stored
+	redactor *logger.Redactor
+
+	// Live followers of the log and the final build status once finished
+	subscribers map[chan models.BuildLogEntry]struct{}
+	finished    bool
+	status      string
 }
 
 // NewBuildLogger creates a new build logger for a specific stage
 func NewBuildLogger() *BuildLogger {
 	return &BuildLogger{
-		logs: make([]models.BuildLogEntry, 0),
+		logs:        make([]models.BuildLogEntry, 0),
+		redactor:    logger.NewRedactor(),
+		subscribers: make(map[chan models.BuildLogEntry]struct{}),
 	}
 }
 
+// SetAttempt sets the build attempt recorded on every later entry
+func (bl *BuildLogger) SetAttempt(attempt int) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.attempt = attempt
+}
+
+// Attempt returns the build attempt the logger records entries for
+func (bl *BuildLogger) Attempt() int {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	return bl.attempt
+}
+
+// AddSecret registers values that must never appear in the build log
+func (bl *BuildLogger) AddSecret(values ...string) {
+	bl.redactor.Add(values...)
+}
+
+// Redact masks the build's secrets, and the globally registered ones, in text
+func (bl *BuildLogger) Redact(text string) string {
+	return logger.Redact(bl.redactor.Redact(text))
+}
+
 // LogInfo logs an info level message
 func (bl *BuildLogger) LogInfo(stage, message string) {
 	bl.log(stage, LevelInfo, message)
 }
 
+// LogWarning logs a warning level message
+func (bl *BuildLogger) LogWarning(stage, message string) {
+	bl.log(stage, LevelWarning, message)
+}
+
 // LogError logs an error level message
 func (bl *BuildLogger) LogError(stage, message string) {
 	bl.log(stage, LevelError, message)
 }
 
+// LogStep logs a Dockerfile step summary
+func (bl *BuildLogger) LogStep(stage, level, message string, step *models.BuildStep) {
+	bl.append(models.BuildLogEntry{
+		Timestamp: time.Now(),
+		Stage:     stage,
+		Level:     level,
+		Message:   message,
+		Step:      step,
+	})
+}
+
 // log is the internal method that adds a log entry
 func (bl *BuildLogger) log(stage, level, message string) {
-	bl.mu.Lock()
-	defer bl.mu.Unlock()
-
-	entry := models.BuildLogEntry{
+	bl.append(models.BuildLogEntry{
 		Timestamp: time.Now(),
 		Stage:     stage,
 		Level:     level,
 		Message:   message,
+	})
+}
+
+// append redacts an entry, numbers it, stores it and forwards it to subscribers
+func (bl *BuildLogger) append(entry models.BuildLogEntry) {
+	entry.Message = bl.Redact(entry.Message)
+	if entry.Step != nil {
+		step := *entry.Step
+		step.Instruction = bl.Redact(step.Instruction)
+		entry.Step = &step
 	}
 
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	entry.Attempt = bl.attempt
+	entry.Seq = len(bl.logs) + 1
 	bl.logs = append(bl.logs, entry)
+
+	for ch := range bl.subscribers {
+		select {
+		case ch <- entry:
+		default:
+			// Drop subscribers that cannot keep up; they resubscribe and replay
+			delete(bl.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the entries logged so far and a channel that receives
+// every later entry. The channel is closed when the build finishes, when the
+// subscriber falls more than buffer entries behind, or when unsubscribe is called.
+func (bl *BuildLogger) Subscribe(buffer int) ([]models.BuildLogEntry, <-chan models.BuildLogEntry, func()) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	logsCopy := make([]models.BuildLogEntry, len(bl.logs))
+	copy(logsCopy, bl.logs)
+
+	ch := make(chan models.BuildLogEntry, buffer)
+	if bl.finished {
+		close(ch)
+		return logsCopy, ch, func() {}
+	}
+
+	bl.subscribers[ch] = struct{}{}
+	unsubscribe := func() {
+		bl.mu.Lock()
+		defer bl.mu.Unlock()
+		if _, ok := bl.subscribers[ch]; ok {
+			delete(bl.subscribers, ch)
+			close(ch)
+		}
+	}
+	return logsCopy, ch, unsubscribe
+}
+
+// Finish records the final build status and closes all subscriber channels
+func (bl *BuildLogger) Finish(status string) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	if bl.finished {
+		return
+	}
+	bl.finished = true
+	bl.status = status
+
+	for ch := range bl.subscribers {
+		delete(bl.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Status returns the final build status and whether the build has finished
+func (bl *BuildLogger) Status() (string, bool) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	return bl.status, bl.finished
 }
 
 // GetLogs returns all logged entries
@@ -65,33 +191,67 @@ func (bl *BuildLogger) GetLogs() []models.BuildLogEntry {
 	return logsCopy
 }
 
+// GetLogsFrom returns the entries logged after the first offset entries
+func (bl *BuildLogger) GetLogsFrom(offset int) []models.BuildLogEntry {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+
+	if offset >= len(bl.logs) {
+		return []models.BuildLogEntry{}
+	}
+	logsCopy := make([]models.BuildLogEntry, len(bl.logs)-offset)
+	copy(logsCopy, bl.logs[offset:])
+	return logsCopy
+}
+
+// GetTail returns the last n entries, truncated to the size limit
+func (bl *BuildLogger) GetTail(n int) []models.BuildLogEntry {
+	logs := bl.GetLogs()
+	if len(logs) > n {
+		logs = logs[len(logs)-n:]
+	}
+	return limitLogSize(logs)
+}
+
 // GetLogsWithSizeLimit returns logs but truncates if they exceed the size limit
 // This prevents DynamoDB items from exceeding their size limits
 func (bl *BuildLogger) GetLogsWithSizeLimit() []models.BuildLogEntry {
-	logs := bl.GetLogs()
+	return limitLogSize(bl.GetLogs())
+}
 
+// limitLogSize keeps the newest entries that fit in LogSizeLimit, preceded by
+// a truncation notice if anything was dropped. The notice takes the sequence
+// number of the last dropped entry, so log followers that already saw that
+// entry skip it.
+func limitLogSize(logs []models.BuildLogEntry) []models.BuildLogEntry {
 	// Estimate size (rough calculation)
 	var totalSize int
-	var result []models.BuildLogEntry
+	first := len(logs)
 
-	for _, log := range logs {
+	for first > 0 {
 		// Rough size estimation: timestamp (25) + stage (50) + level (10) + message (len) + overhead (50)
-		entrySize := 135 + len(log.Message)
+		entrySize := 135 + len(logs[first-1].Message)
 		if totalSize+entrySize > LogSizeLimit {
-			// Add a truncation notice
-			result = append(result, models.BuildLogEntry{
-				Timestamp: time.Now(),
-				Stage:     "system",
-				Level:     LevelWarning,
-				Message:   "Log output exceeded size limit. Older logs truncated.",
-			})
 			break
 		}
-		result = append(result, log)
 		totalSize += entrySize
+		first--
+	}
+
+	if first == 0 {
+		return logs
 	}
 
-	return result
+	result := make([]models.BuildLogEntry, 0, len(logs)-first+1)
+	result = append(result, models.BuildLogEntry{
+		Timestamp: logs[first].Timestamp,
+		Stage:     "system",
+		Level:     LevelWarning,
+		Message:   "Log output exceeded size limit. Older logs truncated.",
+		Attempt:   logs[first].Attempt,
+		Seq:       max(logs[first].Seq-1, 0),
+	})
+	return append(result, logs[first:]...)
 }
 
 // Clear clears all logs
@@ -100,3 +260,27 @@ func (bl *BuildLogger) Clear() {
 	defer bl.mu.Unlock()
 	bl.logs = make([]models.BuildLogEntry, 0)
 }
+
+// redactedError carries an error message with secrets masked. The original
+// error stays reachable for errors.Is and errors.As.
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
+
+// redactError masks the build's secrets in an error message
+func redactError(bl *BuildLogger, err error) error {
+	message := bl.Redact(err.Error())
+	if message == err.Error() {
+		return err
+	}
+	return &redactedError{message: message, err: err}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// TestBuildLogger_RedactsSecretsSplitAcrossLines feeds docker output that
+// prints a secret over two lines and verifies neither part is stored
+func TestBuildLogger_RedactsSecretsSplitAcrossLines(t *testing.T) {
+	const secret = "s3cr3t-env-value-0123456789"
+
+	bl := NewBuildLogger()
+	bl.AddSecret(secret)
+
+	parser := newDockerOutputParser(bl, "build_image")
+	output := "#5 [2/3] RUN echo $API_KEY\n" +
+		"#5 0.231 " + secret[:10] + "\n" +
+		"#5 0.232 " + secret[10:] + "\n" +
+		"#5 DONE 0.3s\n"
+	if err := parser.Consume(strings.NewReader(output), false); err != nil {
+		t.Fatalf("Consume() error = %v", err)
+	}
+
+	logs := bl.GetLogs()
+	for _, entry := range logs {
+		if strings.Contains(entry.Message, secret[:10]) || strings.Contains(entry.Message, secret[10:]) {
+			t.Errorf("build log leaked part of the secret: %q", entry.Message)
+		}
+	}
+	if len(logs) != 3 || logs[0].Message != logger.RedactedText || logs[1].Message != logger.RedactedText {
+		t.Errorf("unexpected log entries: %+v", logs)
+	}
+}
+
+// TestBuildLogger_RedactsSubscribersAndErrors verifies that live followers
+// only see masked entries and that errors keep their identity
+func TestBuildLogger_RedactsSubscribersAndErrors(t *testing.T) {
+	const token = "gho_0123456789abcdefghij"
+
+	bl := NewBuildLogger()
+	bl.AddSecret(token)
+
+	_, entries, unsubscribe := bl.Subscribe(4)
+	defer unsubscribe()
+
+	bl.LogStep("build_image", LevelInfo, "Step 1/1: RUN git clone https://"+token+"@github.com/org/repo", &models.BuildStep{
+		Number:      1,
+		Total:       1,
+		Instruction: "RUN git clone https://" + token + "@github.com/org/repo",
+	})
+
+	entry := <-entries
+	if strings.Contains(entry.Message, token) || strings.Contains(entry.Step.Instruction, token) {
+		t.Errorf("subscriber received an unmasked entry: %+v", entry)
+	}
+
+	cause := errors.New("clone https://" + token + "@github.com failed")
+	err := redactError(bl, cause)
+	if strings.Contains(err.Error(), token) {
+		t.Errorf("error message leaked the token: %q", err)
+	}
+	if !errors.Is(err, cause) {
+		t.Error("redacted error no longer wraps the original error")
+	}
+}
+
+// TestBuildLogger_NumbersEntries verifies that entries keep their sequence
+// number when the log is cut to the size limit, and that the truncation
+// notice takes the number of the last dropped entry
+func TestBuildLogger_NumbersEntries(t *testing.T) {
+	bl := NewBuildLogger()
+	bl.SetAttempt(2)
+	for i := 0; i < 5; i++ {
+		bl.LogInfo("build_image", strings.Repeat("x", LogSizeLimit/4))
+	}
+
+	logs := bl.GetLogsWithSizeLimit()
+	if len(logs) != 4 {
+		t.Fatalf("Size-limited log has %d entries, want a notice and 3 entries", len(logs))
+	}
+	for i, entry := range logs {
+		if entry.Attempt != 2 || entry.Seq != i+2 {
+			t.Errorf("Entry %d is attempt %d seq %d, want attempt 2 seq %d", i, entry.Attempt, entry.Seq, i+2)
+		}
+	}
+}
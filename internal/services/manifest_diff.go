@@ -0,0 +1,335 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// toolSchema is the part of a tool's input JSON Schema the comparison looks at
+type toolSchema struct {
+	Type       json.RawMessage        `json:"type"` // a type name or a list of them
+	Properties map[string]*toolSchema `json:"properties"`
+	Required   []string               `json:"required"`
+	Items      *toolSchema            `json:"items"`
+	Enum       []json.RawMessage      `json:"enum"`
+}
+
+// CompareManifests lists what changed from the base manifest to the head
+// manifest, breaking changes first. A change is breaking when a client
+// written against base may fail against head: a tool, resource, prompt or
+// parameter was removed, a parameter became required, or a parameter
+// accepts fewer types or enum values. Output schemas are not compared.
+func CompareManifests(base, head *models.MCPManifest) []models.ManifestChange {
+	var changes []models.ManifestChange
+
+	baseTools := make(map[string]models.MCPTool, len(base.Tools))
+	for _, tool := range base.Tools {
+		baseTools[tool.Name] = tool
+	}
+	headTools := make(map[string]models.MCPTool, len(head.Tools))
+	for _, tool := range head.Tools {
+		headTools[tool.Name] = tool
+	}
+	for _, name := range unionKeys(baseTools, headTools) {
+		baseTool, inBase := baseTools[name]
+		headTool, inHead := headTools[name]
+		switch {
+		case !inHead:
+			changes = append(changes, models.ManifestChange{Kind: models.ManifestChangeToolRemoved, Breaking: true, Tool: name,
+				Message: fmt.Sprintf("Tool %s was removed", name)})
+		case !inBase:
+			changes = append(changes, models.ManifestChange{Kind: models.ManifestChangeToolAdded, Tool: name,
+				Message: fmt.Sprintf("Tool %s was added", name)})
+		default:
+			diff := schemaDiff{tool: name}
+			diff.compare("", parseToolSchema(baseTool.InputSchema), parseToolSchema(headTool.InputSchema))
+			changes = append(changes, diff.changes...)
+		}
+	}
+
+	baseResources := make(map[string]models.MCPResource, len(base.Resources))
+	for _, resource := range base.Resources {
+		baseResources[resource.URI] = resource
+	}
+	headResources := make(map[string]models.MCPResource, len(head.Resources))
+	for _, resource := range head.Resources {
+		headResources[resource.URI] = resource
+	}
+	for _, uri := range unionKeys(baseResources, headResources) {
+		if _, ok := headResources[uri]; !ok {
+			changes = append(changes, models.ManifestChange{Kind: models.ManifestChangeResourceRemoved, Breaking: true, Resource: uri,
+				Message: fmt.Sprintf("Resource %s was removed", uri)})
+		} else if _, ok := baseResources[uri]; !ok {
+			changes = append(changes, models.ManifestChange{Kind: models.ManifestChangeResourceAdded, Resource: uri,
+				Message: fmt.Sprintf("Resource %s was added", uri)})
+		}
+	}
+
+	basePrompts := make(map[string]models.MCPPrompt, len(base.Prompts))
+	for _, prompt := range base.Prompts {
+		basePrompts[prompt.Name] = prompt
+	}
+	headPrompts := make(map[string]models.MCPPrompt, len(head.Prompts))
+	for _, prompt := range head.Prompts {
+		headPrompts[prompt.Name] = prompt
+	}
+	for _, name := range unionKeys(basePrompts, headPrompts) {
+		basePrompt, inBase := basePrompts[name]
+		headPrompt, inHead := headPrompts[name]
+		switch {
+		case !inHead:
+			changes = append(changes, models.ManifestChange{Kind: models.ManifestChangePromptRemoved, Breaking: true, Prompt: name,
+				Message: fmt.Sprintf("Prompt %s was removed", name)})
+		case !inBase:
+			changes = append(changes, models.ManifestChange{Kind: models.ManifestChangePromptAdded, Prompt: name,
+				Message: fmt.Sprintf("Prompt %s was added", name)})
+		default:
+			changes = append(changes, comparePromptArguments(basePrompt, headPrompt)...)
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Breaking && !changes[j].Breaking
+	})
+	return changes
+}
+
+// comparePromptArguments lists the argument changes of a prompt found in both manifests
+func comparePromptArguments(base, head models.MCPPrompt) []models.ManifestChange {
+	baseArgs := make(map[string]models.MCPPromptArgument, len(base.Arguments))
+	for _, argument := range base.Arguments {
+		baseArgs[argument.Name] = argument
+	}
+	headArgs := make(map[string]models.MCPPromptArgument, len(head.Arguments))
+	for _, argument := range head.Arguments {
+		headArgs[argument.Name] = argument
+	}
+
+	var changes []models.ManifestChange
+	for _, name := range unionKeys(baseArgs, headArgs) {
+		baseArg, inBase := baseArgs[name]
+		headArg, inHead := headArgs[name]
+		change := models.ManifestChange{Prompt: head.Name, Path: name}
+		switch {
+		case !inHead:
+			change.Kind, change.Breaking = models.ManifestChangeParameterRemoved, true
+			change.Message = fmt.Sprintf("Argument %s of prompt %s was removed", name, head.Name)
+		case headArg.Required && (!inBase || !baseArg.Required):
+			change.Kind, change.Breaking = models.ManifestChangeParameterRequired, true
+			change.Message = fmt.Sprintf("Argument %s of prompt %s is now required", name, head.Name)
+		case !inBase:
+			change.Kind = models.ManifestChangeParameterAdded
+			change.Message = fmt.Sprintf("Optional argument %s was added to prompt %s", name, head.Name)
+		case baseArg.Required && !headArg.Required:
+			change.Kind = models.ManifestChangeParameterOptional
+			change.Message = fmt.Sprintf("Argument %s of prompt %s is now optional", name, head.Name)
+		default:
+			continue
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// schemaDiff collects the changes between two input schemas of a tool
+type schemaDiff struct {
+	tool    string
+	changes []models.ManifestChange
+}
+
+// add records a change to the parameter at path
+func (d *schemaDiff) add(kind models.ManifestChangeKind, breaking bool, path, format string, args ...interface{}) {
+	d.changes = append(d.changes, models.ManifestChange{
+		Kind:     kind,
+		Breaking: breaking,
+		Tool:     d.tool,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// compare walks the schemas of the value at path, which is "" for the
+// arguments object itself. A nil schema accepts anything.
+func (d *schemaDiff) compare(path string, base, head *toolSchema) {
+	if base == nil {
+		base = &toolSchema{}
+	}
+	if head == nil {
+		head = &toolSchema{}
+	}
+
+	baseTypes, headTypes := base.types(), head.types()
+	switch {
+	case !acceptsTypes(headTypes, baseTypes):
+		d.add(models.ManifestChangeTypeNarrowed, true, path, "%s of tool %s accepts %s instead of %s",
+			d.describe(path), d.tool, describeTypes(headTypes), describeTypes(baseTypes))
+	case !acceptsTypes(baseTypes, headTypes):
+		d.add(models.ManifestChangeTypeWidened, false, path, "%s of tool %s accepts %s instead of %s",
+			d.describe(path), d.tool, describeTypes(headTypes), describeTypes(baseTypes))
+	}
+
+	removed, added := enumDifference(base.Enum, head.Enum)
+	switch {
+	case base.Enum == nil && head.Enum != nil:
+		d.add(models.ManifestChangeTypeNarrowed, true, path, "%s of tool %s is now limited to %s",
+			d.describe(path), d.tool, strings.Join(added, ", "))
+	case len(removed) > 0 && head.Enum != nil:
+		d.add(models.ManifestChangeTypeNarrowed, true, path, "%s of tool %s no longer accepts %s",
+			d.describe(path), d.tool, strings.Join(removed, ", "))
+	case head.Enum == nil && base.Enum != nil, len(added) > 0:
+		d.add(models.ManifestChangeTypeWidened, false, path, "%s of tool %s accepts more values",
+			d.describe(path), d.tool)
+	}
+
+	baseRequired, headRequired := stringSet(base.Required), stringSet(head.Required)
+	for _, name := range unionKeys(base.Properties, head.Properties) {
+		baseProperty, inBase := base.Properties[name]
+		headProperty, inHead := head.Properties[name]
+		property := joinPath(path, name)
+		switch {
+		case !inHead:
+			d.add(models.ManifestChangeParameterRemoved, true, property, "Parameter %s was removed from tool %s", property, d.tool)
+			continue
+		case headRequired[name] && (!inBase || !baseRequired[name]):
+			d.add(models.ManifestChangeParameterRequired, true, property, "Parameter %s of tool %s is now required", property, d.tool)
+		case !inBase:
+			d.add(models.ManifestChangeParameterAdded, false, property, "Optional parameter %s was added to tool %s", property, d.tool)
+		case baseRequired[name] && !headRequired[name]:
+			d.add(models.ManifestChangeParameterOptional, false, property, "Parameter %s of tool %s is now optional", property, d.tool)
+		}
+		if inBase {
+			d.compare(property, baseProperty, headProperty)
+		}
+	}
+
+	if base.Items != nil || head.Items != nil {
+		d.compare(path+"[]", base.Items, head.Items)
+	}
+}
+
+// describe names the value at path in messages
+func (d *schemaDiff) describe(path string) string {
+	if path == "" {
+		return "The arguments object"
+	}
+	return "Parameter " + path
+}
+
+// parseToolSchema reads an input schema. Schemas that cannot be read are
+// treated as accepting anything, so they never produce changes of their own.
+func parseToolSchema(raw json.RawMessage) *toolSchema {
+	if len(raw) == 0 {
+		return nil
+	}
+	var schema toolSchema
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return nil
+	}
+	return &schema
+}
+
+// types returns the JSON types the schema accepts, or nil for any type
+func (s *toolSchema) types() []string {
+	if len(s.Type) == 0 {
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(s.Type, &name); err == nil {
+		return []string{name}
+	}
+	var names []string
+	json.Unmarshal(s.Type, &names)
+	return names
+}
+
+// acceptsTypes reports whether a schema typed accepting takes every value a
+// schema typed accepted takes. nil means any type; integers are numbers.
+func acceptsTypes(accepting, accepted []string) bool {
+	if accepting == nil {
+		return true
+	}
+	if accepted == nil {
+		return false
+	}
+	set := stringSet(accepting)
+	for _, name := range accepted {
+		if !set[name] && !(name == "integer" && set["number"]) {
+			return false
+		}
+	}
+	return true
+}
+
+// describeTypes formats a list of types for messages
+func describeTypes(types []string) string {
+	if types == nil {
+		return "any type"
+	}
+	return strings.Join(types, " or ")
+}
+
+// enumDifference returns the enum values only base allows and those only head allows
+func enumDifference(base, head []json.RawMessage) (removed, added []string) {
+	baseValues := make(map[string]bool, len(base))
+	for _, value := range base {
+		baseValues[compactJSON(value)] = true
+	}
+	headValues := make(map[string]bool, len(head))
+	for _, value := range head {
+		headValues[compactJSON(value)] = true
+	}
+	for _, value := range unionKeys(baseValues, headValues) {
+		if !headValues[value] {
+			removed = append(removed, value)
+		} else if !baseValues[value] {
+			added = append(added, value)
+		}
+	}
+	return removed, added
+}
+
+// compactJSON returns value without insignificant whitespace
+func compactJSON(value json.RawMessage) string {
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, value); err != nil {
+		return string(value)
+	}
+	return compacted.String()
+}
+
+// joinPath appends a property name to a dotted parameter path
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// stringSet returns the set of names
+func stringSet(names []string) map[string]bool {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return set
+}
+
+// unionKeys returns the keys of both maps, sorted
+func unionKeys[V1, V2 any](a map[string]V1, b map[string]V2) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// forecastSchema is the input schema of get_forecast in the base manifest
+const forecastSchema = `{
+	"type": "object",
+	"properties": {
+		"city": {"type": "string"},
+		"days": {"type": "integer"},
+		"units": {"type": "string", "enum": ["metric", "imperial"]},
+		"location": {"type": "object", "properties": {"lat": {"type": "number"}, "lon": {"type": "number"}}},
+		"hours": {"type": "array", "items": {"type": ["integer", "string"]}}
+	},
+	"required": ["city"]
+}`
+
+// toolManifest returns a manifest with get_forecast taking schema
+func toolManifest(schema string) *models.MCPManifest {
+	return &models.MCPManifest{Tools: []models.MCPTool{{Name: "get_forecast", InputSchema: json.RawMessage(schema)}}}
+}
+
+// describeChanges formats changes as "kind path breaking" lines for comparison
+func describeChanges(changes []models.ManifestChange) string {
+	lines := make([]string, 0, len(changes))
+	for _, change := range changes {
+		lines = append(lines, fmt.Sprintf("%s %s%s%s %s %t", change.Kind, change.Tool, change.Resource, change.Prompt, change.Path, change.Breaking))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestCompareManifests(t *testing.T) {
+	tests := []struct {
+		name       string
+		base, head *models.MCPManifest
+		want       []string
+	}{
+		{
+			name: "unchanged",
+			base: toolManifest(forecastSchema),
+			head: toolManifest(strings.ReplaceAll(forecastSchema, "\n", " ")),
+		},
+		{
+			name: "tool removed and added",
+			base: toolManifest(forecastSchema),
+			head: &models.MCPManifest{Tools: []models.MCPTool{{Name: "get_alerts"}}},
+			want: []string{"tool_removed get_forecast  true", "tool_added get_alerts  false"},
+		},
+		{
+			name: "new required and optional parameters",
+			base: toolManifest(forecastSchema),
+			head: toolManifest(strings.NewReplacer(
+				`"city": {"type": "string"},`, `"city": {"type": "string"}, "country": {"type": "string"}, "lang": {"type": "string"},`,
+				`"required": ["city"]`, `"required": ["city", "country"]`,
+			).Replace(forecastSchema)),
+			want: []string{"parameter_required get_forecast country true", "parameter_added get_forecast lang false"},
+		},
+		{
+			name: "parameter becomes required",
+			base: toolManifest(forecastSchema),
+			head: toolManifest(strings.Replace(forecastSchema, `"required": ["city"]`, `"required": ["days", "city", "country"]`, 1)),
+			// country is not a property, so only days is reported
+			want: []string{"parameter_required get_forecast days true"},
+		},
+		{
+			name: "parameter becomes optional",
+			base: toolManifest(forecastSchema),
+			head: toolManifest(strings.Replace(forecastSchema, `"required": ["city"]`, `"required": []`, 1)),
+			want: []string{"parameter_optional get_forecast city false"},
+		},
+		{
+			name: "parameter removed",
+			base: toolManifest(forecastSchema),
+			head: toolManifest(strings.Replace(forecastSchema, `"days": {"type": "integer"},`, "", 1)),
+			want: []string{"parameter_removed get_forecast days true"},
+		},
+		{
+			name: "types narrowed",
+			base: toolManifest(forecastSchema),
+			head: toolManifest(strings.NewReplacer(
+				`"lat": {"type": "number"}`, `"lat": {"type": "integer"}`,
+				`"items": {"type": ["integer", "string"]}`, `"items": {"type": "string"}`,
+				`"enum": ["metric", "imperial"]`, `"enum": ["metric"]`,
+			).Replace(forecastSchema)),
+			want: []string{
+				"type_narrowed get_forecast hours[] true",
+				"type_narrowed get_forecast location.lat true",
+				"type_narrowed get_forecast units true",
+			},
+		},
+		{
+			name: "types widened",
+			base: toolManifest(forecastSchema),
+			head: toolManifest(strings.NewReplacer(
+				`"days": {"type": "integer"}`, `"days": {"type": "number"}`,
+				`"enum": ["metric", "imperial"]`, `"enum": ["metric", "imperial", "kelvin"]`,
+			).Replace(forecastSchema)),
+			want: []string{"type_widened get_forecast days false", "type_widened get_forecast units false"},
+		},
+		{
+			name: "untyped parameter gets a type and an enum",
+			base: toolManifest(`{"type": "object", "properties": {"query": {}}}`),
+			head: toolManifest(`{"type": "object", "properties": {"query": {"type": "string", "enum": ["a"]}}}`),
+			want: []string{"type_narrowed get_forecast query true", "type_narrowed get_forecast query true"},
+		},
+		{
+			name: "resources and prompts",
+			base: &models.MCPManifest{
+				Resources: []models.MCPResource{{URI: "weather://stations"}},
+				Prompts: []models.MCPPrompt{
+					{Name: "summarize", Arguments: []models.MCPPromptArgument{{Name: "city", Required: true}, {Name: "style"}, {Name: "days"}}},
+					{Name: "compare"},
+				},
+			},
+			head: &models.MCPManifest{
+				Resources: []models.MCPResource{{URI: "weather://radar"}},
+				Prompts: []models.MCPPrompt{
+					{Name: "summarize", Arguments: []models.MCPPromptArgument{{Name: "city"}, {Name: "style", Required: true}, {Name: "tone"}}},
+				},
+			},
+			want: []string{
+				"resource_removed weather://stations  true",
+				"prompt_removed compare  true",
+				"parameter_removed summarize days true",
+				"parameter_required summarize style true",
+				"resource_added weather://radar  false",
+				"parameter_optional summarize city false",
+				"parameter_added summarize tone false",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := describeChanges(CompareManifests(tt.base, tt.head))
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("changes:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
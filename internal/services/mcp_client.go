@@ -0,0 +1,437 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// mcpProtocolVersion is the MCP revision the verifier asks servers to speak
+const mcpProtocolVersion = "2025-06-18"
+
+// mcpMaxListPages bounds how many pages of a paginated list are read
+const mcpMaxListPages = 100
+
+// mcpMaxMessageSize bounds a single JSON-RPC message read from a server
+const mcpMaxMessageSize = 8 << 20
+
+// The wire types below follow the MCP schema and convert to their models
+// counterparts, which carry the API's field names.
+
+// mcpTool is a tool as returned by tools/list
+type mcpTool struct {
+	Name         string          `json:"name"`
+	Title        string          `json:"title,omitempty"`
+	Description  string          `json:"description,omitempty"`
+	InputSchema  json.RawMessage `json:"inputSchema,omitempty"`
+	OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
+}
+
+// mcpResource is a resource as returned by resources/list
+type mcpResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+// mcpPrompt is a prompt as returned by prompts/list
+type mcpPrompt struct {
+	Name        string `json:"name"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Arguments   []struct {
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		Required    bool   `json:"required,omitempty"`
+	} `json:"arguments,omitempty"`
+}
+
+// jsonrpcMessage is a JSON-RPC 2.0 request, notification or response
+type jsonrpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  interface{}     `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *jsonrpcError   `json:"error,omitempty"`
+}
+
+// jsonrpcError is the error of a JSON-RPC response
+type jsonrpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *jsonrpcError) Error() string {
+	return fmt.Sprintf("MCP error %d: %s", e.Code, e.Message)
+}
+
+// mcpTransport carries JSON-RPC messages to one MCP server
+type mcpTransport interface {
+	// call sends a request and waits for its response
+	call(ctx context.Context, method string, params interface{}) (json.RawMessage, error)
+
+	// notify sends a notification
+	notify(ctx context.Context, method string, params interface{}) error
+}
+
+// mcpHandshake initializes an MCP session and lists what the server offers.
+// Lists are only requested for the capabilities the server advertised.
+func mcpHandshake(ctx context.Context, transport mcpTransport) (*models.MCPManifest, error) {
+	raw, err := transport.call(ctx, "initialize", map[string]interface{}{
+		"protocolVersion": mcpProtocolVersion,
+		"capabilities":    map[string]interface{}{},
+		"clientInfo":      map[string]string{"name": "mhive-buildserver", "version": "1.0.0"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("initialize failed: %w", err)
+	}
+
+	var initialized struct {
+		ProtocolVersion string `json:"protocolVersion"`
+		Capabilities    struct {
+			Tools     json.RawMessage `json:"tools"`
+			Resources json.RawMessage `json:"resources"`
+			Prompts   json.RawMessage `json:"prompts"`
+		} `json:"capabilities"`
+		ServerInfo struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"serverInfo"`
+	}
+	if err := json.Unmarshal(raw, &initialized); err != nil {
+		return nil, fmt.Errorf("invalid initialize result: %w", err)
+	}
+	if initialized.ProtocolVersion == "" {
+		return nil, errors.New("invalid initialize result: no protocolVersion")
+	}
+	if err := transport.notify(ctx, "notifications/initialized", nil); err != nil {
+		return nil, fmt.Errorf("notifications/initialized failed: %w", err)
+	}
+
+	manifest := &models.MCPManifest{
+		ProtocolVersion: initialized.ProtocolVersion,
+		ServerName:      initialized.ServerInfo.Name,
+		ServerVersion:   initialized.ServerInfo.Version,
+	}
+	if advertised(initialized.Capabilities.Tools) {
+		var tools []mcpTool
+		if err := mcpList(ctx, transport, "tools/list", "tools", &tools); err != nil {
+			return nil, err
+		}
+		for _, tool := range tools {
+			manifest.Tools = append(manifest.Tools, models.MCPTool(tool))
+		}
+	}
+	if advertised(initialized.Capabilities.Resources) {
+		var resources []mcpResource
+		if err := mcpList(ctx, transport, "resources/list", "resources", &resources); err != nil {
+			return nil, err
+		}
+		for _, resource := range resources {
+			manifest.Resources = append(manifest.Resources, models.MCPResource(resource))
+		}
+	}
+	if advertised(initialized.Capabilities.Prompts) {
+		var prompts []mcpPrompt
+		if err := mcpList(ctx, transport, "prompts/list", "prompts", &prompts); err != nil {
+			return nil, err
+		}
+		for _, prompt := range prompts {
+			converted := models.MCPPrompt{Name: prompt.Name, Title: prompt.Title, Description: prompt.Description}
+			for _, argument := range prompt.Arguments {
+				converted.Arguments = append(converted.Arguments, models.MCPPromptArgument(argument))
+			}
+			manifest.Prompts = append(manifest.Prompts, converted)
+		}
+	}
+	return manifest, nil
+}
+
+// advertised reports whether a capability is present in the initialize result
+func advertised(capability json.RawMessage) bool {
+	return len(capability) > 0 && string(capability) != "null"
+}
+
+// mcpList reads every page of a list method into items, a pointer to a slice
+func mcpList[T any](ctx context.Context, transport mcpTransport, method, field string, items *[]T) error {
+	cursor := ""
+	for page := 0; page < mcpMaxListPages; page++ {
+		var params interface{}
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		raw, err := transport.call(ctx, method, params)
+		if err != nil {
+			return fmt.Errorf("%s failed: %w", method, err)
+		}
+
+		var result map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return fmt.Errorf("invalid %s result: %w", method, err)
+		}
+		var pageItems []T
+		if err := json.Unmarshal(result[field], &pageItems); err != nil {
+			return fmt.Errorf("invalid %s result: %w", method, err)
+		}
+		*items = append(*items, pageItems...)
+
+		cursor = ""
+		if next, ok := result["nextCursor"]; ok {
+			json.Unmarshal(next, &cursor)
+		}
+		if cursor == "" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s returned more than %d pages", method, mcpMaxListPages)
+}
+
+// stdioTransport speaks newline-delimited JSON-RPC over a server's stdin and stdout
+type stdioTransport struct {
+	mu       sync.Mutex // serializes writes to stdin
+	stdin    io.Writer
+	messages chan jsonrpcMessage
+	stop     chan struct{} // closed by close to stop the reader
+	nextID   int64
+
+	// exited is closed with exitErr set once the server's stdout is closed
+	exited  chan struct{}
+	exitErr error
+}
+
+// newStdioTransport reads messages from stdout until it is closed
+func newStdioTransport(stdin io.Writer, stdout io.Reader) *stdioTransport {
+	t := &stdioTransport{
+		stdin:    stdin,
+		messages: make(chan jsonrpcMessage),
+		stop:     make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+	go t.read(stdout)
+	return t
+}
+
+// read decodes stdout line by line. Requests from the server are answered
+// here so the server never waits on the client.
+func (t *stdioTransport) read(stdout io.Reader) {
+	defer close(t.exited)
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), mcpMaxMessageSize)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var message jsonrpcMessage
+		if err := json.Unmarshal(line, &message); err != nil {
+			t.exitErr = fmt.Errorf("server wrote a non-JSON-RPC line to stdout: %.200s", line)
+			return
+		}
+		if message.Method != "" {
+			if message.ID != nil {
+				// Replying in the background keeps stdout drained while the
+				// server is busy reading an earlier request
+				go t.reply(message)
+			}
+			continue
+		}
+		select {
+		case t.messages <- message:
+		case <-t.stop:
+			return
+		}
+	}
+	t.exitErr = scanner.Err()
+	if t.exitErr == nil {
+		t.exitErr = io.EOF
+	}
+}
+
+// close stops the reader. The server's stdout is still drained by the caller
+// closing it.
+func (t *stdioTransport) close() {
+	close(t.stop)
+}
+
+// reply answers a request from the server: pings succeed, anything else is unsupported
+func (t *stdioTransport) reply(request jsonrpcMessage) {
+	response := jsonrpcMessage{JSONRPC: "2.0", ID: request.ID}
+	if request.Method == "ping" {
+		response.Result = json.RawMessage("{}")
+	} else {
+		response.Error = &jsonrpcError{Code: -32601, Message: "method not supported by the build server"}
+	}
+	t.write(response)
+}
+
+// write sends one message on its own line
+func (t *stdioTransport) write(message jsonrpcMessage) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	t.nextID++
+	id := json.RawMessage(strconv.FormatInt(t.nextID, 10))
+	if err := t.write(jsonrpcMessage{JSONRPC: "2.0", ID: id, Method: method, Params: params}); err != nil {
+		return nil, fmt.Errorf("failed to write to the server: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-t.exited:
+			return nil, fmt.Errorf("server closed stdout: %w", t.exitErr)
+		case message := <-t.messages:
+			if string(message.ID) != string(id) {
+				continue
+			}
+			if message.Error != nil {
+				return nil, message.Error
+			}
+			return message.Result, nil
+		}
+	}
+}
+
+func (t *stdioTransport) notify(ctx context.Context, method string, params interface{}) error {
+	return t.write(jsonrpcMessage{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// httpTransport speaks the streamable HTTP transport: every message is POSTed
+// to one endpoint and the response comes back as JSON or as an event stream
+type httpTransport struct {
+	client          *http.Client
+	url             string
+	sessionID       string // Mcp-Session-Id assigned by the server on initialize
+	protocolVersion string // negotiated version, sent on every request after initialize
+	nextID          int64
+}
+
+func (t *httpTransport) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	t.nextID++
+	id := json.RawMessage(strconv.FormatInt(t.nextID, 10))
+	resp, err := t.post(ctx, jsonrpcMessage{JSONRPC: "2.0", ID: id, Method: method, Params: params})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if sessionID := resp.Header.Get("Mcp-Session-Id"); sessionID != "" {
+		t.sessionID = sessionID
+	}
+
+	var message *jsonrpcMessage
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		message, err = readEventStreamResponse(resp.Body, id)
+	} else {
+		message = &jsonrpcMessage{}
+		err = json.NewDecoder(io.LimitReader(resp.Body, mcpMaxMessageSize)).Decode(message)
+		// Reading to the end lets the connection be reused
+		io.Copy(io.Discard, io.LimitReader(resp.Body, mcpMaxMessageSize))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if message.Error != nil {
+		return nil, message.Error
+	}
+
+	if method == "initialize" {
+		var result struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		}
+		json.Unmarshal(message.Result, &result)
+		t.protocolVersion = result.ProtocolVersion
+	}
+	return message.Result, nil
+}
+
+func (t *httpTransport) notify(ctx context.Context, method string, params interface{}) error {
+	resp, err := t.post(ctx, jsonrpcMessage{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// post sends one message with the headers the transport requires
+func (t *httpTransport) post(ctx context.Context, message jsonrpcMessage) (*http.Response, error) {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if t.sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set("MCP-Protocol-Version", t.protocolVersion)
+	}
+	return t.client.Do(req)
+}
+
+// readEventStreamResponse reads server-sent events until the response to id arrives
+func readEventStreamResponse(body io.Reader, id json.RawMessage) (*jsonrpcMessage, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), mcpMaxMessageSize)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteString("\n")
+			}
+			data.WriteString(strings.TrimPrefix(value, " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		// A blank line ends the event
+		var message jsonrpcMessage
+		err := json.Unmarshal([]byte(data.String()), &message)
+		data.Reset()
+		if err == nil && message.Method == "" && string(message.ID) == string(id) {
+			return &message, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("event stream ended without a response")
+}
@@ -0,0 +1,360 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/mhiveconfig"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// verifyLogStage is the build log stage the verifier reports under
+const verifyLogStage = "verify_mcp"
+
+// Verifier defaults
+const (
+	DefaultMCPVerifyTimeout    = 60 * time.Second
+	DefaultMCPVerifyProxyImage = "alpine/socat"
+)
+
+// mcpHTTPPath is the endpoint streamable HTTP servers are expected to serve
+const mcpHTTPPath = "/mcp"
+
+// Wait between handshake attempts while a streamable HTTP server starts. It
+// doubles after every attempt, since each one starts a proxy container.
+const (
+	verifyRetryInitial = 250 * time.Millisecond
+	verifyRetryMax     = 5 * time.Second
+)
+
+// verifyMaxServerLogLines bounds how many lines of server output go into the build log
+const verifyMaxServerLogLines = 200
+
+// containerNameUnsafe matches characters Docker does not allow in container names
+var containerNameUnsafe = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+// MCPVerifyOptions configures the MCP verifier
+type MCPVerifyOptions struct {
+	Timeout    time.Duration // limit for starting the server and the whole handshake
+	ProxyImage string        // image with socat, used to reach HTTP servers inside their isolated network
+	Platform   string        // platform the images are built for, e.g. "linux/amd64"
+}
+
+// MCPVerifier starts a built image without network access and checks that it
+// speaks MCP: it initializes a session and lists the tools, resources and
+// prompts the server offers. It needs a Docker daemon.
+type MCPVerifier struct {
+	runner CommandRunner
+	opts   MCPVerifyOptions
+}
+
+// NewMCPVerifier creates a verifier that runs images with the docker CLI
+func NewMCPVerifier(runner CommandRunner, opts MCPVerifyOptions) *MCPVerifier {
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultMCPVerifyTimeout
+	}
+	if opts.ProxyImage == "" {
+		opts.ProxyImage = DefaultMCPVerifyProxyImage
+	}
+	return &MCPVerifier{runner: runner, opts: opts}
+}
+
+// VerifyRequest describes the server to verify
+type VerifyRequest struct {
+	Image     BuiltImage
+	Container string              // container name, unique to the build
+	Config    *mhiveconfig.Config // transport, port and entrypoint of the server
+	Env       map[string]string   // environment the server runs with
+}
+
+// Verify runs the image and performs the MCP handshake. It fails when the
+// handshake fails or does not finish within the configured timeout.
+func (v *MCPVerifier) Verify(ctx context.Context, req VerifyRequest, log *BuildLogger) (*models.MCPManifest, error) {
+	verifyCtx, cancel := context.WithTimeout(ctx, v.opts.Timeout)
+	defer cancel()
+
+	// The server container goes first, since it keeps a loaded image in use
+	req.Container = containerNameUnsafe.ReplaceAllString(req.Container, "-")
+	loaded := false
+	defer func() {
+		v.removeContainer(req.Container)
+		if loaded {
+			v.removeImage(req.Image.Name)
+		}
+	}()
+
+	if req.Image.Archive != "" {
+		// Daemonless builders leave the image in an archive, which is pushed
+		// from there, so the copy loaded into the daemon is only needed here
+		if err := v.runner.Run(verifyCtx, Command{Name: "docker", Args: []string{"load", "-i", req.Image.Archive}}); err != nil {
+			return nil, fmt.Errorf("failed to load image archive: %w", err)
+		}
+		loaded = true
+	}
+
+	var handshake *models.MCPManifest
+	var err error
+	switch req.Config.Transport {
+	case mhiveconfig.TransportStdio:
+		handshake, err = v.verifyStdio(verifyCtx, req, log)
+	case mhiveconfig.TransportStreamableHTTP:
+		handshake, err = v.verifyHTTP(verifyCtx, req, log)
+	default:
+		return nil, fmt.Errorf("verification of the %s transport is not supported", req.Config.Transport)
+	}
+
+	if err != nil && verifyCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return nil, fmt.Errorf("MCP handshake timed out after %s: %w", v.opts.Timeout, err)
+	}
+	return handshake, err
+}
+
+// verifyStdio runs the server attached to stdin and stdout
+func (v *MCPVerifier) verifyStdio(ctx context.Context, req VerifyRequest, log *BuildLogger) (*models.MCPManifest, error) {
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderrReader, stderrWriter := io.Pipe()
+	logged := make(chan struct{})
+	go func() {
+		logServerOutput(stderrReader, log)
+		close(logged)
+	}()
+
+	command := v.runCommand(req, "-i")
+	command.Stdin = stdinReader
+	command.Stdout = stdoutWriter
+	command.Stderr = stderrWriter
+
+	runCtx, stop := context.WithCancel(ctx)
+	exited := make(chan error, 1)
+	go func() {
+		err := v.runner.Run(runCtx, command)
+		if err == nil {
+			err = errors.New("server exited")
+		}
+		stdoutWriter.CloseWithError(err)
+		stderrWriter.Close()
+		stdinReader.CloseWithError(err)
+		exited <- err
+	}()
+
+	transport := newStdioTransport(stdinWriter, stdoutReader)
+	handshake, err := mcpHandshake(ctx, transport)
+
+	transport.close()
+	stdinWriter.Close()
+	stop()
+	<-exited
+	<-logged
+	return handshake, err
+}
+
+// verifyHTTP starts the server detached and talks to it through a socat
+// container that shares its network namespace, so the server never gets a
+// network of its own. Requests reuse the proxy connection while the server
+// keeps it open. The handshake is retried, with a growing wait, until the
+// server listens, and given up once the server has exited.
+func (v *MCPVerifier) verifyHTTP(ctx context.Context, req VerifyRequest, log *BuildLogger) (*models.MCPManifest, error) {
+	if err := v.runner.Run(ctx, v.runCommand(req, "-d")); err != nil {
+		return nil, fmt.Errorf("failed to start the server: %w", err)
+	}
+	defer v.logContainerOutput(req.Container, log)
+
+	client := &http.Client{Transport: &http.Transport{
+		MaxConnsPerHost: 1,
+		DialContext: func(dialCtx context.Context, network, addr string) (net.Conn, error) {
+			return v.dialContainer(ctx, req.Container, req.Config.Port)
+		},
+	}}
+	defer client.CloseIdleConnections()
+	endpoint := fmt.Sprintf("http://127.0.0.1:%d%s", req.Config.Port, mcpHTTPPath)
+
+	wait := verifyRetryInitial
+	for {
+		// Connection failures come back as *url.Error; anything else is an answer
+		handshake, err := mcpHandshake(ctx, &httpTransport{client: client, url: endpoint})
+		if err == nil || !isConnectionError(err) {
+			return handshake, err
+		}
+
+		// Not listening yet; give up once the server has exited
+		client.CloseIdleConnections()
+		if !v.containerRunning(ctx, req.Container) {
+			return nil, fmt.Errorf("server exited before accepting connections: %w", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("server did not accept connections on port %d: %w", req.Config.Port, err)
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, verifyRetryMax)
+	}
+}
+
+// isConnectionError reports whether an HTTP request failed without an answer from the server
+func isConnectionError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// runCommand returns the docker run command for the server. The container
+// has no network and no capabilities, and environment values are passed
+// through the environment of the docker CLI so they never appear in argv.
+func (v *MCPVerifier) runCommand(req VerifyRequest, mode string) Command {
+	args := []string{"run", "--rm", mode, "--name", req.Container,
+		"--network=none", "--cap-drop=ALL", "--security-opt=no-new-privileges"}
+	if v.opts.Platform != "" {
+		args = append(args, "--platform", v.opts.Platform)
+	}
+
+	names := make([]string, 0, len(req.Env))
+	for name := range req.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var env []string
+	for _, name := range names {
+		args = append(args, "-e", name)
+		env = append(env, name+"="+req.Env[name])
+	}
+
+	entrypoint := req.Config.Entrypoint
+	if len(entrypoint) > 0 {
+		args = append(args, "--entrypoint", entrypoint[0])
+	}
+	args = append(args, req.Image.Name)
+	if len(entrypoint) > 1 {
+		args = append(args, entrypoint[1:]...)
+	}
+	return Command{Name: "docker", Args: args, Env: env}
+}
+
+// dialContainer opens a connection to a port inside the container's network
+// namespace. The proxy runs under ctx, the whole verification, because the
+// HTTP client keeps using the connection after the dial returns.
+func (v *MCPVerifier) dialContainer(ctx context.Context, container string, port int) (net.Conn, error) {
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	proxyCtx, stop := context.WithCancel(ctx)
+
+	go func() {
+		err := v.runner.Run(proxyCtx, Command{
+			Name: "docker",
+			Args: []string{"run", "--rm", "-i", "--network=container:" + container, v.opts.ProxyImage,
+				"STDIO", fmt.Sprintf("TCP:127.0.0.1:%d", port)},
+			Stdin:  stdinReader,
+			Stdout: stdoutWriter,
+		})
+		if err == nil {
+			err = io.EOF
+		}
+		stdoutWriter.CloseWithError(err)
+		stdinReader.Close()
+	}()
+
+	return &pipeConn{Reader: stdoutReader, Writer: stdinWriter, close: func() {
+		stdinWriter.Close()
+		stdoutReader.Close()
+		stop()
+	}}, nil
+}
+
+// containerRunning reports whether the container is still running
+func (v *MCPVerifier) containerRunning(ctx context.Context, container string) bool {
+	var out bytes.Buffer
+	err := v.runner.Run(ctx, Command{
+		Name:   "docker",
+		Args:   []string{"inspect", "--format", "{{.State.Running}}", container},
+		Stdout: &out,
+	})
+	return err == nil && strings.TrimSpace(out.String()) == "true"
+}
+
+// logContainerOutput copies the output of a detached server into the build log
+func (v *MCPVerifier) logContainerOutput(container string, log *BuildLogger) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	reader, writer := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		logServerOutput(reader, log)
+		close(done)
+	}()
+	v.runner.Run(ctx, Command{
+		Name:   "docker",
+		Args:   []string{"logs", "--tail", fmt.Sprint(verifyMaxServerLogLines), container},
+		Stdout: writer,
+		Stderr: writer,
+	})
+	writer.Close()
+	<-done
+}
+
+// removeContainer removes the server container, which is left behind when
+// the docker CLI is killed before the container exits
+func (v *MCPVerifier) removeContainer(container string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	v.runner.Run(ctx, Command{Name: "docker", Args: []string{"rm", "-f", container}})
+}
+
+// removeImage removes an image loaded for verification from the Docker daemon
+func (v *MCPVerifier) removeImage(image string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	v.runner.Run(ctx, Command{Name: "docker", Args: []string{"rmi", image}})
+}
+
+// logServerOutput writes the server's output to the build log line by line
+func logServerOutput(output io.Reader, log *BuildLogger) {
+	scanner := bufio.NewScanner(output)
+	lines := 0
+	for scanner.Scan() {
+		if lines++; lines > verifyMaxServerLogLines {
+			continue
+		}
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			log.LogInfo(verifyLogStage, "server: "+line)
+		}
+	}
+	if lines > verifyMaxServerLogLines {
+		log.LogInfo(verifyLogStage, fmt.Sprintf("server: ... %d more lines", lines-verifyMaxServerLogLines))
+	}
+	io.Copy(io.Discard, output)
+}
+
+// pipeConn is a net.Conn over a proxy process's stdin and stdout
+type pipeConn struct {
+	io.Reader
+	io.Writer
+	close func()
+}
+
+func (c *pipeConn) Close() error {
+	c.close()
+	return nil
+}
+
+func (c *pipeConn) LocalAddr() net.Addr                { return pipeAddr{} }
+func (c *pipeConn) RemoteAddr() net.Addr               { return pipeAddr{} }
+func (c *pipeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *pipeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *pipeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// pipeAddr is the address of a pipeConn
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/imyashkale/buildserver/internal/mhiveconfig"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// fakeMCPServer answers MCP requests like a small server with two pages of
+// tools and one resource. It does not offer prompts.
+type fakeMCPServer struct {
+	mu      sync.Mutex
+	methods []string
+}
+
+// handle returns the response to a request, or nil for a notification
+func (s *fakeMCPServer) handle(request jsonrpcMessage) *jsonrpcMessage {
+	s.mu.Lock()
+	s.methods = append(s.methods, request.Method)
+	s.mu.Unlock()
+	if request.ID == nil {
+		return nil
+	}
+
+	var result string
+	switch request.Method {
+	case "initialize":
+		result = `{"protocolVersion":"2025-06-18","capabilities":{"tools":{"listChanged":false},"resources":{}},"serverInfo":{"name":"weather","version":"1.2.0"}}`
+	case "tools/list":
+		result = `{"tools":[{"name":"get_forecast","inputSchema":{"type":"object"}}],"nextCursor":"page-2"}`
+		if params, _ := request.Params.(map[string]interface{}); params["cursor"] == "page-2" {
+			result = `{"tools":[{"name":"get_alerts","inputSchema":{"type":"object"}}]}`
+		}
+	case "resources/list":
+		result = `{"resources":[{"uri":"weather://stations","name":"stations"}]}`
+	default:
+		return &jsonrpcMessage{JSONRPC: "2.0", ID: request.ID, Error: &jsonrpcError{Code: -32601, Message: "method not found"}}
+	}
+	return &jsonrpcMessage{JSONRPC: "2.0", ID: request.ID, Result: json.RawMessage(result)}
+}
+
+// called returns the methods the server received
+func (s *fakeMCPServer) called() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.methods...)
+}
+
+// serveStdio speaks newline-delimited JSON-RPC until stdin is closed. It
+// pings the client first, as servers may do at any time.
+func (s *fakeMCPServer) serveStdio(stdin io.Reader, stdout io.Writer) {
+	io.WriteString(stdout, `{"jsonrpc":"2.0","id":"server-1","method":"ping"}`+"\n")
+	scanner := bufio.NewScanner(stdin)
+	for scanner.Scan() {
+		var request jsonrpcMessage
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil || request.Method == "" {
+			continue // the client's answer to the ping
+		}
+		if response := s.handle(request); response != nil {
+			data, _ := json.Marshal(response)
+			if _, err := stdout.Write(append(data, '\n')); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ServeHTTP speaks the streamable HTTP transport. tools/list is answered
+// with an event stream that carries a notification before the response.
+func (s *fakeMCPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != mcpHTTPPath {
+		http.NotFound(w, r)
+		return
+	}
+	var request jsonrpcMessage
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.Method == "initialize" {
+		w.Header().Set("Mcp-Session-Id", "session-1")
+	} else if r.Header.Get("Mcp-Session-Id") != "session-1" || r.Header.Get("MCP-Protocol-Version") != mcpProtocolVersion {
+		http.Error(w, "missing session", http.StatusBadRequest)
+		return
+	}
+
+	response := s.handle(request)
+	if response == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	data, _ := json.Marshal(response)
+	if request.Method == "tools/list" {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", `{"jsonrpc":"2.0","method":"notifications/message","params":{"level":"info","data":"listing"}}`)
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// containerRunner stands in for the docker CLI when verifying. The server
+// container speaks MCP over stdio, or over HTTP through the socat proxy.
+type containerRunner struct {
+	mu       sync.Mutex
+	commands []Command
+	server   *fakeMCPServer
+	httpAddr string      // where the proxy connects to
+	refuse   int         // proxy connections to refuse before the HTTP server "listens"
+	proxies  []time.Time // when each proxy container was started
+	crash    bool        // the stdio server exits at once
+	hang     bool        // the stdio server never answers
+}
+
+func (r *containerRunner) Run(ctx context.Context, command Command) error {
+	r.mu.Lock()
+	r.commands = append(r.commands, command)
+	r.mu.Unlock()
+	line := strings.Join(command.Args, " ")
+
+	switch {
+	case strings.Contains(line, "--network=container:"):
+		r.mu.Lock()
+		r.proxies = append(r.proxies, time.Now())
+		refuse := r.refuse > 0
+		r.refuse--
+		r.mu.Unlock()
+		if refuse {
+			return errors.New("exit status 1")
+		}
+		conn, err := net.Dial("tcp", r.httpAddr)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		go func() {
+			io.Copy(conn, command.Stdin)
+			conn.(*net.TCPConn).CloseWrite()
+		}()
+		io.Copy(command.Stdout, conn)
+	case strings.HasPrefix(line, "run --rm -i"):
+		switch {
+		case r.crash:
+			io.WriteString(command.Stderr, "Error: WEATHER_API_KEY is not set\n")
+			return errors.New("exit status 1")
+		case r.hang:
+			io.Copy(io.Discard, command.Stdin)
+		default:
+			r.server.serveStdio(command.Stdin, command.Stdout)
+		}
+	case strings.HasPrefix(line, "inspect"):
+		io.WriteString(command.Stdout, "true\n")
+	}
+	return nil
+}
+
+// ran returns the command lines that were run
+func (r *containerRunner) ran() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lines := make([]string, 0, len(r.commands))
+	for _, command := range r.commands {
+		lines = append(lines, command.Name+" "+strings.Join(command.Args, " "))
+	}
+	return lines
+}
+
+// verifyRequest returns a request for the transport with one secret in the environment
+func verifyRequest(transport string) VerifyRequest {
+	return VerifyRequest{
+		Image:     BuiltImage{Name: "server-1:main-abc"},
+		Container: "mcp-verify-deploy/1",
+		Config: &mhiveconfig.Config{
+			Transport:  transport,
+			Port:       8080,
+			Entrypoint: []string{"node", "dist/index.js"},
+		},
+		Env: map[string]string{"WEATHER_API_KEY": "wk_secret"},
+	}
+}
+
+// assertHandshake checks what the fake server reports
+func assertHandshake(t *testing.T, handshake *models.MCPManifest) {
+	t.Helper()
+	if handshake.ServerName != "weather" || handshake.ServerVersion != "1.2.0" || handshake.ProtocolVersion != mcpProtocolVersion {
+		t.Errorf("handshake = %+v", handshake)
+	}
+	if len(handshake.Tools) != 2 || handshake.Tools[0].Name != "get_forecast" || handshake.Tools[1].Name != "get_alerts" {
+		t.Errorf("tools = %+v, want both pages", handshake.Tools)
+	}
+	if len(handshake.Resources) != 1 || handshake.Resources[0].URI != "weather://stations" || handshake.Prompts != nil {
+		t.Errorf("resources = %+v, prompts = %+v", handshake.Resources, handshake.Prompts)
+	}
+}
+
+func TestMCPVerifier_Stdio(t *testing.T) {
+	server := &fakeMCPServer{}
+	runner := &containerRunner{server: server}
+	verifier := NewMCPVerifier(runner, MCPVerifyOptions{Timeout: 5 * time.Second})
+
+	handshake, err := verifier.Verify(context.Background(), verifyRequest(mhiveconfig.TransportStdio), NewBuildLogger())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	assertHandshake(t, handshake)
+
+	want := []string{"initialize", "notifications/initialized", "tools/list", "tools/list", "resources/list"}
+	if got := server.called(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("server received %v, want %v", got, want)
+	}
+
+	commands := runner.ran()
+	run := commands[0]
+	for _, want := range []string{"--network=none", "--name mcp-verify-deploy-1", "-e WEATHER_API_KEY", "--entrypoint node server-1:main-abc dist/index.js"} {
+		if !strings.Contains(run, want) {
+			t.Errorf("run command %q lacks %q", run, want)
+		}
+	}
+	if strings.Contains(run, "wk_secret") {
+		t.Errorf("secret on the command line: %q", run)
+	}
+	if env := strings.Join(runner.commands[0].Env, " "); env != "WEATHER_API_KEY=wk_secret" {
+		t.Errorf("env = %q", env)
+	}
+	if last := commands[len(commands)-1]; last != "docker rm -f mcp-verify-deploy-1" {
+		t.Errorf("Expected the container to be removed, last command %q", last)
+	}
+}
+
+func TestMCPVerifier_StreamableHTTP(t *testing.T) {
+	server := &fakeMCPServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	// The first connections are refused while the server starts
+	runner := &containerRunner{httpAddr: httpServer.Listener.Addr().String(), refuse: 2}
+	verifier := NewMCPVerifier(runner, MCPVerifyOptions{Timeout: 10 * time.Second})
+
+	req := verifyRequest(mhiveconfig.TransportStreamableHTTP)
+	req.Image.Archive = "/tmp/out/image.tar"
+	handshake, err := verifier.Verify(context.Background(), req, NewBuildLogger())
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	assertHandshake(t, handshake)
+
+	commands := strings.Join(runner.ran(), "\n")
+	for _, want := range []string{
+		"docker load -i /tmp/out/image.tar",
+		"docker run --rm -d --name mcp-verify-deploy-1 --network=none",
+		"docker run --rm -i --network=container:mcp-verify-deploy-1 alpine/socat STDIO TCP:127.0.0.1:8080",
+		"docker inspect",
+		"docker rm -f mcp-verify-deploy-1\ndocker rmi server-1:main-abc",
+	} {
+		if !strings.Contains(commands, want) {
+			t.Errorf("commands lack %q:\n%s", want, commands)
+		}
+	}
+
+	// One proxy per refused attempt, each checked for and waited on longer
+	// than the previous one, then one for the whole handshake
+	if len(runner.proxies) != 3 || strings.Count(commands, "docker inspect") != 2 {
+		t.Fatalf("Started %d proxies and %d inspections, want 3 and 2:\n%s", len(runner.proxies), strings.Count(commands, "docker inspect"), commands)
+	}
+	if first, second := runner.proxies[1].Sub(runner.proxies[0]), runner.proxies[2].Sub(runner.proxies[1]); second <= first {
+		t.Errorf("Waited %s, then %s between attempts; want a growing wait", first, second)
+	}
+}
+
+func TestMCPVerifier_Failures(t *testing.T) {
+	t.Run("server exits", func(t *testing.T) {
+		verifier := NewMCPVerifier(&containerRunner{crash: true}, MCPVerifyOptions{Timeout: 5 * time.Second})
+		log := NewBuildLogger()
+
+		_, err := verifier.Verify(context.Background(), verifyRequest(mhiveconfig.TransportStdio), log)
+		if err == nil || !strings.Contains(err.Error(), "exit status 1") {
+			t.Fatalf("Verify error = %v, want the exit status", err)
+		}
+		// The server's output explains why
+		found := false
+		for _, entry := range log.GetLogs() {
+			found = found || strings.Contains(entry.Message, "server: Error: WEATHER_API_KEY is not set")
+		}
+		if !found {
+			t.Errorf("Expected the server's stderr in the build log, got %+v", log.GetLogs())
+		}
+	})
+
+	t.Run("server does not answer", func(t *testing.T) {
+		verifier := NewMCPVerifier(&containerRunner{hang: true}, MCPVerifyOptions{Timeout: 200 * time.Millisecond})
+
+		_, err := verifier.Verify(context.Background(), verifyRequest(mhiveconfig.TransportStdio), NewBuildLogger())
+		if err == nil || !strings.Contains(err.Error(), "timed out after 200ms") {
+			t.Fatalf("Verify error = %v, want a timeout", err)
+		}
+	})
+
+	t.Run("HTTP server answers wrongly", func(t *testing.T) {
+		httpServer := httptest.NewServer(http.NotFoundHandler())
+		defer httpServer.Close()
+		verifier := NewMCPVerifier(&containerRunner{httpAddr: httpServer.Listener.Addr().String()}, MCPVerifyOptions{Timeout: 5 * time.Second})
+
+		_, err := verifier.Verify(context.Background(), verifyRequest(mhiveconfig.TransportStreamableHTTP), NewBuildLogger())
+		if err == nil || !strings.Contains(err.Error(), "HTTP 404") {
+			t.Fatalf("Verify error = %v, want the HTTP status", err)
+		}
+	})
+}
+
+// TestExecuteBuild_RecordsVerifiedManifest verifies that the manifest the
+// built server offered in the handshake is stored on the deployment
+func TestExecuteBuild_RecordsVerifiedManifest(t *testing.T) {
+	h := newHermeticPipeline(t, "server-1")
+	deployment := h.mustRun(t, "server-1")
+
+	if manifest := deployment.Manifest; manifest == nil || manifest.ServerName != "weather" || len(manifest.Tools) != 2 || len(manifest.Resources) != 1 {
+		t.Errorf("Expected the verified server's manifest, got %+v", manifest)
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Manifest media types a registry may store for an image
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+}
+
+// ociClient talks to the HTTP API of an OCI Distribution v2 registry. It
+// answers authentication challenges with the configured credentials, using
+// basic auth or the bearer token flow, and caches tokens per scope.
+type ociClient struct {
+	baseURL  *url.URL
+	username string
+	password string
+	http     *http.Client
+
+	mu     sync.Mutex
+	tokens map[string]string // bearer token by scope
+	basic  bool              // the registry asked for basic auth
+}
+
+// newOCIClient creates a client for the registry at baseURL
+func newOCIClient(baseURL *url.URL, username, password string) *ociClient {
+	return &ociClient{
+		baseURL:  baseURL,
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: 5 * time.Minute},
+		tokens:   make(map[string]string),
+	}
+}
+
+// newRequest builds a request for a path under /v2/
+func (c *ociClient) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	u := *c.baseURL
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/v2/" + strings.TrimPrefix(path, "/")
+	return http.NewRequestWithContext(ctx, method, u.String(), body)
+}
+
+// do sends req, authenticating for scope (e.g. "repository:acme/mcp-1:pull")
+// when the registry asks for it. A request with a body is only retried if
+// req.GetBody is set, which http.NewRequest does for in-memory readers.
+func (c *ociClient) do(req *http.Request, scope string) (*http.Response, error) {
+	c.authorize(req, scope)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	drain(resp)
+	if err := c.authenticate(req.Context(), challenge, scope); err != nil {
+		return nil, err
+	}
+
+	retry := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("registry asked for authentication and the request body cannot be replayed")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	c.authorize(retry, scope)
+	return c.http.Do(retry)
+}
+
+// authorize adds the credentials the registry asked for earlier, if any
+func (c *ociClient) authorize(req *http.Request, scope string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.basic {
+		req.SetBasicAuth(c.username, c.password)
+		return
+	}
+	if token, ok := c.tokens[scope]; ok {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// authenticate answers a WWW-Authenticate challenge
+func (c *ociClient) authenticate(ctx context.Context, challenge, scope string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.username == "" {
+			return fmt.Errorf("registry requires credentials but none are configured")
+		}
+		c.mu.Lock()
+		c.basic = true
+		c.mu.Unlock()
+		return nil
+	case "bearer":
+		// The registry names the access it wants, which can be wider than
+		// the scope asked for (e.g. "*" to delete). The token is cached under
+		// the requested scope.
+		wanted := params["scope"]
+		if wanted == "" {
+			wanted = scope
+		}
+		token, err := c.fetchToken(ctx, params["realm"], params["service"], wanted)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		c.tokens[scope] = token
+		c.mu.Unlock()
+		return nil
+	default:
+		return fmt.Errorf("registry returned 401 with an unsupported challenge %q", challenge)
+	}
+}
+
+// fetchToken gets a bearer token for scope from the registry's token service
+func (c *ociClient) fetchToken(ctx context.Context, realm, service, scope string) (string, error) {
+	if realm == "" {
+		return "", fmt.Errorf("registry bearer challenge has no realm")
+	}
+	u, err := url.Parse(realm)
+	if err != nil {
+		return "", fmt.Errorf("invalid token realm %q: %w", realm, err)
+	}
+	query := u.Query()
+	if service != "" {
+		query.Set("service", service)
+	}
+	if scope != "" {
+		query.Set("scope", scope)
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token service returned %s", resp.Status)
+	}
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("registry token service returned no token")
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://auth.example.com/token",service="registry"` into its
+// scheme and parameters. Quoted values may contain commas.
+func parseChallenge(header string) (string, map[string]string) {
+	params := make(map[string]string)
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimLeft(rest, ", ") {
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				params[key] = value[1:]
+				break
+			}
+			params[key] = value[1 : end+1]
+			rest = value[end+2:]
+			continue
+		}
+
+		value, rest, _ = strings.Cut(value, ",")
+		params[key] = strings.TrimSpace(value)
+	}
+	return scheme, params
+}
+
+// drain reads and closes a response body so the connection can be reused
+func drain(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+}
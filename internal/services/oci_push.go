@@ -0,0 +1,518 @@
+package services
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/imyashkale/buildserver/internal/logger"
+)
+
+// Media types of the manifests and blobs pushed by the build server
+const (
+	mediaTypeOCIManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeOCIConfig   = "application/vnd.oci.image.config.v1+json"
+	mediaTypeOCILayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+)
+
+// ociDescriptor points at a blob in a registry
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+// ociManifest is an OCI image manifest
+type ociManifest struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	MediaType     string          `json:"mediaType"`
+	Config        ociDescriptor   `json:"config"`
+	Layers        []ociDescriptor `json:"layers"`
+}
+
+// ociBlob is a blob ready for upload, kept in memory or in a temporary file
+type ociBlob struct {
+	ociDescriptor
+	data []byte
+	path string
+}
+
+// open returns the blob content
+func (b *ociBlob) open() (io.ReadCloser, error) {
+	if b.path != "" {
+		return os.Open(b.path)
+	}
+	return io.NopCloser(bytes.NewReader(b.data)), nil
+}
+
+// ociImage is a local image exported for upload. Close removes its temporary files.
+type ociImage struct {
+	config *ociBlob
+	layers []*ociBlob
+	dir    string
+}
+
+// Close removes the exported layers
+func (img *ociImage) Close() error {
+	return os.RemoveAll(img.dir)
+}
+
+// manifest returns the image manifest and its digest
+func (img *ociImage) manifest() ([]byte, string, error) {
+	manifest := ociManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeOCIManifest,
+		Config:        img.config.ociDescriptor,
+		Layers:        make([]ociDescriptor, 0, len(img.layers)),
+	}
+	for _, layer := range img.layers {
+		manifest.Layers = append(manifest.Layers, layer.ociDescriptor)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, sha256Digest(data), nil
+}
+
+// exportImage reads a built image, from its archive or with `docker save`,
+// and prepares its config and gzip-compressed layers for upload
+func exportImage(ctx context.Context, runner CommandRunner, image BuiltImage) (*ociImage, error) {
+	dir, err := os.MkdirTemp("", "mcp-image-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export directory: %w", err)
+	}
+	img := &ociImage{dir: dir}
+
+	if err := img.load(ctx, runner, image); err != nil {
+		img.Close()
+		return nil, err
+	}
+	return img, nil
+}
+
+// load exports the image into an archive, unless the builder wrote one, and reads it
+func (img *ociImage) load(ctx context.Context, runner CommandRunner, image BuiltImage) error {
+	archivePath := image.Archive
+	if archivePath == "" {
+		archivePath = filepath.Join(img.dir, "image.tar")
+		if err := saveImage(ctx, runner, image.Name, archivePath); err != nil {
+			return err
+		}
+	}
+
+	// The archive's manifest.json, which names the config and layer entries,
+	// may come after them, so the archive is read twice
+	entry, err := readArchiveManifest(archivePath)
+	if err != nil {
+		return err
+	}
+	return img.readBlobs(archivePath, entry)
+}
+
+// saveImage writes a local image to a `docker save` archive
+func saveImage(ctx context.Context, runner CommandRunner, imageName, archivePath string) error {
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to create image archive: %w", err)
+	}
+
+	var stderr bytes.Buffer
+	err = runner.Run(ctx, Command{
+		Name:   "docker",
+		Args:   []string{"save", imageName},
+		Stdout: archive,
+		Stderr: &stderr,
+	})
+	archive.Close()
+	if err != nil {
+		return fmt.Errorf("failed to export image %s: %w: %s", imageName, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// archiveManifest is the entry for one image in the manifest.json of a `docker save` archive
+type archiveManifest struct {
+	Config string
+	Layers []string
+
+	// links maps symlink entries to their targets. Layers repeated in an
+	// image are stored once and linked to.
+	links map[string]string
+}
+
+// resolve follows symlinks from an entry name to a regular entry
+func (m *archiveManifest) resolve(name string) string {
+	name = path.Clean(name)
+	for i := 0; i < 10; i++ {
+		target, ok := m.links[name]
+		if !ok {
+			break
+		}
+		name = target
+	}
+	return name
+}
+
+// readArchiveManifest returns the image entry of a `docker save` archive
+func readArchiveManifest(archivePath string) (*archiveManifest, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []archiveManifest
+	links := make(map[string]string)
+
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image archive: %w", err)
+		}
+
+		name := path.Clean(header.Name)
+		switch {
+		case header.Typeflag == tar.TypeSymlink:
+			links[name] = path.Join(path.Dir(name), header.Linkname)
+		case name == "manifest.json":
+			if err := json.NewDecoder(tr).Decode(&entries); err != nil {
+				return nil, fmt.Errorf("failed to decode image archive manifest: %w", err)
+			}
+		}
+	}
+
+	if entries == nil {
+		return nil, fmt.Errorf("image archive has no manifest.json")
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("image archive holds %d images, want 1", len(entries))
+	}
+	entries[0].links = links
+	return &entries[0], nil
+}
+
+// readBlobs reads the config and compresses each layer of the archive
+func (img *ociImage) readBlobs(archivePath string, entry *archiveManifest) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	configName := entry.resolve(entry.Config)
+	layers := make(map[string]*ociBlob)
+	compressed := 0
+	for _, layer := range entry.Layers {
+		layers[entry.resolve(layer)] = nil
+	}
+
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read image archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(header.Name)
+
+		if name == configName {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return fmt.Errorf("failed to read image config: %w", err)
+			}
+			img.config = &ociBlob{
+				ociDescriptor: ociDescriptor{MediaType: mediaTypeOCIConfig, Digest: sha256Digest(data), Size: int64(len(data))},
+				data:          data,
+			}
+		}
+		if blob, ok := layers[name]; ok && blob == nil {
+			blob, err := img.compressLayer(tr, compressed)
+			if err != nil {
+				return fmt.Errorf("failed to compress layer %s: %w", name, err)
+			}
+			layers[name] = blob
+			compressed++
+		}
+	}
+
+	if img.config == nil {
+		return fmt.Errorf("image archive has no config %s", entry.Config)
+	}
+	for _, layer := range entry.Layers {
+		blob := layers[entry.resolve(layer)]
+		if blob == nil {
+			return fmt.Errorf("image archive has no layer %s", layer)
+		}
+		img.layers = append(img.layers, blob)
+	}
+	return nil
+}
+
+// compressLayer gzips a layer into a temporary file and computes its digest.
+// A layer that is already gzip-compressed is stored as it is.
+func (img *ociImage) compressLayer(r io.Reader, n int) (*ociBlob, error) {
+	blobPath := filepath.Join(img.dir, fmt.Sprintf("layer-%d", n))
+	f, err := os.Create(blobPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	out := io.MultiWriter(f, hash, counter)
+
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(2)
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		if _, err := io.Copy(out, br); err != nil {
+			return nil, err
+		}
+	} else {
+		// gzip output has no timestamp, so the same layer always gets the same digest
+		zw := gzip.NewWriter(out)
+		if _, err := io.Copy(zw, br); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ociBlob{
+		ociDescriptor: ociDescriptor{
+			MediaType: mediaTypeOCILayer,
+			Digest:    "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+			Size:      counter.n,
+		},
+		path: blobPath,
+	}, nil
+}
+
+// countingWriter counts the bytes written to it
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// sha256Digest returns the OCI digest of data
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// pushImage uploads the image's blobs the registry does not have yet and puts
+// its manifest once per tag. It returns the manifest digest.
+func (c *ociClient) pushImage(ctx context.Context, repoName string, img *ociImage, tags []string) (string, error) {
+	if len(tags) == 0 {
+		return "", fmt.Errorf("at least one tag must be provided")
+	}
+	scope := "repository:" + repoName + ":pull,push"
+
+	for _, blob := range append([]*ociBlob{img.config}, img.layers...) {
+		if err := c.uploadBlob(ctx, repoName, scope, blob); err != nil {
+			return "", err
+		}
+	}
+
+	manifest, digest, err := img.manifest()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	// Each tag is one manifest PUT; the layers are only uploaded once
+	for _, tag := range tags {
+		if err := c.putManifest(ctx, repoName, scope, tag, manifest, digest); err != nil {
+			return "", err
+		}
+		logger.WithFields(map[string]interface{}{
+			"repo_name": repoName,
+			"tag":       tag,
+			"digest":    digest,
+		}).Info("Image manifest pushed")
+	}
+	return digest, nil
+}
+
+// blobExists reports whether the repository already holds a blob
+func (c *ociClient) blobExists(ctx context.Context, repoName, scope, digest string) (bool, error) {
+	req, err := c.newRequest(ctx, http.MethodHead, repoName+"/blobs/"+digest, nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := c.do(req, scope)
+	if err != nil {
+		return false, err
+	}
+	drain(resp)
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("registry returned %s", resp.Status)
+	}
+}
+
+// uploadBlob uploads a blob in one request unless the repository already has it
+func (c *ociClient) uploadBlob(ctx context.Context, repoName, scope string, blob *ociBlob) error {
+	exists, err := c.blobExists(ctx, repoName, scope, blob.Digest)
+	if err != nil {
+		return fmt.Errorf("failed to check blob %s: %w", blob.Digest, err)
+	}
+	if exists {
+		logger.WithFields(map[string]interface{}{
+			"repo_name": repoName,
+			"digest":    blob.Digest,
+		}).Debug("Blob already in registry, skipping upload")
+		return nil
+	}
+
+	// Start an upload session
+	req, err := c.newRequest(ctx, http.MethodPost, repoName+"/blobs/uploads/", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req, scope)
+	if err != nil {
+		return fmt.Errorf("failed to start upload of %s: %w", blob.Digest, err)
+	}
+	drain(resp)
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("failed to start upload of %s: registry returned %s", blob.Digest, resp.Status)
+	}
+
+	location, err := resp.Location()
+	if err != nil {
+		return fmt.Errorf("failed to start upload of %s: %w", blob.Digest, err)
+	}
+	query := location.Query()
+	query.Set("digest", blob.Digest)
+	location.RawQuery = query.Encode()
+
+	// Finish it with the whole blob
+	if err := c.putBlob(ctx, location, scope, blob); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", blob.Digest, err)
+	}
+
+	logger.WithFields(map[string]interface{}{
+		"repo_name": repoName,
+		"digest":    blob.Digest,
+		"size":      blob.Size,
+	}).Debug("Blob uploaded")
+	return nil
+}
+
+// putBlob sends the blob content to an upload location
+func (c *ociClient) putBlob(ctx context.Context, location *url.URL, scope string, blob *ociBlob) error {
+	body, err := blob.open()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, location.String(), body)
+	if err != nil {
+		body.Close()
+		return err
+	}
+	req.ContentLength = blob.Size
+	req.GetBody = blob.open
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := c.do(req, scope)
+	if err != nil {
+		return err
+	}
+	drain(resp)
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("registry returned %s", resp.Status)
+	}
+	return nil
+}
+
+// putManifest stores the manifest under a tag and checks the digest the registry computed
+func (c *ociClient) putManifest(ctx context.Context, repoName, scope, tag string, manifest []byte, digest string) error {
+	req, err := c.newRequest(ctx, http.MethodPut, repoName+"/manifests/"+tag, bytes.NewReader(manifest))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mediaTypeOCIManifest)
+
+	resp, err := c.do(req, scope)
+	if err != nil {
+		return fmt.Errorf("failed to push manifest %s:%s: %w", repoName, tag, err)
+	}
+	drain(resp)
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to push manifest %s:%s: registry returned %s", repoName, tag, resp.Status)
+	}
+
+	if stored := resp.Header.Get("Docker-Content-Digest"); stored != "" && stored != digest {
+		return fmt.Errorf("registry stored manifest %s:%s as %s, want %s", repoName, tag, stored, digest)
+	}
+	return nil
+}
+
+// pushLocalImage exports a built image and pushes it to repo through client
+func pushLocalImage(ctx context.Context, runner CommandRunner, client *ociClient, repo ImageRepository, image BuiltImage, tags []string) (PushedImage, error) {
+	if len(tags) == 0 {
+		return PushedImage{}, fmt.Errorf("at least one tag must be provided")
+	}
+	if image.Name == "" {
+		return PushedImage{}, fmt.Errorf("image name cannot be empty")
+	}
+
+	img, err := exportImage(ctx, runner, image)
+	if err != nil {
+		return PushedImage{}, err
+	}
+	defer img.Close()
+
+	digest, err := client.pushImage(ctx, repo.Name, img, tags)
+	if err != nil {
+		return PushedImage{}, err
+	}
+
+	pushed := PushedImage{
+		URI:        fmt.Sprintf("%s:%s", repo.URI, tags[0]),
+		DigestURI:  fmt.Sprintf("%s@%s", repo.URI, digest),
+		Digest:     digest,
+		LayerCount: len(img.layers),
+		LayerSizes: make([]int64, 0, len(img.layers)),
+	}
+	for _, layer := range img.layers {
+		pushed.Size += layer.Size
+		pushed.LayerSizes = append(pushed.LayerSizes, layer.Size)
+	}
+	return pushed, nil
+}
@@ -2,49 +2,85 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/imyashkale/buildserver/internal/dockergen"
 	"github.com/imyashkale/buildserver/internal/logger"
+	"github.com/imyashkale/buildserver/internal/logstore"
+	"github.com/imyashkale/buildserver/internal/mhiveconfig"
 	"github.com/imyashkale/buildserver/internal/models"
 	"github.com/imyashkale/buildserver/internal/queue"
 	"github.com/imyashkale/buildserver/internal/repository"
-	"gopkg.in/yaml.v2"
 )
 
+// LogTailSize is how many of the latest log entries are kept on the deployment record
+const LogTailSize = 50
+
+// TokenDecrypter decrypts the access token stored with a GitHub connection.
+// *GitHubService implements it.
+type TokenDecrypter interface {
+	DecryptToken(encryptedToken string) (string, error)
+}
+
+// TokenCipher encrypts secrets to be stored like GitHub access tokens and
+// decrypts them again. *GitHubService implements it.
+type TokenCipher interface {
+	TokenDecrypter
+	EncryptToken(token string) (string, error)
+}
+
 // PipelineService orchestrates the build pipeline stages
 type PipelineService struct {
 	deploymentRepo repository.DeploymentRepository
-	githubService  *GitHubService
-	ecrService     *ECRService
+	githubService  TokenDecrypter
+	registries     *Registries
+	builders       *Builders
+	verifier       *MCPVerifier         // nil skips the verify_mcp stage
+	dockerfiles    *dockergen.Generator // nil requires every repository to have a Dockerfile
 	mcpRepo        repository.MCPRepository
 	githubRepo     repository.GitHubRepository
-	logger         *BuildLogger
+	logHub         *LogHub
+	logStore       logstore.LogStore
+	runner         CommandRunner
 }
 
 // NewPipelineService creates a new pipeline service
 func NewPipelineService(
 	deploymentRepo repository.DeploymentRepository,
-	githubService *GitHubService,
-	ecrService *ECRService,
+	githubService TokenDecrypter,
+	registries *Registries,
+	builders *Builders,
+	verifier *MCPVerifier,
+	dockerfiles *dockergen.Generator,
 	mcpRepo repository.MCPRepository,
 	githubRepo repository.GitHubRepository,
+	logHub *LogHub,
+	logStore logstore.LogStore,
+	runner CommandRunner,
 ) *PipelineService {
 	return &PipelineService{
 		deploymentRepo: deploymentRepo,
 		githubService:  githubService,
-		ecrService:     ecrService,
+		registries:     registries,
+		builders:       builders,
+		verifier:       verifier,
+		dockerfiles:    dockerfiles,
 		mcpRepo:        mcpRepo,
 		githubRepo:     githubRepo,
-		logger:         NewBuildLogger(),
+		logHub:         logHub,
+		logStore:       logStore,
+		runner:         runner,
 	}
 }
 
 // ExecuteBuild executes the complete build pipeline for a job
-func (ps *PipelineService) ExecuteBuild(ctx context.Context, job *queue.BuildJob) error {
+func (ps *PipelineService) ExecuteBuild(ctx context.Context, job *queue.BuildJob) (err error) {
 
 	logger.WithFields(map[string]interface{}{
 		"deployment_id": job.DeploymentID,
@@ -52,29 +88,77 @@ func (ps *PipelineService) ExecuteBuild(ctx context.Context, job *queue.BuildJob
 		"user_id":       job.UserID,
 	}).Info("Build execution started")
 
-	ps.logger.Clear()
-	now := time.Now()
+	// Every job gets its own logger and workspace. A retried job starts a new
+	// log, told apart from the previous one by its attempt number.
+	bc := NewBuildContext(job)
+	bc.Logger.SetAttempt(queue.Attempt(ctx))
+	defer bc.Cleanup()
+
+	// The returned error is recorded by the job store, so mask secrets while they are still registered
+	defer func() {
+		if err != nil {
+			err = redactError(bc.Logger, err)
+		}
+	}()
+
+	// Publish the logger to live followers until the build reaches its final status
+	ps.logHub.Register(job.ServerID, job.DeploymentID, bc.Logger)
+	defer func() {
+		// A build that stopped without reaching a final status ended in failure
+		status := models.DeploymentStatusFailed
+		if bc.Deployment != nil && bc.Deployment.Status.IsTerminal() {
+			status = bc.Deployment.Status
+		}
+		bc.Logger.Finish(string(status))
+		ps.logHub.Unregister(job.ServerID, job.DeploymentID, bc.Logger)
+	}()
 
 	// Initialize stages in deployment
 	stages := map[string]*models.BuildStageStatus{
-		"clone":           {Status: "pending", StartedAt: &now},
-		"validate_config": {Status: "pending"},
-		"validate_docker": {Status: "pending"},
-		"build_image":     {Status: "pending"},
-		"create_ecr":      {Status: "pending"},
-		"push_image":      {Status: "pending"},
+		"clone":           {Status: models.StageStatusPending},
+		"validate_config": {Status: models.StageStatusPending},
+		"validate_docker": {Status: models.StageStatusPending},
+		"build_image":     {Status: models.StageStatusPending},
+		"verify_mcp":      {Status: models.StageStatusPending},
+		"create_ecr":      {Status: models.StageStatusPending},
+		"push_image":      {Status: models.StageStatusPending},
 	}
 
 	// Get the deployment record
 	deployment, err := ps.deploymentRepo.Get(ctx, job.ServerID, job.DeploymentID)
 	if err != nil || deployment == nil {
-		ps.logger.LogError("init", "Failed to fetch deployment from database")
 		logger.WithFields(map[string]interface{}{
 			"deployment_id": job.DeploymentID,
 			"server_id":     job.ServerID,
 		}).Error("Failed to fetch deployment from database")
 		return fmt.Errorf("deployment not found")
 	}
+	bc.Deployment = deployment
+	bc.storedStatus = deployment.Status
+
+	// Only queued deployments are built. A deployment left in progress is
+	// resumed when the worker that was building it stopped renewing its lease.
+	expected := models.DeploymentStatusQueued
+	if deployment.Status == models.DeploymentStatusInProgress && queue.Attempt(ctx) > 1 {
+		expected = models.DeploymentStatusInProgress
+	}
+	if deployment.Status != expected {
+		logger.WithFields(map[string]interface{}{
+			"deployment_id": job.DeploymentID,
+			"server_id":     job.ServerID,
+			"status":        deployment.Status,
+		}).Warn("Build skipped: deployment is not queued")
+		return fmt.Errorf("deployment is %s, expected %s", deployment.Status, expected)
+	}
+
+	// A retried job starts its log from scratch
+	if err := ps.logStore.Delete(ctx, logstore.Key(job.ServerID, job.DeploymentID)); err != nil {
+		logger.WithFields(map[string]interface{}{
+			"deployment_id": job.DeploymentID,
+			"server_id":     job.ServerID,
+			"error":         err.Error(),
+		}).Warn("Failed to clear previous build log")
+	}
 
 	// Log deployment details
 	logger.WithFields(map[string]interface{}{
@@ -83,286 +167,590 @@ func (ps *PipelineService) ExecuteBuild(ctx context.Context, job *queue.BuildJob
 		"commit_hash":   deployment.CommitHash,
 	}).Debug("Deployment record retrieved")
 
+	bc.Logger.LogInfo("init", fmt.Sprintf("Starting build for deployment %s (branch %s, commit %s)", job.DeploymentID, job.Branch, shortCommit(job.CommitHash)))
+
 	deployment.Stages = stages
-	deployment.Status = "in_progress"
-	deployment.BuildLogs = ps.logger.GetLogs()
+	deployment.Status = models.DeploymentStatusInProgress
+	ps.flushLogs(ctx, bc)
 
-	// Update deployment with initialized stages
-	if err := ps.updateDeployment(ctx, deployment); err != nil {
-		ps.logger.LogError("init", fmt.Sprintf("Failed to update deployment: %v", err))
+	// Update deployment with initialized stages. This fails if another
+	// request changed the deployment since it was read.
+	if err := ps.updateDeployment(ctx, bc); err != nil {
+		bc.Logger.LogError("init", fmt.Sprintf("Failed to update deployment: %v", err))
 		return err
 	}
 
 	// Stage 1: Clone Repository
-	if err := ps.stageClone(ctx, job, deployment); err != nil {
-		ps.markStageFailed(ctx, deployment, "clone", err)
+	bc.StartedAt = time.Now()
+	if err := ps.runStage(ctx, bc, "clone", func() error {
+		return ps.stageClone(ctx, bc)
+	}); err != nil {
 		return err
 	}
 
-	ps.markStageCompleted(ctx, deployment, "clone")
-
 	// Stage 2: Validate mhive.config.yaml
-	tempDir := ps.getTempDir(job)
-	if err := ps.stageValidateConfig(ctx, job, deployment, tempDir); err != nil {
-		ps.markStageFailed(ctx, deployment, "validate_config", err)
-		defer os.RemoveAll(tempDir)
+	if err := ps.runStage(ctx, bc, "validate_config", func() error {
+		return ps.stageValidateConfig(ctx, bc)
+	}); err != nil {
 		return err
 	}
 
-	ps.markStageCompleted(ctx, deployment, "validate_config")
-
 	// Stage 3: Validate Dockerfile
-	if err := ps.stageValidateDocker(ctx, job, deployment, tempDir); err != nil {
-		ps.markStageFailed(ctx, deployment, "validate_docker", err)
-		defer os.RemoveAll(tempDir)
+	if err := ps.runStage(ctx, bc, "validate_docker", func() error {
+		return ps.stageValidateDocker(ctx, bc)
+	}); err != nil {
 		return err
 	}
 
-	ps.markStageCompleted(ctx, deployment, "validate_docker")
-
 	// Stage 4: Build Docker Image
-	imageName := ps.getImageName(job)
-	if err := ps.stageBuildImage(ctx, job, deployment, tempDir, imageName); err != nil {
-		ps.markStageFailed(ctx, deployment, "build_image", err)
-		defer os.RemoveAll(tempDir)
+	var image BuiltImage
+	if err := ps.runStage(ctx, bc, "build_image", func() (err error) {
+		image, err = ps.stageBuildImage(ctx, bc, bc.ImageName())
+		return err
+	}); err != nil {
 		return err
 	}
 
-	ps.markStageCompleted(ctx, deployment, "build_image")
-	defer os.RemoveAll(tempDir)
-
-	// Stage 5: Create/Verify ECR Repository
-	repoName, repoURI, err := ps.stageCreateECR(ctx, job, deployment)
-	if err != nil {
-		ps.markStageFailed(ctx, deployment, "create_ecr", err)
+	// Stage 5: Verify the image is a working MCP server before it is pushed
+	if err := ps.runStage(ctx, bc, "verify_mcp", func() error {
+		return ps.stageVerifyMCP(ctx, bc, image)
+	}); err != nil {
 		return err
 	}
 
-	ps.markStageCompleted(ctx, deployment, "create_ecr")
+	// Stage 6: Create/Verify the image repository. The stage keeps its
+	// original name so existing clients can follow it.
+	var registry Registry
+	var repo ImageRepository
+	if err := ps.runStage(ctx, bc, "create_ecr", func() (err error) {
+		registry, repo, err = ps.stageCreateRepository(ctx, bc)
+		return err
+	}); err != nil {
+		return err
+	}
 
-	// Update MCP with ECR repository information
-	if err := ps.updateMCPWithECRRepo(ctx, job.ServerID, repoName, repoURI); err != nil {
-		ps.logger.LogError("create_ecr", fmt.Sprintf("Failed to update MCP with ECR repo info: %v", err))
-		// Log warning but don't fail the build - ECR repo was created successfully
+	// Update MCP with image repository information
+	if err := ps.updateMCPWithECRRepo(ctx, job.ServerID, repo.Name, repo.URI); err != nil {
+		bc.Logger.LogError("create_ecr", fmt.Sprintf("Failed to update MCP with image repository info: %v", err))
+		// Log warning but don't fail the build - the repository was created successfully
 	}
 
-	// Stage 6: Push Image to ECR
-	imageURI, err := ps.stagePushImage(ctx, job, deployment, imageName, repoName)
-	if err != nil {
-		ps.markStageFailed(ctx, deployment, "push_image", err)
+	// Stage 7: Push Image to the registry
+	var pushed PushedImage
+	if err := ps.runStage(ctx, bc, "push_image", func() (err error) {
+		pushed, err = ps.stagePushImage(ctx, bc, registry, repo, image)
+		return err
+	}); err != nil {
 		return err
 	}
 
-	ps.markStageCompleted(ctx, deployment, "push_image")
+	// Describe the pushed image for MCP registries. A server that cannot be
+	// named for a registry still deploys.
+	serverJSON, err := generateServerJSON(bc, pushed)
+	if err != nil {
+		bc.Logger.LogWarning("finalize", fmt.Sprintf("Could not generate server.json: %v", err))
+	} else {
+		bc.Logger.LogInfo("finalize", fmt.Sprintf("Generated server.json for %s version %s", serverJSON.Name, serverJSON.Version))
+	}
 
 	// Mark build as completed
-	deployment.Status = "completed"
-	deployment.ImageURI = imageURI
-	deployment.BuildLogs = ps.logger.GetLogsWithSizeLimit()
-
-	if err := ps.updateDeployment(ctx, deployment); err != nil {
-		ps.logger.LogError("finalize", fmt.Sprintf("Failed to update deployment: %v", err))
+	bc.Logger.LogInfo("finalize", "Build pipeline completed successfully")
+	deployment.Status = models.DeploymentStatusCompleted
+	deployment.ImageURI = pushed.URI
+	deployment.ImageDigestURI = pushed.DigestURI
+	deployment.Image = &models.ImageMetadata{
+		Digest:          pushed.Digest,
+		Size:            pushed.Size,
+		LayerCount:      pushed.LayerCount,
+		LayerSizes:      pushed.LayerSizes,
+		BaseImage:       bc.BaseImage,
+		BuildDurationMs: time.Since(bc.StartedAt).Milliseconds(),
+	}
+	deployment.Manifest = bc.Manifest
+	deployment.ServerJSON = serverJSON
+	ps.flushLogs(ctx, bc)
+
+	if err := ps.updateDeployment(ctx, bc); err != nil {
+		bc.Logger.LogError("finalize", fmt.Sprintf("Failed to update deployment: %v", err))
 		return err
 	}
 
-	ps.logger.LogInfo("finalize", "Build pipeline completed successfully")
 	return nil
 }
 
 // stageClone handles repository cloning
-func (ps *PipelineService) stageClone(ctx context.Context, job *queue.BuildJob, deployment *models.Deployment) error {
-	ps.logger.LogInfo("clone", "Starting repository clone")
+func (ps *PipelineService) stageClone(ctx context.Context, bc *BuildContext) error {
+	bc.Logger.LogInfo("clone", "Starting repository clone")
 
 	// Get MCP server details
-	mcp, err := ps.mcpRepo.Get(ctx, job.ServerID)
+	mcp, err := ps.mcpRepo.Get(ctx, bc.Job.ServerID)
 	if err != nil || mcp == nil {
-		ps.logger.LogError("clone", "MCP server not found")
+		bc.Logger.LogError("clone", "MCP server not found")
 		return fmt.Errorf("mcp server not found")
 	}
+	bc.Server = mcp
+
+	// Secret environment values must never show up in build output
+	for _, env := range mcp.EnvironmentVariables {
+		if env.IsSecret {
+			bc.AddSecret(env.Value)
+		}
+	}
 
 	// Get GitHub connection and token
-	githubConn, err := ps.githubRepo.GetConnectionByUserId(ctx, job.UserID)
+	githubConn, err := ps.githubRepo.GetConnectionByUserId(ctx, bc.Job.UserID)
 	if err != nil || githubConn == nil {
-		ps.logger.LogError("clone", "GitHub connection not found")
+		bc.Logger.LogError("clone", "GitHub connection not found")
 		return fmt.Errorf("github connection not found")
 	}
 
 	// Decrypt token
 	accessToken, err := ps.githubService.DecryptToken(githubConn.AccessToken)
 	if err != nil {
-		ps.logger.LogError("clone", fmt.Sprintf("Failed to decrypt GitHub token: %v", err))
+		bc.Logger.LogError("clone", fmt.Sprintf("Failed to decrypt GitHub token: %v", err))
 		return fmt.Errorf("token decryption failed: %w", err)
 	}
+	bc.AddSecret(accessToken)
 
 	// Clone repository
-	tempDir := ps.getTempDir(job)
-	if err := ps.cloneRepository(mcp.Repository, job.Branch, job.CommitHash, tempDir, accessToken); err != nil {
-		ps.logger.LogError("clone", fmt.Sprintf("Repository clone failed: %v", err))
+	if err := ps.cloneRepository(ctx, mcp.Repository, bc.Job.Branch, bc.Job.CommitHash, bc.WorkDir, accessToken); err != nil {
+		bc.Logger.LogError("clone", fmt.Sprintf("Repository clone failed: %v", err))
 		return err
 	}
 
-	ps.logger.LogInfo("clone", fmt.Sprintf("Repository cloned successfully to %s", tempDir))
+	bc.Logger.LogInfo("clone", fmt.Sprintf("Repository cloned successfully to %s", bc.WorkDir))
 	return nil
 }
 
 // stageValidateConfig validates mhive.config.yaml
-func (ps *PipelineService) stageValidateConfig(ctx context.Context, job *queue.BuildJob, deployment *models.Deployment, tempDir string) error {
-	ps.logger.LogInfo("validate_config", "Starting mhive.config.yaml validation")
+func (ps *PipelineService) stageValidateConfig(ctx context.Context, bc *BuildContext) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	bc.Logger.LogInfo("validate_config", "Starting mhive.config.yaml validation")
 
-	configPath := filepath.Join(tempDir, "mhive.config.yaml")
-	if err := ps.validateConfig(configPath); err != nil {
-		ps.logger.LogError("validate_config", fmt.Sprintf("Config validation failed: %v", err))
+	configPath := filepath.Join(bc.WorkDir, mhiveconfig.FileName)
+	if err := ps.validateConfig(bc, configPath); err != nil {
+		bc.Logger.LogError("validate_config", fmt.Sprintf("Config validation failed: %v", err))
 		return err
 	}
 
-	ps.logger.LogInfo("validate_config", "mhive.config.yaml is valid")
+	bc.Logger.LogInfo("validate_config", "mhive.config.yaml is valid")
 	return nil
 }
 
-// stageValidateDocker validates Dockerfile
-func (ps *PipelineService) stageValidateDocker(ctx context.Context, job *queue.BuildJob, deployment *models.Deployment, tempDir string) error {
-	ps.logger.LogInfo("validate_docker", "Starting Dockerfile validation")
+// stageValidateDocker resolves the build context and Dockerfile declared in
+// mhive.config.yaml and validates the Dockerfile
+func (ps *PipelineService) stageValidateDocker(ctx context.Context, bc *BuildContext) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	bc.Logger.LogInfo("validate_docker", "Starting Dockerfile validation")
 
-	dockerfilePath := filepath.Join(tempDir, "Dockerfile")
-	if _, err := os.Stat(dockerfilePath); os.IsNotExist(err) {
-		ps.logger.LogError("validate_docker", "Dockerfile not found at "+dockerfilePath)
-		return fmt.Errorf("dockerfile not found")
+	build := mhiveconfig.Build{Context: ".", Dockerfile: "Dockerfile"}
+	if bc.Config != nil {
+		build = bc.Config.Build
 	}
-	ps.logger.LogInfo("validate_docker", "Dockerfile file exists at "+dockerfilePath)
+
+	contextDir, err := bc.repoPath(build.Context)
+	if err != nil {
+		bc.Logger.LogError("validate_docker", fmt.Sprintf("Invalid build context: %v", err))
+		return fmt.Errorf("invalid build context: %w", err)
+	}
+	if info, err := os.Stat(contextDir); err != nil || !info.IsDir() {
+		bc.Logger.LogError("validate_docker", fmt.Sprintf("Build context %s is not a directory", build.Context))
+		return fmt.Errorf("build context %s is not a directory", build.Context)
+	}
+	bc.ContextDir = contextDir
+	bc.Logger.LogInfo("validate_docker", "Build context: "+build.Context)
+
+	var dockerfilePath string
+	if _, err := os.Lstat(filepath.Join(contextDir, "Dockerfile")); errors.Is(err, os.ErrNotExist) && ps.canGenerateDockerfile(bc) {
+		if dockerfilePath, err = ps.generateDockerfile(bc); err != nil {
+			return err
+		}
+	} else {
+		if dockerfilePath, err = bc.repoPath(build.Dockerfile); err != nil {
+			bc.Logger.LogError("validate_docker", fmt.Sprintf("Invalid Dockerfile path: %v", err))
+			return fmt.Errorf("invalid dockerfile path: %w", err)
+		}
+		if info, err := os.Stat(dockerfilePath); err != nil || !info.Mode().IsRegular() {
+			bc.Logger.LogError("validate_docker", fmt.Sprintf("Dockerfile %s is not a regular file", build.Dockerfile))
+			return fmt.Errorf("dockerfile %s is not a regular file", build.Dockerfile)
+		}
+		bc.Logger.LogInfo("validate_docker", "Dockerfile file exists at "+build.Dockerfile)
+	}
+	bc.Dockerfile = dockerfilePath
 
 	// Read the Dockerfile to validate its format
 	data, err := os.ReadFile(dockerfilePath)
 	if err != nil {
-		ps.logger.LogError("validate_docker", fmt.Sprintf("Failed to read Dockerfile: %v", err))
+		bc.Logger.LogError("validate_docker", fmt.Sprintf("Failed to read Dockerfile: %v", err))
 		return fmt.Errorf("failed to read dockerfile: %w", err)
 	}
-	ps.logger.LogInfo("validate_docker", fmt.Sprintf("Dockerfile read successfully (%d bytes)", len(data)))
+	bc.Logger.LogInfo("validate_docker", fmt.Sprintf("Dockerfile read successfully (%d bytes)", len(data)))
 
 	// Basic syntax validation - check for required instructions
 	content := string(data)
 	if len(content) == 0 {
-		ps.logger.LogError("validate_docker", "Dockerfile is empty")
+		bc.Logger.LogError("validate_docker", "Dockerfile is empty")
 		return fmt.Errorf("dockerfile is empty")
 	}
 
-	ps.logger.LogInfo("validate_docker", "Dockerfile syntax validation completed successfully")
+	bc.BaseImage = dockerfileBaseImage(content, build.Target)
+	switch {
+	case build.Target != "" && bc.BaseImage == "":
+		bc.Logger.LogError("validate_docker", fmt.Sprintf("Dockerfile has no stage named %s", build.Target))
+		return fmt.Errorf("dockerfile has no stage named %s", build.Target)
+	case bc.BaseImage == "":
+		bc.Logger.LogWarning("validate_docker", "Dockerfile has no FROM instruction")
+	default:
+		bc.Logger.LogInfo("validate_docker", "Base image: "+bc.BaseImage)
+	}
+
+	bc.Logger.LogInfo("validate_docker", "Dockerfile syntax validation completed successfully")
 	return nil
 }
 
-// stageBuildImage builds the Docker image
-func (ps *PipelineService) stageBuildImage(ctx context.Context, job *queue.BuildJob, deployment *models.Deployment, tempDir, imageName string) error {
-	ps.logger.LogInfo("build_image", fmt.Sprintf("Starting Docker image build for %s", imageName))
+// canGenerateDockerfile reports whether a missing Dockerfile can be generated.
+// Only the default Dockerfile of the build context is; one named in
+// mhive.config.yaml has to exist.
+func (ps *PipelineService) canGenerateDockerfile(bc *BuildContext) bool {
+	return ps.dockerfiles != nil && bc.Config != nil &&
+		bc.Config.Build.Dockerfile == path.Join(bc.Config.Build.Context, "Dockerfile")
+}
+
+// generateDockerfile renders a Dockerfile for the build context and writes it
+// to the build outputs, so the clone is left as it was. The template it came
+// from, what was detected and the file itself are logged for transparency.
+func (ps *PipelineService) generateDockerfile(bc *BuildContext) (string, error) {
+	bc.Logger.LogInfo("validate_docker", "No Dockerfile in the repository, generating one")
+
+	_, _, owner, _ := parseRepositoryURL(bc.Server.Repository)
+	result, err := ps.dockerfiles.Generate(bc.ContextDir, bc.Config, owner)
+	if err != nil {
+		bc.Logger.LogError("validate_docker", fmt.Sprintf("Failed to generate Dockerfile: %v", err))
+		return "", fmt.Errorf("failed to generate dockerfile: %w", err)
+	}
+	project := result.Project
+	bc.Logger.LogInfo("validate_docker", fmt.Sprintf("Detected runtime %s, entrypoint %s", project.Runtime, strings.Join(project.Entrypoint, " ")))
+
+	dir := filepath.Join(bc.OutputDir, "generated")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create generated dockerfile directory: %w", err)
+	}
+	dockerfilePath := filepath.Join(dir, "Dockerfile")
+	if err := os.WriteFile(dockerfilePath, result.Dockerfile, 0o644); err != nil {
+		return "", fmt.Errorf("failed to write generated dockerfile: %w", err)
+	}
+
+	bc.Logger.LogInfo("validate_docker", fmt.Sprintf("Generated Dockerfile from the %s template (%s):", project.Runtime, result.Source))
+	for _, line := range strings.Split(strings.TrimRight(string(result.Dockerfile), "\n"), "\n") {
+		bc.Logger.LogInfo("validate_docker", "  "+line)
+	}
+	return dockerfilePath, nil
+}
+
+// stageBuildImage builds the Docker image with the server's builder
+func (ps *PipelineService) stageBuildImage(ctx context.Context, bc *BuildContext, imageName string) (BuiltImage, error) {
+	builder, err := ps.builders.ForServer(bc.Server)
+	if err != nil {
+		bc.Logger.LogError("build_image", err.Error())
+		return BuiltImage{}, err
+	}
+
+	bc.Logger.LogInfo("build_image", fmt.Sprintf("Starting Docker image build for %s with %s", imageName, builder.Name()))
+
+	// Secret environment variables of the server can be mounted by RUN steps
+	secrets := make(map[string]string)
+	for _, env := range bc.Server.EnvironmentVariables {
+		if env.IsSecret {
+			secrets[env.Name] = env.Value
+		}
+	}
+
+	var target string
+	var buildArgs map[string]string
+	if bc.Config != nil {
+		target, buildArgs = bc.Config.Build.Target, bc.Config.Build.Args
+	}
+
+	image, err := builder.Build(ctx, BuildRequest{
+		ContextDir: bc.ContextDir,
+		Dockerfile: bc.Dockerfile,
+		Target:     target,
+		BuildArgs:  buildArgs,
+		Image:      imageName,
+		OutputDir:  bc.OutputDir,
+		CacheKey:   repositoryName(bc.Job.ServerID),
+		Secrets:    secrets,
+	}, bc.Logger)
+	if err != nil {
+		bc.Logger.LogError("build_image", fmt.Sprintf("Docker build failed: %v", err))
+		return BuiltImage{}, err
+	}
 
-	if err := ps.buildDockerImage(tempDir, imageName); err != nil {
-		ps.logger.LogError("build_image", fmt.Sprintf("Docker build failed: %v", err))
+	bc.Logger.LogInfo("build_image", fmt.Sprintf("Docker image built successfully: %s", imageName))
+	return image, nil
+}
+
+// stageVerifyMCP starts the built image without network access and performs
+// the MCP handshake with it
+func (ps *PipelineService) stageVerifyMCP(ctx context.Context, bc *BuildContext, image BuiltImage) error {
+	if ps.verifier == nil {
+		bc.Logger.LogWarning("verify_mcp", "MCP verification is disabled on this build server, skipping")
+		return nil
+	}
+	if bc.Config.Transport == mhiveconfig.TransportSSE {
+		bc.Logger.LogWarning("verify_mcp", "MCP verification does not support the sse transport, skipping")
+		return nil
+	}
+
+	bc.Logger.LogInfo("verify_mcp", fmt.Sprintf("Starting %s without network access and performing the MCP handshake over %s", image.Name, bc.Config.Transport))
+
+	env := make(map[string]string, len(bc.Server.EnvironmentVariables))
+	for _, variable := range bc.Server.EnvironmentVariables {
+		env[variable.Name] = variable.Value
+	}
+	for _, name := range bc.Config.RequiredEnv() {
+		if _, ok := env[name]; !ok {
+			bc.Logger.LogWarning("verify_mcp", fmt.Sprintf("Required environment variable %s is not set on the server", name))
+		}
+	}
+
+	manifest, err := ps.verifier.Verify(ctx, VerifyRequest{
+		Image:     image,
+		Container: "mcp-verify-" + bc.Job.DeploymentID,
+		Config:    bc.Config,
+		Env:       env,
+	}, bc.Logger)
+	if err != nil {
+		bc.Logger.LogError("verify_mcp", fmt.Sprintf("MCP verification failed: %v", err))
 		return err
 	}
+	bc.Manifest = manifest
 
-	ps.logger.LogInfo("build_image", fmt.Sprintf("Docker image built successfully: %s", imageName))
+	bc.Logger.LogInfo("verify_mcp", fmt.Sprintf("Server %s %s speaks MCP %s", manifest.ServerName, manifest.ServerVersion, manifest.ProtocolVersion))
+	toolNames := make([]string, 0, len(manifest.Tools))
+	for _, tool := range manifest.Tools {
+		toolNames = append(toolNames, tool.Name)
+	}
+	bc.Logger.LogInfo("verify_mcp", fmt.Sprintf("%d tools (%s), %d resources, %d prompts",
+		len(manifest.Tools), strings.Join(toolNames, ", "), len(manifest.Resources), len(manifest.Prompts)))
 	return nil
 }
 
-// stageCreateECR creates or verifies ECR repository
-func (ps *PipelineService) stageCreateECR(ctx context.Context, job *queue.BuildJob, deployment *models.Deployment) (string, string, error) {
-	ps.logger.LogInfo("create_ecr", fmt.Sprintf("Creating/verifying ECR repository for server %s", job.ServerID))
+// stageCreateRepository picks the server's registry and creates or verifies its image repository
+func (ps *PipelineService) stageCreateRepository(ctx context.Context, bc *BuildContext) (Registry, ImageRepository, error) {
+	registry, err := ps.registries.ForServer(bc.Server)
+	if err != nil {
+		bc.Logger.LogError("create_ecr", err.Error())
+		return nil, ImageRepository{}, err
+	}
+
+	bc.Logger.LogInfo("create_ecr", fmt.Sprintf("Creating/verifying %s repository for server %s", registry.Name(), bc.Job.ServerID))
 
-	repoName, err := ps.ecrService.GetOrCreateRepository(ctx, job.ServerID)
+	repo, err := registry.EnsureRepository(ctx, bc.Job.ServerID)
 	if err != nil {
-		ps.logger.LogError("create_ecr", fmt.Sprintf("Failed to create ECR repository: %v", err))
-		return "", "", err
+		bc.Logger.LogError("create_ecr", fmt.Sprintf("Failed to create %s repository: %v", registry.Name(), err))
+		return nil, ImageRepository{}, err
 	}
 
-	repoURI := ps.ecrService.GetRepositoryURI(repoName)
-	ps.logger.LogInfo("create_ecr", fmt.Sprintf("ECR repository ready: %s", repoURI))
-	return repoName, repoURI, nil
+	bc.Logger.LogInfo("create_ecr", fmt.Sprintf("Image repository ready: %s", repo.URI))
+	return registry, repo, nil
 }
 
-// stagePushImage pushes the Docker image to ECR
-func (ps *PipelineService) stagePushImage(ctx context.Context, job *queue.BuildJob, deployment *models.Deployment, imageName, repoName string) (string, error) {
-	ps.logger.LogInfo("push_image", fmt.Sprintf("Pushing Docker image to ECR: %s", repoName))
+// stagePushImage pushes the Docker image to the registry
+func (ps *PipelineService) stagePushImage(ctx context.Context, bc *BuildContext, registry Registry, repo ImageRepository, image BuiltImage) (PushedImage, error) {
+	bc.Logger.LogInfo("push_image", fmt.Sprintf("Pushing Docker image to %s: %s", registry.Name(), repo.Name))
 
 	// Create tags for the image
 	tags := []string{
-		fmt.Sprintf("%s-%s", job.Branch, job.CommitHash[:8]),
+		fmt.Sprintf("%s-%s", bc.Job.Branch, shortCommit(bc.Job.CommitHash)),
 		"latest",
 	}
 
-	imageURI, err := ps.ecrService.PushImage(ctx, repoName, imageName, tags)
+	pushed, err := registry.Push(ctx, repo, image, tags)
 	if err != nil {
-		ps.logger.LogError("push_image", fmt.Sprintf("Failed to push image to ECR: %v", err))
-		return "", err
+		bc.Logger.LogError("push_image", fmt.Sprintf("Failed to push image to %s: %v", registry.Name(), err))
+		return PushedImage{}, err
 	}
 
-	ps.logger.LogInfo("push_image", fmt.Sprintf("Image pushed successfully to ECR: %s", imageURI))
-	return imageURI, nil
+	bc.Logger.LogInfo("push_image", fmt.Sprintf("Image pushed successfully to %s: %s (%s, %d layers, %d bytes)", registry.Name(), pushed.URI, pushed.Digest, pushed.LayerCount, pushed.Size))
+	return pushed, nil
 }
 
 // Helper methods
 
-// getTempDir returns the temporary directory path for a job
-func (ps *PipelineService) getTempDir(job *queue.BuildJob) string {
-	return filepath.Join(os.TempDir(), fmt.Sprintf("mcp-build-%s-%s", job.ServerID, job.DeploymentID))
+// runStage marks a stage as started, runs it and records its outcome. It
+// returns the stage's error, joined with the error of recording it if that
+// write stops the build.
+func (ps *PipelineService) runStage(ctx context.Context, bc *BuildContext, stageName string, run func() error) error {
+	if err := ps.markStageStarted(ctx, bc, stageName); err != nil {
+		return err
+	}
+	if err := run(); err != nil {
+		if writeErr := ps.markStageFailed(ctx, bc, stageName, err); writeErr != nil {
+			return errors.Join(err, writeErr)
+		}
+		return err
+	}
+	return ps.markStageCompleted(ctx, bc, stageName)
 }
 
-// getImageName returns the Docker image name for a job
-func (ps *PipelineService) getImageName(job *queue.BuildJob) string {
-	return fmt.Sprintf("%s:%s-%s", job.ServerID, job.Branch, job.CommitHash[:8])
+// markStageStarted marks a stage as in progress in the deployment
+func (ps *PipelineService) markStageStarted(ctx context.Context, bc *BuildContext, stageName string) error {
+	ps.setStageStatus(bc, stageName, models.StageStatusInProgress)
+	return ps.saveProgress(ctx, bc, stageName)
 }
 
 // markStageCompleted marks a stage as completed in the deployment
-func (ps *PipelineService) markStageCompleted(ctx context.Context, deployment *models.Deployment, stageName string) {
-	if deployment.Stages == nil {
-		deployment.Stages = make(map[string]*models.BuildStageStatus)
-	}
+func (ps *PipelineService) markStageCompleted(ctx context.Context, bc *BuildContext, stageName string) error {
+	ps.setStageStatus(bc, stageName, models.StageStatusCompleted)
+	return ps.saveProgress(ctx, bc, stageName)
+}
 
-	now := time.Now()
-	deployment.Stages[stageName] = &models.BuildStageStatus{
-		Status:      "completed",
-		CompletedAt: &now,
+// markStageFailed marks a stage as failed in the deployment, or as cancelled
+// if the build was stopped by a user
+func (ps *PipelineService) markStageFailed(ctx context.Context, bc *BuildContext, stageName string, err error) error {
+	if by, ok := queue.CancelledBy(ctx); ok {
+		return ps.markStageCancelled(ctx, bc, stageName, by)
 	}
 
-	deployment.BuildLogs = ps.logger.GetLogsWithSizeLimit()
-	ps.updateDeployment(ctx, deployment)
+	stage := ps.setStageStatus(bc, stageName, models.StageStatusFailed)
+	stage.Error = bc.Logger.Redact(err.Error())
+
+	bc.Deployment.Status = models.DeploymentStatusFailed
+	return ps.saveProgress(ctx, bc, stageName)
 }
 
-// markStageFailed marks a stage as failed in the deployment
-func (ps *PipelineService) markStageFailed(ctx context.Context, deployment *models.Deployment, stageName string, err error) {
+// markStageCancelled marks a stage and the deployment as cancelled
+func (ps *PipelineService) markStageCancelled(ctx context.Context, bc *BuildContext, stageName, cancelledBy string) error {
+	bc.Logger.LogWarning(stageName, fmt.Sprintf("Build cancelled by %s", cancelledBy))
+
+	stage := ps.setStageStatus(bc, stageName, models.StageStatusCancelled)
+	stage.CancelledBy = cancelledBy
+
+	bc.Deployment.Status = models.DeploymentStatusCancelled
+	return ps.saveProgress(ctx, bc, stageName)
+}
+
+// saveProgress writes the deployment after a stage changed. A write rejected
+// because the deployment was changed elsewhere, for example by a worker that
+// took the job over, or because its status may not change this way, stops
+// the build. Other write errors are logged and the change is written again
+// with the next stage.
+func (ps *PipelineService) saveProgress(ctx context.Context, bc *BuildContext, stageName string) error {
+	ps.flushLogs(ctx, bc)
+
+	err := ps.updateDeployment(ctx, bc)
+	if errors.Is(err, repository.ErrConflict) || errors.Is(err, repository.ErrInvalidTransition) {
+		bc.Logger.LogError(stageName, fmt.Sprintf("Build stopped: %v", err))
+		return fmt.Errorf("failed to record %s stage: %w", stageName, err)
+	}
+	return nil
+}
+
+// setStageStatus moves a stage of the deployment to a new status and records when it started or ended
+func (ps *PipelineService) setStageStatus(bc *BuildContext, stageName string, status models.StageStatus) *models.BuildStageStatus {
+	deployment := bc.Deployment
 	if deployment.Stages == nil {
 		deployment.Stages = make(map[string]*models.BuildStageStatus)
 	}
 
+	stage := deployment.Stages[stageName]
+	if stage == nil {
+		stage = &models.BuildStageStatus{Status: models.StageStatusPending}
+		deployment.Stages[stageName] = stage
+	}
+
+	if !stage.Status.CanTransitionTo(status) {
+		logger.WithFields(map[string]interface{}{
+			"deployment_id": deployment.DeploymentId,
+			"server_id":     deployment.ServerId,
+			"stage":         stageName,
+			"from":          stage.Status,
+			"to":            status,
+		}).Warn("Unexpected build stage transition")
+	}
+
 	now := time.Now()
-	deployment.Stages[stageName] = &models.BuildStageStatus{
-		Status:      "failed",
-		CompletedAt: &now,
-		Error:       err.Error(),
+	stage.Status = status
+	if status == models.StageStatusInProgress {
+		stage.StartedAt = &now
+	} else {
+		stage.CompletedAt = &now
 	}
+	return stage
+}
 
-	deployment.Status = "failed"
-	deployment.BuildLogs = ps.logger.GetLogsWithSizeLimit()
-	ps.updateDeployment(ctx, deployment)
+// flushLogs writes the entries logged since the last flush to the log store
+// and keeps only the latest entries on the deployment record. If the log
+// store is unavailable the record falls back to holding the size-limited log.
+func (ps *PipelineService) flushLogs(ctx context.Context, bc *BuildContext) {
+	key := logstore.Key(bc.Job.ServerID, bc.Job.DeploymentID)
+
+	pending := bc.Logger.GetLogsFrom(bc.flushedLogs)
+	if len(pending) > 0 {
+		if err := ps.logStore.Append(context.WithoutCancel(ctx), key, bc.flushedLogs, pending); err != nil {
+			logger.WithFields(map[string]interface{}{
+				"deployment_id": bc.Job.DeploymentID,
+				"server_id":     bc.Job.ServerID,
+				"log_store":     ps.logStore.Name(),
+				"error":         err.Error(),
+			}).Warn("Failed to write build logs to log store")
+			bc.Deployment.LogRef = nil
+			bc.Deployment.BuildLogs = bc.Logger.GetLogsWithSizeLimit()
+			return
+		}
+		bc.flushedLogs += len(pending)
+	}
+
+	bc.Deployment.LogRef = &models.LogReference{
+		Store:   ps.logStore.Name(),
+		Key:     key,
+		Entries: bc.flushedLogs,
+		Attempt: bc.Logger.Attempt(),
+	}
+	bc.Deployment.BuildLogs = bc.Logger.GetTail(LogTailSize)
 }
 
-// updateDeployment updates the deployment record in the database
-func (ps *PipelineService) updateDeployment(ctx context.Context, deployment *models.Deployment) error {
+// updateDeployment updates the deployment record in the database, on the
+// condition that its stored status is still the one this build last wrote.
+// The write is detached from cancellation so a cancelled build can still record its final state.
+func (ps *PipelineService) updateDeployment(ctx context.Context, bc *BuildContext) error {
+	deployment := bc.Deployment
 	deployment.UpdatedAt = time.Now()
-	return ps.deploymentRepo.Update(ctx, deployment)
+
+	if err := ps.deploymentRepo.Update(context.WithoutCancel(ctx), deployment, bc.storedStatus); err != nil {
+		logger.WithFields(map[string]interface{}{
+			"deployment_id":   deployment.DeploymentId,
+			"server_id":       deployment.ServerId,
+			"status":          deployment.Status,
+			"expected_status": bc.storedStatus,
+			"error":           err.Error(),
+		}).Error("Failed to update deployment")
+		return err
+	}
+
+	bc.storedStatus = deployment.Status
+	return nil
 }
 
 // cloneRepository clones a git repository at a specific branch and commit
-func (ps *PipelineService) cloneRepository(repoURL, branch, commitHash, targetDir, accessToken string) error {
+func (ps *PipelineService) cloneRepository(ctx context.Context, repoURL, branch, commitHash, targetDir, accessToken string) error {
 	// Inject GitHub token for authentication
 	authenticatedURL := ps.injectGitHubToken(repoURL, accessToken)
 
 	// Clone the repository
-	cmd := exec.Command("git", "clone", "-b", branch, authenticatedURL, targetDir)
-	if err := cmd.Run(); err != nil {
+	err := ps.runner.Run(ctx, Command{Name: "git", Args: []string{"clone", "-b", branch, authenticatedURL, targetDir}})
+	if err != nil {
 		return fmt.Errorf("git clone failed: %w", err)
 	}
 
 	// Checkout specific commit
-	cmd = exec.Command("git", "-C", targetDir, "checkout", commitHash)
-	if err := cmd.Run(); err != nil {
+	err = ps.runner.Run(ctx, Command{Name: "git", Args: []string{"-C", targetDir, "checkout", commitHash}})
+	if err != nil {
 		return fmt.Errorf("git checkout failed: %w", err)
 	}
 
@@ -377,74 +765,62 @@ func (ps *PipelineService) injectGitHubToken(repoURL, token string) string {
 	return repoURL
 }
 
-// validateConfig checks if mhive.config.yaml is valid YAML
-func (ps *PipelineService) validateConfig(configPath string) error {
+// validateConfig parses mhive.config.yaml into bc.Config. Every problem is
+// logged with its line so users can fix the file in one go.
+func (ps *PipelineService) validateConfig(bc *BuildContext, configPath string) error {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		ps.logger.LogError("validate_config", "mhive.config.yaml not found at "+configPath)
+		bc.Logger.LogError("validate_config", "mhive.config.yaml not found at "+configPath)
 		return fmt.Errorf("mhive.config.yaml not found")
 	}
-	ps.logger.LogInfo("validate_config", "mhive.config.yaml file exists")
+	bc.Logger.LogInfo("validate_config", "mhive.config.yaml file exists")
 
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		ps.logger.LogError("validate_config", fmt.Sprintf("Failed to read mhive.config.yaml: %v", err))
+		bc.Logger.LogError("validate_config", fmt.Sprintf("Failed to read mhive.config.yaml: %v", err))
 		return fmt.Errorf("failed to read mhive.config.yaml: %w", err)
 	}
-	ps.logger.LogInfo("validate_config", fmt.Sprintf("Successfully read mhive.config.yaml (%d bytes)", len(data)))
+	bc.Logger.LogInfo("validate_config", fmt.Sprintf("Successfully read mhive.config.yaml (%d bytes)", len(data)))
 
-	var config map[string]interface{}
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		ps.logger.LogError("validate_config", fmt.Sprintf("Invalid YAML syntax: %v", err))
-		return fmt.Errorf("invalid YAML syntax: %w", err)
+	// A file without a version that leaves out the name is named after the server
+	defaultName := bc.Job.ServerID
+	if bc.Server != nil && mhiveconfig.DefaultName(bc.Server.Name) != "" {
+		defaultName = bc.Server.Name
 	}
-	ps.logger.LogInfo("validate_config", fmt.Sprintf("YAML syntax is valid. Configuration contains %d root keys", len(config)))
-
-	// Log configuration keys for validation
-	ps.logger.LogInfo("validate_config", "Configuration validation completed successfully")
-	return nil
-}
-
-// buildDockerImage builds a Docker image from the cloned repository
-func (ps *PipelineService) buildDockerImage(repoDir, imageName string) error {
-	dockerfilePath := filepath.Join(repoDir, "Dockerfile")
-	if _, err := os.Stat(dockerfilePath); os.IsNotExist(err) {
-		return fmt.Errorf("dockerfile not found in repository")
-	}
-
-	cmd := exec.Command("docker", "build", "-t", imageName, repoDir)
-
-	// Capture combined stdout and stderr to log build output
-	output, err := cmd.CombinedOutput()
-
-	// Log the output regardless of error
-	if output != nil {
-		outputStr := string(output)
-		// Log Docker build output line by line
-		ps.logger.LogInfo("build_image", outputStr)
+	config, warnings, err := mhiveconfig.Parse(data, defaultName)
+	for _, warning := range warnings {
+		bc.Logger.LogWarning("validate_config", warning.Error())
 	}
-
 	if err != nil {
-		return fmt.Errorf("docker build failed: %w", err)
+		var validationErr *mhiveconfig.ValidationError
+		if errors.As(err, &validationErr) {
+			for _, fieldErr := range validationErr.Errors {
+				bc.Logger.LogError("validate_config", fieldErr.Error())
+			}
+		}
+		return err
 	}
+	bc.Config = config
 
+	runtime := config.Runtime
+	if runtime == "" {
+		runtime = "detected"
+	}
+	bc.Logger.LogInfo("validate_config", fmt.Sprintf("Configuration is valid: name=%s, runtime=%s, transport=%s, version=%d",
+		config.Name, runtime, config.Transport, config.Version))
 	return nil
 }
 
-// updateMCPWithECRRepo updates the MCP with ECR repository information
+// updateMCPWithECRRepo updates the MCP with ECR repository information.
+// Only the ECR fields are changed, reapplied on a fresh copy if the server was
+// modified concurrently, so edits made through the API are kept.
 func (ps *PipelineService) updateMCPWithECRRepo(ctx context.Context, serverID, repoName, repoURI string) error {
-	// Get the MCP server
-	mcp, err := ps.mcpRepo.Get(ctx, serverID)
-	if err != nil || mcp == nil {
-		return fmt.Errorf("failed to get MCP server: %w", err)
-	}
-
-	// Update ECR repository information
-	mcp.ECRRepositoryName = repoName
-	mcp.ECRRepositoryURI = repoURI
-	mcp.UpdatedAt = time.Now()
-
-	// Save the updated MCP
-	if err := ps.mcpRepo.Update(ctx, mcp); err != nil {
+	_, err := repository.UpdateMCPWithRetry(ctx, ps.mcpRepo, serverID, func(mcp *models.MCPServer) error {
+		mcp.ECRRepositoryName = repoName
+		mcp.ECRRepositoryURI = repoURI
+		mcp.UpdatedAt = time.Now()
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("failed to update MCP with ECR repo info: %w", err)
 	}
 
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// processWaitDelay bounds how long Wait blocks on output pipes after the
+// process group has been killed
+const processWaitDelay = 10 * time.Second
+
+// Command describes an external program run by the build pipeline
+type Command struct {
+	Name string
+	Args []string
+
+	// Env is added to the server's environment
+	Env []string
+
+	// Stdin is the program's input; nil means no input
+	Stdin io.Reader
+
+	// Stdout and Stderr receive the program's output; nil discards it
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// CommandRunner runs external programs such as git and docker. Tests replace
+// it to run the pipeline without touching the host.
+type CommandRunner interface {
+	// Run starts the command and waits for it to exit. Cancelling ctx kills it.
+	Run(ctx context.Context, command Command) error
+}
+
+// execRunner runs commands as child processes
+type execRunner struct{}
+
+// NewExecRunner creates a CommandRunner that starts real processes
+func NewExecRunner() CommandRunner {
+	return execRunner{}
+}
+
+// Run starts the command and waits for it to exit
+func (execRunner) Run(ctx context.Context, command Command) error {
+	cmd := newCommand(ctx, command.Name, command.Args...)
+	if len(command.Env) > 0 {
+		cmd.Env = append(os.Environ(), command.Env...)
+	}
+	cmd.Stdin = command.Stdin
+	cmd.Stdout = command.Stdout
+	cmd.Stderr = command.Stderr
+	return cmd.Run()
+}
+
+// newCommand creates a command that is bound to ctx. When ctx is cancelled
+// the whole process tree is killed, not just the direct child, so that
+// helpers spawned by git or docker do not outlive the build.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = processWaitDelay
+	setProcessGroup(cmd)
+	return cmd
+}
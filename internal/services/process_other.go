@@ -0,0 +1,9 @@
+//go:build !unix
+
+package services
+
+import "os/exec"
+
+// setProcessGroup is a no-op on platforms without process groups; the
+// default CommandContext behaviour kills the direct child only
+func setProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,57 @@
+//go:build unix
+
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestExecRunner_CancelKillsProcessGroup cancels a shell whose background
+// child holds its output open. Killing only the shell would leave Run waiting
+// for the child until processWaitDelay.
+func TestExecRunner_CancelKillsProcessGroup(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	output := &signalWriter{written: started}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- NewExecRunner().Run(ctx, Command{Name: "sh", Args: []string{"-c", "sleep 60 & echo started; wait"}, Stdout: output})
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The command did not start")
+	}
+	cancelled := time.Now()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected the cancelled command to fail")
+		}
+		if elapsed := time.Since(cancelled); elapsed > processWaitDelay/2 {
+			t.Errorf("Run returned %s after cancellation; the child was not killed", elapsed)
+		}
+	case <-time.After(processWaitDelay + 5*time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+}
+
+// signalWriter closes written on the first write
+type signalWriter struct {
+	written chan struct{}
+	closed  bool
+}
+
+func (w *signalWriter) Write(p []byte) (int, error) {
+	if !w.closed {
+		w.closed = true
+		close(w.written)
+	}
+	return len(p), nil
+}
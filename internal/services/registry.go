@@ -0,0 +1,135 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// Registry backend names, used in configuration and on MCP servers
+const (
+	RegistryECR   = "ecr"
+	RegistryOCI   = "oci"
+	RegistryLocal = "local"
+)
+
+// ErrImageNotFound is returned when a tag or digest does not exist in a repository
+var ErrImageNotFound = errors.New("image not found in registry")
+
+// ImageRepository is the repository that holds the images of one MCP server
+type ImageRepository struct {
+	Name string // repository name within the registry, e.g. "mcp-server-1"
+	URI  string // address images are pushed to, without tag
+}
+
+// PushedImage is an image stored in a registry
+type PushedImage struct {
+	URI        string  // repository URI and first tag, e.g. "ghcr.io/acme/mcp-server-1:main-abc1234"
+	DigestURI  string  // repository URI and manifest digest, e.g. "ghcr.io/acme/mcp-server-1@sha256:..."; empty when nothing was pushed
+	Digest     string  // digest of the pushed manifest
+	Size       int64   // size of all layers in bytes, compressed as stored in the registry
+	LayerCount int     // number of layers in the image
+	LayerSizes []int64 // size of each layer, base layer first; nil when the backend cannot tell
+}
+
+// Registry stores the images built for MCP servers
+type Registry interface {
+	// Name returns the backend name, e.g. "ecr"
+	Name() string
+
+	// EnsureRepository returns the server's image repository, creating it if the registry needs that
+	EnsureRepository(ctx context.Context, serverID string) (ImageRepository, error)
+
+	// Push pushes a built image under each tag
+	Push(ctx context.Context, repo ImageRepository, image BuiltImage, tags []string) (PushedImage, error)
+
+	// ResolveDigest returns the digest of the manifest a tag points at
+	ResolveDigest(ctx context.Context, repo ImageRepository, tag string) (string, error)
+
+	// Delete removes a tag or digest from the repository
+	Delete(ctx context.Context, repo ImageRepository, reference string) error
+}
+
+// repositoryName returns the image repository name of an MCP server
+func repositoryName(serverID string) string {
+	return fmt.Sprintf("mcp-%s", serverID)
+}
+
+// Registries holds the configured registry backends and picks the one each
+// MCP server uses
+type Registries struct {
+	backends    map[string]Registry
+	defaultName string
+}
+
+// NewRegistries creates the set of available registries. Servers that do not
+// choose a registry use defaultName, which must be one of them.
+func NewRegistries(defaultName string, registries ...Registry) (*Registries, error) {
+	set := &Registries{
+		backends:    make(map[string]Registry, len(registries)),
+		defaultName: defaultName,
+	}
+	for _, registry := range registries {
+		set.backends[registry.Name()] = registry
+	}
+	if _, ok := set.backends[defaultName]; !ok {
+		return nil, fmt.Errorf("default registry %q is not configured", defaultName)
+	}
+	return set, nil
+}
+
+// ForServer returns the registry the server selected, or the default one
+func (r *Registries) ForServer(server *models.MCPServer) (Registry, error) {
+	name := r.defaultName
+	if server != nil && server.Registry != "" {
+		name = server.Registry
+	}
+
+	registry, ok := r.backends[name]
+	if !ok {
+		return nil, fmt.Errorf("registry %q is not configured on this build server (available: %s)", name, strings.Join(r.Names(), ", "))
+	}
+	return registry, nil
+}
+
+// Names returns the names of the configured registries
+func (r *Registries) Names() []string {
+	names := make([]string, 0, len(r.backends))
+	for name := range r.backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tagWithDocker tags a local image under repoURI once for each tag. docker tag
+// only writes on failure, so its output is returned in the error, which the
+// pipeline writes to the build log.
+func tagWithDocker(ctx context.Context, runner CommandRunner, repoURI, imageName string, tags []string) error {
+	if len(tags) == 0 {
+		return fmt.Errorf("at least one tag must be provided")
+	}
+	if imageName == "" {
+		return fmt.Errorf("image name cannot be empty")
+	}
+
+	for _, tag := range tags {
+		fullImageName := fmt.Sprintf("%s:%s", repoURI, tag)
+		var output bytes.Buffer
+		err := runner.Run(ctx, Command{
+			Name:   "docker",
+			Args:   []string{"tag", imageName, fullImageName},
+			Stdout: &output,
+			Stderr: &output,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to tag Docker image %s as %s: %w: %s", imageName, fullImageName, err, strings.TrimSpace(output.String()))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/imyashkale/buildserver/internal/logger"
+)
+
+// LocalRegistry keeps images in the local Docker daemon without pushing them
+// anywhere. It suits development machines and single-host setups where the
+// image is run on the build server itself.
+type LocalRegistry struct {
+	runner CommandRunner
+}
+
+// NewLocalRegistry creates a registry that only tags images in the local daemon
+func NewLocalRegistry(runner CommandRunner) *LocalRegistry {
+	return &LocalRegistry{runner: runner}
+}
+
+// Name returns the registry backend name
+func (lr *LocalRegistry) Name() string {
+	return RegistryLocal
+}
+
+// EnsureRepository returns the local image name of the server. Nothing needs creating.
+func (lr *LocalRegistry) EnsureRepository(ctx context.Context, serverID string) (ImageRepository, error) {
+	name := repositoryName(serverID)
+	return ImageRepository{Name: name, URI: name}, nil
+}
+
+// Push tags the image under the repository name for each tag, loading it
+// into the daemon first if it was built into an archive. The digest is
+// the local image ID, see ResolveDigest. The daemon keeps layers
+// uncompressed and has no repository digest, so Size is the uncompressed
+// image size, LayerSizes is nil and DigestURI stays empty.
+func (lr *LocalRegistry) Push(ctx context.Context, repo ImageRepository, image BuiltImage, tags []string) (PushedImage, error) {
+	if image.Archive != "" {
+		var stderr bytes.Buffer
+		err := lr.runner.Run(ctx, Command{
+			Name:   "docker",
+			Args:   []string{"load", "-i", image.Archive},
+			Stderr: &stderr,
+		})
+		if err != nil {
+			return PushedImage{}, fmt.Errorf("failed to load image %s: %w: %s", image.Name, err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	if err := tagWithDocker(ctx, lr.runner, repo.URI, image.Name, tags); err != nil {
+		return PushedImage{}, err
+	}
+
+	pushed, err := lr.inspect(ctx, repo, tags[0])
+	if err != nil {
+		return PushedImage{}, err
+	}
+	pushed.URI = fmt.Sprintf("%s:%s", repo.URI, tags[0])
+
+	logger.WithFields(map[string]interface{}{
+		"image_uri": pushed.URI,
+		"digest":    pushed.Digest,
+		"tags":      tags,
+	}).Info("Docker image tagged in the local daemon")
+	return pushed, nil
+}
+
+// ResolveDigest returns the ID of the local image a tag points at. The daemon
+// has no manifest for an image that was never pushed, so this is the digest of
+// the image config rather than of a manifest.
+func (lr *LocalRegistry) ResolveDigest(ctx context.Context, repo ImageRepository, tag string) (string, error) {
+	image, err := lr.inspect(ctx, repo, tag)
+	if err != nil {
+		return "", err
+	}
+	return image.Digest, nil
+}
+
+// inspect reads the ID, size and layer count of a tagged image from the daemon
+func (lr *LocalRegistry) inspect(ctx context.Context, repo ImageRepository, tag string) (PushedImage, error) {
+	var stdout, stderr bytes.Buffer
+	err := lr.runner.Run(ctx, Command{
+		Name:   "docker",
+		Args:   []string{"image", "inspect", "--format", "{{.Id}} {{.Size}} {{len .RootFS.Layers}}", fmt.Sprintf("%s:%s", repo.URI, tag)},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return PushedImage{}, localImageError(repo, tag, stderr.String(), err)
+	}
+
+	var image PushedImage
+	if _, err := fmt.Sscan(stdout.String(), &image.Digest, &image.Size, &image.LayerCount); err != nil {
+		return PushedImage{}, fmt.Errorf("unexpected docker image inspect output for %s:%s: %q", repo.Name, tag, strings.TrimSpace(stdout.String()))
+	}
+	return image, nil
+}
+
+// Delete removes a tag, or the image with the given ID, from the local daemon
+func (lr *LocalRegistry) Delete(ctx context.Context, repo ImageRepository, reference string) error {
+	image := fmt.Sprintf("%s:%s", repo.URI, reference)
+	if strings.HasPrefix(reference, "sha256:") {
+		image = reference
+	}
+
+	var stderr bytes.Buffer
+	err := lr.runner.Run(ctx, Command{
+		Name:   "docker",
+		Args:   []string{"rmi", image},
+		Stderr: &stderr,
+	})
+	if err != nil {
+		return localImageError(repo, reference, stderr.String(), err)
+	}
+	return nil
+}
+
+// localImageError turns a failed docker command into ErrImageNotFound when
+// the daemon reported a missing image
+func localImageError(repo ImageRepository, reference, stderr string, err error) error {
+	if strings.Contains(strings.ToLower(stderr), "no such image") {
+		return fmt.Errorf("%w: %s:%s", ErrImageNotFound, repo.Name, reference)
+	}
+	return fmt.Errorf("docker failed for %s:%s: %w: %s", repo.Name, reference, err, strings.TrimSpace(stderr))
+}
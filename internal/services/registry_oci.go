@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/imyashkale/buildserver/internal/logger"
+)
+
+// OCIConfig configures a registry that speaks the OCI Distribution v2 API,
+// such as GHCR, Harbor or a local registry:2 container
+type OCIConfig struct {
+	URL       string // registry address, e.g. "ghcr.io" or "http://localhost:5000"
+	Namespace string // path repositories are created under, e.g. an organisation; may be empty
+	Username  string
+	Password  string
+	Insecure  bool // use plain HTTP when URL has no scheme
+}
+
+// OCIRegistry stores images in an OCI Distribution v2 registry through its
+// HTTP API. Repositories are created by the registry on first push, so
+// EnsureRepository only names them. Credentials stay in memory.
+type OCIRegistry struct {
+	host      string // host[:port] used in image references
+	namespace string
+	client    *ociClient
+	runner    CommandRunner
+}
+
+// NewOCIRegistry creates a registry client for cfg that exports images through runner
+func NewOCIRegistry(cfg OCIConfig, runner CommandRunner) (*OCIRegistry, error) {
+	raw := cfg.URL
+	if !strings.Contains(raw, "://") {
+		scheme := "https"
+		if cfg.Insecure {
+			scheme = "http"
+		}
+		raw = scheme + "://" + raw
+	}
+
+	baseURL, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry URL %q: %w", cfg.URL, err)
+	}
+	if baseURL.Host == "" || (baseURL.Scheme != "http" && baseURL.Scheme != "https") {
+		return nil, fmt.Errorf("invalid registry URL %q: want host[:port] or an http(s) URL", cfg.URL)
+	}
+	baseURL.Path = ""
+
+	logger.WithFields(map[string]interface{}{
+		"registry":  baseURL.Host,
+		"namespace": cfg.Namespace,
+	}).Info("OCI registry initialized")
+
+	return &OCIRegistry{
+		host:      baseURL.Host,
+		namespace: strings.Trim(cfg.Namespace, "/"),
+		client:    newOCIClient(baseURL, cfg.Username, cfg.Password),
+		runner:    runner,
+	}, nil
+}
+
+// Name returns the registry backend name
+func (o *OCIRegistry) Name() string {
+	return RegistryOCI
+}
+
+// EnsureRepository returns the server's repository. The registry creates it on first push.
+func (o *OCIRegistry) EnsureRepository(ctx context.Context, serverID string) (ImageRepository, error) {
+	name := repositoryName(serverID)
+	if o.namespace != "" {
+		name = o.namespace + "/" + name
+	}
+	return ImageRepository{Name: name, URI: o.host + "/" + name}, nil
+}
+
+// Push uploads the image over the registry's HTTP API, sharing layers between tags
+func (o *OCIRegistry) Push(ctx context.Context, repo ImageRepository, image BuiltImage, tags []string) (PushedImage, error) {
+	pushed, err := pushLocalImage(ctx, o.runner, o.client, repo, image, tags)
+	if err != nil {
+		return PushedImage{}, err
+	}
+
+	logger.WithFields(map[string]interface{}{
+		"repo_name":   repo.Name,
+		"image_uri":   pushed.URI,
+		"digest":      pushed.Digest,
+		"tags_pushed": len(tags),
+	}).Info("Docker image pushed to OCI registry successfully")
+	return pushed, nil
+}
+
+// ResolveDigest returns the digest of the manifest a tag points at
+func (o *OCIRegistry) ResolveDigest(ctx context.Context, repo ImageRepository, tag string) (string, error) {
+	req, err := o.client.newRequest(ctx, http.MethodHead, repo.Name+"/manifests/"+tag, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+
+	resp, err := o.client.do(req, "repository:"+repo.Name+":pull")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s:%s: %w", repo.Name, tag, err)
+	}
+	drain(resp)
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", fmt.Errorf("%w: %s:%s", ErrImageNotFound, repo.Name, tag)
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("failed to resolve %s:%s: registry returned %s", repo.Name, tag, resp.Status)
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("failed to resolve %s:%s: registry returned no digest", repo.Name, tag)
+	}
+	return digest, nil
+}
+
+// Delete removes a manifest. Registries only delete by digest, so a tag is resolved first.
+func (o *OCIRegistry) Delete(ctx context.Context, repo ImageRepository, reference string) error {
+	digest := reference
+	if !strings.HasPrefix(reference, "sha256:") {
+		resolved, err := o.ResolveDigest(ctx, repo, reference)
+		if err != nil {
+			return err
+		}
+		digest = resolved
+	}
+
+	req, err := o.client.newRequest(ctx, http.MethodDelete, repo.Name+"/manifests/"+digest, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := o.client.do(req, "repository:"+repo.Name+":delete")
+	if err != nil {
+		return fmt.Errorf("failed to delete %s@%s: %w", repo.Name, digest, err)
+	}
+	drain(resp)
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s@%s", ErrImageNotFound, repo.Name, digest)
+	case http.StatusMethodNotAllowed:
+		return fmt.Errorf("failed to delete %s@%s: the registry does not allow deletes", repo.Name, digest)
+	default:
+		return fmt.Errorf("failed to delete %s@%s: registry returned %s", repo.Name, digest, resp.Status)
+	}
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// TestRegistries_ForServer verifies that servers get the registry they
+// selected, or the default one
+func TestRegistries_ForServer(t *testing.T) {
+	if _, err := NewRegistries("ecr", &fakeRegistry{}); err == nil {
+		t.Fatal("Expected an error for a default registry that is not configured")
+	}
+
+	registries, err := NewRegistries("fake", &fakeRegistry{}, &fakeRegistry{name: "other"})
+	if err != nil {
+		t.Fatalf("NewRegistries: %v", err)
+	}
+
+	tests := []struct {
+		server  *models.MCPServer
+		want    string
+		wantErr bool
+	}{
+		{server: nil, want: "fake"},
+		{server: &models.MCPServer{}, want: "fake"},
+		{server: &models.MCPServer{Registry: "other"}, want: "other"},
+		{server: &models.MCPServer{Registry: "harbor"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		registry, err := registries.ForServer(tt.server)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "fake, other") {
+				t.Errorf("ForServer(%+v) = %v, want an error listing the configured registries", tt.server, err)
+			}
+			continue
+		}
+		if err != nil || registry.Name() != tt.want {
+			t.Errorf("ForServer(%+v) = %v, %v; want %s", tt.server, registry, err, tt.want)
+		}
+	}
+}
+
+// fakeDistribution is an OCI Distribution v2 registry for one repository,
+// guarded by a bearer token service
+type fakeDistribution struct {
+	*httptest.Server
+	mu          sync.Mutex
+	tags        map[string]string // tag -> manifest digest
+	manifests   map[string][]byte // digest -> manifest
+	blobs       map[string][]byte // digest -> content
+	blobUploads int
+	scopes      []string // scopes tokens were issued for
+	deleted     []string
+}
+
+func newFakeDistribution(t *testing.T) *fakeDistribution {
+	t.Helper()
+	d := &fakeDistribution{
+		tags:      map[string]string{"latest": "sha256:" + strings.Repeat("a", 64)},
+		manifests: make(map[string][]byte),
+		blobs:     make(map[string][]byte),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "robot" || pass != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		d.mu.Lock()
+		d.scopes = append(d.scopes, r.URL.Query().Get("scope"))
+		d.mu.Unlock()
+		w.Write([]byte(`{"token":"token-123"}`))
+	})
+	mux.HandleFunc("/v2/acme/mcp-server-1/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-123" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+d.URL+`/token",service="fake"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		kind, reference, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v2/acme/mcp-server-1/"), "/")
+		switch {
+		case kind == "manifests" && r.Method == http.MethodHead:
+			digest, ok := d.tags[reference]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digest)
+		case kind == "manifests" && r.Method == http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			digest := sha256Digest(body)
+			d.manifests[digest] = body
+			d.tags[reference] = digest
+			w.Header().Set("Docker-Content-Digest", digest)
+			w.WriteHeader(http.StatusCreated)
+		case kind == "manifests" && r.Method == http.MethodDelete:
+			d.deleted = append(d.deleted, reference)
+			w.WriteHeader(http.StatusAccepted)
+		case kind == "blobs" && r.Method == http.MethodHead:
+			if _, ok := d.blobs[reference]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case kind == "blobs" && r.Method == http.MethodPost:
+			w.Header().Set("Location", "/v2/acme/mcp-server-1/blobs/uploads/session-1?state=x")
+			w.WriteHeader(http.StatusAccepted)
+		case kind == "blobs" && r.Method == http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			digest := r.URL.Query().Get("digest")
+			if sha256Digest(body) != digest || r.URL.Query().Get("state") != "x" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			d.blobs[digest] = body
+			d.blobUploads++
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	d.Server = httptest.NewServer(mux)
+	t.Cleanup(d.Close)
+	return d
+}
+
+// TestOCIRegistry_ResolveAndDelete exercises the token flow, digest lookup
+// and delete against a fake registry
+func TestOCIRegistry_ResolveAndDelete(t *testing.T) {
+	d := newFakeDistribution(t)
+	ctx := context.Background()
+
+	registry, err := NewOCIRegistry(OCIConfig{URL: d.URL, Namespace: "acme", Username: "robot", Password: "s3cret"}, &fakeRunner{})
+	if err != nil {
+		t.Fatalf("NewOCIRegistry: %v", err)
+	}
+
+	repo, err := registry.EnsureRepository(ctx, "server-1")
+	if err != nil {
+		t.Fatalf("EnsureRepository: %v", err)
+	}
+	if want := strings.TrimPrefix(d.URL, "http://") + "/acme/mcp-server-1"; repo.URI != want {
+		t.Errorf("URI = %s, want %s", repo.URI, want)
+	}
+
+	digest, err := registry.ResolveDigest(ctx, repo, "latest")
+	if err != nil {
+		t.Fatalf("ResolveDigest: %v", err)
+	}
+	if digest != d.tags["latest"] {
+		t.Errorf("digest = %s, want %s", digest, d.tags["latest"])
+	}
+	if _, err := registry.ResolveDigest(ctx, repo, "missing"); !errors.Is(err, ErrImageNotFound) {
+		t.Errorf("ResolveDigest of a missing tag = %v, want ErrImageNotFound", err)
+	}
+
+	// A tag is deleted through its digest
+	if err := registry.Delete(ctx, repo, "latest"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if len(d.deleted) != 1 || d.deleted[0] != digest {
+		t.Errorf("deleted %v, want [%s]", d.deleted, digest)
+	}
+
+	// One token per scope, reused across requests
+	want := []string{"repository:acme/mcp-server-1:pull", "repository:acme/mcp-server-1:delete"}
+	if strings.Join(d.scopes, " ") != strings.Join(want, " ") {
+		t.Errorf("token scopes = %v, want %v", d.scopes, want)
+	}
+}
+
+// TestOCIRegistry_PushUploadsLayersOnce pushes an exported image with two
+// tags and verifies that each blob is uploaded once and each tag is a manifest
+func TestOCIRegistry_PushUploadsLayersOnce(t *testing.T) {
+	d := newFakeDistribution(t)
+	ctx := context.Background()
+
+	// A docker save archive whose third layer repeats the first through a symlink
+	runner := &saveRunner{archive: dockerArchive(t, map[string]string{
+		"config.json":   `{"architecture":"amd64","os":"linux"}`,
+		"aaa/layer.tar": "base layer",
+		"bbb/layer.tar": "app layer",
+		"ccc/layer.tar": "->../aaa/layer.tar",
+		"manifest.json": `[{"Config":"config.json","RepoTags":["server-1:abc"],"Layers":["aaa/layer.tar","bbb/layer.tar","ccc/layer.tar"]}]`,
+	})}
+
+	registry, err := NewOCIRegistry(OCIConfig{URL: d.URL, Namespace: "acme", Username: "robot", Password: "s3cret"}, runner)
+	if err != nil {
+		t.Fatalf("NewOCIRegistry: %v", err)
+	}
+	repo, _ := registry.EnsureRepository(ctx, "server-1")
+
+	pushed, err := registry.Push(ctx, repo, BuiltImage{Name: "server-1:abc"}, []string{"main-abc", "latest"})
+	if err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if pushed.URI != repo.URI+":main-abc" {
+		t.Errorf("URI = %s", pushed.URI)
+	}
+	if d.tags["main-abc"] != pushed.Digest || d.tags["latest"] != pushed.Digest {
+		t.Errorf("tags = %v, want both at %s", d.tags, pushed.Digest)
+	}
+	if d.blobUploads != 3 {
+		t.Errorf("uploaded %d blobs, want the config and two layers", d.blobUploads)
+	}
+	if pushed.DigestURI != repo.URI+"@"+pushed.Digest {
+		t.Errorf("DigestURI = %s", pushed.DigestURI)
+	}
+
+	var manifest ociManifest
+	if err := json.Unmarshal(d.manifests[pushed.Digest], &manifest); err != nil {
+		t.Fatalf("stored manifest: %v", err)
+	}
+	if len(manifest.Layers) != 3 || manifest.Layers[0].Digest != manifest.Layers[2].Digest {
+		t.Fatalf("manifest layers = %+v", manifest.Layers)
+	}
+	var size int64
+	for i, layer := range manifest.Layers {
+		size += layer.Size
+		if pushed.LayerCount != 3 || len(pushed.LayerSizes) != 3 || pushed.LayerSizes[i] != layer.Size {
+			t.Fatalf("pushed layers = %d %v, want the manifest's %+v", pushed.LayerCount, pushed.LayerSizes, manifest.Layers)
+		}
+	}
+	if pushed.Size != size {
+		t.Errorf("Size = %d, want %d", pushed.Size, size)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(d.blobs[manifest.Layers[1].Digest]))
+	if err != nil {
+		t.Fatalf("layer is not gzip: %v", err)
+	}
+	if content, _ := io.ReadAll(zr); string(content) != "app layer" {
+		t.Errorf("layer content = %q", content)
+	}
+
+	// Pushing again finds every blob in the registry
+	if _, err := registry.Push(ctx, repo, BuiltImage{Name: "server-1:abc"}, []string{"main-abc"}); err != nil {
+		t.Fatalf("second Push: %v", err)
+	}
+	if d.blobUploads != 3 {
+		t.Errorf("second push uploaded %d more blobs", d.blobUploads-3)
+	}
+	if len(runner.commands) != 2 || runner.commands[0] != "docker save server-1:abc" {
+		t.Errorf("commands = %v", runner.commands)
+	}
+
+	// An image a daemonless builder wrote to an archive is pushed without docker
+	archive := filepath.Join(t.TempDir(), "image.tar")
+	if err := os.WriteFile(archive, runner.archive, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fromArchive, err := registry.Push(ctx, repo, BuiltImage{Name: "server-1:abc", Archive: archive}, []string{"main-abc"})
+	if err != nil {
+		t.Fatalf("Push from archive: %v", err)
+	}
+	if fromArchive.Digest != pushed.Digest || len(runner.commands) != 2 {
+		t.Errorf("archive push = %s with commands %v, want %s without running docker", fromArchive.Digest, runner.commands, pushed.Digest)
+	}
+}
+
+// dockerArchive builds a tar archive from name -> content. Content starting
+// with "->" makes a symlink.
+func dockerArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		content := files[name]
+		header := &tar.Header{Name: name, Mode: 0o644, Typeflag: tar.TypeReg, Size: int64(len(content))}
+		if target, ok := strings.CutPrefix(content, "->"); ok {
+			header = &tar.Header{Name: name, Mode: 0o777, Typeflag: tar.TypeSymlink, Linkname: target}
+			content = ""
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// saveRunner answers docker save with a fixed archive and records commands
+type saveRunner struct {
+	archive  []byte
+	commands []string
+}
+
+func (r *saveRunner) Run(ctx context.Context, command Command) error {
+	r.commands = append(r.commands, command.Name+" "+strings.Join(command.Args, " "))
+	if commandName(command) == "docker save" {
+		_, err := command.Stdout.Write(r.archive)
+		return err
+	}
+	return nil
+}
+
+// tagRunner fails docker tag the way the Docker CLI does for a missing image
+type tagRunner struct{}
+
+func (tagRunner) Run(ctx context.Context, command Command) error {
+	if commandName(command) == "docker tag" {
+		io.WriteString(command.Stderr, "Error response from daemon: No such image: "+command.Args[1]+"\n")
+		return errors.New("exit status 1")
+	}
+	return nil
+}
+
+func TestLocalRegistry_PushReportsTagOutput(t *testing.T) {
+	registry := NewLocalRegistry(tagRunner{})
+	repo, _ := registry.EnsureRepository(context.Background(), "server-1")
+
+	_, err := registry.Push(context.Background(), repo, BuiltImage{Name: "server-1:main-abc12345"}, []string{"main-abc12345"})
+	if err == nil || !strings.Contains(err.Error(), "No such image: server-1:main-abc12345") {
+		t.Errorf("Push error = %v, want the docker tag output", err)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:acme/app:pull,push"`)
+	if scheme != "Bearer" {
+		t.Errorf("scheme = %q", scheme)
+	}
+	if params["realm"] != "https://auth.example.com/token" || params["service"] != "registry.example.com" || params["scope"] != "repository:acme/app:pull,push" {
+		t.Errorf("params = %v", params)
+	}
+
+	scheme, params = parseChallenge(`Basic realm=Registry`)
+	if scheme != "Basic" || params["realm"] != "Registry" {
+		t.Errorf("Basic challenge = %q %v", scheme, params)
+	}
+}
+
+// TestExecuteBuild_RecordsRepositoryAndPushedImage verifies that the server
+// records its image repository and the deployment the pushed image
+func TestExecuteBuild_RecordsRepositoryAndPushedImage(t *testing.T) {
+	h := newHermeticPipeline(t, "server-1")
+	deployment := h.mustRun(t, "server-1")
+
+	server, _ := h.mcpRepo.Get(context.Background(), "server-1")
+	if server.ECRRepositoryName != "mcp-server-1" || server.ECRRepositoryURI != "registry.example.com/mcp-server-1" || server.Version != 1 {
+		t.Errorf("Expected the server to record its repository, got %+v", server)
+	}
+	if deployment.ImageURI != "registry.example.com/mcp-server-1:main-00000000" || deployment.ImageDigestURI != "registry.example.com/mcp-server-1@"+fakeDigest {
+		t.Errorf("Expected the pushed image URIs, got %s and %s", deployment.ImageURI, deployment.ImageDigestURI)
+	}
+	if image := deployment.Image; image == nil || image.Digest != fakeDigest || image.Size != 300 || image.LayerCount != 2 || len(image.LayerSizes) != 2 {
+		t.Errorf("Expected the pushed image's digest and sizes, got %+v", image)
+	}
+}
+
+// TestExecuteBuild_PushesToServerRegistry verifies that a server's registry is
+// used instead of the default
+func TestExecuteBuild_PushesToServerRegistry(t *testing.T) {
+	h := newHermeticPipeline(t, "server-1")
+	h.updateServer(t, "server-1", func(server *models.MCPServer) { server.Registry = "other" })
+	h.mustRun(t, "server-1")
+
+	if len(h.other.pushed) != 2 || len(h.registry.pushed) != 0 {
+		t.Errorf("Expected two pushes to the selected registry only, got %v and %v on the default", h.other.pushed, h.registry.pushed)
+	}
+}
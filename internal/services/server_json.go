@@ -0,0 +1,165 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/imyashkale/buildserver/internal/mhiveconfig"
+	"github.com/imyashkale/buildserver/internal/models"
+)
+
+// registryDescriptionLimit is the longest description MCP registries accept
+const registryDescriptionLimit = 100
+
+// generateServerJSON describes a pushed image as an MCP registry server.json.
+// The name is namespaced by the repository owner, e.g. io.github.acme/weather
+// for https://github.com/acme/weather-mcp. The version is the one the server
+// reported in the MCP handshake, or the image tag when it was not verified.
+// Environment variables are declared with their flags but never their values.
+func generateServerJSON(bc *BuildContext, pushed PushedImage) (*models.RegistryServer, error) {
+	namespace, repository, err := registryNamespace(bc.Server.Repository)
+	if err != nil {
+		return nil, err
+	}
+	registryBaseURL, identifier, tag := splitImageReference(pushed.URI)
+
+	config := bc.Config
+	if config.Build.Context != "" && config.Build.Context != "." {
+		repository.Subfolder = strings.TrimPrefix(config.Build.Context, "./")
+	}
+
+	version := tag
+	if bc.Manifest != nil && bc.Manifest.ServerVersion != "" {
+		version = bc.Manifest.ServerVersion
+	}
+
+	return &models.RegistryServer{
+		Schema:      models.ServerJSONSchema,
+		Name:        namespace + "/" + config.Name,
+		Description: truncateRunes(bc.Server.Description, registryDescriptionLimit),
+		Version:     version,
+		Repository:  repository,
+		Packages: []models.RegistryPackage{{
+			RegistryType:         "oci",
+			RegistryBaseURL:      registryBaseURL,
+			Identifier:           identifier,
+			Version:              tag,
+			Transport:            registryTransport(config),
+			EnvironmentVariables: registryEnvironment(bc.Server, config),
+		}},
+		Meta: &models.RegistryMeta{PublisherProvided: &models.RegistryBuildInfo{
+			ServerId:       bc.Job.ServerID,
+			DeploymentId:   bc.Job.DeploymentID,
+			CommitHash:     bc.Job.CommitHash,
+			ImageDigest:    pushed.Digest,
+			ImageDigestURI: pushed.DigestURI,
+		}},
+	}, nil
+}
+
+// registryNamespace derives the reverse-DNS namespace of a server from its
+// repository URL: io.github.<owner> on GitHub, the reversed host followed by
+// the owner elsewhere
+func registryNamespace(repositoryURL string) (string, *models.RegistryRepository, error) {
+	host, path, owner, err := parseRepositoryURL(repositoryURL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	repository := &models.RegistryRepository{URL: "https://" + host + "/" + path, Source: host}
+	if host == "github.com" {
+		repository.Source = "github"
+		return "io.github." + owner, repository, nil
+	}
+	if host == "gitlab.com" {
+		repository.Source = "gitlab"
+	}
+
+	labels := strings.Split(host, ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return strings.Join(labels, ".") + "." + owner, repository, nil
+}
+
+// parseRepositoryURL splits a repository URL into its lowercased host, its
+// path without .git and the owner, the path's first segment
+func parseRepositoryURL(repositoryURL string) (host, path, owner string, err error) {
+	parsed, err := url.Parse(repositoryURL)
+	if err != nil || parsed.Host == "" {
+		return "", "", "", fmt.Errorf("repository %q is not a URL", repositoryURL)
+	}
+	path = strings.TrimSuffix(strings.Trim(parsed.Path, "/"), ".git")
+	owner, _, _ = strings.Cut(path, "/")
+	if owner == "" {
+		return "", "", "", fmt.Errorf("repository %q has no owner", repositoryURL)
+	}
+	return strings.ToLower(parsed.Hostname()), path, owner, nil
+}
+
+// splitImageReference splits repository:tag into the registry's base URL, the
+// repository within it and the tag. References without a registry host are
+// on Docker Hub.
+func splitImageReference(reference string) (registryBaseURL, identifier, tag string) {
+	identifier = reference
+	if i := strings.LastIndex(identifier, ":"); i > strings.LastIndex(identifier, "/") {
+		identifier, tag = identifier[:i], identifier[i+1:]
+	}
+
+	host := "docker.io"
+	if first, rest, ok := strings.Cut(identifier, "/"); ok && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		host, identifier = first, rest
+	}
+	return "https://" + host, identifier, tag
+}
+
+// registryTransport returns the transport declaration for the server's
+// transport. HTTP servers are addressed on localhost, where the package runs.
+func registryTransport(config *mhiveconfig.Config) models.RegistryTransport {
+	switch config.Transport {
+	case mhiveconfig.TransportStreamableHTTP:
+		return models.RegistryTransport{Type: config.Transport, URL: fmt.Sprintf("http://localhost:%d%s", config.Port, mcpHTTPPath)}
+	case mhiveconfig.TransportSSE:
+		return models.RegistryTransport{Type: config.Transport, URL: fmt.Sprintf("http://localhost:%d/sse", config.Port)}
+	}
+	return models.RegistryTransport{Type: config.Transport}
+}
+
+// registryEnvironment declares the variables listed in mhive.config.yaml,
+// in their order, followed by the ones only set on the server. Descriptions
+// and required flags come from the config, secret flags from the server.
+func registryEnvironment(server *models.MCPServer, config *mhiveconfig.Config) []models.RegistryEnvironmentVariable {
+	secret := make(map[string]bool, len(server.EnvironmentVariables))
+	for _, variable := range server.EnvironmentVariables {
+		secret[variable.Name] = variable.IsSecret
+	}
+
+	var variables []models.RegistryEnvironmentVariable
+	declared := make(map[string]bool, len(config.Env))
+	for _, variable := range config.Env {
+		declared[variable.Name] = true
+		variables = append(variables, models.RegistryEnvironmentVariable{
+			Name:        variable.Name,
+			Description: variable.Description,
+			IsRequired:  variable.Required,
+			IsSecret:    secret[variable.Name],
+		})
+	}
+	for _, variable := range server.EnvironmentVariables {
+		if !declared[variable.Name] {
+			declared[variable.Name] = true
+			variables = append(variables, models.RegistryEnvironmentVariable{Name: variable.Name, IsSecret: variable.IsSecret})
+		}
+	}
+	return variables
+}
+
+// truncateRunes shortens s to at most limit characters
+func truncateRunes(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/imyashkale/buildserver/internal/mhiveconfig"
+	"github.com/imyashkale/buildserver/internal/models"
+	"github.com/imyashkale/buildserver/internal/queue"
+)
+
+func TestGenerateServerJSON(t *testing.T) {
+	yaml := "name: weather\nruntime: node\ntransport: streamable-http\nport: 8080\n" +
+		"env:\n  - name: WEATHER_API_KEY\n    description: API key\n    required: true\n  - name: UNITS\n"
+	config, _, err := mhiveconfig.Parse([]byte(yaml), "")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	bc := &BuildContext{
+		Job: &queue.BuildJob{ServerID: "server-1", DeploymentID: "deploy-1", CommitHash: "abc123"},
+		Server: &models.MCPServer{
+			Description: strings.Repeat("Forecasts ", 20),
+			Repository:  "https://github.com/acme/weather-mcp.git",
+			EnvironmentVariables: []models.EnvironmentVariable{
+				{Name: "WEATHER_API_KEY", Value: "wk_secret", IsSecret: true},
+				{Name: "LOG_LEVEL", Value: "debug"},
+			},
+		},
+		Config: config,
+	}
+	pushed := PushedImage{
+		URI:       "ghcr.io/acme/mcp-server-1:main-abc123",
+		DigestURI: "ghcr.io/acme/mcp-server-1@sha256:4f1e",
+		Digest:    "sha256:4f1e",
+	}
+
+	serverJSON, err := generateServerJSON(bc, pushed)
+	if err != nil {
+		t.Fatalf("generateServerJSON: %v", err)
+	}
+	data, _ := json.Marshal(serverJSON)
+	if strings.Contains(string(data), "wk_secret") || strings.Contains(string(data), "debug") {
+		t.Fatalf("server.json contains variable values: %s", data)
+	}
+
+	var got map[string]interface{}
+	json.Unmarshal(data, &got)
+	if got["$schema"] != models.ServerJSONSchema || got["name"] != "io.github.acme/weather" || got["version"] != "main-abc123" {
+		t.Errorf("server.json = %s", data)
+	}
+	if description := []rune(serverJSON.Description); len(description) != registryDescriptionLimit {
+		t.Errorf("description has %d characters, want %d", len(description), registryDescriptionLimit)
+	}
+	if repository := serverJSON.Repository; repository.URL != "https://github.com/acme/weather-mcp" || repository.Source != "github" {
+		t.Errorf("repository = %+v", repository)
+	}
+
+	pkg := serverJSON.Packages[0]
+	if pkg.RegistryType != "oci" || pkg.RegistryBaseURL != "https://ghcr.io" || pkg.Identifier != "acme/mcp-server-1" || pkg.Version != "main-abc123" {
+		t.Errorf("package = %+v", pkg)
+	}
+	if pkg.Transport.Type != "streamable-http" || pkg.Transport.URL != "http://localhost:8080/mcp" {
+		t.Errorf("transport = %+v", pkg.Transport)
+	}
+	wantEnv := []models.RegistryEnvironmentVariable{
+		{Name: "WEATHER_API_KEY", Description: "API key", IsRequired: true, IsSecret: true},
+		{Name: "UNITS"},
+		{Name: "LOG_LEVEL"},
+	}
+	if len(pkg.EnvironmentVariables) != len(wantEnv) {
+		t.Fatalf("environment = %+v, want %+v", pkg.EnvironmentVariables, wantEnv)
+	}
+	for i, want := range wantEnv {
+		if pkg.EnvironmentVariables[i] != want {
+			t.Errorf("environment[%d] = %+v, want %+v", i, pkg.EnvironmentVariables[i], want)
+		}
+	}
+	if build := serverJSON.Meta.PublisherProvided; build.DeploymentId != "deploy-1" || build.ImageDigestURI != pushed.DigestURI {
+		t.Errorf("build info = %+v", build)
+	}
+
+	// The version the server reports wins over the image tag
+	bc.Manifest = &models.MCPManifest{ServerVersion: "1.2.0"}
+	if serverJSON, _ := generateServerJSON(bc, pushed); serverJSON.Version != "1.2.0" || serverJSON.Packages[0].Version != "main-abc123" {
+		t.Errorf("versions = %s and %s", serverJSON.Version, serverJSON.Packages[0].Version)
+	}
+}
+
+func TestRegistryNamespace(t *testing.T) {
+	tests := []struct {
+		repository string
+		want       string
+		wantErr    bool
+	}{
+		{repository: "https://github.com/acme/weather", want: "io.github.acme"},
+		{repository: "https://gitlab.com/acme/tools/weather.git", want: "com.gitlab.acme"},
+		{repository: "https://git.example.co.uk/platform/weather", want: "uk.co.example.git.platform"},
+		{repository: "https://github.com/", wantErr: true},
+		{repository: "acme/weather", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, _, err := registryNamespace(tt.repository)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("registryNamespace(%q) = %q, %v; want %q", tt.repository, got, err, tt.want)
+		}
+	}
+}
+
+func TestSplitImageReference(t *testing.T) {
+	tests := []struct {
+		reference                string
+		baseURL, identifier, tag string
+	}{
+		{"123456789.dkr.ecr.us-east-1.amazonaws.com/mcp-server-1:main-abc", "https://123456789.dkr.ecr.us-east-1.amazonaws.com", "mcp-server-1", "main-abc"},
+		{"localhost:5000/acme/weather:v1", "https://localhost:5000", "acme/weather", "v1"},
+		{"acme/weather:v1", "https://docker.io", "acme/weather", "v1"},
+		{"server-1", "https://docker.io", "server-1", ""},
+	}
+	for _, tt := range tests {
+		baseURL, identifier, tag := splitImageReference(tt.reference)
+		if baseURL != tt.baseURL || identifier != tt.identifier || tag != tt.tag {
+			t.Errorf("splitImageReference(%q) = %q, %q, %q", tt.reference, baseURL, identifier, tag)
+		}
+	}
+}
+
+// TestExecuteBuild_StoresServerJSON verifies that the server.json of the
+// pushed image is stored on the deployment
+func TestExecuteBuild_StoresServerJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		files         map[string]string // the repository's files; nil keeps the default ones
+		wantSubfolder string
+	}{
+		{name: "repository root"},
+		{
+			name: "monorepo context",
+			files: map[string]string{
+				"mhive.config.yaml":          "name: weather\nruntime: node\nbuild:\n  context: servers/weather\n",
+				"servers/weather/Dockerfile": "FROM node:20-alpine\n",
+			},
+			wantSubfolder: "servers/weather",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHermeticPipeline(t, "server-1")
+			if tt.files != nil {
+				h.runner.files = tt.files
+			}
+			deployment := h.mustRun(t, "server-1")
+
+			serverJSON := deployment.ServerJSON
+			if serverJSON == nil || serverJSON.Packages[0].Identifier != "mcp-server-1" ||
+				serverJSON.Packages[0].Version != "main-00000000" || serverJSON.Meta.PublisherProvided.ImageDigest != fakeDigest {
+				t.Fatalf("Expected server.json for the pushed image, got %+v", serverJSON)
+			}
+			if serverJSON.Repository.Subfolder != tt.wantSubfolder {
+				t.Errorf("Subfolder = %q, want %q", serverJSON.Repository.Subfolder, tt.wantSubfolder)
+			}
+		})
+	}
+}